@@ -90,7 +90,11 @@ func (as *AgentPool) initialize() error {
 
 	as.template = template.Template.(map[string]interface{})
 	as.parameters = as.manager.config.DeploymentParameters
-	return normalizeForK8sVMASScalingUp(as.template)
+	if err := normalizeForK8sVMASScalingUp(as.template); err != nil {
+		return err
+	}
+	applyPropagatedTagsToTemplate(as.template, as.manager.config.PropagatedTags)
+	return nil
 }
 
 // MinSize returns minimum size of the node group.
@@ -278,6 +282,15 @@ func (as *AgentPool) deleteOutdatedDeployments() (err error) {
 
 // IncreaseSize increases agent pool size
 func (as *AgentPool) IncreaseSize(delta int) error {
+	// SKU restrictions aren't checked: the VM size is a parameter of the deployment template, which can't be
+	// resolved reliably before deploying it.
+	// The cost ceiling is checked before locking, as it reads the target size of every node group.
+	if delta > 0 {
+		if err := as.manager.checkCostCeiling(as, delta, nil); err != nil {
+			return err
+		}
+	}
+
 	as.mutex.Lock()
 	defer as.mutex.Unlock()
 
@@ -289,6 +302,10 @@ func (as *AgentPool) IncreaseSize(delta int) error {
 		return fmt.Errorf("size increase must be positive")
 	}
 
+	if as.manager.dryRun(operationUpdateCapacity, as.Name, "deploy %d more VMs", delta) {
+		return nil
+	}
+
 	err := as.deleteOutdatedDeployments()
 	if err != nil {
 		klog.Warningf("IncreaseSize: failed to cleanup outdated deployments with err: %v.", err)
@@ -316,6 +333,12 @@ func (as *AgentPool) IncreaseSize(delta int) error {
 	as.parameters[as.Name+"Count"] = map[string]int{"value": countForTemplate}
 	as.parameters[as.Name+"Offset"] = map[string]int{"value": highestUsedIndex + 1}
 
+	done, err := as.manager.operations.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: as.Name, TargetSize: int64(expectedSize)})
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	newDeploymentName := fmt.Sprintf("cluster-autoscaler-%d", rand.New(rand.NewSource(time.Now().UnixNano())).Int31())
 	newDeployment := resources.Deployment{
 		Properties: &resources.DeploymentProperties{
@@ -328,6 +351,7 @@ func (as *AgentPool) IncreaseSize(delta int) error {
 	defer cancel()
 	klog.V(3).Infof("Waiting for deploymentClient.CreateOrUpdate(%s, %s, %v)", as.manager.config.ResourceGroup, newDeploymentName, newDeployment)
 	rerr := as.manager.azClient.deploymentClient.CreateOrUpdate(ctx, as.manager.config.ResourceGroup, newDeploymentName, newDeployment, "")
+	as.manager.recordMutation(operationUpdateCapacity, as.Name, rerr.Error(), "deploy %d more VMs", delta)
 	if rerr != nil {
 		klog.Errorf("deploymentClient.CreateOrUpdate for deployment %q failed: %v", newDeploymentName, rerr.Error())
 		return rerr.Error()
@@ -415,6 +439,24 @@ func (as *AgentPool) DeleteInstances(instances []*azureRef) error {
 		}
 	}
 
+	if as.manager.dryRun(operationDeleteInstances, as.Name, "delete VMs %v", instances) {
+		return nil
+	}
+
+	instanceIDs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		instanceIDs = append(instanceIDs, instance.Name)
+	}
+	if err := as.manager.runPreDeleteHook(as.Name, instanceIDs); err != nil {
+		as.manager.recordMutation(operationDeleteInstances, as.Name, err, "delete VMs %v", instances)
+		return err
+	}
+	done, err := as.manager.operations.start(armOperation{Kind: operationDeleteInstances, NodeGroup: as.Name, InstanceIDs: instanceIDs})
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	for _, instance := range instances {
 		name, err := resourceName((*instance).Name)
 		if err != nil {
@@ -425,9 +467,11 @@ func (as *AgentPool) DeleteInstances(instances []*azureRef) error {
 		err = as.deleteVirtualMachine(name)
 		if err != nil {
 			klog.Errorf("Delete virtual machine %q failed: %v", name, err)
+			as.manager.recordMutation(operationDeleteInstances, as.Name, err, "delete VMs %v", instances)
 			return err
 		}
 	}
+	as.manager.recordMutation(operationDeleteInstances, as.Name, nil, "delete VMs %v", instances)
 
 	klog.V(6).Infof("DeleteInstances: invalidating cache")
 	as.manager.invalidateCache()
@@ -446,6 +490,10 @@ func (as *AgentPool) DeleteNodes(nodes []*apiv1.Node) error {
 		return fmt.Errorf("min size reached, nodes will not be deleted")
 	}
 
+	if err := checkDeletionHold(as.Name, nodes, nil); err != nil {
+		return err
+	}
+
 	refs := make([]*azureRef, 0, len(nodes))
 	for _, node := range nodes {
 		belongs, err := as.Belongs(node)
@@ -18,8 +18,10 @@ package azure
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -410,6 +412,29 @@ func TestDeleteInstances(t *testing.T) {
 	assert.Equal(t, expectedErr, err)
 }
 
+func TestDeleteInstancesPreDeleteHook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var received PreDeleteHookRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	as := newTestAgentPool(newTestAzureManager(t), "as")
+	as.manager.config.PreDeleteHookURL = server.URL
+	as.manager.config.PreDeleteHookFailurePolicy = PreDeleteHookFailurePolicyFail
+	as.manager.azureCache.instanceToNodeGroup[azureRef{Name: testValidProviderID0}] = as
+	// No VM is deleted when the hook vetoes the deletion.
+	as.manager.azClient.virtualMachinesClient = mockvmclient.NewMockInterface(ctrl)
+
+	err := as.DeleteInstances([]*azureRef{{Name: testValidProviderID0}})
+	assert.ErrorContains(t, err, "pre-delete hook for node group as failed")
+	assert.Equal(t, PreDeleteHookRequest{NodeGroup: "as", ProviderIDs: []string{testValidProviderID0}}, received)
+}
+
 func TestAgentPoolDeleteNodes(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
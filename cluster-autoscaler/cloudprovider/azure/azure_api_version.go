@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/Azure/go-autorest/autorest"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	computeClientName          = "compute"
+	containerServiceClientName = "containerservice"
+
+	// sdkDefaultAPIVersion is reported for clients whose API version is not pinned.
+	sdkDefaultAPIVersion = "sdk-default"
+	apiVersionQueryKey   = "api-version"
+)
+
+// apiVersionRegex matches ARM API versions, e.g. 2022-08-01 or 2024-04-02-preview.
+var apiVersionRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(-preview)?$`)
+
+// apiVersionAuthorizer decorates an authorizer so that every request sent by the client
+// uses the pinned API version instead of the one built into the SDK.
+type apiVersionAuthorizer struct {
+	autorest.Authorizer
+	apiVersion string
+}
+
+// withAPIVersion returns authorizer unchanged if apiVersion is empty, or wrapped to pin apiVersion otherwise.
+func withAPIVersion(authorizer autorest.Authorizer, apiVersion string) autorest.Authorizer {
+	if apiVersion == "" {
+		return authorizer
+	}
+	return &apiVersionAuthorizer{Authorizer: authorizer, apiVersion: apiVersion}
+}
+
+// WithAuthorization returns a PrepareDecorator authorizing the request and overriding its API version.
+func (a *apiVersionAuthorizer) WithAuthorization() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return a.Authorizer.WithAuthorization()(autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err == nil && r.URL != nil {
+				setAPIVersion(r.URL, a.apiVersion)
+			}
+			return r, err
+		}))
+	}
+}
+
+func setAPIVersion(u *url.URL, apiVersion string) {
+	v := u.Query()
+	v.Set(apiVersionQueryKey, apiVersion)
+	u.RawQuery = v.Encode()
+}
+
+// recordAPIVersion logs and exports the API version used by a client.
+func recordAPIVersion(client, apiVersion string) {
+	if apiVersion == "" {
+		apiVersion = sdkDefaultAPIVersion
+	}
+	klog.Infof("Using API version %s for the %s client", apiVersion, client)
+	apiVersionInfo.WithLabelValues(client, apiVersion).Set(1)
+}
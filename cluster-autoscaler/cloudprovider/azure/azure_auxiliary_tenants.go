@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	klog "k8s.io/klog/v2"
+)
+
+// newMultiTenantAuthorizer returns an authorizer which, besides the primary token for the tenant of the cluster,
+// sends auxiliary tokens for config.AuxiliaryTenantIDs in the x-ms-authorization-auxiliary header. ARM requires
+// them to operate on scale sets referencing resources, e.g. gallery images, from other tenants.
+func newMultiTenantAuthorizer(config *Config, env *azure.Environment) (autorest.Authorizer, error) {
+	oauthConfig, err := adal.NewMultiTenantOAuthConfig(env.ActiveDirectoryEndpoint, config.TenantID, config.AuxiliaryTenantIDs, adal.OAuthOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("creating the multi-tenant OAuth config: %w", err)
+	}
+
+	var token *adal.MultiTenantServicePrincipalToken
+	switch {
+	case config.AADClientSecret != "":
+		klog.V(2).Infof("azure: using client_id+client_secret to retrieve access tokens for tenant %s and auxiliary tenants %v", config.TenantID, config.AuxiliaryTenantIDs)
+		token, err = adal.NewMultiTenantServicePrincipalToken(oauthConfig, config.AADClientID, config.AADClientSecret, env.ServiceManagementEndpoint)
+	case config.AADClientCertPath != "":
+		klog.V(2).Infof("azure: using client_cert+client_private_key to retrieve access tokens for tenant %s and auxiliary tenants %v", config.TenantID, config.AuxiliaryTenantIDs)
+		certData, readErr := os.ReadFile(config.AADClientCertPath)
+		if readErr != nil {
+			return nil, fmt.Errorf("reading the client certificate from file %s: %w", config.AADClientCertPath, readErr)
+		}
+		certificate, privateKey, decodeErr := adal.DecodePfxCertificateData(certData, config.AADClientCertPassword)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("decoding the client certificate: %w", decodeErr)
+		}
+		token, err = adal.NewMultiTenantServicePrincipalTokenFromCertificate(oauthConfig, config.AADClientID, certificate, privateKey, env.ServiceManagementEndpoint)
+	default:
+		return nil, fmt.Errorf("auxiliary tenants require a client secret or certificate")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("retrieve multi-tenant service principal token: %w", err)
+	}
+	return autorest.NewMultiTenantServicePrincipalTokenAuthorizer(token), nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+)
+
+const (
+	// backPressureWindow is the number of recent cache refreshes the error rate is computed on.
+	backPressureWindow = 10
+	// minBackPressureSamples is the number of cache refreshes needed before their error rate is considered, so
+	// that a single failed refresh after startup doesn't report ARM as degraded.
+	minBackPressureSamples                = 3
+	defaultBackPressureLatencyThreshold   = time.Minute
+	defaultBackPressureErrorRateThreshold = 0.5
+	minBackPressureLoopDelay              = 10 * time.Second
+	maxBackPressureLoopDelay              = 2 * time.Minute
+)
+
+// refreshHealth tracks the latency and outcome of the recent cache refreshes, to report ARM as degraded when they
+// are slow or failing, so that the autoscaler loop backs off. A nil refreshHealth is always healthy.
+type refreshHealth struct {
+	latencyThreshold   time.Duration
+	errorRateThreshold float64
+
+	mutex       sync.Mutex
+	lastLatency time.Duration
+	// failures keeps whether each of the last backPressureWindow refreshes failed, oldest first.
+	failures []bool
+	// degradedStreak is the number of consecutive slow or failed refreshes, by which the loop delay grows.
+	degradedStreak int
+}
+
+func newRefreshHealth(config *Config) *refreshHealth {
+	h := &refreshHealth{
+		latencyThreshold:   time.Duration(config.BackPressureLatencyThresholdInSeconds) * time.Second,
+		errorRateThreshold: config.BackPressureErrorRateThreshold,
+	}
+	if h.latencyThreshold == 0 {
+		h.latencyThreshold = defaultBackPressureLatencyThreshold
+	}
+	if h.errorRateThreshold == 0 {
+		h.errorRateThreshold = defaultBackPressureErrorRateThreshold
+	}
+	return h
+}
+
+// observe records a cache refresh which took latency, and whether it failed.
+func (h *refreshHealth) observe(latency time.Duration, failed bool) {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.lastLatency = latency
+	h.failures = append(h.failures, failed)
+	if len(h.failures) > backPressureWindow {
+		h.failures = h.failures[1:]
+	}
+	if failed || latency > h.latencyThreshold {
+		h.degradedStreak++
+	} else {
+		h.degradedStreak = 0
+	}
+}
+
+// health returns the health of ARM at now, degraded while requests are throttled until throttledUntil, the last
+// refresh was slow, or too many recent refreshes failed.
+func (h *refreshHealth) health(throttledUntil, now time.Time) cloudprovider.ProviderHealth {
+	if h == nil {
+		return cloudprovider.ProviderHealth{}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var reasons []string
+	var delay time.Duration
+	if throttledUntil.After(now) {
+		reasons = append(reasons, fmt.Sprintf("ARM requests are throttled until %v", throttledUntil))
+		delay = throttledUntil.Sub(now)
+	}
+	if h.lastLatency > h.latencyThreshold {
+		reasons = append(reasons, fmt.Sprintf("the last cache refresh took %v", h.lastLatency))
+	}
+	failed := 0
+	for _, f := range h.failures {
+		if f {
+			failed++
+		}
+	}
+	if failed > 0 && len(h.failures) >= minBackPressureSamples && float64(failed)/float64(len(h.failures)) >= h.errorRateThreshold {
+		reasons = append(reasons, fmt.Sprintf("%d of the last %d cache refreshes failed", failed, len(h.failures)))
+	}
+
+	if len(reasons) == 0 {
+		providerDegraded.Set(0)
+		return cloudprovider.ProviderHealth{}
+	}
+	providerDegraded.Set(1)
+	backoff := minBackPressureLoopDelay
+	for i := 1; i < h.degradedStreak && backoff < maxBackPressureLoopDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > delay {
+		delay = backoff
+	}
+	if delay > maxBackPressureLoopDelay {
+		delay = maxBackPressureLoopDelay
+	}
+	return cloudprovider.ProviderHealth{Degraded: true, Reason: strings.Join(reasons, ", "), LoopDelay: delay}
+}
+
+// ProviderHealth returns the health of ARM, as seen by the cache refreshes. It implements
+// cloudprovider.ProviderHealthReporter.
+func (azure *AzureCloudProvider) ProviderHealth() cloudprovider.ProviderHealth {
+	cache := azure.azureManager.azureCache
+	return azure.azureManager.refreshHealth.health(cache.callQueue.throttledUntilAt(), cache.now())
+}
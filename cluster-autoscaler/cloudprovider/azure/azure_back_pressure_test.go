@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshHealth(t *testing.T) {
+	now := time.Now()
+	h := newRefreshHealth(&Config{})
+	assert.Equal(t, defaultBackPressureLatencyThreshold, h.latencyThreshold)
+
+	h.observe(time.Second, false)
+	assert.False(t, h.health(time.Time{}, now).Degraded)
+
+	h.observe(2*time.Minute, false)
+	health := h.health(time.Time{}, now)
+	assert.True(t, health.Degraded)
+	assert.Equal(t, "the last cache refresh took 2m0s", health.Reason)
+	assert.Equal(t, minBackPressureLoopDelay, health.LoopDelay)
+
+	// The loop delay doubles with each consecutive degraded refresh.
+	h.observe(time.Second, true)
+	assert.False(t, h.health(time.Time{}, now).Degraded, "1 of the last 3 refreshes failed")
+	h.observe(time.Second, true)
+	health = h.health(time.Time{}, now)
+	assert.Equal(t, "2 of the last 4 cache refreshes failed", health.Reason)
+	assert.Equal(t, 4*minBackPressureLoopDelay, health.LoopDelay)
+	for i := 0; i < 5; i++ {
+		h.observe(time.Second, true)
+	}
+	assert.Equal(t, maxBackPressureLoopDelay, h.health(time.Time{}, now).LoopDelay)
+
+	for i := 0; i < backPressureWindow; i++ {
+		h.observe(time.Second, false)
+	}
+	assert.False(t, h.health(time.Time{}, now).Degraded)
+
+	// Throttling delays the loop until it's over.
+	health = h.health(now.Add(time.Minute), now)
+	assert.True(t, health.Degraded)
+	assert.Equal(t, time.Minute, health.LoopDelay)
+
+	var nilHealth *refreshHealth
+	nilHealth.observe(time.Hour, true)
+	assert.False(t, nilHealth.health(now.Add(time.Minute), now).Degraded)
+}
+
+func TestProviderHealth(t *testing.T) {
+	provider := newTestProvider(t)
+	provider.azureManager.refreshHealth = newRefreshHealth(provider.azureManager.config)
+	assert.False(t, provider.ProviderHealth().Degraded)
+
+	provider.azureManager.refreshHealth.observe(time.Second, true)
+	assert.False(t, provider.ProviderHealth().Degraded, "a single failed refresh isn't enough to report ARM as degraded")
+	provider.azureManager.refreshHealth.observe(time.Second, true)
+	provider.azureManager.refreshHealth.observe(time.Second, false)
+	assert.True(t, provider.ProviderHealth().Degraded)
+}
@@ -19,24 +19,47 @@ package azure
 import (
 	"context"
 	"errors"
+	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/Azure/skewer"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
-	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	kretry "k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
 
 	"k8s.io/klog/v2"
 )
 
+const (
+	// agentPoolListPrefetchPages bounds how many agent pool pages are fetched ahead of processing.
+	agentPoolListPrefetchPages = 2
+	// vmsPoolsRecheckInterval is how often agent pools are listed again once the cluster was found to have no VMs pool.
+	vmsPoolsRecheckInterval = 10 * time.Minute
+	// defaultNodeGroupRefreshConcurrency bounds how many node groups list their nodes concurrently on regenerate.
+	defaultNodeGroupRefreshConcurrency = 8
+)
+
 var (
 	virtualMachineRE = regexp.MustCompile(`^azure://(?:.*)/providers/Microsoft.Compute/virtualMachines/(.+)$`)
+
+	// agentPoolListPageBackoff is the backoff used to retry fetching a single page of agent pools.
+	agentPoolListPageBackoff = wait.Backoff{
+		Duration: 1 * time.Second,
+		Factor:   2.0,
+		Jitter:   0.1,
+		Steps:    3,
+	}
 )
 
 // azureCache is used for caching cluster resources state.
@@ -75,10 +98,17 @@ type azureCache struct {
 
 	// enableVMsAgentPool specifies whether VMs agent pool type is supported.
 	enableVMsAgentPool bool
+	// hasVMsPools caches whether the cluster had VMs pools when agent pools were last listed, at vmsPoolsCheckedAt.
+	// Agent pools are only listed every vmsPoolsRecheckInterval when it has none.
+	hasVMsPools       bool
+	vmsPoolsCheckedAt time.Time
 
 	// vmType can be one of vmTypeVMSS (default), vmTypeStandard
 	vmType string
 
+	// refreshRegisteredNodeGroupsOnly specifies whether only the resources backing registered node groups are fetched.
+	refreshRegisteredNodeGroupsOnly bool
+
 	vmsPoolMap map[string]armcontainerservice.AgentPool // track the nodepools that're vms pool
 
 	// scaleSets keeps the set of all known scalesets in the resource group, populated/refreshed via VMSS.List() call.
@@ -104,6 +134,56 @@ type azureCache struct {
 
 	autoscalingOptions map[azureRef]map[string]string
 	skus               *skewer.Cache
+	// skusFetchedAt is when skus was last fetched successfully, zero if never.
+	skusFetchedAt time.Time
+	// skuRefreshInterval is the interval at which skus is refetched, never if 0.
+	skuRefreshInterval time.Duration
+
+	// launchConfigHashes maps scale sets to the hash of their cached launch configuration.
+	launchConfigHashes map[azureRef]string
+	// scaleSetSKUs maps scale sets to the VM SKU name of their cached model.
+	scaleSetSKUs map[azureRef]string
+	// scaleSetZones maps scale sets to the sorted availability zones of their cached model.
+	scaleSetZones map[azureRef][]string
+
+	// resourceCacheClient, if set, fetches scale sets, VMs and VMs pools from a resource cache service instead of ARM.
+	resourceCacheClient *resourceCacheClient
+	// standbySnapshot holds the resources listed while waiting for leadership, used on the first fetch only.
+	standbySnapshot *resourceSnapshot
+
+	// callQueue defers the background ARM calls of the cache while ARM requests are throttled.
+	callQueue *armCallQueue
+	// errors deduplicates the repeated ARM errors of the cache in the logs.
+	errors *errorAggregator
+	// vmPoolMapper maps the listed VMs to their agent pool.
+	vmPoolMapper *vmPoolMapper
+
+	// clock is the time source of the cache and of the refreshes of the manager, faked by tests. Real time if nil.
+	clock clock.Clock
+	// faults, if set, injects failures and latency into the ARM calls of the cache. Tests only.
+	faults faultInjector
+
+	// instanceMatchingStrategy is how FindForInstance resolves the node group of instances, see InstanceMatchingExact.
+	instanceMatchingStrategy string
+	// instanceFilters is the chain omitting the instances FindForInstance doesn't look up, the default one of the
+	// vmType looked up if nil.
+	instanceFilters []InstanceFilter
+
+	// nodeGroupRefreshConcurrency bounds how many node groups list their nodes concurrently on regenerate.
+	nodeGroupRefreshConcurrency int
+
+	// unregisteredNodeGroupCacheTTL specifies how long cached Azure resources of an unregistered
+	// node group are kept before being evicted. Zero evicts them on unregistration.
+	unregisteredNodeGroupCacheTTL time.Duration
+	// pendingEvictions keeps the unregistered node groups whose cached resources are yet to be evicted,
+	// keyed by lower-cased node group id. Entries are dropped if the node group is registered again.
+	pendingEvictions map[string]pendingEviction
+}
+
+// pendingEviction is a node group whose cached resources are due for eviction at evictAt.
+type pendingEviction struct {
+	nodeGroup cloudprovider.NodeGroup
+	evictAt   time.Time
 }
 
 func newAzureCache(client *azClient, cacheTTL time.Duration, config Config) (*azureCache, error) {
@@ -124,9 +204,53 @@ func newAzureCache(client *azClient, cacheTTL time.Duration, config Config) (*az
 		unownedInstances:     make(map[azureRef]bool),
 		autoscalingOptions:   make(map[azureRef]map[string]string),
 		skus:                 &skewer.Cache{}, // populated iff config.EnableDynamicInstanceList
+		skuRefreshInterval:   time.Duration(config.SKUCacheRefreshIntervalInSeconds) * time.Second,
+
+		refreshRegisteredNodeGroupsOnly: config.RefreshRegisteredNodeGroupsOnly,
+		unregisteredNodeGroupCacheTTL:   time.Duration(config.UnregisteredNodeGroupCacheTTLInSeconds) * time.Second,
+		pendingEvictions:                make(map[string]pendingEviction),
+		launchConfigHashes:              make(map[azureRef]string),
+		scaleSetSKUs:                    make(map[azureRef]string),
+		scaleSetZones:                   make(map[azureRef][]string),
+		nodeGroupRefreshConcurrency:     config.NodeGroupRefreshConcurrency,
+		callQueue:                       newARMCallQueue(),
+		errors:                          newErrorAggregator(),
+		instanceMatchingStrategy:        config.InstanceMatchingStrategy,
+		clock:                           clock.RealClock{},
+	}
+
+	vmPoolMapper, err := newVMPoolMapper(config.AgentPoolNameTagKeys, config.AgentPoolNamePatterns)
+	if err != nil {
+		return nil, err
+	}
+	cache.vmPoolMapper = vmPoolMapper
+	if len(config.InstanceFilters) > 0 {
+		if cache.instanceFilters, err = newInstanceFilterChain(config.InstanceFilters, config.VMType); err != nil {
+			return nil, err
+		}
+	}
+
+	if cache.nodeGroupRefreshConcurrency <= 0 {
+		cache.nodeGroupRefreshConcurrency = defaultNodeGroupRefreshConcurrency
 	}
 
-	if err := cache.regenerate(); err != nil {
+	if config.ResourceCacheServiceAddress != "" {
+		resourceCacheClient, err := newResourceCacheClient(config.ResourceCacheServiceAddress, 2*cacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		cache.resourceCacheClient = resourceCacheClient
+	}
+
+	var snapshot *resourceSnapshot
+	if config.StandbyCacheRefreshIntervalInSeconds > 0 {
+		snapshot = takeStandbySnapshot(config.ResourceGroup, 2*time.Duration(config.StandbyCacheRefreshIntervalInSeconds)*time.Second)
+	}
+	if snapshot != nil {
+		// The first refresh of the manager uses the snapshot, no need to list resources here.
+		klog.Infof("Starting from the Azure resources listed while on standby, refreshed at %v", snapshot.RefreshedAt)
+		cache.standbySnapshot = snapshot
+	} else if err := cache.regenerate(); err != nil {
 		klog.Errorf("Error while regenerating Azure cache: %v", err)
 	}
 
@@ -160,9 +284,50 @@ func (m *azureCache) getScaleSets() map[string]compute.VirtualMachineScaleSet {
 	return m.scaleSets
 }
 
+// listNodeGroupInstances maps the instances of the given node groups to their node group. Nodes() may call ARM,
+// so node groups are listed by a bounded pool of workers, which stop on the first error.
+func (m *azureCache) listNodeGroupInstances(nodeGroups []cloudprovider.NodeGroup) (map[azureRef]cloudprovider.NodeGroup, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mutex          sync.Mutex
+		firstErr       error
+		instanceGroups = make(map[azureRef]cloudprovider.NodeGroup)
+	)
+	workqueue.ParallelizeUntil(ctx, m.nodeGroupRefreshConcurrency, len(nodeGroups), func(piece int) {
+		ng := nodeGroups[piece]
+		klog.V(4).Infof("regenerate: finding nodes for node group %s", ng.Id())
+		instances, err := ng.Nodes()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+			return
+		}
+		klog.V(4).Infof("regenerate: found %d nodes for node group %s: %+v", len(instances), ng.Id(), instances)
+		for _, instance := range instances {
+			instanceGroups[azureRef{Name: instance.Id}] = ng
+		}
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return instanceGroups, nil
+}
+
 // Cleanup closes the channel to signal the go routine to stop that is handling the cache
 func (m *azureCache) Cleanup() {
 	close(m.interrupt)
+	if m.resourceCacheClient != nil {
+		if err := m.resourceCacheClient.conn.Close(); err != nil {
+			klog.Warningf("Failed to close resource cache service connection: %v", err)
+		}
+	}
 }
 
 func (m *azureCache) regenerate() error {
@@ -170,21 +335,18 @@ func (m *azureCache) regenerate() error {
 	if err != nil {
 		return err
 	}
+	_, err = m.regenerateMappings()
+	return err
+}
 
+// regenerateMappings rebuilds the instance to node group, autoscaling options and launch configuration
+// mappings from the Azure resources fetched last and the currently registered node groups. It returns
+// the changes of scale set models detected since the previous refresh.
+func (m *azureCache) regenerateMappings() ([]scaleSetModelChange, error) {
 	// Regenerate instance to node groups mapping.
-	newInstanceToNodeGroupCache := make(map[azureRef]cloudprovider.NodeGroup)
-	for _, ng := range m.registeredNodeGroups {
-		klog.V(4).Infof("regenerate: finding nodes for node group %s", ng.Id())
-		instances, err := ng.Nodes()
-		if err != nil {
-			return err
-		}
-		klog.V(4).Infof("regenerate: found %d nodes for node group %s: %+v", len(instances), ng.Id(), instances)
-
-		for _, instance := range instances {
-			ref := azureRef{Name: instance.Id}
-			newInstanceToNodeGroupCache[ref] = ng
-		}
+	newInstanceToNodeGroupCache, err := m.listNodeGroupInstances(m.getRegisteredNodeGroups())
+	if err != nil {
+		return nil, err
 	}
 
 	// Regenerate VMSS to autoscaling options mapping.
@@ -198,30 +360,65 @@ func (m *azureCache) regenerate() error {
 		newAutoscalingOptions[ref] = options
 	}
 
+	// Node templates are built from the cached scale set models, so they reflect changes of their launch
+	// configuration, SKU or zones as soon as they are fetched; the changes are only reported here.
+	newLaunchConfigHashes := regenerateLaunchConfigHashes(m.scaleSets, m.getLaunchConfigHashes())
+	newScaleSetSKUs, newSKUChanges := regenerateScaleSetSKUs(m.scaleSets, m.getScaleSetSKUs())
+	newScaleSetZones, newZoneChanges := regenerateScaleSetZones(m.scaleSets, m.getScaleSetZones())
+	changes := append(newSKUChanges, newZoneChanges...)
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	m.instanceToNodeGroup = newInstanceToNodeGroupCache
 	m.autoscalingOptions = newAutoscalingOptions
+	m.launchConfigHashes = newLaunchConfigHashes
+	m.scaleSetSKUs = newScaleSetSKUs
+	m.scaleSetZones = newScaleSetZones
 
 	// Reset unowned instances cache.
 	m.unownedInstances = make(map[azureRef]bool)
 
-	return nil
+	return changes, nil
 }
 
 func (m *azureCache) fetchSKUCache(location string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
+	if rerr := m.injectFault("ResourceSKUsClient.List", location); rerr != nil {
+		return rerr.Error()
+	}
+	// SKUs are fetched without the lock: listing them can take a while.
 	cache, err := m.fetchSKUs(context.Background(), location)
 	if err != nil {
 		return err
 	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.skus = cache
+	m.skusFetchedAt = m.now()
 	return nil
 }
 
+// refreshSKUCache refetches the SKU cache if it is older than the SKU refresh interval, keeping the
+// current cache on failure, and reports its age.
+func (m *azureCache) refreshSKUCache(location string, now time.Time) {
+	m.mutex.Lock()
+	fetchedAt := m.skusFetchedAt
+	m.mutex.Unlock()
+
+	if m.skuRefreshInterval > 0 && !now.Before(fetchedAt.Add(m.skuRefreshInterval)) && m.callQueue.admitBackground(callSKURefresh, location, now) {
+		if err := m.fetchSKUCache(location); err != nil {
+			m.errors.errorf("ResourceSKUsClient.List", location, err, now, "Failed to refresh the SKU cache, keeping the one fetched at %v: %v", fetchedAt, err)
+		} else {
+			klog.V(2).Infof("Refreshed the SKU cache, next refresh after %v", now.Add(m.skuRefreshInterval))
+			fetchedAt = now
+		}
+	}
+	if !fetchedAt.IsZero() {
+		skuCacheAge.Set(now.Sub(fetchedAt).Seconds())
+	}
+}
+
 // fetchAzureResources retrieves and updates the cached Azure resources.
 //
 // This function performs the following:
@@ -234,26 +431,70 @@ func (m *azureCache) fetchAzureResources() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if m.standbySnapshot != nil {
+		m.applyResourceSnapshot(m.standbySnapshot)
+		m.standbySnapshot = nil
+		return m.fetchExternalScaleSets(m.scaleSets)
+	}
+
+	if m.resourceCacheClient != nil {
+		snapshot, err := m.resourceCacheClient.getResources(m.resourceGroup)
+		if err == nil {
+			m.applyResourceSnapshot(snapshot)
+			klog.V(4).Infof("Fetched Azure resources from the resource cache service, refreshed at %v", snapshot.RefreshedAt)
+			return m.fetchExternalScaleSets(m.scaleSets)
+		}
+		klog.Warningf("Failed to fetch Azure resources from the resource cache service, listing them from ARM: %v", err)
+	}
+
+	if len(m.scaleSets)+len(m.virtualMachines) > 0 && !m.callQueue.admitBackground(callCacheRefresh, m.resourceGroup, m.now()) {
+		return nil
+	}
+
 	// NOTE: this lists virtual machine scale sets, not virtual machine
 	// scale set instances
-	vmssResult, err := m.fetchScaleSets()
-	if err != nil {
-		return err
+	var (
+		vmssResult map[string]compute.VirtualMachineScaleSet
+		err        error
+	)
+	if m.refreshRegisteredNodeGroupsOnly {
+		// Registered scale sets are fetched without the lock, so that cache readers aren't blocked by the Gets.
+		scaleSets, previous := m.getRegisteredScaleSets(), m.scaleSets
+		m.mutex.Unlock()
+		vmssResult = m.fetchRegisteredScaleSets(scaleSets, previous)
+		m.mutex.Lock()
+	} else {
+		vmssResult, err = m.fetchScaleSets()
+		if err != nil {
+			return err
+		}
 	}
 	m.scaleSets = vmssResult
-	vmResult, err := m.fetchVirtualMachines()
-	if err != nil {
-		return err
+	// VMs can only be listed per resource group, skip the call entirely when no registered node group is backed by VMs.
+	if m.refreshRegisteredNodeGroupsOnly && !m.hasRegisteredVMNodeGroups() {
+		m.virtualMachines = make(map[string][]compute.VirtualMachine)
+	} else {
+		vmResult, err := m.fetchVirtualMachines()
+		if err != nil {
+			return err
+		}
+		// we fetch both sets of resources since CAS may operate on mixed nodepools
+		m.virtualMachines = vmResult
 	}
-	// we fetch both sets of resources since CAS may operate on mixed nodepools
-	m.virtualMachines = vmResult
 	// fetch VMs pools if enabled
 	if m.enableVMsAgentPool {
-		vmsPoolMap, err := m.fetchVMsPools()
-		if err != nil {
-			return err
+		now := m.now()
+		if m.shouldFetchVMsPools(now) {
+			vmsPoolMap, err := m.fetchVMsPools()
+			if err != nil {
+				return err
+			}
+			m.vmsPoolMap = vmsPoolMap
+			m.hasVMsPools = len(vmsPoolMap) > 0
+			m.vmsPoolsCheckedAt = now
+		} else {
+			klog.V(4).Infof("Skipping agent pools listing, cluster %s had no VMs pool as of %v", m.clusterName, m.vmsPoolsCheckedAt)
 		}
-		m.vmsPoolMap = vmsPoolMap
 	}
 
 	return nil
@@ -266,35 +507,68 @@ const (
 	vmsPoolType            = "VirtualMachines"
 )
 
+// shouldFetchVMsPools returns whether agent pools need to be listed. Clusters without VMs pools
+// are only checked every vmsPoolsRecheckInterval, unless a VMs pool node group is registered.
+func (m *azureCache) shouldFetchVMsPools(now time.Time) bool {
+	if m.hasVMsPools || now.Sub(m.vmsPoolsCheckedAt) >= vmsPoolsRecheckInterval {
+		return true
+	}
+	for _, ng := range m.registeredNodeGroups {
+		if _, ok := ng.(*VMPool); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// applyResourceSnapshot replaces the fetched Azure resources with the ones of snapshot.
+// Must be called with m.mutex held.
+func (m *azureCache) applyResourceSnapshot(snapshot *resourceSnapshot) {
+	m.scaleSets = snapshot.ScaleSets
+	if m.scaleSets == nil {
+		m.scaleSets = make(map[string]compute.VirtualMachineScaleSet)
+	}
+	m.virtualMachines = snapshot.VirtualMachines
+	if m.enableVMsAgentPool {
+		m.vmsPoolMap = snapshot.VMsPools
+		m.hasVMsPools = len(snapshot.VMsPools) > 0
+		m.vmsPoolsCheckedAt = snapshot.RefreshedAt
+	}
+}
+
 // fetchVirtualMachines returns the updated list of virtual machines in the config resource group using the Azure API.
 func (m *azureCache) fetchVirtualMachines() (map[string][]compute.VirtualMachine, error) {
+	if m.azClient.virtualMachinePagesClient != nil {
+		return m.streamVirtualMachines()
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
-	result, err := m.azClient.virtualMachinesClient.List(ctx, m.resourceGroup)
+	var result []compute.VirtualMachine
+	err := m.injectFault("VirtualMachinesClient.List", m.resourceGroup)
+	if err == nil {
+		result, err = m.azClient.virtualMachinesClient.List(ctx, m.resourceGroup)
+	}
+	m.callQueue.observe(err, m.now())
 	if err != nil {
-		klog.Errorf("VirtualMachinesClient.List in resource group %q failed: %v", m.resourceGroup, err)
+		m.errors.errorf("VirtualMachinesClient.List", m.resourceGroup, err, m.now(), "VirtualMachinesClient.List in resource group %q failed: %v", m.resourceGroup, err)
 		return nil, err.Error()
 	}
 
 	instances := make(map[string][]compute.VirtualMachine)
+	unmapped := 0
 	for _, instance := range result {
-		if instance.Tags == nil {
+		vmPoolName, ok := m.vmPoolMapper.poolName(instance)
+		if !ok {
+			klog.V(4).Infof("VM %s in resource group %q is not mapped to any agent pool", to.String(instance.Name), m.resourceGroup)
+			unmapped++
 			continue
 		}
 
-		tags := instance.Tags
-		vmPoolName := tags[agentpoolNameTag]
-		// fall back to legacy tag name if not found
-		if vmPoolName == nil {
-			vmPoolName = tags[legacyAgentpoolNameTag]
-		}
-		if vmPoolName == nil {
-			continue
-		}
-
-		instances[to.String(vmPoolName)] = append(instances[to.String(vmPoolName)], instance)
+		instances[vmPoolName] = append(instances[vmPoolName], instance)
 	}
+	unmappedVirtualMachines.Set(float64(unmapped))
 	return instances, nil
 }
 
@@ -310,16 +584,34 @@ func (m *azureCache) fetchVMsPools() (map[string]armcontainerservice.AgentPool,
 
 	vmsPoolMap := make(map[string]armcontainerservice.AgentPool)
 	pager := m.azClient.agentPoolClient.NewListPager(m.clusterResourceGroup, m.clusterName, nil)
-	var aps []*armcontainerservice.AgentPool
-	for pager.More() {
-		resp, err := pager.NextPage(ctx)
-		if err != nil {
-			klog.Errorf("agentPoolClient.pager.NextPage in cluster %s resource group %s failed: %v",
-				m.clusterName, m.clusterResourceGroup, err)
-			return nil, err
+
+	// Each page carries the link to the next one, so pages can't be fetched in parallel.
+	// Instead the next pages are prefetched, up to agentPoolListPrefetchPages, while the current one is processed.
+	pages := make(chan armcontainerservice.AgentPoolsClientListResponse, agentPoolListPrefetchPages)
+	pageErr := make(chan error, 1)
+	go func() {
+		defer close(pages)
+		for pager.More() {
+			resp, err := m.fetchVMsPoolsPage(ctx, pager)
+			if err != nil {
+				pageErr <- err
+				return
+			}
+			pages <- resp
 		}
+	}()
+
+	var aps []*armcontainerservice.AgentPool
+	for resp := range pages {
 		aps = append(aps, resp.Value...)
 	}
+	select {
+	case err := <-pageErr:
+		m.errors.errorf("AgentPoolsClient.List", m.clusterName, err, m.now(), "agentPoolClient.pager.NextPage in cluster %s resource group %s failed: %v",
+			m.clusterName, m.clusterResourceGroup, err)
+		return nil, err
+	default:
+	}
 
 	for _, ap := range aps {
 		if ap != nil && ap.Name != nil && ap.Properties != nil && ap.Properties.Type != nil &&
@@ -333,14 +625,51 @@ func (m *azureCache) fetchVMsPools() (map[string]armcontainerservice.AgentPool,
 	return vmsPoolMap, nil
 }
 
+// fetchVMsPoolsPage fetches the next page of agent pools, retrying it on transient failures.
+// Retrying is safe as the pager only moves on to the next page once a page was fetched successfully.
+func (m *azureCache) fetchVMsPoolsPage(ctx context.Context, pager *runtime.Pager[armcontainerservice.AgentPoolsClientListResponse]) (armcontainerservice.AgentPoolsClientListResponse, error) {
+	var resp armcontainerservice.AgentPoolsClientListResponse
+	err := kretry.OnError(agentPoolListPageBackoff, func(err error) bool {
+		return ctx.Err() == nil && isAgentPoolListPageErrorRetriable(err)
+	}, func() error {
+		start := time.Now()
+		var err error
+		if rerr := m.injectFault("AgentPoolsClient.List", m.clusterName); rerr != nil {
+			err = rerr.Error()
+		} else {
+			resp, err = pager.NextPage(ctx)
+		}
+		observeAgentPoolListPage(err, start)
+		if err != nil {
+			klog.Warningf("Failed to fetch agent pools page in cluster %s resource group %s: %v", m.clusterName, m.clusterResourceGroup, err)
+		}
+		return err
+	})
+	return resp, err
+}
+
+// isAgentPoolListPageErrorRetriable returns false for client errors other than throttling, which won't succeed on retry.
+func isAgentPoolListPageErrorRetriable(err error) bool {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
 // fetchScaleSets returns the updated list of scale sets in the config resource group using the Azure API.
 func (m *azureCache) fetchScaleSets() (map[string]compute.VirtualMachineScaleSet, error) {
 	ctx, cancel := getContextWithTimeout(vmssContextTimeout)
 	defer cancel()
 
-	result, err := m.azClient.virtualMachineScaleSetsClient.List(ctx, m.resourceGroup)
+	var result []compute.VirtualMachineScaleSet
+	err := m.injectFault("VirtualMachineScaleSetsClient.List", m.resourceGroup)
+	if err == nil {
+		result, err = m.azClient.virtualMachineScaleSetsClient.List(ctx, m.resourceGroup)
+	}
+	m.callQueue.observe(err, m.now())
 	if err != nil {
-		klog.Errorf("VirtualMachineScaleSetsClient.List in resource group %q failed: %v", m.resourceGroup, err)
+		m.errors.errorf("VirtualMachineScaleSetsClient.List", m.resourceGroup, err, m.now(), "VirtualMachineScaleSetsClient.List in resource group %q failed: %v", m.resourceGroup, err)
 		return nil, err.Error()
 	}
 
@@ -348,9 +677,73 @@ func (m *azureCache) fetchScaleSets() (map[string]compute.VirtualMachineScaleSet
 	for _, vmss := range result {
 		sets[*vmss.Name] = vmss
 	}
+	if err := m.fetchExternalScaleSets(sets); err != nil {
+		m.errors.errorf("VirtualMachineScaleSetsClient.Get", "external scale sets", err, m.now(), "Failed to fetch scale sets outside resource group %q: %v", m.resourceGroup, err)
+		return nil, err
+	}
 	return sets, nil
 }
 
+// getRegisteredScaleSets returns the registered node groups backed by scale sets. Caller must hold m.mutex.
+func (m *azureCache) getRegisteredScaleSets() []*ScaleSet {
+	var scaleSets []*ScaleSet
+	for _, ng := range m.registeredNodeGroups {
+		if scaleSet, ok := ng.(*ScaleSet); ok {
+			scaleSets = append(scaleSets, scaleSet)
+		}
+	}
+	return scaleSets
+}
+
+// fetchRegisteredScaleSets returns the given scale sets, fetched one by one using the Azure API by a bounded pool of
+// workers. Scale sets that no longer exist are left out. Scale sets that failed to be fetched keep their previous
+// value, if any, so that a single failure doesn't drop the other scale sets. m.mutex must not be held.
+func (m *azureCache) fetchRegisteredScaleSets(scaleSets []*ScaleSet, previous map[string]compute.VirtualMachineScaleSet) map[string]compute.VirtualMachineScaleSet {
+	var mutex sync.Mutex
+	sets := make(map[string]compute.VirtualMachineScaleSet)
+	workqueue.ParallelizeUntil(context.Background(), m.nodeGroupRefreshConcurrency, len(scaleSets), func(piece int) {
+		scaleSet := scaleSets[piece]
+		resourceGroup := scaleSet.resourceGroupName()
+		ctx, cancel := getContextWithTimeout(vmssContextTimeout)
+		defer cancel()
+		var vmss compute.VirtualMachineScaleSet
+		rerr := m.injectFault("VirtualMachineScaleSetsClient.Get", scaleSet.Name)
+		if rerr == nil {
+			vmss, rerr = m.azClient.virtualMachineScaleSetsClient.Get(ctx, resourceGroup, scaleSet.Name)
+		}
+		m.callQueue.observe(rerr, m.now())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		exists, err := checkResourceExistsFromRetryError(rerr)
+		if err != nil {
+			m.errors.errorf("VirtualMachineScaleSetsClient.Get", scaleSet.Name, rerr, m.now(), "VirtualMachineScaleSetsClient.Get for scale set %q in resource group %q failed, keeping its cached model: %v", scaleSet.Name, resourceGroup, err)
+			if vmss, found := previous[scaleSet.Name]; found {
+				sets[scaleSet.Name] = vmss
+			}
+			return
+		}
+		if !exists {
+			klog.Warningf("Scale set %q of registered node group not found in resource group %q", scaleSet.Name, resourceGroup)
+			return
+		}
+		sets[*vmss.Name] = vmss
+	})
+	return sets
+}
+
+// hasRegisteredVMNodeGroups returns true if any registered node group is backed by standalone VMs.
+// Caller must hold m.mutex.
+func (m *azureCache) hasRegisteredVMNodeGroups() bool {
+	for _, ng := range m.registeredNodeGroups {
+		switch ng.(type) {
+		case *AgentPool, *VMPool:
+			return true
+		}
+	}
+	return false
+}
+
 // Register registers a node group if it hasn't been registered.
 func (m *azureCache) Register(nodeGroup cloudprovider.NodeGroup) bool {
 	m.mutex.Lock()
@@ -371,6 +764,8 @@ func (m *azureCache) Register(nodeGroup cloudprovider.NodeGroup) bool {
 
 	klog.V(4).Infof("Registering Node Group %q", nodeGroup.Id())
 
+	// The node group is back before its cached resources were evicted, keep them.
+	delete(m.pendingEvictions, strings.ToLower(nodeGroup.Id()))
 	m.registeredNodeGroups = append(m.registeredNodeGroups, nodeGroup)
 	m.invalidateUnownedInstanceCache()
 	return true
@@ -397,7 +792,89 @@ func (m *azureCache) Unregister(nodeGroup cloudprovider.NodeGroup) bool {
 		updated = append(updated, existing)
 	}
 	m.registeredNodeGroups = updated
-	return changed
+	if !changed {
+		return false
+	}
+
+	// Instances must stop resolving to the unregistered node group right away,
+	// while its VMSS/VM data may be kept around for a while in case it comes back.
+	for ref, ng := range m.instanceToNodeGroup {
+		if strings.EqualFold(ng.Id(), nodeGroup.Id()) {
+			delete(m.instanceToNodeGroup, ref)
+		}
+	}
+	if m.unregisteredNodeGroupCacheTTL == 0 {
+		m.evictNodeGroupResources(nodeGroup)
+		return true
+	}
+	m.pendingEvictions[strings.ToLower(nodeGroup.Id())] = pendingEviction{
+		nodeGroup: nodeGroup,
+		evictAt:   m.now().Add(m.unregisteredNodeGroupCacheTTL),
+	}
+	return true
+}
+
+// evictExpiredNodeGroupResources evicts the cached resources of node groups
+// that have been unregistered for longer than unregisteredNodeGroupCacheTTL.
+func (m *azureCache) evictExpiredNodeGroupResources(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, pending := range m.pendingEvictions {
+		if now.Before(pending.evictAt) {
+			continue
+		}
+		m.evictNodeGroupResources(pending.nodeGroup)
+		delete(m.pendingEvictions, id)
+	}
+}
+
+// evictNodeGroupResources drops the cached Azure resources backing an unregistered node group.
+// The maps are copied rather than modified in place as they are handed out to callers without the lock.
+// Caller must hold m.mutex.
+func (m *azureCache) evictNodeGroupResources(nodeGroup cloudprovider.NodeGroup) {
+	switch ng := nodeGroup.(type) {
+	case *ScaleSet:
+		scaleSets := make(map[string]compute.VirtualMachineScaleSet, len(m.scaleSets))
+		for name, vmss := range m.scaleSets {
+			if !strings.EqualFold(name, ng.Name) {
+				scaleSets[name] = vmss
+			}
+		}
+		m.scaleSets = scaleSets
+		autoscalingOptions := make(map[azureRef]map[string]string, len(m.autoscalingOptions))
+		for ref, options := range m.autoscalingOptions {
+			if !strings.EqualFold(ref.Name, ng.Name) {
+				autoscalingOptions[ref] = options
+			}
+		}
+		m.autoscalingOptions = autoscalingOptions
+		outdatedInstances.Delete(map[string]string{"node_group": ng.Name})
+	case *VMPool:
+		// VMPools of different SKUs share the agent pool, only evict it once none of them is registered.
+		for _, registered := range m.registeredNodeGroups {
+			if other, ok := registered.(*VMPool); ok && strings.EqualFold(other.agentPoolName, ng.agentPoolName) {
+				return
+			}
+		}
+		vmsPoolMap := make(map[string]armcontainerservice.AgentPool, len(m.vmsPoolMap))
+		for name, pool := range m.vmsPoolMap {
+			if !strings.EqualFold(name, ng.agentPoolName) {
+				vmsPoolMap[name] = pool
+			}
+		}
+		m.vmsPoolMap = vmsPoolMap
+		virtualMachines := make(map[string][]compute.VirtualMachine, len(m.virtualMachines))
+		for name, vms := range m.virtualMachines {
+			if !strings.EqualFold(name, ng.agentPoolName) {
+				virtualMachines[name] = vms
+			}
+		}
+		m.virtualMachines = virtualMachines
+	default:
+		return
+	}
+	klog.V(4).Infof("Evicted cached resources of unregistered node group %q", nodeGroup.Id())
 }
 
 func (m *azureCache) fetchSKUs(ctx context.Context, location string) (*skewer.Cache, error) {
@@ -438,6 +915,27 @@ func (m *azureCache) getAutoscalingOptions(ref azureRef) map[string]string {
 	return m.autoscalingOptions[ref]
 }
 
+func (m *azureCache) getLaunchConfigHashes() map[azureRef]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.launchConfigHashes
+}
+
+func (m *azureCache) getScaleSetSKUs() map[azureRef]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.scaleSetSKUs
+}
+
+func (m *azureCache) getScaleSetZones() map[azureRef][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.scaleSetZones
+}
+
 // HasInstance returns if a given instance exists in the azure cache
 func (m *azureCache) HasInstance(providerID string) (bool, error) {
 	m.mutex.Lock()
@@ -477,25 +975,15 @@ func (m *azureCache) FindForInstance(instance *azureRef, vmType string) (cloudpr
 		return nil, nil
 	}
 
-	// cluster with vmss pool only
-	if vmType == providerazureconsts.VMTypeVMSS && len(vmsPoolMap) == 0 {
-		if m.areAllScaleSetsUniform() {
-			// Omit virtual machines not managed by vmss only in case of uniform scale set.
-			if ok := virtualMachineRE.Match([]byte(inst.Name)); ok {
-				klog.V(3).Infof("Instance %q is not managed by vmss, omit it in autoscaler", instance.Name)
-				m.unownedInstances[inst] = true
-				return nil, nil
-			}
-		}
+	if omitted, filter, reason := m.filterInstance(inst.Name, vmType, len(vmsPoolMap) > 0); omitted {
+		klog.V(3).Infof("Instance %q %s, omit it in autoscaler (instance filter %s)", instance.Name, reason, filter)
+		m.unownedInstances[inst] = true
+		return nil, nil
 	}
 
-	if vmType == providerazureconsts.VMTypeStandard {
-		// Omit virtual machines with providerID not in Azure resource ID format.
-		if ok := virtualMachineRE.Match([]byte(inst.Name)); !ok {
-			klog.V(3).Infof("Instance %q is not in Azure resource ID format, omit it in autoscaler", instance.Name)
-			m.unownedInstances[inst] = true
-			return nil, nil
-		}
+	if nodeGroup := m.matchInstance(inst.Name); nodeGroup != nil {
+		klog.V(4).Infof("FindForInstance: matched node group %q by %s", nodeGroup.Id(), m.instanceMatchingStrategy)
+		return nodeGroup, nil
 	}
 
 	// Look up caches for the instance.
@@ -17,12 +17,25 @@ limitations under the License.
 package azure
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
 	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
@@ -58,6 +71,109 @@ func TestFetchVMsPools(t *testing.T) {
 	assert.True(t, ok)
 }
 
+func TestFetchVMsPoolsPaging(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backoff := agentPoolListPageBackoff
+	defer func() { agentPoolListPageBackoff = backoff }()
+	agentPoolListPageBackoff.Duration = 0
+
+	vmsPoolType := armcontainerservice.AgentPoolTypeVirtualMachines
+	newPool := func(name string) *armcontainerservice.AgentPool {
+		return &armcontainerservice.AgentPool{
+			Name:       to.StringPtr(name),
+			Properties: &armcontainerservice.ManagedClusterAgentPoolProfileProperties{Type: &vmsPoolType},
+		}
+	}
+	// newPager returns a pager of the given pages, failing with errs[i] on the i-th fetch attempt.
+	newPager := func(pages [][]*armcontainerservice.AgentPool, errs map[int]error) *runtime.Pager[armcontainerservice.AgentPoolsClientListResponse] {
+		attempt, page := 0, 0
+		return runtime.NewPager(runtime.PagingHandler[armcontainerservice.AgentPoolsClientListResponse]{
+			More: func(armcontainerservice.AgentPoolsClientListResponse) bool {
+				return page < len(pages)
+			},
+			Fetcher: func(context.Context, *armcontainerservice.AgentPoolsClientListResponse) (armcontainerservice.AgentPoolsClientListResponse, error) {
+				attempt++
+				if err := errs[attempt]; err != nil {
+					return armcontainerservice.AgentPoolsClientListResponse{}, err
+				}
+				page++
+				return armcontainerservice.AgentPoolsClientListResponse{
+					AgentPoolListResult: armcontainerservice.AgentPoolListResult{Value: pages[page-1]},
+				}, nil
+			},
+		})
+	}
+	pages := [][]*armcontainerservice.AgentPool{{newPool("pool1")}, {newPool("pool2")}, {newPool("pool3")}}
+
+	testCases := []struct {
+		name          string
+		errs          map[int]error
+		expectedPools int
+		expectedErr   bool
+	}{
+		{
+			name:          "all pages fetched",
+			expectedPools: 3,
+		},
+		{
+			name:          "transient page failure is retried",
+			errs:          map[int]error{2: &azcore.ResponseError{StatusCode: http.StatusInternalServerError}},
+			expectedPools: 3,
+		},
+		{
+			name: "retries exhausted",
+			errs: map[int]error{
+				2: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+				3: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+				4: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "client error is not retried",
+			errs:        map[int]error{1: &azcore.ResponseError{StatusCode: http.StatusForbidden}, 2: nil},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := newTestProvider(t)
+			ac := provider.azureManager.azureCache
+			mockAgentpoolclient := NewMockAgentPoolsClient(ctrl)
+			ac.azClient.agentPoolClient = mockAgentpoolclient
+			mockAgentpoolclient.EXPECT().NewListPager(gomock.Any(), gomock.Any(), nil).Return(newPager(pages, tc.errs))
+
+			vmsPoolMap, err := ac.fetchVMsPools()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPools, len(vmsPoolMap))
+		})
+	}
+}
+
+func TestShouldFetchVMsPools(t *testing.T) {
+	now := time.Now()
+	cache := &azureCache{}
+	assert.True(t, cache.shouldFetchVMsPools(now), "agent pools are listed on the first refresh")
+
+	cache.vmsPoolsCheckedAt = now
+	assert.False(t, cache.shouldFetchVMsPools(now.Add(time.Minute)))
+	assert.True(t, cache.shouldFetchVMsPools(now.Add(vmsPoolsRecheckInterval)))
+
+	cache.registeredNodeGroups = []cloudprovider.NodeGroup{&VMPool{}}
+	assert.True(t, cache.shouldFetchVMsPools(now.Add(time.Minute)))
+
+	cache.registeredNodeGroups = nil
+	cache.hasVMsPools = true
+	assert.True(t, cache.shouldFetchVMsPools(now.Add(time.Minute)))
+}
+
 func TestRegister(t *testing.T) {
 	provider := newTestProvider(t)
 	ss := newTestScaleSet(provider.azureManager, "ss")
@@ -87,6 +203,145 @@ func TestUnRegister(t *testing.T) {
 	assert.Equal(t, 1, len(ac.registeredNodeGroups))
 }
 
+func TestUnregisterEvictsNodeGroupResources(t *testing.T) {
+	provider := newTestProvider(t)
+	ss := newTestScaleSet(provider.azureManager, "ss")
+	ss1 := newTestScaleSet(provider.azureManager, "ss1")
+
+	newCache := func(ttl time.Duration) *azureCache {
+		ac := provider.azureManager.azureCache
+		ac.unregisteredNodeGroupCacheTTL = ttl
+		ac.pendingEvictions = make(map[string]pendingEviction)
+		ac.registeredNodeGroups = []cloudprovider.NodeGroup{ss, ss1}
+		ac.scaleSets = map[string]compute.VirtualMachineScaleSet{
+			"ss":  {Name: to.StringPtr("ss")},
+			"ss1": {Name: to.StringPtr("ss1")},
+		}
+		ac.autoscalingOptions = map[azureRef]map[string]string{
+			{Name: "ss"}:  {},
+			{Name: "ss1"}: {},
+		}
+		ac.instanceToNodeGroup = map[azureRef]cloudprovider.NodeGroup{
+			{Name: "instance-0"}: ss,
+			{Name: "instance-1"}: ss1,
+		}
+		return ac
+	}
+
+	t.Run("evicted immediately without TTL", func(t *testing.T) {
+		ac := newCache(0)
+		assert.True(t, ac.Unregister(ss))
+		assert.NotContains(t, ac.instanceToNodeGroup, azureRef{Name: "instance-0"})
+		assert.Contains(t, ac.instanceToNodeGroup, azureRef{Name: "instance-1"})
+		assert.NotContains(t, ac.scaleSets, "ss")
+		assert.Contains(t, ac.scaleSets, "ss1")
+		assert.NotContains(t, ac.autoscalingOptions, azureRef{Name: "ss"})
+		assert.Empty(t, ac.pendingEvictions)
+	})
+
+	t.Run("evicted once TTL expires", func(t *testing.T) {
+		ac := newCache(time.Minute)
+		assert.True(t, ac.Unregister(ss))
+		assert.NotContains(t, ac.instanceToNodeGroup, azureRef{Name: "instance-0"})
+		assert.Contains(t, ac.scaleSets, "ss")
+
+		ac.evictExpiredNodeGroupResources(time.Now())
+		assert.Contains(t, ac.scaleSets, "ss")
+
+		ac.evictExpiredNodeGroupResources(time.Now().Add(2 * time.Minute))
+		assert.NotContains(t, ac.scaleSets, "ss")
+		assert.Contains(t, ac.scaleSets, "ss1")
+		assert.Empty(t, ac.pendingEvictions)
+	})
+
+	t.Run("eviction cancelled on re-registration", func(t *testing.T) {
+		ac := newCache(time.Minute)
+		assert.True(t, ac.Unregister(ss))
+		assert.True(t, ac.Register(ss))
+		ac.evictExpiredNodeGroupResources(time.Now().Add(2 * time.Minute))
+		assert.Contains(t, ac.scaleSets, "ss")
+	})
+}
+
+func TestFetchAzureResourcesRegisteredNodeGroupsOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	provider := newTestProvider(t)
+	ac := provider.azureManager.azureCache
+	ac.refreshRegisteredNodeGroupsOnly = true
+	ac.registeredNodeGroups = []cloudprovider.NodeGroup{
+		newTestScaleSet(provider.azureManager, "ss"),
+		newTestScaleSet(provider.azureManager, "gone"),
+	}
+
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "rg", "ss").Return(compute.VirtualMachineScaleSet{Name: to.StringPtr("ss")}, nil)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "rg", "gone").Return(compute.VirtualMachineScaleSet{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+	ac.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	// no List calls are expected on the VM client since no node group is backed by VMs
+	ac.azClient.virtualMachinesClient = mockvmclient.NewMockInterface(ctrl)
+
+	assert.NoError(t, ac.fetchAzureResources())
+	assert.Equal(t, 1, len(ac.scaleSets))
+	assert.Contains(t, ac.scaleSets, "ss")
+	assert.Empty(t, ac.virtualMachines)
+
+	// A scale set failing to be fetched keeps its cached model, without dropping the other scale sets.
+	ac.registeredNodeGroups = append(ac.registeredNodeGroups[:1], newTestScaleSet(provider.azureManager, "new"))
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "rg", "ss").Return(compute.VirtualMachineScaleSet{}, &retry.Error{HTTPStatusCode: http.StatusInternalServerError})
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "rg", "new").Return(compute.VirtualMachineScaleSet{Name: to.StringPtr("new")}, nil)
+	assert.NoError(t, ac.fetchAzureResources())
+	assert.Len(t, ac.scaleSets, 2)
+	assert.Contains(t, ac.scaleSets, "ss")
+	assert.Contains(t, ac.scaleSets, "new")
+}
+
+// fakeNodesNodeGroup is a node group whose Nodes() returns fixed instances or an error.
+type fakeNodesNodeGroup struct {
+	cloudprovider.NodeGroup
+	id        string
+	instances []cloudprovider.Instance
+	err       error
+	calls     *int32
+}
+
+func (ng *fakeNodesNodeGroup) Id() string {
+	return ng.id
+}
+
+func (ng *fakeNodesNodeGroup) Nodes() ([]cloudprovider.Instance, error) {
+	atomic.AddInt32(ng.calls, 1)
+	return ng.instances, ng.err
+}
+
+func TestListNodeGroupInstances(t *testing.T) {
+	var calls int32
+	var nodeGroups []cloudprovider.NodeGroup
+	for i := 0; i < 20; i++ {
+		nodeGroups = append(nodeGroups, &fakeNodesNodeGroup{
+			id:        fmt.Sprintf("ng-%d", i),
+			instances: []cloudprovider.Instance{{Id: fmt.Sprintf("instance-%d", i)}},
+			calls:     &calls,
+		})
+	}
+	cache := &azureCache{nodeGroupRefreshConcurrency: 4}
+
+	instanceGroups, err := cache.listNodeGroupInstances(nodeGroups)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), calls)
+	assert.Len(t, instanceGroups, 20)
+	assert.Equal(t, "ng-7", instanceGroups[azureRef{Name: "instance-7"}].Id())
+
+	calls = 0
+	cache.nodeGroupRefreshConcurrency = 1
+	nodeGroups[0].(*fakeNodesNodeGroup).err = fmt.Errorf("list failed")
+	_, err = cache.listNodeGroupInstances(nodeGroups)
+	assert.EqualError(t, err, "list failed")
+	// Remaining node groups are not listed once a worker failed.
+	assert.Equal(t, int32(1), calls)
+}
+
 func TestFindForInstance(t *testing.T) {
 	provider := newTestProvider(t)
 	ac := provider.azureManager.azureCache
@@ -104,3 +359,44 @@ func TestFindForInstance(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, ac.unownedInstances[inst])
 }
+
+func TestRefreshSKUCache(t *testing.T) {
+	var listed atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		skus := `{"name": "Standard_D2_v3", "resourceType": "virtualMachines", "locations": ["eastus"]}`
+		// The second SKU is enabled in the subscription after the first listing.
+		if listed.Add(1) > 1 {
+			skus += `, {"name": "Standard_D4_v3", "resourceType": "virtualMachines", "locations": ["eastus"]}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"value": [%s]}`, skus)
+	}))
+	defer server.Close()
+
+	skuClient := compute.NewResourceSkusClientWithBaseURI(server.URL, "sub")
+	skuClient.Authorizer = autorest.NullAuthorizer{}
+	cache := &azureCache{
+		azClient:           &azClient{skuClient: skuClient},
+		skuRefreshInterval: 10 * time.Minute,
+	}
+
+	assert.NoError(t, cache.fetchSKUCache("eastus"))
+	_, err := cache.GetSKU(context.Background(), "Standard_D2_v3", "eastus")
+	assert.NoError(t, err)
+	_, err = cache.GetSKU(context.Background(), "Standard_D4_v3", "eastus")
+	assert.Error(t, err)
+
+	now := time.Now()
+	cache.refreshSKUCache("eastus", now)
+	assert.Equal(t, int32(1), listed.Load())
+
+	cache.refreshSKUCache("eastus", now.Add(10*time.Minute))
+	assert.Equal(t, int32(2), listed.Load())
+	_, err = cache.GetSKU(context.Background(), "Standard_D4_v3", "eastus")
+	assert.NoError(t, err)
+
+	// Without a refresh interval, SKUs are only fetched on start.
+	cache.skuRefreshInterval = 0
+	cache.refreshSKUCache("eastus", now.Add(time.Hour))
+	assert.Equal(t, int32(2), listed.Load())
+}
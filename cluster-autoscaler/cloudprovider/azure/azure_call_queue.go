@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sync"
+	"time"
+
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// defaultThrottledBackoff is how long the ARM rate budget is considered constrained after a throttled call
+	// without Retry-After.
+	defaultThrottledBackoff = 30 * time.Second
+	// maxBackgroundCallDeferral bounds how long a background call is deferred, so that caches are still refreshed
+	// under sustained throttling.
+	maxBackgroundCallDeferral = 5 * time.Minute
+
+	callCacheRefresh    = "cache_refresh"
+	callSKURefresh      = "sku_refresh"
+	callInstanceRefresh = "instance_refresh"
+)
+
+// armCallQueue prioritizes ARM calls while the ARM rate budget is constrained, i.e. from a throttled call until
+// the throttling is over. Scale-up and deletion mutations are always issued, while the background calls keeping
+// caches fresh are deferred: their callers keep the cached resources until a later refresh.
+// A nil queue never defers calls.
+type armCallQueue struct {
+	mutex          sync.Mutex
+	throttledUntil time.Time
+	// deferredSince keeps when each deferred background call was first deferred, by call and target.
+	deferredSince map[string]time.Time
+}
+
+func newARMCallQueue() *armCallQueue {
+	return &armCallQueue{deferredSince: make(map[string]time.Time)}
+}
+
+// observe records the outcome of an ARM call, constraining the rate budget if it was throttled.
+func (q *armCallQueue) observe(rerr *retry.Error, now time.Time) {
+	if q == nil || rerr == nil || !isAzureRequestsThrottled(rerr) {
+		return
+	}
+
+	until := rerr.RetryAfter
+	if until.Before(now) {
+		until = now.Add(defaultThrottledBackoff)
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if until.After(q.throttledUntil) {
+		if !q.throttledUntil.After(now) {
+			klog.Warningf("ARM requests are throttled, deferring cache refreshes until %v", until)
+		}
+		q.throttledUntil = until
+	}
+}
+
+// throttledUntilAt returns until when ARM requests are throttled, zero if they never were.
+func (q *armCallQueue) throttledUntilAt() time.Time {
+	if q == nil {
+		return time.Time{}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.throttledUntil
+}
+
+// admitBackground returns whether the background call on target may be issued at now. It is deferred while the
+// ARM rate budget is constrained, for up to maxBackgroundCallDeferral.
+func (q *armCallQueue) admitBackground(call, target string, now time.Time) bool {
+	if q == nil {
+		return true
+	}
+
+	key := call + "/" + target
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if !now.Before(q.throttledUntil) {
+		delete(q.deferredSince, key)
+		return true
+	}
+	since, found := q.deferredSince[key]
+	if !found {
+		q.deferredSince[key] = now
+		since = now
+	}
+	if now.Sub(since) >= maxBackgroundCallDeferral {
+		klog.Warningf("Issuing %s of %s, deferred since %v while ARM requests are throttled", call, target, since)
+		delete(q.deferredSince, key)
+		return true
+	}
+	klog.V(3).Infof("Deferring %s of %s while ARM requests are throttled until %v", call, target, q.throttledUntil)
+	deferredCalls.WithLabelValues(call).Inc()
+	return false
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestARMCallQueue(t *testing.T) {
+	now := time.Now()
+	queue := newARMCallQueue()
+	assert.True(t, queue.admitBackground(callCacheRefresh, "rg", now))
+
+	queue.observe(nil, now)
+	queue.observe(&retry.Error{HTTPStatusCode: http.StatusInternalServerError}, now)
+	assert.True(t, queue.admitBackground(callCacheRefresh, "rg", now))
+
+	queue.observe(&retry.Error{HTTPStatusCode: http.StatusTooManyRequests, RetryAfter: now.Add(time.Hour)}, now)
+	assert.False(t, queue.admitBackground(callCacheRefresh, "rg", now))
+	assert.False(t, queue.admitBackground(callInstanceRefresh, "asg", now.Add(time.Minute)))
+	assert.True(t, queue.admitBackground(callCacheRefresh, "rg", now.Add(maxBackgroundCallDeferral)))
+	assert.False(t, queue.admitBackground(callCacheRefresh, "rg", now.Add(maxBackgroundCallDeferral)))
+	assert.False(t, queue.admitBackground(callInstanceRefresh, "asg", now.Add(maxBackgroundCallDeferral)))
+	assert.True(t, queue.admitBackground(callInstanceRefresh, "asg", now.Add(time.Hour)))
+
+	queue = newARMCallQueue()
+	queue.observe(&retry.Error{HTTPStatusCode: http.StatusTooManyRequests}, now)
+	assert.False(t, queue.admitBackground(callSKURefresh, "eastus", now.Add(defaultThrottledBackoff-time.Second)))
+	assert.True(t, queue.admitBackground(callSKURefresh, "eastus", now.Add(defaultThrottledBackoff)))
+
+	var nilQueue *armCallQueue
+	nilQueue.observe(&retry.Error{HTTPStatusCode: http.StatusTooManyRequests}, now)
+	assert.True(t, nilQueue.admitBackground(callCacheRefresh, "rg", now))
+}
+
+func TestInstanceRefreshDeferredWhenThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.azureCache.callQueue = newARMCallQueue()
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).
+		Return(nil, &retry.Error{HTTPStatusCode: http.StatusTooManyRequests}).Times(1)
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	// The first throttled refresh constrains the rate budget, the next one is deferred without calling ARM.
+	assert.NoError(t, scaleSet.updateInstanceCache())
+	assert.NoError(t, scaleSet.updateInstanceCache())
+}
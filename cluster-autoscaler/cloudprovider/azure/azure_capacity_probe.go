@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultCapacityProbeSize    = 1
+	defaultCapacityProbeTimeout = 30 * time.Second
+	// capacityProbeValidity is how long a successful capacity probe lets large scale-ups skip probing.
+	capacityProbeValidity = 10 * time.Minute
+)
+
+// capacityProbeState tracks the capacity probe of a scale set. The zero value is ready to use.
+type capacityProbeState struct {
+	mutex     sync.Mutex
+	inFlight  bool
+	succeeded time.Time
+}
+
+// CapacityProbeError is returned when probing the capacity of a scale set before a large scale-up
+// detects a stockout. The scale-up is not issued, so that the autoscaler backs off the node group
+// and places the remaining pods on other eligible node groups instead of failing the whole batch.
+type CapacityProbeError struct {
+	ScaleSet string
+	SKU      string
+	Cause    error
+}
+
+func (e *CapacityProbeError) Error() string {
+	return fmt.Sprintf("capacity probe for scale set %s (SKU %s) detected a stockout: %v", e.ScaleSet, e.SKU, e.Cause)
+}
+
+func (e *CapacityProbeError) Unwrap() error {
+	return e.Cause
+}
+
+// probeCapacity grows the scale set vmssInfo from size by a small number of instances and waits for them to be
+// provisioned, to detect capacity stockouts before a large scale-up is issued. The probe is only waited for up to
+// the probe timeout: if it completes later, an error is returned so that the node group is backed off and the rest
+// of the scale-up is placed on other node groups, while the probe is waited for in the background, recording a
+// stockout if it detects one. Once a probe succeeds, large scale-ups skip probing for capacityProbeValidity.
+func (scaleSet *ScaleSet) probeCapacity(vmssInfo compute.VirtualMachineScaleSet, size int64) error {
+	probeSize := scaleSet.manager.config.CapacityProbeSize
+	if probeSize <= 0 {
+		probeSize = defaultCapacityProbeSize
+	}
+	timeout := defaultCapacityProbeTimeout
+	if scaleSet.manager.config.CapacityProbeTimeoutInSeconds > 0 {
+		timeout = time.Duration(scaleSet.manager.config.CapacityProbeTimeoutInSeconds) * time.Second
+	}
+
+	sku := ""
+	if vmssInfo.Sku != nil && vmssInfo.Sku.Name != nil {
+		sku = *vmssInfo.Sku.Name
+	}
+
+	scaleSet.capacityProbe.mutex.Lock()
+	if scaleSet.capacityProbe.inFlight {
+		scaleSet.capacityProbe.mutex.Unlock()
+		return fmt.Errorf("capacity probe of scale set %s is in progress, skipping large scale-up", scaleSet.Name)
+	}
+	if time.Since(scaleSet.capacityProbe.succeeded) < capacityProbeValidity {
+		scaleSet.capacityProbe.mutex.Unlock()
+		klog.V(3).Infof("Capacity of scale set %s was probed successfully at %v, skipping probe", scaleSet.Name, scaleSet.capacityProbe.succeeded)
+		return nil
+	}
+	scaleSet.capacityProbe.inFlight = true
+	scaleSet.capacityProbe.mutex.Unlock()
+	started := false
+	defer func() {
+		if !started {
+			scaleSet.capacityProbe.mutex.Lock()
+			scaleSet.capacityProbe.inFlight = false
+			scaleSet.capacityProbe.mutex.Unlock()
+		}
+	}()
+
+	if scaleSet.manager.dryRun(operationUpdateCapacity, scaleSet.Name, "probe capacity with %d instance(s)", probeSize) {
+		return nil
+	}
+	klog.V(2).Infof("Probing capacity of scale set %s with %d instance(s) before scaling up", scaleSet.Name, probeSize)
+	done, err := scaleSet.manager.operations.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: scaleSet.Name, TargetSize: size + int64(probeSize)})
+	if err != nil {
+		return err
+	}
+	future, err := scaleSet.updateCapacityAsync(&vmssInfo, size+int64(probeSize))
+	scaleSet.manager.recordMutation(operationUpdateCapacity, scaleSet.Name, err, "probe capacity with %d instance(s)", probeSize)
+	if err != nil {
+		done()
+		return err
+	}
+
+	started = true
+	result := make(chan error, 1)
+	go func() {
+		defer done()
+		result <- scaleSet.waitForCapacityProbe(future, sku)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		klog.Warningf("Capacity probe of scale set %s did not complete within %v, backing off the rest of the scale-up", scaleSet.Name, timeout)
+		return fmt.Errorf("capacity probe of scale set %s did not complete within %v, only %d instance(s) were added", scaleSet.Name, timeout, probeSize)
+	}
+}
+
+// waitForCapacityProbe waits for the outcome of the capacity probe and records it.
+func (scaleSet *ScaleSet) waitForCapacityProbe(future *azure.Future, sku string) error {
+	ctx, cancel := getContextWithTimeout(asyncContextTimeout)
+	defer cancel()
+	httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForCreateOrUpdateResult(ctx, future, scaleSet.resourceGroupName())
+	isSuccess, err := isSuccessHTTPResponse(httpResponse, err)
+	scaleSet.invalidateInstanceCache()
+
+	scaleSet.capacityProbe.mutex.Lock()
+	scaleSet.capacityProbe.inFlight = false
+	if isSuccess {
+		scaleSet.capacityProbe.succeeded = time.Now()
+	}
+	scaleSet.capacityProbe.mutex.Unlock()
+	if isSuccess {
+		klog.V(3).Infof("Capacity probe of scale set %s succeeded", scaleSet.Name)
+		return nil
+	}
+
+	// Invalidate the VMSS size cache in order to fetch the size from the API.
+	scaleSet.invalidateLastSizeRefreshWithLock()
+	scaleSet.manager.invalidateCache()
+	if isOutOfResourcesError(err) {
+		capacityProbeStockouts.WithLabelValues(sku).Inc()
+		scaleSet.manager.recordStockout(scaleSet.Name, err)
+		klog.Warningf("Capacity probe of scale set %s detected a stockout: %v", scaleSet.Name, err)
+		return &CapacityProbeError{ScaleSet: scaleSet.Name, SKU: sku, Cause: err}
+	}
+	klog.Errorf("Capacity probe of scale set %s failed: %v", scaleSet.Name, err)
+	return err
+}
+
+// isOutOfResourcesError returns true if the ARM error code of err is one of the out of resources error codes.
+func isOutOfResourcesError(err error) bool {
+	return err != nil && outOfResourcesErrorCodes[errorCode(err)]
+}
@@ -33,10 +33,12 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/resourcehealth/mgmt/2020-05-01/resourcehealth"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 
+	"k8s.io/client-go/util/flowcontrol"
 	klog "k8s.io/klog/v2"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/deploymentclient"
@@ -100,7 +102,9 @@ func getAgentpoolClientCredentials(cfg *Config) (azcore.TokenCredential, error)
 		// Use Service Principal with ClientID and ClientSecret
 		if cfg.AADClientID != "" && cfg.AADClientSecret != "" {
 			klog.V(2).Infoln("Agentpool client: using client_id+client_secret to retrieve access token")
-			return azidentity.NewClientSecretCredential(cfg.TenantID, cfg.AADClientID, cfg.AADClientSecret, nil)
+			return azidentity.NewClientSecretCredential(cfg.TenantID, cfg.AADClientID, cfg.AADClientSecret, &azidentity.ClientSecretCredentialOptions{
+				AdditionallyAllowedTenants: cfg.AuxiliaryTenantIDs,
+			})
 		}
 
 		// Use Service Principal with ClientCert and AADClientCertPassword
@@ -115,7 +119,8 @@ func getAgentpoolClientCredentials(cfg *Config) (azcore.TokenCredential, error)
 				return nil, fmt.Errorf("parsing service principal certificate data failed with error: %w", err)
 			}
 			return azidentity.NewClientCertificateCredential(cfg.TenantID, cfg.AADClientID, certs, privateKey, &azidentity.ClientCertificateCredentialOptions{
-				SendCertificateChain: true,
+				AdditionallyAllowedTenants: cfg.AuxiliaryTenantIDs,
+				SendCertificateChain:       true,
 			})
 		}
 	}
@@ -150,17 +155,19 @@ func newAgentpoolClient(cfg *Config) (AgentPoolsClient, error) {
 
 	if cfg.ARMBaseURLForAPClient != "" {
 		klog.V(10).Infof("Using ARMBaseURLForAPClient to create agent pool client")
-		return newAgentpoolClientWithConfig(cfg.SubscriptionID, cred, cfg.ARMBaseURLForAPClient, env.TokenAudience, retryOptions, true /*insecureAllowCredentialWithHTTP*/)
+		return newAgentpoolClientWithConfig(cfg.SubscriptionID, cred, cfg.ARMBaseURLForAPClient, env.TokenAudience, cfg.ContainerServiceAPIVersion, cfg.AuxiliaryTenantIDs, retryOptions, true /*insecureAllowCredentialWithHTTP*/)
 	}
 
-	return newAgentpoolClientWithConfig(cfg.SubscriptionID, cred, env.ResourceManagerEndpoint, env.TokenAudience, retryOptions, false /*insecureAllowCredentialWithHTTP*/)
+	return newAgentpoolClientWithConfig(cfg.SubscriptionID, cred, env.ResourceManagerEndpoint, env.TokenAudience, cfg.ContainerServiceAPIVersion, cfg.AuxiliaryTenantIDs, retryOptions, false /*insecureAllowCredentialWithHTTP*/)
 }
 
 func newAgentpoolClientWithConfig(subscriptionID string, cred azcore.TokenCredential,
-	cloudCfgEndpoint, cloudCfgAudience string, retryOptions azurecore_policy.RetryOptions, insecureAllowCredentialWithHTTP bool) (AgentPoolsClient, error) {
+	cloudCfgEndpoint, cloudCfgAudience, apiVersion string, auxiliaryTenants []string, retryOptions azurecore_policy.RetryOptions, insecureAllowCredentialWithHTTP bool) (AgentPoolsClient, error) {
 	agentPoolsClient, err := armcontainerservice.NewAgentPoolsClient(subscriptionID, cred,
 		&policy.ClientOptions{
+			AuxiliaryTenants: auxiliaryTenants,
 			ClientOptions: azurecore_policy.ClientOptions{
+				APIVersion: apiVersion,
 				Cloud: cloud.Configuration{
 					Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
 						cloud.ResourceManager: {
@@ -181,6 +188,7 @@ func newAgentpoolClientWithConfig(subscriptionID string, cred azcore.TokenCreden
 	}
 
 	klog.V(10).Infof("Successfully created agent pool client with ARMBaseURL")
+	recordAPIVersion(containerServiceClientName, apiVersion)
 	return agentPoolsClient, nil
 }
 
@@ -193,7 +201,19 @@ type azClient struct {
 	disksClient                     diskclient.Interface
 	storageAccountsClient           storageaccountclient.Interface
 	skuClient                       compute.ResourceSkusClient
+	usagesClient                    UsagesClient
 	agentPoolClient                 AgentPoolsClient
+	scaleSetRestartClient           ScaleSetRestartClient
+	resourceHealthClient            ResourceHealthClient
+	virtualMachinePagesClient       VirtualMachinePagesClient
+	// virtualMachinePagesRateLimiter limits the requests of virtualMachinePagesClient, page by page, like the
+	// reads of virtualMachinesClient.
+	virtualMachinePagesRateLimiter flowcontrol.RateLimiter
+	// usagesRateLimiter limits the requests of usagesClient with the default read rate limit.
+	usagesRateLimiter flowcontrol.RateLimiter
+	// scaleSetRestartRateLimiter limits the requests of scaleSetRestartClient, like the writes of
+	// virtualMachineScaleSetsClient.
+	scaleSetRestartRateLimiter flowcontrol.RateLimiter
 }
 
 func newAuthorizer(config *Config, env *azure.Environment) (autorest.Authorizer, error) {
@@ -201,6 +221,9 @@ func newAuthorizer(config *Config, env *azure.Environment) (autorest.Authorizer,
 	case authMethodCLI:
 		return auth.NewAuthorizerFromCLI()
 	case "", authMethodPrincipal:
+		if len(config.AuxiliaryTenantIDs) > 0 {
+			return newMultiTenantAuthorizer(config, env)
+		}
 		token, err := providerazureconfig.GetServicePrincipalToken(&config.AzureAuthConfig, env, "")
 		if err != nil {
 			return nil, fmt.Errorf("retrieve service principal token: %v", err)
@@ -220,15 +243,20 @@ func newAzClient(cfg *Config, env *azure.Environment) (*azClient, error) {
 	azClientConfig := cfg.getAzureClientConfig(authorizer, env)
 	azClientConfig.UserAgent = getUserAgentExtension()
 
-	vmssClientConfig := azClientConfig.WithRateLimiter(cfg.VirtualMachineScaleSetRateLimit)
+	// Compute clients share a config whose authorizer pins the configured API version, if any.
+	computeClientConfig := *azClientConfig
+	computeClientConfig.Authorizer = withAPIVersion(authorizer, cfg.ComputeAPIVersion)
+	recordAPIVersion(computeClientName, cfg.ComputeAPIVersion)
+
+	vmssClientConfig := computeClientConfig.WithRateLimiter(cfg.VirtualMachineScaleSetRateLimit)
 	scaleSetsClient := vmssclient.New(vmssClientConfig)
 	klog.V(5).Infof("Created scale set client with authorizer: %v", scaleSetsClient)
 
-	vmssVMClientConfig := azClientConfig.WithRateLimiter(cfg.VirtualMachineScaleSetRateLimit)
+	vmssVMClientConfig := computeClientConfig.WithRateLimiter(cfg.VirtualMachineScaleSetRateLimit)
 	scaleSetVMsClient := vmssvmclient.New(vmssVMClientConfig)
 	klog.V(5).Infof("Created scale set vm client with authorizer: %v", scaleSetVMsClient)
 
-	vmClientConfig := azClientConfig.WithRateLimiter(cfg.VirtualMachineRateLimit)
+	vmClientConfig := computeClientConfig.WithRateLimiter(cfg.VirtualMachineRateLimit)
 	virtualMachinesClient := vmclient.New(vmClientConfig)
 	klog.V(5).Infof("Created vm client with authorizer: %v", virtualMachinesClient)
 
@@ -255,6 +283,38 @@ func newAzClient(cfg *Config, env *azure.Environment) (*azClient, error) {
 	skuClient.UserAgent = azClientConfig.UserAgent
 	klog.V(5).Infof("Created sku client with authorizer: %v", skuClient)
 
+	restartClient := compute.NewVirtualMachineScaleSetsClientWithBaseURI(azClientConfig.ResourceManagerEndpoint, cfg.SubscriptionID)
+	restartClient.Authorizer = computeClientConfig.Authorizer
+	restartClient.UserAgent = azClientConfig.UserAgent
+	klog.V(5).Infof("Created scale set restart client with authorizer: %v", restartClient)
+
+	var usagesClient UsagesClient
+	if cfg.EnableQuotaMetrics {
+		client := compute.NewUsageClientWithBaseURI(azClientConfig.ResourceManagerEndpoint, cfg.SubscriptionID)
+		client.Authorizer = computeClientConfig.Authorizer
+		client.UserAgent = azClientConfig.UserAgent
+		usagesClient = client
+		klog.V(5).Infof("Created usages client with authorizer: %v", client)
+	}
+
+	var resourceHealthClient ResourceHealthClient
+	if cfg.EnableResourceHealth {
+		client := resourcehealth.NewAvailabilityStatusesClientWithBaseURI(azClientConfig.ResourceManagerEndpoint, cfg.SubscriptionID)
+		client.Authorizer = azClientConfig.Authorizer
+		client.UserAgent = azClientConfig.UserAgent
+		resourceHealthClient = client
+		klog.V(5).Infof("Created resource health client with authorizer: %v", client)
+	}
+
+	var virtualMachinePagesClient VirtualMachinePagesClient
+	if cfg.StreamVirtualMachineList {
+		client := compute.NewVirtualMachinesClientWithBaseURI(azClientConfig.ResourceManagerEndpoint, cfg.SubscriptionID)
+		client.Authorizer = computeClientConfig.Authorizer
+		client.UserAgent = azClientConfig.UserAgent
+		virtualMachinePagesClient = client
+		klog.V(5).Infof("Created vm pages client with authorizer: %v", client)
+	}
+
 	agentPoolClient, err := newAgentpoolClient(cfg)
 	if err != nil {
 		klog.Errorf("newAgentpoolClient failed with error: %s", err)
@@ -273,6 +333,13 @@ func newAzClient(cfg *Config, env *azure.Environment) (*azClient, error) {
 		virtualMachinesClient:           virtualMachinesClient,
 		storageAccountsClient:           storageAccountsClient,
 		skuClient:                       skuClient,
+		usagesClient:                    usagesClient,
+		usagesRateLimiter:               newUsagesRateLimiter(cfg),
 		agentPoolClient:                 agentPoolClient,
+		scaleSetRestartClient:           scaleSetRestartClient{client: restartClient},
+		resourceHealthClient:            resourceHealthClient,
+		virtualMachinePagesClient:       virtualMachinePagesClient,
+		virtualMachinePagesRateLimiter:  newVirtualMachinePagesRateLimiter(cfg),
+		scaleSetRestartRateLimiter:      newScaleSetRestartRateLimiter(cfg),
 	}, nil
 }
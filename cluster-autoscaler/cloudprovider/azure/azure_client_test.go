@@ -17,9 +17,11 @@ limitations under the License.
 package azure
 
 import (
+	"net/http"
 	"os"
 	"testing"
 
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/stretchr/testify/assert"
@@ -88,3 +90,39 @@ func TestGetServicePrincipalTokenFromCertificateWithoutPassword(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, token.Token(), spt.Token())
 }
+
+func TestWithAPIVersion(t *testing.T) {
+	authorizer := autorest.NewAPIKeyAuthorizerWithHeaders(map[string]interface{}{"x-test": "value"})
+	assert.Equal(t, authorizer, withAPIVersion(authorizer, ""))
+
+	pinned := withAPIVersion(authorizer, "2023-09-01")
+	req, err := autorest.Prepare(&http.Request{},
+		autorest.WithBaseURL("https://management.azure.com"),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": "2022-03-01", "$filter": "x"}),
+		pinned.WithAuthorization())
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-09-01", req.URL.Query().Get("api-version"))
+	assert.Equal(t, "x", req.URL.Query().Get("$filter"))
+	assert.Equal(t, "value", req.Header.Get("x-test"))
+}
+
+func TestNewAuthorizerWithAuxiliaryTenants(t *testing.T) {
+	cfg := &Config{}
+	cfg.TenantID = "tenant"
+	cfg.AADClientID = "client"
+	cfg.AADClientSecret = "secret"
+	env := &azure.PublicCloud
+
+	authorizer, err := newAuthorizer(cfg, env)
+	assert.NoError(t, err)
+	assert.IsType(t, &autorest.BearerAuthorizer{}, authorizer)
+
+	cfg.AuxiliaryTenantIDs = []string{"other-tenant"}
+	authorizer, err = newAuthorizer(cfg, env)
+	assert.NoError(t, err)
+	assert.IsType(t, &autorest.MultiTenantBearerAuthorizer{}, authorizer)
+
+	cfg.AADClientSecret = ""
+	_, err = newAuthorizer(cfg, env)
+	assert.Error(t, err)
+}
@@ -28,6 +28,7 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
 	klog "k8s.io/klog/v2"
 )
 
@@ -148,7 +149,7 @@ func (azure *AzureCloudProvider) HasInstance(node *apiv1.Node) (bool, error) {
 
 // Pricing returns pricing model for this cloud provider or error if not available.
 func (azure *AzureCloudProvider) Pricing() (cloudprovider.PricingModel, errors.AutoscalerError) {
-	return nil, cloudprovider.ErrNotImplemented
+	return &AzurePriceModel{}, nil
 }
 
 // GetAvailableMachineTypes get all machine types that can be requested from the cloud provider.
@@ -191,6 +192,10 @@ func (m *azureRef) String() string {
 
 // BuildAzure builds Azure cloud provider, manager etc.
 func BuildAzure(opts config.AutoscalingOptions, do cloudprovider.NodeGroupDiscoveryOptions, rl *cloudprovider.ResourceLimiter) cloudprovider.CloudProvider {
+	// Register Azure API usage metrics first: the metrics written while the manager is created, e.g. the
+	// API versions of the clients, would be dropped otherwise.
+	RegisterMetrics()
+
 	var config io.ReadCloser
 	if opts.CloudConfig != "" {
 		klog.Infof("Creating Azure Manager using cloud-config file: %v", opts.CloudConfig)
@@ -203,10 +208,14 @@ func BuildAzure(opts config.AutoscalingOptions, do cloudprovider.NodeGroupDiscov
 	} else {
 		klog.Info("Creating Azure Manager with default configuration.")
 	}
-	manager, err := CreateAzureManager(config, do)
+	manager, err := CreateAzureManagerWithOverrides(config, do, opts.AzureOptions.ConfigOverrides)
 	if err != nil {
 		klog.Fatalf("Failed to create Azure Manager: %v", err)
 	}
+	if manager.config.StateConfigMapName != "" {
+		kubeClient := kube_util.CreateKubeClient(opts.KubeClientOpts)
+		manager.initState(kubeClient, kube_util.CreateEventRecorder(kubeClient, opts.RecordDuplicatedEvents), opts.ConfigNamespace)
+	}
 	provider, err := BuildAzureCloudProvider(manager, rl)
 	if err != nil {
 		klog.Fatalf("Failed to create Azure cloud provider: %v", err)
@@ -22,13 +22,14 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
 	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
@@ -103,6 +104,130 @@ type Config struct {
 
 	// EnableFastDeleteOnFailedProvisioning defines whether to delete the experimental faster VMSS instance deletion on failed provisioning
 	EnableFastDeleteOnFailedProvisioning bool `json:"enableFastDeleteOnFailedProvisioning,omitempty" yaml:"enableFastDeleteOnFailedProvisioning,omitempty"`
+
+	// UnregisteredNodeGroupCacheTTLInSeconds defines how long cached Azure resources of an unregistered node group are kept
+	// before being evicted. 0 (default) evicts them immediately on unregistration.
+	UnregisteredNodeGroupCacheTTLInSeconds int `json:"unregisteredNodeGroupCacheTTLInSeconds,omitempty" yaml:"unregisteredNodeGroupCacheTTLInSeconds,omitempty"`
+
+	// RefreshRegisteredNodeGroupsOnly limits cache refreshes to the Azure resources backing registered node groups,
+	// fetching scale sets one by one instead of listing the whole resource group. Not supported with node group autodiscovery.
+	RefreshRegisteredNodeGroupsOnly bool `json:"refreshRegisteredNodeGroupsOnly,omitempty" yaml:"refreshRegisteredNodeGroupsOnly,omitempty"`
+
+	// CapacityProbeThreshold is the scale-up size from which the capacity of a scale set is probed first,
+	// by adding CapacityProbeSize instances and waiting for them. 0 (default) disables probing.
+	CapacityProbeThreshold int `json:"capacityProbeThreshold,omitempty" yaml:"capacityProbeThreshold,omitempty"`
+	// CapacityProbeSize is the number of instances added to probe capacity, defaults to 1.
+	CapacityProbeSize int `json:"capacityProbeSize,omitempty" yaml:"capacityProbeSize,omitempty"`
+	// CapacityProbeTimeoutInSeconds bounds how long a scale-up waits for its capacity probe, defaults to 30.
+	CapacityProbeTimeoutInSeconds int `json:"capacityProbeTimeoutInSeconds,omitempty" yaml:"capacityProbeTimeoutInSeconds,omitempty"`
+
+	// ComputeAPIVersion pins the ARM API version used by the VMSS, VMSS VM and VM clients.
+	// Empty (default) uses the version built into the SDK.
+	ComputeAPIVersion string `json:"computeAPIVersion,omitempty" yaml:"computeAPIVersion,omitempty"`
+	// ContainerServiceAPIVersion pins the ARM API version used by the agent pool client.
+	// Empty (default) uses the version built into the SDK.
+	ContainerServiceAPIVersion string `json:"containerServiceAPIVersion,omitempty" yaml:"containerServiceAPIVersion,omitempty"`
+
+	// PreDeleteHookURL is an endpoint notified before instances are deleted, empty (default) disables the hook.
+	PreDeleteHookURL string `json:"preDeleteHookURL,omitempty" yaml:"preDeleteHookURL,omitempty"`
+	// PreDeleteHookTimeoutInSeconds bounds how long the pre-delete hook is waited for, defaults to 30.
+	PreDeleteHookTimeoutInSeconds int `json:"preDeleteHookTimeoutInSeconds,omitempty" yaml:"preDeleteHookTimeoutInSeconds,omitempty"`
+	// PreDeleteHookFailurePolicy is either Ignore (default) or Fail, the latter aborting deletions on hook failures.
+	PreDeleteHookFailurePolicy string `json:"preDeleteHookFailurePolicy,omitempty" yaml:"preDeleteHookFailurePolicy,omitempty"`
+
+	// NodeGroupRefreshConcurrency bounds how many node groups list their instances concurrently on cache refresh, defaults to 8.
+	NodeGroupRefreshConcurrency int `json:"nodeGroupRefreshConcurrency,omitempty" yaml:"nodeGroupRefreshConcurrency,omitempty"`
+
+	// EnableQuotaMetrics exports the vCPU family quota consumed and limit of node groups on every cache refresh.
+	// Requires EnableDynamicInstanceList to resolve the SKU family of node groups.
+	EnableQuotaMetrics bool `json:"enableQuotaMetrics,omitempty" yaml:"enableQuotaMetrics,omitempty"`
+
+	// AuxiliaryTenantIDs lists other AAD tenants holding resources referenced by node groups, e.g. shared image
+	// galleries or scale sets delegated through Lighthouse. Requests carry auxiliary tokens for these tenants.
+	// Requires service principal authentication with a client secret or certificate.
+	AuxiliaryTenantIDs []string `json:"auxiliaryTenantIDs,omitempty" yaml:"auxiliaryTenantIDs,omitempty"`
+
+	// ResourceCacheServiceAddress is the address of a resource cache service (see ResourceCacheServer) to fetch
+	// scale sets, VMs and VMs pools from, instead of listing them from ARM. ARM is listed if the service fails.
+	ResourceCacheServiceAddress string `json:"resourceCacheServiceAddress,omitempty" yaml:"resourceCacheServiceAddress,omitempty"`
+
+	// StandbyCacheRefreshIntervalInSeconds, if set, makes replicas waiting for leadership list Azure resources
+	// at this interval, so that they start from a warm cache when elected. Disabled when 0.
+	StandbyCacheRefreshIntervalInSeconds int `json:"standbyCacheRefreshIntervalInSeconds,omitempty" yaml:"standbyCacheRefreshIntervalInSeconds,omitempty"`
+
+	// SKUCacheRefreshIntervalInSeconds, if set, refetches the VM SKU cache at this interval when EnableDynamicInstanceList is set,
+	// so that SKUs newly enabled in the subscription are picked up. By default, SKUs are only fetched on start.
+	SKUCacheRefreshIntervalInSeconds int `json:"skuCacheRefreshIntervalInSeconds,omitempty" yaml:"skuCacheRefreshIntervalInSeconds,omitempty"`
+
+	// NetworkPlugin (kubenet, azure or none) and NetworkPluginMode (overlay) of the cluster determine the default
+	// max pods of template nodes, for node groups which don't set theirs.
+	NetworkPlugin     string `json:"networkPlugin,omitempty" yaml:"networkPlugin,omitempty"`
+	NetworkPluginMode string `json:"networkPluginMode,omitempty" yaml:"networkPluginMode,omitempty"`
+
+	// ShutdownOperationTimeoutInSeconds bounds how long in-flight scale set updates and deletions are waited for on shutdown.
+	ShutdownOperationTimeoutInSeconds int `json:"shutdownOperationTimeoutInSeconds,omitempty" yaml:"shutdownOperationTimeoutInSeconds,omitempty"`
+
+	// StateConfigMapName, if set, is the ConfigMap of the cluster-autoscaler namespace where the provider persists
+	// its state across restarts, like the operations left unfinished on shutdown.
+	StateConfigMapName string `json:"stateConfigMapName,omitempty" yaml:"stateConfigMapName,omitempty"`
+
+	// LifecycleEventWebhookURL, if set, is the URL where the lifecycle events of scale set instances are posted.
+	LifecycleEventWebhookURL string `json:"lifecycleEventWebhookURL,omitempty" yaml:"lifecycleEventWebhookURL,omitempty"`
+
+	// InstanceMatchingStrategy is how the node group of an instance is resolved: exact (default), prefix or providerID.
+	// prefix and providerID resolve most scale set instances without waiting for the node groups to list them,
+	// and are only supported for vmType vmss.
+	InstanceMatchingStrategy string `json:"instanceMatchingStrategy,omitempty" yaml:"instanceMatchingStrategy,omitempty"`
+
+	// DryRun, if true, logs and counts the mutating operations (capacity updates, instance deletions and agent pool
+	// changes) instead of executing them, while reads behave normally.
+	DryRun bool `json:"dryRun,omitempty" yaml:"dryRun,omitempty"`
+
+	// BackPressureLatencyThresholdInSeconds and BackPressureErrorRateThreshold are the cache refresh latency and
+	// the rate of failed refreshes above which ARM is reported as degraded, and the autoscaler loop backs off.
+	// Default to 60 seconds and 0.5.
+	BackPressureLatencyThresholdInSeconds int     `json:"backPressureLatencyThresholdInSeconds,omitempty" yaml:"backPressureLatencyThresholdInSeconds,omitempty"`
+	BackPressureErrorRateThreshold        float64 `json:"backPressureErrorRateThreshold,omitempty" yaml:"backPressureErrorRateThreshold,omitempty"`
+
+	// PropagatedTags are tags, like a cost center, owner or expiry, which the scale sets managed by the autoscaler
+	// must carry. They are restored when removed out of band, and set on the VMs created by standard agent pools.
+	PropagatedTags map[string]string `json:"propagatedTags,omitempty" yaml:"propagatedTags,omitempty"`
+
+	// CostCeilingPerHour is the estimated hourly cost of the managed node groups, in the normalized prices of the
+	// pricing model, above which scale-ups are refused, unless the scale set is tagged to override it. Disabled if 0.
+	// CostCeilingWarnOnly only logs the scale-ups exceeding the ceiling instead.
+	CostCeilingPerHour  float64 `json:"costCeilingPerHour,omitempty" yaml:"costCeilingPerHour,omitempty"`
+	CostCeilingWarnOnly bool    `json:"costCeilingWarnOnly,omitempty" yaml:"costCeilingWarnOnly,omitempty"`
+
+	// EnableResourceHealth queries Resource Health for the managed scale sets, and lowers the health score of the
+	// scale sets affected by platform issues.
+	EnableResourceHealth bool `json:"enableResourceHealth,omitempty" yaml:"enableResourceHealth,omitempty"`
+
+	// DecisionReportAddress, if set, is the address where the reports of what the provider saw and did in the last
+	// loops are served, e.g. localhost:8086. DecisionReportFile, if set, is the file where they are written.
+	DecisionReportAddress string `json:"decisionReportAddress,omitempty" yaml:"decisionReportAddress,omitempty"`
+	DecisionReportFile    string `json:"decisionReportFile,omitempty" yaml:"decisionReportFile,omitempty"`
+
+	// AgentPoolNameTagKeys are tag keys holding the agent pool name of VMs, checked in order when VMs have neither
+	// the aks-managed-poolName nor the poolName tag. AgentPoolNamePatterns are regular expressions matching the names
+	// of VMs still untagged, whose first capture group is the agent pool name. They map the VMs of clusters migrating
+	// between tagging schemes.
+	AgentPoolNameTagKeys  []string `json:"agentPoolNameTagKeys,omitempty" yaml:"agentPoolNameTagKeys,omitempty"`
+	AgentPoolNamePatterns []string `json:"agentPoolNamePatterns,omitempty" yaml:"agentPoolNamePatterns,omitempty"`
+
+	// InstanceFilters are the filters, run in order, omitting instances which can't belong to any node group before
+	// looking up their node group. Defaults to standaloneVMs for vmType vmss, and vmResourceID for vmType standard.
+	InstanceFilters []string `json:"instanceFilters,omitempty" yaml:"instanceFilters,omitempty"`
+
+	// StreamVirtualMachineList lists the VMs of the resource group page by page, keeping only the VMs of agent pools,
+	// or of registered node groups with RefreshRegisteredNodeGroupsOnly, and stopping once the registered agent pools
+	// are populated. It bounds the memory used by resource groups with tens of thousands of VMs.
+	StreamVirtualMachineList bool `json:"streamVirtualMachineList,omitempty" yaml:"streamVirtualMachineList,omitempty"`
+
+	// PlacementLabelPrefix is the prefix of the labels of template nodes naming their proximity placement group,
+	// dedicated host group and capacity reservation group, e.g. example.com/. Defaults to
+	// placement.cluster-autoscaler.azure/.
+	PlacementLabelPrefix string `json:"placementLabelPrefix,omitempty" yaml:"placementLabelPrefix,omitempty"`
 }
 
 // These are only here for backward compabitility. Their equivalent exists in providerazure.Config with a different name.
@@ -117,12 +242,11 @@ type legacyConfig struct {
 	EnableVmssFlex *bool `json:"enableVmssFlex,omitempty" yaml:"enableVmssFlex,omitempty"`
 }
 
-// BuildAzureConfig returns a Config object for the Azure clients
-func BuildAzureConfig(configReader io.Reader) (*Config, error) {
-	var err error
+// NewDefaultConfig returns a Config holding the static defaults, which programmatic callers of
+// NewAzureCloudProvider are expected to start from. BuildAzureConfigWithOverrides applies the config file,
+// the environment and the command-line overrides on top of it.
+func NewDefaultConfig() *Config {
 	cfg := &Config{}
-
-	// Static defaults
 	cfg.EnableDynamicInstanceList = false
 	cfg.EnableVmssFlexNodes = false
 	cfg.EnableVMsAgentPool = false
@@ -133,6 +257,20 @@ func BuildAzureConfig(configReader io.Reader) (*Config, error) {
 	cfg.VMType = providerazureconsts.VMTypeVMSS
 	cfg.MaxDeploymentsCount = int64(defaultMaxDeploymentsCount)
 	cfg.StrictCacheUpdates = false
+	cfg.PlacementLabelPrefix = defaultPlacementLabelPrefix
+	return cfg
+}
+
+// BuildAzureConfig returns a Config object for the Azure clients.
+func BuildAzureConfig(configReader io.Reader) (*Config, error) {
+	return BuildAzureConfigWithOverrides(configReader, nil)
+}
+
+// BuildAzureConfigWithOverrides returns a Config object for the Azure clients.
+// configOverrides are key=value pairs (keyed by the JSON field name) applied on top of the config file and the environment.
+func BuildAzureConfigWithOverrides(configReader io.Reader, configOverrides []string) (*Config, error) {
+	var err error
+	cfg := NewDefaultConfig()
 
 	// Config file overrides defaults
 	if configReader != nil {
@@ -308,7 +446,147 @@ func BuildAzureConfig(configReader io.Reader) (*Config, error) {
 	if _, err = assignBoolFromEnvIfExists(&cfg.EnableFastDeleteOnFailedProvisioning, "AZURE_ENABLE_FAST_DELETE_ON_FAILED_PROVISIONING"); err != nil {
 		return nil, err
 	}
+	if _, err = assignIntFromEnvIfExists(&cfg.UnregisteredNodeGroupCacheTTLInSeconds, "AZURE_UNREGISTERED_NODE_GROUP_CACHE_TTL_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignBoolFromEnvIfExists(&cfg.RefreshRegisteredNodeGroupsOnly, "AZURE_REFRESH_REGISTERED_NODE_GROUPS_ONLY"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.CapacityProbeThreshold, "AZURE_CAPACITY_PROBE_THRESHOLD"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.CapacityProbeSize, "AZURE_CAPACITY_PROBE_SIZE"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.CapacityProbeTimeoutInSeconds, "AZURE_CAPACITY_PROBE_TIMEOUT_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.ComputeAPIVersion, "AZURE_COMPUTE_API_VERSION"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.ContainerServiceAPIVersion, "AZURE_CONTAINER_SERVICE_API_VERSION"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.PreDeleteHookURL, "AZURE_PRE_DELETE_HOOK_URL"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.PreDeleteHookTimeoutInSeconds, "AZURE_PRE_DELETE_HOOK_TIMEOUT_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.PreDeleteHookFailurePolicy, "AZURE_PRE_DELETE_HOOK_FAILURE_POLICY"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.NodeGroupRefreshConcurrency, "AZURE_NODE_GROUP_REFRESH_CONCURRENCY"); err != nil {
+		return nil, err
+	}
+	if _, err = assignBoolFromEnvIfExists(&cfg.EnableQuotaMetrics, "AZURE_ENABLE_QUOTA_METRICS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.ResourceCacheServiceAddress, "AZURE_RESOURCE_CACHE_SERVICE_ADDRESS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.StandbyCacheRefreshIntervalInSeconds, "AZURE_STANDBY_CACHE_REFRESH_INTERVAL_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.SKUCacheRefreshIntervalInSeconds, "AZURE_SKU_CACHE_REFRESH_INTERVAL_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.NetworkPlugin, "AZURE_NETWORK_PLUGIN"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.NetworkPluginMode, "AZURE_NETWORK_PLUGIN_MODE"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.ShutdownOperationTimeoutInSeconds, "AZURE_SHUTDOWN_OPERATION_TIMEOUT_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.StateConfigMapName, "AZURE_STATE_CONFIGMAP_NAME"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.LifecycleEventWebhookURL, "AZURE_LIFECYCLE_EVENT_WEBHOOK_URL"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.InstanceMatchingStrategy, "AZURE_INSTANCE_MATCHING_STRATEGY"); err != nil {
+		return nil, err
+	}
+	if _, err = assignBoolFromEnvIfExists(&cfg.DryRun, "AZURE_DRY_RUN"); err != nil {
+		return nil, err
+	}
+	if _, err = assignIntFromEnvIfExists(&cfg.BackPressureLatencyThresholdInSeconds, "AZURE_BACK_PRESSURE_LATENCY_THRESHOLD_IN_SECONDS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFloat64FromEnvIfExists(&cfg.BackPressureErrorRateThreshold, "AZURE_BACK_PRESSURE_ERROR_RATE_THRESHOLD"); err != nil {
+		return nil, err
+	}
+	if propagatedTags := os.Getenv("AZURE_PROPAGATED_TAGS"); propagatedTags != "" {
+		if cfg.PropagatedTags, err = parsePropagatedTags(propagatedTags); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = assignFloat64FromEnvIfExists(&cfg.CostCeilingPerHour, "AZURE_COST_CEILING_PER_HOUR"); err != nil {
+		return nil, err
+	}
+	if _, err = assignBoolFromEnvIfExists(&cfg.CostCeilingWarnOnly, "AZURE_COST_CEILING_WARN_ONLY"); err != nil {
+		return nil, err
+	}
+	if _, err = assignBoolFromEnvIfExists(&cfg.EnableResourceHealth, "AZURE_ENABLE_RESOURCE_HEALTH"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.DecisionReportAddress, "AZURE_DECISION_REPORT_ADDRESS"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.DecisionReportFile, "AZURE_DECISION_REPORT_FILE"); err != nil {
+		return nil, err
+	}
+	if tagKeys := os.Getenv("AZURE_AGENTPOOL_NAME_TAG_KEYS"); tagKeys != "" {
+		cfg.AgentPoolNameTagKeys = nil
+		for _, key := range strings.Split(tagKeys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				cfg.AgentPoolNameTagKeys = append(cfg.AgentPoolNameTagKeys, key)
+			}
+		}
+	}
+	if filters := os.Getenv("AZURE_INSTANCE_FILTERS"); filters != "" {
+		cfg.InstanceFilters = nil
+		for _, filter := range strings.Split(filters, ",") {
+			if filter = strings.TrimSpace(filter); filter != "" {
+				cfg.InstanceFilters = append(cfg.InstanceFilters, filter)
+			}
+		}
+	}
+	if patterns := os.Getenv("AZURE_AGENTPOOL_NAME_PATTERNS"); patterns != "" {
+		// Patterns are separated by spaces, as they may contain commas.
+		cfg.AgentPoolNamePatterns = strings.Fields(patterns)
+	}
+	if _, err = assignBoolFromEnvIfExists(&cfg.StreamVirtualMachineList, "AZURE_STREAM_VIRTUAL_MACHINE_LIST"); err != nil {
+		return nil, err
+	}
+	if _, err = assignFromEnvIfExists(&cfg.PlacementLabelPrefix, "AZURE_PLACEMENT_LABEL_PREFIX"); err != nil {
+		return nil, err
+	}
+	if auxiliaryTenantIDs := os.Getenv("AZURE_AUXILIARY_TENANT_IDS"); auxiliaryTenantIDs != "" {
+		cfg.AuxiliaryTenantIDs = nil
+		for _, tenantID := range strings.Split(auxiliaryTenantIDs, ",") {
+			if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+				cfg.AuxiliaryTenantIDs = append(cfg.AuxiliaryTenantIDs, tenantID)
+			}
+		}
+	}
+
+	// Command-line overrides take precedence over both the config file and the environment.
+	if err := cfg.applyOverrides(configOverrides); err != nil {
+		return nil, err
+	}
 
+	if err := cfg.complete(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// complete sets the nonstatic defaults of the config, possibly calling the instance metadata service
+// or reading the deployment parameters file, and validates it.
+func (cfg *Config) complete() error {
 	// Nonstatic defaults
 	cfg.VMType = strings.ToLower(cfg.VMType)
 	if cfg.MaxDeploymentsCount == 0 {
@@ -319,12 +597,12 @@ func BuildAzureConfig(configReader io.Reader) (*Config, error) {
 	if cfg.SubscriptionID == "" {
 		metadataService, err := providerazure.NewInstanceMetadataService(imdsServerURL)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		metadata, err := metadataService.GetMetadata(0)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		cfg.SubscriptionID = metadata.Compute.SubscriptionID
@@ -334,17 +612,14 @@ func BuildAzureConfig(configReader io.Reader) (*Config, error) {
 		parameters, err := readDeploymentParameters(deploymentParametersPath)
 		if err != nil {
 			klog.Errorf("readDeploymentParameters failed with error: %v", err)
-			return nil, err
+			return err
 		}
 
 		cfg.DeploymentParameters = parameters
 	}
 	providerazureconfig.InitializeCloudProviderRateLimitConfig(&cfg.CloudProviderRateLimitConfig)
 
-	if err := cfg.validate(); err != nil {
-		return nil, err
-	}
-	return cfg, nil
+	return cfg.validate()
 }
 
 // A "fork" of az.getAzureClientConfig with BYO authorizer (e.g., for CLI auth) and custom polling delay support
@@ -431,6 +706,200 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("Cloud provider backoff is enabled but retries are not set")
 	}
 
+	if cfg.UnregisteredNodeGroupCacheTTLInSeconds < 0 {
+		return fmt.Errorf("unregisteredNodeGroupCacheTTLInSeconds must not be negative")
+	}
+
+	if cfg.CapacityProbeThreshold < 0 || cfg.CapacityProbeSize < 0 || cfg.CapacityProbeTimeoutInSeconds < 0 {
+		return fmt.Errorf("capacity probe settings must not be negative")
+	}
+
+	if cfg.CapacityProbeThreshold > 0 && cfg.CapacityProbeSize >= cfg.CapacityProbeThreshold {
+		return fmt.Errorf("capacityProbeSize (%d) must be lower than capacityProbeThreshold (%d)", cfg.CapacityProbeSize, cfg.CapacityProbeThreshold)
+	}
+
+	if cfg.ComputeAPIVersion != "" && !apiVersionRegex.MatchString(cfg.ComputeAPIVersion) {
+		return fmt.Errorf("computeAPIVersion %q is not a valid API version", cfg.ComputeAPIVersion)
+	}
+
+	if cfg.ContainerServiceAPIVersion != "" && !apiVersionRegex.MatchString(cfg.ContainerServiceAPIVersion) {
+		return fmt.Errorf("containerServiceAPIVersion %q is not a valid API version", cfg.ContainerServiceAPIVersion)
+	}
+
+	if cfg.PlacementLabelPrefix != "" {
+		if errs := validation.IsQualifiedName(cfg.PlacementLabelPrefix + capacityReservationGroupLabelName); !strings.HasSuffix(cfg.PlacementLabelPrefix, "/") || len(errs) > 0 {
+			return fmt.Errorf("placementLabelPrefix %q is not a valid label key prefix", cfg.PlacementLabelPrefix)
+		}
+		if strings.HasPrefix(cfg.PlacementLabelPrefix, AKSLabelPrefixValue) {
+			return fmt.Errorf("placementLabelPrefix %q is reserved by AKS", cfg.PlacementLabelPrefix)
+		}
+	}
+
+	if cfg.NodeGroupRefreshConcurrency < 0 {
+		return fmt.Errorf("nodeGroupRefreshConcurrency must not be negative")
+	}
+
+	if cfg.StandbyCacheRefreshIntervalInSeconds < 0 {
+		return fmt.Errorf("standbyCacheRefreshIntervalInSeconds must not be negative")
+	}
+
+	if cfg.SKUCacheRefreshIntervalInSeconds < 0 {
+		return fmt.Errorf("skuCacheRefreshIntervalInSeconds must not be negative")
+	}
+
+	if cfg.ShutdownOperationTimeoutInSeconds < 0 {
+		return fmt.Errorf("shutdownOperationTimeoutInSeconds must not be negative")
+	}
+
+	if err := validateInstanceMatchingStrategy(cfg.InstanceMatchingStrategy, cfg.VMType); err != nil {
+		return err
+	}
+
+	if err := validateInstanceFilters(cfg.InstanceFilters, cfg.VMType); err != nil {
+		return err
+	}
+
+	if cfg.BackPressureLatencyThresholdInSeconds < 0 {
+		return fmt.Errorf("backPressureLatencyThresholdInSeconds must not be negative")
+	}
+
+	if cfg.BackPressureErrorRateThreshold < 0 || cfg.BackPressureErrorRateThreshold > 1 {
+		return fmt.Errorf("backPressureErrorRateThreshold must be between 0 and 1")
+	}
+
+	if err := validatePropagatedTags(cfg.PropagatedTags); err != nil {
+		return err
+	}
+
+	if cfg.CostCeilingPerHour < 0 {
+		return fmt.Errorf("costCeilingPerHour must not be negative")
+	}
+
+	if _, err := parseAgentPoolNamePatterns(cfg.AgentPoolNamePatterns); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(cfg.NetworkPlugin) {
+	case "", networkPluginKubenet, networkPluginAzure, networkPluginNone:
+	default:
+		return fmt.Errorf("unsupported network plugin: %s", cfg.NetworkPlugin)
+	}
+	if cfg.NetworkPluginMode != "" && (!strings.EqualFold(cfg.NetworkPluginMode, networkPluginModeOverlay) || !strings.EqualFold(cfg.NetworkPlugin, networkPluginAzure)) {
+		return fmt.Errorf("unsupported network plugin mode %q for network plugin %q", cfg.NetworkPluginMode, cfg.NetworkPlugin)
+	}
+
+	if cfg.PreDeleteHookTimeoutInSeconds < 0 {
+		return fmt.Errorf("preDeleteHookTimeoutInSeconds must not be negative")
+	}
+
+	if cfg.PreDeleteHookFailurePolicy != "" && cfg.PreDeleteHookFailurePolicy != PreDeleteHookFailurePolicyIgnore &&
+		cfg.PreDeleteHookFailurePolicy != PreDeleteHookFailurePolicyFail {
+		return fmt.Errorf("preDeleteHookFailurePolicy %q is not supported, must be %s or %s",
+			cfg.PreDeleteHookFailurePolicy, PreDeleteHookFailurePolicyIgnore, PreDeleteHookFailurePolicyFail)
+	}
+
+	if len(cfg.AuxiliaryTenantIDs) > 0 {
+		if cfg.UseManagedIdentityExtension || cfg.UseFederatedWorkloadIdentityExtension ||
+			(cfg.AuthMethod != "" && cfg.AuthMethod != authMethodPrincipal) || (cfg.AADClientSecret == "" && cfg.AADClientCertPath == "") {
+			return fmt.Errorf("auxiliaryTenantIDs require service principal authentication with a client secret or certificate")
+		}
+		for _, tenantID := range cfg.AuxiliaryTenantIDs {
+			if tenantID == "" || strings.EqualFold(tenantID, cfg.TenantID) {
+				return fmt.Errorf("auxiliaryTenantIDs must not contain empty IDs or the tenant ID %q", cfg.TenantID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyOverrides sets the Config fields named by overrides, each in the format <jsonFieldName>=<value>.
+// Field names are matched case-insensitively against the JSON tags, including those of inlined structs.
+func (cfg *Config) applyOverrides(overrides []string) error {
+	for _, override := range overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf("invalid config override %q, expected <jsonFieldName>=<value>", override)
+		}
+		name, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		field, found := findConfigField(reflect.ValueOf(cfg).Elem(), name)
+		if !found {
+			return fmt.Errorf("invalid config override %q: unknown field %q", override, name)
+		}
+		if err := setConfigField(field, val); err != nil {
+			return fmt.Errorf("invalid config override %q: %v", override, err)
+		}
+		klog.V(2).Infof("Overriding Azure config field %q from command line", name)
+	}
+	return nil
+}
+
+// findConfigField returns the settable struct field whose JSON name matches name.
+func findConfigField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		tagName := strings.Split(tag, ",")[0]
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && (tagName == "" || strings.Contains(tag, "inline")) {
+			if field, found := findConfigField(v.Field(i), name); found {
+				return field, true
+			}
+			continue
+		}
+		if tagName == "" || tagName == "-" || !strings.EqualFold(tagName, name) {
+			continue
+		}
+		if !v.Field(i).CanSet() {
+			return reflect.Value{}, false
+		}
+		return v.Field(i), true
+	}
+	return reflect.Value{}, false
+}
+
+// setConfigField parses val according to the kind of field and assigns it.
+func setConfigField(field reflect.Value, val string) error {
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setConfigField(elem.Elem(), val); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("fields of type %s cannot be overridden", field.Type())
+	}
 	return nil
 }
 
@@ -17,6 +17,7 @@ limitations under the License.
 package azure
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -121,3 +122,134 @@ func TestInitializeCloudProviderRateLimitConfigWithReadAndWriteRateLimitSettings
 	assert.InDelta(t, cfg.VirtualMachineScaleSetRateLimit.CloudProviderRateLimitQPSWrite, rateLimitWriteQPS, 0.0001)
 	assert.InDelta(t, cfg.VirtualMachineScaleSetRateLimit.CloudProviderRateLimitBucketWrite, rateLimitWriteBuckets, 0.0001)
 }
+
+func TestApplyConfigOverrides(t *testing.T) {
+	cfg := &Config{}
+	cfg.VMType = providerazureconsts.VMTypeVMSS
+
+	err := cfg.applyOverrides([]string{
+		"enableVMsAgentPool=true",
+		"clusterName = mycluster",
+		"vmType=standard",
+		"maxDeploymentsCount=5",
+		"cloudProviderRateLimitQPS=2.5",
+	})
+	assert.NoError(t, err)
+	assert.True(t, cfg.EnableVMsAgentPool)
+	assert.Equal(t, "mycluster", cfg.ClusterName)
+	assert.Equal(t, providerazureconsts.VMTypeStandard, cfg.VMType)
+	assert.Equal(t, int64(5), cfg.MaxDeploymentsCount)
+	assert.InDelta(t, 2.5, cfg.CloudProviderRateLimitQPS, 0.0001)
+
+	for _, override := range []string{
+		"enableVMsAgentPool",
+		"=true",
+		"unknownField=true",
+		"enableVMsAgentPool=notabool",
+		"deploymentParameters=foo",
+	} {
+		assert.Error(t, cfg.applyOverrides([]string{override}), override)
+	}
+}
+
+func TestBuildAzureConfigWithOverrides(t *testing.T) {
+	cfg, err := BuildAzureConfig(strings.NewReader(validAzureCfg))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), cfg.MaxDeploymentsCount)
+	assert.False(t, cfg.EnableVMsAgentPool)
+
+	cfg, err = BuildAzureConfigWithOverrides(strings.NewReader(validAzureCfg), []string{"maxDeploymentsCount=5", "enableVMsAgentPool=true"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), cfg.MaxDeploymentsCount, "overrides take precedence over the config file")
+	assert.True(t, cfg.EnableVMsAgentPool)
+
+	_, err = BuildAzureConfigWithOverrides(strings.NewReader(validAzureCfg), []string{"unknownField=true"})
+	assert.Error(t, err)
+}
+
+func TestValidateAuxiliaryTenantIDs(t *testing.T) {
+	newConfig := func() *Config {
+		cfg := &Config{}
+		cfg.VMType = providerazureconsts.VMTypeVMSS
+		cfg.ResourceGroup = "rg"
+		cfg.SubscriptionID = "subscription"
+		cfg.TenantID = "tenant"
+		cfg.AADClientID = "client"
+		cfg.AADClientSecret = "secret"
+		cfg.AuxiliaryTenantIDs = []string{"other-tenant"}
+		return cfg
+	}
+	assert.NoError(t, newConfig().validate())
+
+	cfg := newConfig()
+	cfg.AADClientSecret = ""
+	cfg.AADClientCertPath = "/etc/kubernetes/cert.pfx"
+	assert.NoError(t, cfg.validate())
+
+	cfg = newConfig()
+	cfg.AADClientSecret = ""
+	assert.Error(t, cfg.validate())
+
+	cfg = newConfig()
+	cfg.UseManagedIdentityExtension = true
+	assert.Error(t, cfg.validate())
+
+	cfg = newConfig()
+	cfg.AuthMethod = authMethodCLI
+	assert.Error(t, cfg.validate())
+
+	cfg = newConfig()
+	cfg.AuxiliaryTenantIDs = []string{"Tenant"}
+	assert.Error(t, cfg.validate())
+}
+
+func TestValidateNetworkPlugin(t *testing.T) {
+	newConfig := func(networkPlugin, networkPluginMode string) *Config {
+		cfg := &Config{}
+		cfg.VMType = providerazureconsts.VMTypeVMSS
+		cfg.ResourceGroup = "rg"
+		cfg.SubscriptionID = "subscription"
+		cfg.TenantID = "tenant"
+		cfg.AADClientID = "client"
+		cfg.NetworkPlugin = networkPlugin
+		cfg.NetworkPluginMode = networkPluginMode
+		return cfg
+	}
+	assert.NoError(t, newConfig("", "").validate())
+	assert.NoError(t, newConfig("kubenet", "").validate())
+	assert.NoError(t, newConfig("azure", "overlay").validate())
+	assert.Error(t, newConfig("calico", "").validate())
+	assert.Error(t, newConfig("kubenet", "overlay").validate())
+	assert.Error(t, newConfig("azure", "underlay").validate())
+}
+
+func TestValidateAgentPoolNamePatterns(t *testing.T) {
+	cfg := &Config{}
+	cfg.VMType = providerazureconsts.VMTypeVMSS
+	cfg.ResourceGroup = "rg"
+	cfg.SubscriptionID = "subscription"
+	cfg.TenantID = "tenant"
+	cfg.AADClientID = "client"
+	cfg.AgentPoolNamePatterns = []string{`^aks-([a-z0-9]+)-[0-9]+-vm[0-9]+$`}
+	assert.NoError(t, cfg.validate())
+
+	cfg.AgentPoolNamePatterns = []string{`^aks-[a-z0-9]+$`}
+	assert.Error(t, cfg.validate())
+}
+
+func TestValidatePlacementLabelPrefix(t *testing.T) {
+	cfg := &Config{}
+	cfg.VMType = providerazureconsts.VMTypeVMSS
+	cfg.ResourceGroup = "rg"
+	cfg.SubscriptionID = "subscription"
+	cfg.TenantID = "tenant"
+	cfg.AADClientID = "client"
+	for _, prefix := range []string{"", defaultPlacementLabelPrefix, "example.com/"} {
+		cfg.PlacementLabelPrefix = prefix
+		assert.NoError(t, cfg.validate(), prefix)
+	}
+	for _, prefix := range []string{"example.com", "Example_com/", "kubernetes.azure.com/"} {
+		cfg.PlacementLabelPrefix = prefix
+		assert.Error(t, cfg.validate(), prefix)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	klog "k8s.io/klog/v2"
+)
+
+// costCeilingOverrideTag lets the scale-ups of a scale set exceed the cost ceiling while set to "true".
+const costCeilingOverrideTag = "cluster-autoscaler-cost-ceiling-override"
+
+func isCostCeilingOverridden(tags map[string]*string) bool {
+	value, ok := tags[costCeilingOverrideTag]
+	return ok && value != nil && strings.EqualFold(strings.TrimSpace(*value), "true")
+}
+
+// hourlyNodeCost returns the estimated hourly cost of a node of the node group, priced from its template node.
+func hourlyNodeCost(nodeGroup cloudprovider.NodeGroup) (float64, error) {
+	nodeInfo, err := nodeGroup.TemplateNodeInfo()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	return (&AzurePriceModel{}).NodePrice(nodeInfo.Node(), now, now.Add(time.Hour))
+}
+
+// estimatedHourlyCost returns the estimated hourly cost of the managed node groups at their target size.
+// Node groups whose cost can't be estimated are left out.
+func (m *AzureManager) estimatedHourlyCost() float64 {
+	total := 0.0
+	for _, nodeGroup := range m.getNodeGroups() {
+		size, err := nodeGroup.TargetSize()
+		if err != nil || size <= 0 {
+			continue
+		}
+		cost, err := hourlyNodeCost(nodeGroup)
+		if err != nil {
+			klog.V(4).Infof("Failed to estimate the cost of node group %s: %v", nodeGroup.Id(), err)
+			continue
+		}
+		total += cost * float64(size)
+	}
+	estimatedHourlyCost.Set(total)
+	return total
+}
+
+// reportEstimatedCost exports the estimated hourly cost of the managed node groups, if a cost ceiling is configured.
+func (m *AzureManager) reportEstimatedCost() {
+	if m.config.CostCeilingPerHour > 0 {
+		m.estimatedHourlyCost()
+	}
+}
+
+// checkCostCeiling refuses to scale up the node group by delta nodes if it would bring the estimated hourly cost
+// of the managed node groups over the configured cost ceiling. Scale-ups over the ceiling are only logged when
+// CostCeilingWarnOnly is set, or when tags carry the cost ceiling override. Scale-ups which can't be priced are
+// not refused.
+func (m *AzureManager) checkCostCeiling(nodeGroup cloudprovider.NodeGroup, delta int, tags map[string]*string) error {
+	ceiling := m.config.CostCeilingPerHour
+	if ceiling <= 0 {
+		return nil
+	}
+	nodeCost, err := hourlyNodeCost(nodeGroup)
+	if err != nil {
+		klog.Warningf("Failed to estimate the cost of scaling up %s, not checking the cost ceiling: %v", nodeGroup.Id(), err)
+		return nil
+	}
+	current := m.estimatedHourlyCost()
+	projected := current + nodeCost*float64(delta)
+	if projected <= ceiling {
+		return nil
+	}
+
+	switch {
+	case m.config.CostCeilingWarnOnly:
+		klog.Warningf("Scale-up of %s by %d nodes brings the estimated hourly cost from %.2f to %.2f, over the cost ceiling of %.2f",
+			nodeGroup.Id(), delta, current, projected, ceiling)
+		costCeilingExceeded.WithLabelValues(nodeGroup.Id(), "warned").Inc()
+		return nil
+	case isCostCeilingOverridden(tags):
+		klog.Warningf("Scale-up of %s by %d nodes brings the estimated hourly cost from %.2f to %.2f, over the cost ceiling of %.2f, allowed by tag %s",
+			nodeGroup.Id(), delta, current, projected, ceiling, costCeilingOverrideTag)
+		costCeilingExceeded.WithLabelValues(nodeGroup.Id(), "overridden").Inc()
+		return nil
+	}
+	costCeilingExceeded.WithLabelValues(nodeGroup.Id(), "refused").Inc()
+	return fmt.Errorf("scale-up of %s by %d nodes would bring the estimated hourly cost from %.2f to %.2f, over the cost ceiling of %.2f",
+		nodeGroup.Id(), delta, current, projected, ceiling)
+}
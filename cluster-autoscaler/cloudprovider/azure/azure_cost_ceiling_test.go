@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func TestCheckCostCeiling(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Pin the instance type, so that each node costs 8 vCPUs and 1 GB of memory: 0.2644 an hour.
+	getInstanceTypeStatically := GetInstanceTypeStatically
+	t.Cleanup(func() { GetInstanceTypeStatically = getInstanceTypeStatically })
+	GetInstanceTypeStatically = func(template NodeTemplate) (*InstanceType, error) {
+		return &InstanceType{InstanceType: template.SkuName, VCPU: 8, MemoryMb: 1024}, nil
+	}
+
+	manager := newTestAzureManager(t)
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestVMSSList(3, testASG, testLocation, compute.Uniform), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	scaleSet := newTestScaleSet(manager, testASG)
+	assert.True(t, manager.RegisterNodeGroup(scaleSet))
+	manager.explicitlyConfigured[testASG] = true
+	assert.NoError(t, manager.forceRefresh())
+
+	assert.NoError(t, manager.checkCostCeiling(scaleSet, 100, nil), "no cost ceiling configured")
+
+	manager.config.CostCeilingPerHour = 1
+	assert.InDelta(t, 3*0.2644, manager.estimatedHourlyCost(), 0.001)
+	assert.NoError(t, manager.checkCostCeiling(scaleSet, 0, nil))
+	err := manager.checkCostCeiling(scaleSet, 1, nil)
+	assert.EqualError(t, err, "scale-up of test-asg by 1 nodes would bring the estimated hourly cost from 0.79 to 1.06, over the cost ceiling of 1.00")
+
+	assert.NoError(t, manager.checkCostCeiling(scaleSet, 1, map[string]*string{costCeilingOverrideTag: to.StringPtr("true")}))
+	manager.config.CostCeilingWarnOnly = true
+	assert.NoError(t, manager.checkCostCeiling(scaleSet, 1, nil))
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// NodeGroupDebugInfo is the cached state of a node group which scaling decisions are based on.
+// It is built from the caches only, so that collecting it for support bundles doesn't call ARM.
+type NodeGroupDebugInfo struct {
+	ID      string `json:"id"`
+	MinSize int    `json:"minSize"`
+	MaxSize int    `json:"maxSize"`
+	// OrchestrationMode is Uniform or Flexible for scale sets, and VirtualMachines for VMs pools.
+	OrchestrationMode string `json:"orchestrationMode,omitempty"`
+	ProvisioningState string `json:"provisioningState,omitempty"`
+	// CurrentCapacity is the number of cached instances, and TargetCapacity the requested number of instances.
+	// Both are -1 when not cached yet.
+	CurrentCapacity int64    `json:"currentCapacity"`
+	TargetCapacity  int64    `json:"targetCapacity"`
+	Zones           []string `json:"zones,omitempty"`
+	Paused          bool     `json:"paused,omitempty"`
+	HealthScore     float64  `json:"healthScore"`
+	LastFailure     string   `json:"lastFailure,omitempty"`
+	// CacheRefreshedAt is when the Azure resources were last listed, SizeRefreshedAt when the target capacity
+	// was last refreshed and InstancesRefreshedAt when the instances were last listed.
+	CacheRefreshedAt     time.Time `json:"cacheRefreshedAt,omitempty"`
+	SizeRefreshedAt      time.Time `json:"sizeRefreshedAt,omitempty"`
+	InstancesRefreshedAt time.Time `json:"instancesRefreshedAt,omitempty"`
+}
+
+// String returns the debug string of the node group, leaving out the fields which are unknown.
+func (info NodeGroupDebugInfo) String() string {
+	parts := []string{fmt.Sprintf("%s (%d:%d)", info.ID, info.MinSize, info.MaxSize)}
+	if info.OrchestrationMode != "" {
+		parts = append(parts, "mode="+info.OrchestrationMode)
+	}
+	if info.ProvisioningState != "" {
+		parts = append(parts, "state="+info.ProvisioningState)
+	}
+	if info.CurrentCapacity >= 0 || info.TargetCapacity >= 0 {
+		parts = append(parts, fmt.Sprintf("size=%s/%s", formatCapacity(info.CurrentCapacity), formatCapacity(info.TargetCapacity)))
+	}
+	if len(info.Zones) > 0 {
+		parts = append(parts, "zones="+strings.Join(info.Zones, ","))
+	}
+	for _, refresh := range []struct {
+		name string
+		at   time.Time
+	}{
+		{"refreshed", info.CacheRefreshedAt},
+		{"sizeRefreshed", info.SizeRefreshedAt},
+		{"instancesRefreshed", info.InstancesRefreshedAt},
+	} {
+		if !refresh.at.IsZero() {
+			parts = append(parts, refresh.name+"="+refresh.at.UTC().Format(time.RFC3339))
+		}
+	}
+	if info.Paused {
+		parts = append(parts, "paused")
+	}
+	return strings.Join(parts, " ") + describeHealth(info.HealthScore, failureKind(info.LastFailure))
+}
+
+func formatCapacity(capacity int64) string {
+	if capacity < 0 {
+		return "?"
+	}
+	return fmt.Sprint(capacity)
+}
+
+// DebugInfo returns the cached state of the scale set.
+func (scaleSet *ScaleSet) DebugInfo() NodeGroupDebugInfo {
+	info := NodeGroupDebugInfo{
+		ID:               scaleSet.Id(),
+		MinSize:          scaleSet.MinSize(),
+		MaxSize:          scaleSet.MaxSize(),
+		CurrentCapacity:  -1,
+		Paused:           scaleSet.paused.Load(),
+		CacheRefreshedAt: scaleSet.manager.lastRefresh,
+	}
+	if vmss, err := scaleSet.getVMSSFromCache(); err == nil {
+		if vmss.VirtualMachineScaleSetProperties != nil {
+			info.OrchestrationMode = string(vmss.OrchestrationMode)
+			info.ProvisioningState = to.String(vmss.ProvisioningState)
+		}
+		if vmss.Zones != nil {
+			info.Zones = sortedZones(*vmss.Zones)
+		}
+	}
+
+	scaleSet.sizeMutex.Lock()
+	info.TargetCapacity = scaleSet.curSize
+	info.SizeRefreshedAt = scaleSet.lastSizeRefresh
+	scaleSet.sizeMutex.Unlock()
+
+	scaleSet.instanceMutex.Lock()
+	if !scaleSet.lastInstanceRefresh.IsZero() {
+		info.CurrentCapacity = int64(len(scaleSet.instanceCache))
+		info.InstancesRefreshedAt = scaleSet.lastInstanceRefresh
+	}
+	scaleSet.instanceMutex.Unlock()
+
+	score, lastFailure := scaleSet.manager.health.debugScore(scaleSet.Name, time.Now())
+	info.HealthScore, info.LastFailure = score, string(lastFailure)
+	return info
+}
+
+// DebugInfo returns the cached state of the VMs pool. The target capacity of VMs pools is the number of
+// instances which are not being deleted.
+func (vmPool *VMPool) DebugInfo() NodeGroupDebugInfo {
+	info := NodeGroupDebugInfo{
+		ID:                vmPool.Id(),
+		MinSize:           vmPool.MinSize(),
+		MaxSize:           vmPool.MaxSize(),
+		OrchestrationMode: vmsPoolType,
+		CurrentCapacity:   -1,
+		TargetCapacity:    -1,
+		HealthScore:       1,
+	}
+	if vmPool.manager == nil {
+		return info
+	}
+	info.CacheRefreshedAt = vmPool.manager.lastRefresh
+	if ap, err := vmPool.getAgentpoolFromCache(); err == nil && ap.Properties != nil {
+		info.ProvisioningState = to.String(ap.Properties.ProvisioningState)
+		var zones []string
+		for _, zone := range ap.Properties.AvailabilityZones {
+			zones = append(zones, to.String(zone))
+		}
+		info.Zones = sortedZones(zones)
+	}
+	if vmPool.manager.azureCache != nil {
+		if vms, err := vmPool.getVMsFromCache(skipOption{}); err == nil {
+			info.CurrentCapacity = int64(len(vms))
+		}
+		if vms, err := vmPool.getVMsFromCache(skipOption{skipDeleting: true}); err == nil {
+			info.TargetCapacity = int64(len(vms))
+		}
+	}
+	score, lastFailure := vmPool.manager.health.debugScore(vmPool.Id(), time.Now())
+	info.HealthScore, info.LastFailure = score, string(lastFailure)
+	return info
+}
+
+func sortedZones(zones []string) []string {
+	if len(zones) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), zones...)
+	sort.Strings(sorted)
+	return sorted
+}
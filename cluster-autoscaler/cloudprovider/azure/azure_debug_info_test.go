@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+)
+
+func TestScaleSetDebugInfo(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		testASG: {
+			Name:  to.StringPtr(testASG),
+			Sku:   &compute.Sku{Capacity: to.Int64Ptr(3)},
+			Zones: &[]string{"2", "1"},
+			VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+				OrchestrationMode: compute.Flexible,
+				ProvisioningState: to.StringPtr("Updating"),
+			},
+		},
+	}
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	info := scaleSet.DebugInfo()
+	assert.Equal(t, "Flexible", info.OrchestrationMode)
+	assert.Equal(t, "Updating", info.ProvisioningState)
+	assert.Equal(t, []string{"1", "2"}, info.Zones)
+	assert.Equal(t, int64(-1), info.CurrentCapacity)
+	assert.Equal(t, 1.0, info.HealthScore)
+	assert.Equal(t, testASG+" (1:5) mode=Flexible state=Updating size=?/0 zones=1,2", info.String())
+
+	refreshed := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	scaleSet.curSize = 3
+	scaleSet.lastSizeRefresh = refreshed
+	scaleSet.instanceCache = []cloudprovider.Instance{{Id: "vm-0"}, {Id: "vm-1"}}
+	scaleSet.lastInstanceRefresh = refreshed
+	manager.health.record(testASG, failureStockout, time.Now())
+
+	info = scaleSet.DebugInfo()
+	assert.Equal(t, int64(2), info.CurrentCapacity)
+	assert.Equal(t, int64(3), info.TargetCapacity)
+	assert.Equal(t, "stockout", info.LastFailure)
+	assert.Equal(t, testASG+" (1:5) mode=Flexible state=Updating size=2/3 zones=1,2"+
+		" sizeRefreshed=2024-05-01T10:00:00Z instancesRefreshed=2024-05-01T10:00:00Z"+
+		" unhealthy (score 0.33, last failure: stockout)", scaleSet.Debug())
+
+	encoded, err := json.Marshal(info)
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), `"orchestrationMode":"Flexible"`)
+	assert.Contains(t, string(encoded), `"sizeRefreshedAt":"2024-05-01T10:00:00Z"`)
+}
+
+func TestVMPoolDebugInfo(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.azureCache.vmsPoolMap = map[string]armcontainerservice.AgentPool{
+		vmsAgentPoolName: {
+			Properties: &armcontainerservice.ManagedClusterAgentPoolProfileProperties{
+				ProvisioningState: to.StringPtr("Succeeded"),
+				AvailabilityZones: []*string{to.StringPtr("3")},
+			},
+		},
+	}
+	vmList := newTestVMsPoolVMList(3)
+	vmList[0].ProvisioningState = to.StringPtr("Deleting")
+	manager.azureCache.virtualMachines[vmsAgentPoolName] = vmList
+	vmPool := newTestVMsPool(manager)
+
+	info := vmPool.DebugInfo()
+	assert.Equal(t, vmsPoolType, info.OrchestrationMode)
+	assert.Equal(t, "Succeeded", info.ProvisioningState)
+	assert.Equal(t, []string{"3"}, info.Zones)
+	assert.Equal(t, int64(3), info.CurrentCapacity)
+	assert.Equal(t, int64(2), info.TargetCapacity)
+	assert.Equal(t, vmsNodeGroupName+" (3:10) mode=VirtualMachines state=Succeeded size=3/2 zones=3", vmPool.Debug())
+}
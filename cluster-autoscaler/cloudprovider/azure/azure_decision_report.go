@@ -0,0 +1,292 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// decisionReportHistory is how many reports of finished loops are kept, served and written.
+	decisionReportHistory = 10
+	// decisionReportPath is the path of the decision report endpoint.
+	decisionReportPath = "/decisions"
+
+	decisionReportShutdownTimeout = 5 * time.Second
+)
+
+// decisionReport is what the provider saw and did during one autoscaler loop, from one Refresh to the next.
+type decisionReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+	// CacheAge is how old the cache used by the loop was, after refreshing it if expired.
+	CacheAge string `json:"cacheAge,omitempty"`
+	// Listed are the resources listed from ARM during the loop, if the cache was refreshed.
+	Listed    *listedResources   `json:"listed,omitempty"`
+	Lookups   nodeGroupLookups   `json:"lookups"`
+	Mutations []decisionMutation `json:"mutations,omitempty"`
+	Errors    []decisionError    `json:"errors,omitempty"`
+}
+
+// listedResources counts the resources in the cache after a refresh.
+type listedResources struct {
+	ScaleSets       int `json:"scaleSets"`
+	VirtualMachines int `json:"virtualMachines"`
+	VMsPools        int `json:"vmsPools"`
+	NodeGroups      int `json:"nodeGroups"`
+}
+
+// nodeGroupLookups counts the lookups of the node group of instances, by outcome.
+type nodeGroupLookups struct {
+	Found    int `json:"found"`
+	NotFound int `json:"notFound"`
+	Failed   int `json:"failed"`
+}
+
+// decisionMutation is a mutation of a node group issued to ARM, or only logged on dry run. Error is set if the
+// request failed or was vetoed.
+type decisionMutation struct {
+	Operation   string    `json:"operation"`
+	NodeGroup   string    `json:"nodeGroup"`
+	Description string    `json:"description"`
+	DryRun      bool      `json:"dryRun,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// decisionError is a failed ARM call of the cache.
+type decisionError struct {
+	Call    string    `json:"call"`
+	Target  string    `json:"target,omitempty"`
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// decisionReporter builds a decisionReport for every autoscaler loop, a machine-readable version of the provider
+// logs for tooling and bug reports. The reports of the last loops are served as JSON on the configured address,
+// and written as JSON lines to the configured file, oldest first, at the end of every loop.
+// A nil reporter reports nothing.
+type decisionReporter struct {
+	file   string
+	server *http.Server
+
+	mutex   sync.Mutex
+	current decisionReport
+	history []decisionReport
+}
+
+// newDecisionReporter returns a reporter serving the reports on address and writing them to file, or nil if
+// neither is set.
+func newDecisionReporter(address, file string, now time.Time) (*decisionReporter, error) {
+	if address == "" && file == "" {
+		return nil, nil
+	}
+
+	r := &decisionReporter{file: file, current: decisionReport{StartedAt: now}}
+	if address != "" {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on decision report address %q: %v", address, err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle(decisionReportPath, r)
+		r.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := r.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				klog.Errorf("Failed to serve decision reports: %v", err)
+			}
+		}()
+		klog.Infof("Serving Azure decision reports on http://%s%s", listener.Addr(), decisionReportPath)
+	}
+	return r, nil
+}
+
+// next finishes the report of the current loop at now and starts the report of the next one.
+func (r *decisionReporter) next(now time.Time) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	r.current.FinishedAt = now
+	r.history = append(r.history, r.current)
+	if len(r.history) > decisionReportHistory {
+		r.history = r.history[len(r.history)-decisionReportHistory:]
+	}
+	r.current = decisionReport{StartedAt: now}
+	history := r.history
+	r.mutex.Unlock()
+
+	r.write(history)
+}
+
+func (r *decisionReporter) recordCacheAge(age time.Duration) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current.CacheAge = age.Round(time.Millisecond).String()
+}
+
+func (r *decisionReporter) recordListed(listed listedResources) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current.Listed = &listed
+}
+
+func (r *decisionReporter) recordLookup(found bool, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch {
+	case err != nil:
+		r.current.Lookups.Failed++
+	case found:
+		r.current.Lookups.Found++
+	default:
+		r.current.Lookups.NotFound++
+	}
+}
+
+func (r *decisionReporter) recordMutation(mutation decisionMutation) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current.Mutations = append(r.current.Mutations, mutation)
+}
+
+func (r *decisionReporter) recordError(e decisionError) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current.Errors = append(r.current.Errors, e)
+}
+
+// reports returns the reports of the last finished loops and of the current one, oldest first.
+func (r *decisionReporter) reports() []decisionReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	reports := make([]decisionReport, 0, len(r.history)+1)
+	reports = append(reports, r.history...)
+	current := r.current
+	current.Mutations = append([]decisionMutation(nil), r.current.Mutations...)
+	current.Errors = append([]decisionError(nil), r.current.Errors...)
+	return append(reports, current)
+}
+
+// ServeHTTP serves the reports of the last loops, the current one last, as a JSON array.
+func (r *decisionReporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.reports()); err != nil {
+		klog.Warningf("Failed to serve decision reports: %v", err)
+	}
+}
+
+// write replaces the report file with the reports of the last finished loops, one JSON object per line.
+func (r *decisionReporter) write(history []decisionReport) {
+	if r.file == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, report := range history {
+		if err := encoder.Encode(report); err != nil {
+			klog.Warningf("Failed to encode decision report: %v", err)
+			return
+		}
+	}
+	// The file is replaced by a rename, so that readers never see a partially written report.
+	tmp, err := os.CreateTemp(filepath.Dir(r.file), filepath.Base(r.file)+".*")
+	if err != nil {
+		klog.Warningf("Failed to write decision reports to %s: %v", r.file, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), r.file)
+	}
+	if err != nil {
+		klog.Warningf("Failed to write decision reports to %s: %v", r.file, err)
+	}
+}
+
+// stop finishes the report of the current loop, and stops serving the reports.
+func (r *decisionReporter) stop() {
+	if r == nil {
+		return
+	}
+
+	r.next(time.Now())
+	if r.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), decisionReportShutdownTimeout)
+		defer cancel()
+		if err := r.server.Shutdown(ctx); err != nil {
+			klog.Warningf("Failed to stop serving decision reports: %v", err)
+		}
+	}
+}
+
+// recordListedResources records the resources in the cache in the decision report, after a refresh.
+func (m *AzureManager) recordListedResources() {
+	if m.decisions == nil {
+		return
+	}
+
+	virtualMachines := 0
+	for _, vms := range m.azureCache.getVirtualMachines() {
+		virtualMachines += len(vms)
+	}
+	m.decisions.recordListed(listedResources{
+		ScaleSets:       len(m.azureCache.getScaleSets()),
+		VirtualMachines: virtualMachines,
+		VMsPools:        len(m.azureCache.getVMsPoolMap()),
+		NodeGroups:      len(m.getNodeGroups()),
+	})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestNewDecisionReporter(t *testing.T) {
+	r, err := newDecisionReporter("", "", time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, r, "nothing is reported without an address or a file")
+
+	_, err = newDecisionReporter("invalid address", "", time.Now())
+	assert.Error(t, err)
+
+	r, err = newDecisionReporter("127.0.0.1:0", "", time.Now())
+	assert.NoError(t, err)
+	assert.NotNil(t, r.server)
+	r.stop()
+}
+
+func TestDecisionReporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "decisions.jsonl")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r, err := newDecisionReporter("", file, start)
+	assert.NoError(t, err)
+
+	r.recordCacheAge(1500 * time.Millisecond)
+	r.recordListed(listedResources{ScaleSets: 2, VirtualMachines: 5, NodeGroups: 1})
+	r.recordLookup(true, nil)
+	r.recordLookup(true, nil)
+	r.recordLookup(false, nil)
+	r.recordLookup(false, errors.New("lookup failed"))
+	r.recordMutation(decisionMutation{Operation: operationUpdateCapacity, NodeGroup: testASG, Description: "set capacity to 3", Time: start})
+	r.recordError(decisionError{Call: "VirtualMachinesClient.List", Target: "rg", Code: "429", Message: "throttled", Time: start})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", decisionReportPath, nil))
+	var served []decisionReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Len(t, served, 1, "the current loop is served before it finishes")
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err), "only finished loops are written")
+
+	r.next(start.Add(time.Minute))
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 1)
+	var report decisionReport
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &report))
+	assert.Equal(t, decisionReport{
+		StartedAt:  start,
+		FinishedAt: start.Add(time.Minute),
+		CacheAge:   "1.5s",
+		Listed:     &listedResources{ScaleSets: 2, VirtualMachines: 5, NodeGroups: 1},
+		Lookups:    nodeGroupLookups{Found: 2, NotFound: 1, Failed: 1},
+		Mutations:  []decisionMutation{{Operation: operationUpdateCapacity, NodeGroup: testASG, Description: "set capacity to 3", Time: start}},
+		Errors:     []decisionError{{Call: "VirtualMachinesClient.List", Target: "rg", Code: "429", Message: "throttled", Time: start}},
+	}, report)
+
+	for i := 2; i <= decisionReportHistory+5; i++ {
+		r.next(start.Add(time.Duration(i) * time.Minute))
+	}
+	content, err = os.ReadFile(file)
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, decisionReportHistory, "only the last loops are kept")
+	assert.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &report))
+	assert.Equal(t, start.Add(time.Duration(decisionReportHistory+5)*time.Minute), report.FinishedAt)
+	assert.Len(t, r.reports(), decisionReportHistory+1)
+}
+
+func TestManagerDecisionReport(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.decisions, _ = newDecisionReporter("", filepath.Join(t.TempDir(), "decisions.jsonl"), time.Now())
+	manager.azureCache.errors.decisions = manager.decisions
+
+	manager.config.DryRun = true
+	assert.True(t, manager.dryRun(operationDeleteInstances, testASG, "delete instances %v", []string{"0"}))
+	manager.azureCache.errors.errorf("VirtualMachinesClient.List", "rg", errors.New("failed"), time.Now(), "listing failed: %v", "failed")
+	_, err := manager.GetNodeGroupForInstance(&azureRef{Name: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/unknown"})
+	assert.NoError(t, err)
+
+	report := manager.decisions.reports()[0]
+	assert.Len(t, report.Mutations, 1)
+	assert.Equal(t, "delete instances [0]", report.Mutations[0].Description)
+	assert.True(t, report.Mutations[0].DryRun)
+	assert.Len(t, report.Errors, 1)
+	assert.Equal(t, "listing failed: failed", report.Errors[0].Message)
+	assert.Equal(t, nodeGroupLookups{NotFound: 1}, report.Lookups)
+}
+
+func TestManagerDecisionReportMutationOutcome(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.decisions, _ = newDecisionReporter("", filepath.Join(t.TempDir(), "decisions.jsonl"), time.Now())
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().CreateOrUpdateAsync(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(nil, &retry.Error{RawError: errors.New("conflict")})
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	vmss := compute.VirtualMachineScaleSet{Name: to.StringPtr(testASG), Sku: &compute.Sku{Capacity: to.Int64Ptr(3)}}
+	assert.Error(t, scaleSet.createOrUpdateInstances(&vmss, 5))
+
+	report := manager.decisions.reports()[0]
+	assert.Len(t, report.Mutations, 1, "mutations are recorded once their outcome is known")
+	assert.Equal(t, "set capacity to 5", report.Mutations[0].Description)
+	assert.False(t, report.Mutations[0].DryRun)
+	assert.Contains(t, report.Mutations[0].Error, "conflict")
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// deletionHoldAnnotationKey holds a node from deletion by the Azure provider, either indefinitely when set to
+	// "true", or until the RFC3339 time it is set to.
+	deletionHoldAnnotationKey = "cluster-autoscaler.kubernetes.io/azure-deletion-hold"
+	// deletionHoldTag holds the instances of a scale set from deletion, listed by instance ID (uniform) or
+	// VM name (flexible), separated by commas.
+	deletionHoldTag = "cluster-autoscaler-deletion-hold"
+)
+
+// deletionHeldByAnnotation returns whether the node is held from deletion by its annotation at now, and why.
+func deletionHeldByAnnotation(node *apiv1.Node, now time.Time) (bool, string) {
+	value, found := node.Annotations[deletionHoldAnnotationKey]
+	if !found {
+		return false, ""
+	}
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "true") {
+		return true, fmt.Sprintf("annotation %s", deletionHoldAnnotationKey)
+	}
+	if value == "" || strings.EqualFold(value, "false") {
+		return false, ""
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.Warningf("Ignoring invalid %s annotation %q on node %s, expected \"true\" or an RFC3339 time", deletionHoldAnnotationKey, value, node.Name)
+		return false, ""
+	}
+	if !now.Before(until) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("annotation %s until %s", deletionHoldAnnotationKey, until.UTC().Format(time.RFC3339))
+}
+
+// heldInstances returns the instances listed by the deletion hold tag, by lower case instance ID or VM name.
+func heldInstances(tags map[string]*string) map[string]bool {
+	value, found := tags[deletionHoldTag]
+	if !found || value == nil {
+		return nil
+	}
+	held := make(map[string]bool)
+	for _, instance := range strings.Split(*value, ",") {
+		if instance = strings.ToLower(strings.TrimSpace(instance)); instance != "" {
+			held[instance] = true
+		}
+	}
+	return held
+}
+
+// deletionHeld returns whether the node is held from deletion at now, by its annotation or by the instances held
+// by the deletion hold tag of its node group, and why.
+func deletionHeld(nodeGroup string, node *apiv1.Node, held map[string]bool, now time.Time) (bool, string) {
+	if onHold, reason := deletionHeldByAnnotation(node, now); onHold {
+		return true, reason
+	}
+	if len(held) == 0 {
+		return false, ""
+	}
+	if instance, err := getLastSegment(node.Spec.ProviderID); err == nil && held[strings.ToLower(instance)] {
+		return true, fmt.Sprintf("tag %s of %s", deletionHoldTag, nodeGroup)
+	}
+	return false, ""
+}
+
+// DeletionHeld implements cloudprovider.DeletionHoldReporter, so that the core keeps held nodes out of the
+// scale-down candidates instead of draining them before DeleteNodes refuses to delete them.
+func (azure *AzureCloudProvider) DeletionHeld(node *apiv1.Node) (bool, string) {
+	var nodeGroup string
+	var held map[string]bool
+	if ng, err := azure.NodeGroupForNode(node); err == nil && ng != nil {
+		nodeGroup = ng.Id()
+		if scaleSet, ok := ng.(*ScaleSet); ok {
+			if vmss, err := scaleSet.getVMSSFromCache(); err == nil {
+				held = heldInstances(vmss.Tags)
+			}
+		}
+	}
+	return deletionHeld(nodeGroup, node, held, time.Now())
+}
+
+// checkDeletionHold refuses the deletion of the nodes if any of them is held, by its annotation or, when tags
+// are given, by the deletion hold tag of its scale set. Held nodes are kept out of scale-down candidates by the
+// core, see DeletionHeld, so this is a backstop for nodes held meanwhile. The error names the held nodes, so that
+// the ScaleDownFailed events the core records on the nodes explain the refusal.
+func checkDeletionHold(nodeGroup string, nodes []*apiv1.Node, tags map[string]*string) error {
+	now := time.Now()
+	held := heldInstances(tags)
+	var reasons []string
+	for _, node := range nodes {
+		if onHold, reason := deletionHeld(nodeGroup, node, held, now); onHold {
+			reasons = append(reasons, fmt.Sprintf("%s (%s)", node.Name, reason))
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	klog.Warningf("Refusing to delete nodes of %s held from deletion: %s", nodeGroup, strings.Join(reasons, ", "))
+	deletionHolds.WithLabelValues(nodeGroup).Add(float64(len(reasons)))
+	return fmt.Errorf("nodes held from deletion, nodes will not be deleted: %s", strings.Join(reasons, ", "))
+}
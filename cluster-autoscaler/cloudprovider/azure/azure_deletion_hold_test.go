@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestHeldNode(i int, hold string) *apiv1.Node {
+	node := &apiv1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}}
+	node.Spec.ProviderID = azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, i)
+	if hold != "" {
+		node.Annotations = map[string]string{deletionHoldAnnotationKey: hold}
+	}
+	return node
+}
+
+func TestDeletionHeldByAnnotation(t *testing.T) {
+	now := time.Now()
+	for name, tc := range map[string]struct {
+		hold     string
+		expected bool
+	}{
+		"no annotation":       {},
+		"held":                {hold: "True", expected: true},
+		"held until later":    {hold: now.Add(time.Hour).Format(time.RFC3339), expected: true},
+		"hold expired":        {hold: now.Add(-time.Hour).Format(time.RFC3339)},
+		"invalid value":       {hold: "tomorrow"},
+		"explicitly not held": {hold: "false"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			held, reason := deletionHeldByAnnotation(newTestHeldNode(0, tc.hold), now)
+			assert.Equal(t, tc.expected, held)
+			assert.Equal(t, tc.expected, reason != "")
+		})
+	}
+}
+
+func TestCheckDeletionHold(t *testing.T) {
+	tags := map[string]*string{deletionHoldTag: to.StringPtr(" 2, vm-5 ")}
+	assert.NoError(t, checkDeletionHold(testASG, []*apiv1.Node{newTestHeldNode(0, ""), newTestHeldNode(1, "")}, tags))
+
+	err := checkDeletionHold(testASG, []*apiv1.Node{newTestHeldNode(0, ""), newTestHeldNode(1, "true"), newTestHeldNode(2, "")}, tags)
+	assert.EqualError(t, err, "nodes held from deletion, nodes will not be deleted: "+
+		"node-1 (annotation "+deletionHoldAnnotationKey+"), node-2 (tag "+deletionHoldTag+" of "+testASG+")")
+
+	// Without tags, only annotations hold nodes.
+	assert.NoError(t, checkDeletionHold(testASG, []*apiv1.Node{newTestHeldNode(2, "")}, nil))
+}
+
+func TestScaleSetDeleteHeldNodes(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{testASG: {
+		Name: to.StringPtr(testASG),
+		Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(3)},
+		Tags: map[string]*string{deletionHoldTag: to.StringPtr("1")},
+	}}
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	err := scaleSet.DeleteNodes([]*apiv1.Node{newTestHeldNode(1, "")})
+	assert.ErrorContains(t, err, "held from deletion")
+	err = scaleSet.DeleteNodes([]*apiv1.Node{newTestHeldNode(0, "true")})
+	assert.ErrorContains(t, err, "held from deletion")
+}
+
+func TestDeletionHeld(t *testing.T) {
+	provider := newTestProvider(t)
+	assert.True(t, provider.azureManager.RegisterNodeGroup(newTestScaleSet(provider.azureManager, testASG)))
+	provider.azureManager.explicitlyConfigured[testASG] = true
+	assert.NoError(t, provider.azureManager.forceRefresh())
+	vmss := provider.azureManager.azureCache.scaleSets[testASG]
+	vmss.Tags = map[string]*string{deletionHoldTag: to.StringPtr("1")}
+	provider.azureManager.azureCache.scaleSets[testASG] = vmss
+
+	held, _ := provider.DeletionHeld(newTestHeldNode(0, ""))
+	assert.False(t, held)
+	held, reason := provider.DeletionHeld(newTestHeldNode(1, ""))
+	assert.True(t, held)
+	assert.Equal(t, "tag "+deletionHoldTag+" of "+testASG, reason)
+	held, _ = provider.DeletionHeld(newTestHeldNode(2, "true"))
+	assert.True(t, held)
+
+	node := newTestHeldNode(3, "true")
+	node.Spec.ProviderID = ""
+	held, _ = provider.DeletionHeld(node)
+	assert.True(t, held, "annotations hold nodes outside of node groups")
+}
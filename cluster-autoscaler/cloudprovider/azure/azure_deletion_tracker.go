@@ -0,0 +1,284 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// maxDeletionAttempts bounds how many times the deletion of an instance is requested before giving up.
+	maxDeletionAttempts = 3
+	// deletionRetryBackoff is how long a failed deletion waits before being retried.
+	deletionRetryBackoff = time.Minute
+	// deletionResurrectionWindow is how long instances stay tracked after their deletion succeeded, to detect
+	// them being listed again.
+	deletionResurrectionWindow = 10 * time.Minute
+)
+
+type deletionState string
+
+const (
+	deletionPending   deletionState = "pending"
+	deletionFailed    deletionState = "failed"
+	deletionSucceeded deletionState = "succeeded"
+)
+
+// instanceDeletion is the deletion of a scale set instance, tracked from its request until it is confirmed.
+type instanceDeletion struct {
+	scaleSet   scaleSetKey
+	providerID string
+	state      deletionState
+	attempts   int
+	// updatedAt is when the deletion was last requested or completed.
+	updatedAt time.Time
+	lastError string
+	// node is the node backing the instance when its deletion was requested through DeleteNodes, if any.
+	node *apiv1.Node
+}
+
+// deletionTracker tracks the instance deletions issued to ARM, so that they are reconciled on the following
+// autoscaler loops instead of being forgotten once requested. A nil tracker tracks nothing.
+type deletionTracker struct {
+	mutex     sync.Mutex
+	deletions map[string]*instanceDeletion
+}
+
+func newDeletionTracker() *deletionTracker {
+	return &deletionTracker{deletions: make(map[string]*instanceDeletion)}
+}
+
+// start records the deletion of the instances of the scale set as requested, by provider ID.
+func (t *deletionTracker) start(scaleSet scaleSetKey, providerIDs []string, now time.Time) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, providerID := range providerIDs {
+		deletion, found := t.deletions[providerID]
+		if !found {
+			deletion = &instanceDeletion{scaleSet: scaleSet, providerID: providerID}
+			t.deletions[providerID] = deletion
+		}
+		deletion.state = deletionPending
+		deletion.attempts++
+		deletion.updatedAt = now
+	}
+}
+
+// finish records the outcome of the deletion of the instances, failed if err is set.
+func (t *deletionTracker) finish(providerIDs []string, err error, now time.Time) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, providerID := range providerIDs {
+		deletion, found := t.deletions[providerID]
+		if !found {
+			continue
+		}
+		deletion.updatedAt = now
+		if err != nil {
+			deletion.state = deletionFailed
+			deletion.lastError = err.Error()
+		} else {
+			deletion.state = deletionSucceeded
+			deletion.lastError = ""
+		}
+	}
+}
+
+// recordNodes records the nodes whose deletion was requested, so that retries go through the same checks.
+func (t *deletionTracker) recordNodes(nodes []*apiv1.Node) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, node := range nodes {
+		if deletion, found := t.deletions[node.Spec.ProviderID]; found {
+			deletion.node = node.DeepCopy()
+		}
+	}
+}
+
+// fail records the deletion of the instance as failed, e.g. when the instance is found again after its deletion.
+func (t *deletionTracker) fail(providerID string, reason string, now time.Time) {
+	t.finish([]string{providerID}, fmt.Errorf("%s", reason), now)
+}
+
+// failRetry records a retry of the failed deletion of the instance which could not be requested, unless the
+// deletion was requested since now.
+func (t *deletionTracker) failRetry(providerID string, err error, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	deletion, found := t.deletions[providerID]
+	if !found || deletion.state != deletionFailed || deletion.updatedAt.After(now) {
+		return
+	}
+	deletion.attempts++
+	deletion.updatedAt = now
+	deletion.lastError = err.Error()
+}
+
+func (t *deletionTracker) forget(providerID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.deletions, providerID)
+}
+
+// byScaleSet returns copies of the tracked deletions, by scale set.
+func (t *deletionTracker) byScaleSet() map[scaleSetKey][]instanceDeletion {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	result := make(map[scaleSetKey][]instanceDeletion)
+	for _, deletion := range t.deletions {
+		result[deletion.scaleSet] = append(result[deletion.scaleSet], *deletion)
+	}
+	return result
+}
+
+// pendingCount returns the number of deletions of the scale set not confirmed yet, requested or awaiting retry.
+func (t *deletionTracker) pendingCount(scaleSet scaleSetKey) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	count := 0
+	for _, deletion := range t.deletions {
+		if deletion.scaleSet == scaleSet && deletion.state != deletionSucceeded {
+			count++
+		}
+	}
+	return count
+}
+
+// instanceListedSince returns whether the instance cache was refreshed since the given time and, if so, whether
+// it lists the instance, other than as being deleted.
+func (scaleSet *ScaleSet) instanceListedSince(providerID string, since time.Time) (listed bool, refreshed bool) {
+	instance, found, err := scaleSet.getInstanceByProviderID(providerID)
+	if err != nil {
+		return false, false
+	}
+	scaleSet.instanceMutex.Lock()
+	refreshed = scaleSet.lastInstanceRefresh.After(since)
+	scaleSet.instanceMutex.Unlock()
+	if !refreshed {
+		return false, false
+	}
+	return found && (instance.Status == nil || instance.Status.State != cloudprovider.InstanceDeleting), true
+}
+
+// reconcileDeletions reconciles the tracked instance deletions with the instances of their scale set: failed
+// deletions of instances still listed are retried up to maxDeletionAttempts, instances listed again after their
+// deletion succeeded are reported as resurrected and deleted again, and confirmed deletions are forgotten.
+// Retries go through DeleteNodes, so that they are refused like the original deletions while the scale set is
+// paused, at its min size or holding the nodes, and not issued in dry run mode. Annotation holds are checked on
+// the nodes as they were when their deletion was requested.
+func (m *AzureManager) reconcileDeletions(now time.Time) {
+	if m.deletions == nil {
+		return
+	}
+
+	scaleSets := make(map[scaleSetKey]*ScaleSet)
+	for _, nodeGroup := range m.getNodeGroups() {
+		if scaleSet, ok := nodeGroup.(*ScaleSet); ok {
+			scaleSets[scaleSet.key()] = scaleSet
+		}
+	}
+	for key, deletions := range m.deletions.byScaleSet() {
+		nodeGroup := key.name
+		scaleSet, found := scaleSets[key]
+		if !found {
+			for _, deletion := range deletions {
+				m.deletions.forget(deletion.providerID)
+			}
+			pendingDeletions.Delete(map[string]string{"node_group": nodeGroup})
+			continue
+		}
+
+		var retries []*apiv1.Node
+		for _, deletion := range deletions {
+			switch deletion.state {
+			case deletionSucceeded:
+				if now.Sub(deletion.updatedAt) > deletionResurrectionWindow {
+					m.deletions.forget(deletion.providerID)
+					continue
+				}
+				if listed, _ := scaleSet.instanceListedSince(deletion.providerID, deletion.updatedAt); listed {
+					klog.Warningf("Instance %s of scale set %s is listed again after its deletion succeeded", deletion.providerID, nodeGroup)
+					resurrectedInstances.WithLabelValues(nodeGroup).Inc()
+					m.deletions.fail(deletion.providerID, "instance listed again after its deletion", now)
+				}
+			case deletionFailed:
+				listed, refreshed := scaleSet.instanceListedSince(deletion.providerID, deletion.updatedAt)
+				switch {
+				case !refreshed || now.Sub(deletion.updatedAt) < deletionRetryBackoff:
+				case !listed:
+					klog.V(3).Infof("Instance %s of scale set %s is gone after its deletion failed", deletion.providerID, nodeGroup)
+					m.deletions.forget(deletion.providerID)
+				case deletion.attempts >= maxDeletionAttempts:
+					klog.Errorf("Giving up deleting instance %s of scale set %s after %d attempts: %s", deletion.providerID, nodeGroup, deletion.attempts, deletion.lastError)
+					m.deletions.forget(deletion.providerID)
+				default:
+					retries = append(retries, deletionNode(deletion))
+				}
+			}
+		}
+		// DeleteNodes only refuses deletions once the scale set is at its min size, the core bounding how many
+		// nodes it deletes: retries are bounded so as not to go below it.
+		if size, err := scaleSet.getScaleSetSize(); err == nil {
+			if excess := int(size) - scaleSet.MinSize(); excess > 0 && excess < len(retries) {
+				retries = retries[:excess]
+			}
+		}
+		if len(retries) > 0 {
+			klog.V(2).Infof("Retrying the deletion of %d instances of scale set %s", len(retries), nodeGroup)
+			deletionRetries.WithLabelValues(nodeGroup).Add(float64(len(retries)))
+			if err := scaleSet.DeleteNodes(retries); err != nil {
+				klog.Errorf("Failed to retry the deletion of instances of scale set %s: %v", nodeGroup, err)
+				for _, node := range retries {
+					m.deletions.failRetry(node.Spec.ProviderID, err, now)
+				}
+			}
+		}
+	}
+	for key, scaleSet := range scaleSets {
+		pendingDeletions.WithLabelValues(scaleSet.Name).Set(float64(m.deletions.pendingCount(key)))
+	}
+}
+
+// deletionNode returns the node whose deletion is retried, a placeholder for instances deleted without node.
+func deletionNode(deletion instanceDeletion) *apiv1.Node {
+	if deletion.node != nil {
+		return deletion.node
+	}
+	return &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: deletion.providerID},
+		Spec:       apiv1.NodeSpec{ProviderID: deletion.providerID},
+	}
+}
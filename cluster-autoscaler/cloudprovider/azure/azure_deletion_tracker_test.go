@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestDeletionTracker(t *testing.T) {
+	testKey := scaleSetKey{resourceGroup: "rg", name: testASG}
+	tracker := newDeletionTracker()
+	now := time.Now()
+	tracker.start(testKey, []string{"a", "b"}, now)
+	assert.Equal(t, 2, tracker.pendingCount(testKey))
+
+	tracker.finish([]string{"a"}, nil, now)
+	tracker.finish([]string{"b"}, fmt.Errorf("conflict"), now)
+	assert.Equal(t, 1, tracker.pendingCount(testKey), "failed deletions are pending until retried")
+	deletions := tracker.byScaleSet()[testKey]
+	assert.Len(t, deletions, 2)
+	for _, deletion := range deletions {
+		if deletion.providerID == "b" {
+			assert.Equal(t, deletionFailed, deletion.state)
+			assert.Equal(t, "conflict", deletion.lastError)
+		}
+	}
+
+	// Retries count as attempts, whether they could be requested or not.
+	tracker.start(testKey, []string{"b"}, now.Add(time.Minute))
+	tracker.finish([]string{"b"}, fmt.Errorf("conflict"), now.Add(time.Minute))
+	tracker.failRetry("b", fmt.Errorf("min size reached"), now.Add(2*time.Minute))
+	tracker.failRetry("b", fmt.Errorf("min size reached"), now.Add(time.Minute))
+	for _, deletion := range tracker.byScaleSet()[testKey] {
+		if deletion.providerID == "b" {
+			assert.Equal(t, 3, deletion.attempts)
+			assert.Equal(t, "min size reached", deletion.lastError)
+		}
+	}
+
+	tracker.forget("a")
+	tracker.forget("b")
+	assert.Empty(t, tracker.byScaleSet())
+
+	var nilTracker *deletionTracker
+	nilTracker.start(testKey, []string{"a"}, now)
+	nilTracker.finish([]string{"a"}, nil, now)
+}
+
+func TestReconcileDeletions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.deletions = newDeletionTracker()
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestVMSSList(3, testASG, testLocation, compute.Uniform), nil).AnyTimes()
+	mockVMSSClient.EXPECT().DeleteInstancesAsync(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any(), gomock.Any()).
+		Return(nil, &retry.Error{RawError: fmt.Errorf("conflict")})
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(newTestVMSSVMList(3), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	scaleSet := newTestScaleSet(manager, testASG)
+	assert.True(t, manager.RegisterNodeGroup(scaleSet))
+	manager.explicitlyConfigured[testASG] = true
+
+	providerID := func(i int) string {
+		return azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, i)
+	}
+	before := time.Now().Add(-2 * time.Minute)
+	manager.deletions.start(scaleSet.key(), []string{providerID(0), providerID(1), providerID(2), providerID(7)}, before)
+	manager.deletions.finish([]string{providerID(0), providerID(7)}, fmt.Errorf("conflict"), before)
+	manager.deletions.finish([]string{providerID(1)}, nil, before)
+	// Instance 2 failed too often already.
+	manager.deletions.start(scaleSet.key(), []string{providerID(2)}, before)
+	manager.deletions.start(scaleSet.key(), []string{providerID(2)}, before)
+	manager.deletions.finish([]string{providerID(2)}, fmt.Errorf("conflict"), before)
+	// Deletions of a same-named scale set of another resource group are not reconciled with the registered one.
+	otherScaleSet := scaleSetKey{resourceGroup: "other-rg", name: testASG}
+	manager.deletions.start(otherScaleSet, []string{"other"}, before)
+	manager.deletions.finish([]string{"other"}, fmt.Errorf("conflict"), before)
+	assert.NoError(t, manager.forceRefresh())
+
+	now := time.Now()
+	manager.reconcileDeletions(now)
+	deletions := make(map[string]instanceDeletion)
+	for _, deletion := range manager.deletions.byScaleSet()[scaleSet.key()] {
+		deletions[deletion.providerID] = deletion
+	}
+	assert.Len(t, deletions, 2, "deletions of gone instances and given up deletions are forgotten")
+	assert.Empty(t, manager.deletions.byScaleSet()[otherScaleSet], "deletions of unregistered scale sets are forgotten")
+	assert.Equal(t, deletionFailed, deletions[providerID(0)].state)
+	assert.Equal(t, 2, deletions[providerID(0)].attempts, "failed deletions of listed instances are retried")
+	assert.Equal(t, deletionFailed, deletions[providerID(1)].state, "instances listed again after their deletion are resurrected")
+	assert.Equal(t, 2, manager.deletions.pendingCount(scaleSet.key()))
+
+	// Nothing is retried again within the backoff.
+	manager.reconcileDeletions(time.Now())
+	assert.Equal(t, 2, manager.deletions.pendingCount(scaleSet.key()))
+}
+
+func TestReconcileDeletionsGuarded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.deletions = newDeletionTracker()
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestVMSSList(3, testASG, testLocation, compute.Uniform), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(newTestVMSSVMList(3), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	scaleSet := newTestScaleSet(manager, testASG)
+	assert.True(t, manager.RegisterNodeGroup(scaleSet))
+	manager.explicitlyConfigured[testASG] = true
+
+	providerID := azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, 0)
+	node := &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0", Annotations: map[string]string{deletionHoldAnnotationKey: "true"}},
+		Spec:       apiv1.NodeSpec{ProviderID: providerID},
+	}
+	before := time.Now().Add(-2 * time.Minute)
+	manager.deletions.start(scaleSet.key(), []string{providerID}, before)
+	manager.deletions.finish([]string{providerID}, fmt.Errorf("conflict"), before)
+	manager.deletions.recordNodes([]*apiv1.Node{node})
+	assert.NoError(t, manager.forceRefresh())
+
+	// No deletion is requested from VMSS: the retry is refused like the original deletion would be.
+	attempts := func() int {
+		return manager.deletions.byScaleSet()[scaleSet.key()][0].attempts
+	}
+	manager.reconcileDeletions(time.Now())
+	assert.Equal(t, 2, attempts(), "retries of held nodes are refused")
+
+	delete(node.Annotations, deletionHoldAnnotationKey)
+	manager.deletions.recordNodes([]*apiv1.Node{node})
+	scaleSet.minSize = 3
+	manager.reconcileDeletions(time.Now().Add(deletionRetryBackoff))
+	assert.Equal(t, 3, attempts(), "retries in scale sets at their min size are refused")
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+// dryRun returns whether mutating operations are disabled by the dryRun config. If so, the operation on nodeGroup,
+// described by format and args, is logged, counted by the azure_dry_run_operations_total metric and recorded in the
+// decision report instead, and callers must return as if it succeeded without executing it. Otherwise, callers
+// record the operation with recordMutation once its outcome is known.
+func (m *AzureManager) dryRun(operation, nodeGroup, format string, args ...interface{}) bool {
+	if m == nil || !m.config.DryRun {
+		return false
+	}
+	klog.InfofDepth(1, "Dry run, not executing %s on node group %s: "+format, append([]interface{}{operation, nodeGroup}, args...)...)
+	dryRunOperations.WithLabelValues(operation).Inc()
+	m.decisions.recordMutation(decisionMutation{
+		Operation:   operation,
+		NodeGroup:   nodeGroup,
+		Description: fmt.Sprintf(format, args...),
+		DryRun:      true,
+		Time:        time.Now(),
+	})
+	return true
+}
+
+// recordMutation records the operation on nodeGroup, described by format and args, in the decision report. err is
+// the error of the ARM request, or of the hook which vetoed the operation, if any.
+func (m *AzureManager) recordMutation(operation, nodeGroup string, err error, format string, args ...interface{}) {
+	if m == nil {
+		return
+	}
+	mutation := decisionMutation{
+		Operation:   operation,
+		NodeGroup:   nodeGroup,
+		Description: fmt.Sprintf(format, args...),
+		Time:        time.Now(),
+	}
+	if err != nil {
+		mutation.Error = err.Error()
+	}
+	m.decisions.recordMutation(mutation)
+}
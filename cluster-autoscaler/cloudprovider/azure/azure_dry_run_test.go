@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	apiv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func TestDryRunScaleSetCapacityUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.config.DryRun = true
+	// No calls are expected on the scale set client.
+	manager.azClient.virtualMachineScaleSetsClient = mockvmssclient.NewMockInterface(ctrl)
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	vmss := compute.VirtualMachineScaleSet{Name: to.StringPtr(testASG), Sku: &compute.Sku{Capacity: to.Int64Ptr(3)}}
+	assert.NoError(t, scaleSet.createOrUpdateInstances(&vmss, 5))
+	assert.Equal(t, int64(3), *vmss.Sku.Capacity)
+	assert.NoError(t, scaleSet.probeCapacity(vmss, 3))
+
+	manager.config.DryRun = false
+	assert.False(t, manager.dryRun(operationUpdateCapacity, testASG, "set capacity to %d", 5))
+}
+
+func TestDryRunVMsPoolDeleteNodes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ap := newTestVMsPool(newTestAzureManager(t))
+	ap.manager.config.DryRun = true
+
+	mockVMClient := mockvmclient.NewMockInterface(ctrl)
+	ap.manager.azClient.virtualMachinesClient = mockVMClient
+	ap.manager.config.EnableVMsAgentPool = true
+	mockAgentpoolclient := NewMockAgentPoolsClient(ctrl)
+	agentpool := getTestVMsAgentPool(false)
+	ap.manager.azClient.agentPoolClient = mockAgentpoolclient
+	mockAgentpoolclient.EXPECT().NewListPager(gomock.Any(), gomock.Any(), nil).Return(getFakeAgentpoolListPager(&agentpool))
+	mockVMClient.EXPECT().List(gomock.Any(), ap.manager.config.ResourceGroup).Return(newTestVMsPoolVMList(5), nil)
+
+	ap.manager.azureCache.enableVMsAgentPool = true
+	assert.True(t, ap.manager.RegisterNodeGroup(ap))
+	ap.manager.explicitlyConfigured[vmsNodeGroupName] = true
+	assert.NoError(t, ap.manager.forceRefresh())
+
+	// BeginDeleteMachines is not expected to be called.
+	assert.NoError(t, ap.DeleteNodes([]*apiv1.Node{newVMsNode(0)}))
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/go-autorest/autorest/azure"
+	klog "k8s.io/klog/v2"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// errorSummaryInterval is how often the repeated errors of the cache are summarized in the logs. Errors which
+	// didn't repeat for that long are forgotten, and logged again on their next occurrence.
+	errorSummaryInterval = 5 * time.Minute
+
+	unknownErrorCode = "Unknown"
+)
+
+// errorAggregator deduplicates the repeated ARM errors of the cache, which would otherwise be logged on every
+// refresh while the failure lasts. The first occurrence of an error is logged, while the repeated ones, by call,
+// target and error code, are counted and summarized every errorSummaryInterval.
+// All errors are counted by the azure_cache_errors_total metric. A nil aggregator logs every error.
+type errorAggregator struct {
+	mutex       sync.Mutex
+	lastSummary time.Time
+	errors      map[aggregatedErrorKey]*aggregatedError
+
+	// decisions records every error in the decision report of the current loop.
+	decisions *decisionReporter
+}
+
+type aggregatedErrorKey struct {
+	call   string
+	target string
+	code   string
+}
+
+type aggregatedError struct {
+	// repeated is the number of occurrences not logged since the last summary.
+	repeated    int
+	lastSeen    time.Time
+	lastMessage string
+}
+
+func newErrorAggregator() *errorAggregator {
+	return &errorAggregator{errors: make(map[aggregatedErrorKey]*aggregatedError)}
+}
+
+// errorf reports err, a *retry.Error or an error, failing call on target at now, logging the message built from format and args unless the
+// same error was already logged since the last summary.
+func (a *errorAggregator) errorf(call, target string, err interface{}, now time.Time, format string, args ...interface{}) {
+	code := errorCode(err)
+	cacheErrors.WithLabelValues(call, code).Inc()
+	if a == nil {
+		klog.ErrorfDepth(1, format, args...)
+		return
+	}
+	a.decisions.recordError(decisionError{Call: call, Target: target, Code: code, Message: fmt.Sprintf(format, args...), Time: now})
+
+	key := aggregatedErrorKey{call: call, target: target, code: code}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.lastSummary.IsZero() {
+		a.lastSummary = now
+	}
+	if e, found := a.errors[key]; found {
+		e.repeated++
+		e.lastSeen = now
+		e.lastMessage = fmt.Sprintf(format, args...)
+		return
+	}
+	a.errors[key] = &aggregatedError{lastSeen: now}
+	klog.ErrorfDepth(1, format, args...)
+}
+
+// summarize logs how many times each error repeated since the last summary, once every errorSummaryInterval, and
+// forgets the errors which didn't occur since.
+func (a *errorAggregator) summarize(now time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if now.Sub(a.lastSummary) < errorSummaryInterval {
+		return
+	}
+
+	keys := make([]aggregatedErrorKey, 0, len(a.errors))
+	for key := range a.errors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	for _, key := range keys {
+		e := a.errors[key]
+		if e.repeated > 0 {
+			name := key.call
+			if key.target != "" {
+				name += " for " + key.target
+			}
+			klog.Errorf("%s failed %d more times with %s since %v, last error: %s", name, e.repeated, key.code, a.lastSummary, e.lastMessage)
+			e.repeated = 0
+		}
+		if now.Sub(e.lastSeen) >= errorSummaryInterval {
+			delete(a.errors, key)
+		}
+	}
+	a.lastSummary = now
+}
+
+// errorCode returns the ARM error code of err, a *retry.Error or an error, or its HTTP status code if it has none.
+func errorCode(err interface{}) string {
+	switch e := err.(type) {
+	case *retry.Error:
+		if e == nil {
+			return unknownErrorCode
+		}
+		if code := e.ServiceErrorCode(); code != "" {
+			return code
+		}
+		if e.HTTPStatusCode != 0 {
+			return strconv.Itoa(e.HTTPStatusCode)
+		}
+		return errorCode(e.RawError)
+	case error:
+		var respErr *azcore.ResponseError
+		if errors.As(e, &respErr) {
+			if respErr.ErrorCode != "" {
+				return respErr.ErrorCode
+			}
+			return strconv.Itoa(respErr.StatusCode)
+		}
+		// Long-running operations of the track 1 SDK fail with the service error of the operation.
+		var serviceErr *azure.ServiceError
+		if errors.As(e, &serviceErr) && serviceErr.Code != "" {
+			return serviceErr.Code
+		}
+		var requestErr *azure.RequestError
+		if errors.As(e, &requestErr) && requestErr.ServiceError != nil && requestErr.ServiceError.Code != "" {
+			return requestErr.ServiceError.Code
+		}
+	}
+	return unknownErrorCode
+}
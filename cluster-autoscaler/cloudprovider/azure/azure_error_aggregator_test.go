@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestErrorAggregator(t *testing.T) {
+	now := time.Now()
+	a := newErrorAggregator()
+	throttled := &retry.Error{HTTPStatusCode: http.StatusTooManyRequests}
+	key := aggregatedErrorKey{call: "VirtualMachineScaleSetsClient.List", target: "rg", code: "429"}
+
+	a.errorf(key.call, key.target, throttled, now, "List failed: %v", 1)
+	assert.Equal(t, 0, a.errors[key].repeated, "the first occurrence is logged")
+	a.errorf(key.call, key.target, throttled, now.Add(time.Minute), "List failed: %v", 2)
+	a.errorf(key.call, key.target, throttled, now.Add(2*time.Minute), "List failed: %v", 3)
+	assert.Equal(t, 2, a.errors[key].repeated)
+	assert.Equal(t, "List failed: 3", a.errors[key].lastMessage)
+
+	a.errorf(key.call, "other-rg", throttled, now, "List failed")
+	assert.Len(t, a.errors, 2, "errors are aggregated by target")
+
+	a.summarize(now.Add(time.Minute))
+	assert.Equal(t, 2, a.errors[key].repeated, "summaries are logged every errorSummaryInterval")
+
+	a.summarize(now.Add(errorSummaryInterval + time.Minute))
+	assert.Equal(t, 0, a.errors[key].repeated)
+	assert.Len(t, a.errors, 1, "errors which didn't repeat since the last summary are forgotten")
+
+	a.summarize(now.Add(2*errorSummaryInterval + 2*time.Minute))
+	assert.Empty(t, a.errors)
+
+	var nilAggregator *errorAggregator
+	nilAggregator.errorf(key.call, key.target, throttled, now, "List failed")
+	nilAggregator.summarize(now)
+}
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, "429", errorCode(&retry.Error{HTTPStatusCode: http.StatusTooManyRequests}))
+	assert.Equal(t, "OperationNotAllowed", errorCode(&retry.Error{
+		HTTPStatusCode: http.StatusConflict,
+		RawError:       fmt.Errorf(`{"error": {"code": "OperationNotAllowed", "message": "not allowed"}}`),
+	}))
+	assert.Equal(t, "ResourceNotFound", errorCode(fmt.Errorf("listing: %w", &azcore.ResponseError{ErrorCode: "ResourceNotFound", StatusCode: http.StatusNotFound})))
+	assert.Equal(t, "500", errorCode(&azcore.ResponseError{StatusCode: http.StatusInternalServerError}))
+	assert.Equal(t, "ZonalAllocationFailed", errorCode(&azure.ServiceError{Code: "ZonalAllocationFailed"}))
+	assert.Equal(t, "QuotaExceeded", errorCode(autorest.DetailedError{Original: &azure.RequestError{ServiceError: &azure.ServiceError{Code: "QuotaExceeded"}}}))
+	assert.Equal(t, unknownErrorCode, errorCode(fmt.Errorf("context deadline exceeded")))
+	assert.Equal(t, unknownErrorCode, errorCode((*retry.Error)(nil)))
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	klog "k8s.io/klog/v2"
+)
+
+// scaleSetResourceIDRE matches the resource ID of a scale set, capturing its subscription, resource group and name.
+var scaleSetResourceIDRE = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft\.Compute/virtualMachineScaleSets/([^/]+)$`)
+
+// parseScaleSetResourceID returns the subscription, resource group and name of the scale set with the given
+// resource ID, or false if id is not a scale set resource ID.
+func parseScaleSetResourceID(id string) (subscriptionID, resourceGroup, name string, ok bool) {
+	matches := scaleSetResourceIDRE.FindStringSubmatch(id)
+	if matches == nil {
+		return "", "", "", false
+	}
+	return matches[1], matches[2], matches[3], true
+}
+
+// resourceGroupName returns the resource group of the scale set: the configured one, unless the node group was
+// registered by the resource ID of a scale set in another resource group.
+func (scaleSet *ScaleSet) resourceGroupName() string {
+	if scaleSet.resourceGroup != "" {
+		return scaleSet.resourceGroup
+	}
+	return scaleSet.manager.config.ResourceGroup
+}
+
+// scaleSetKey identifies a scale set by resource group and name, as scale sets of different resource groups may
+// share their name.
+type scaleSetKey struct {
+	resourceGroup string
+	name          string
+}
+
+// key returns the key of the scale set. Resource groups are case-insensitive.
+func (scaleSet *ScaleSet) key() scaleSetKey {
+	return scaleSetKey{resourceGroup: strings.ToLower(scaleSet.resourceGroupName()), name: scaleSet.Name}
+}
+
+// cachedModel returns the model of the scale set in scaleSets, by name, unless it belongs to a same-named scale set
+// of another resource group.
+func (scaleSet *ScaleSet) cachedModel(scaleSets map[string]compute.VirtualMachineScaleSet) (compute.VirtualMachineScaleSet, bool) {
+	vmss, found := scaleSets[scaleSet.Name]
+	if !found {
+		return vmss, false
+	}
+	if _, resourceGroup, _, ok := parseScaleSetResourceID(to.String(vmss.ID)); ok && !strings.EqualFold(resourceGroup, scaleSet.resourceGroupName()) {
+		return vmss, false
+	}
+	return vmss, true
+}
+
+// isExternal returns whether the scale set lives outside the resource group listed by the cache.
+func (scaleSet *ScaleSet) isExternal() bool {
+	return scaleSet.resourceGroup != "" && !strings.EqualFold(scaleSet.resourceGroup, scaleSet.manager.config.ResourceGroup)
+}
+
+// fetchExternalScaleSets adds to sets the scale sets of registered node groups which live outside the resource
+// group of the cache, fetched one by one as they don't show up in its listing. Caller must hold m.mutex.
+func (m *azureCache) fetchExternalScaleSets(sets map[string]compute.VirtualMachineScaleSet) error {
+	ctx, cancel := getContextWithTimeout(vmssContextTimeout)
+	defer cancel()
+
+	for _, ng := range m.registeredNodeGroups {
+		scaleSet, ok := ng.(*ScaleSet)
+		if !ok || !scaleSet.isExternal() {
+			continue
+		}
+		vmss, rerr := m.azClient.virtualMachineScaleSetsClient.Get(ctx, scaleSet.resourceGroup, scaleSet.Name)
+		m.callQueue.observe(rerr, time.Now())
+		exists, err := checkResourceExistsFromRetryError(rerr)
+		if err != nil {
+			return fmt.Errorf("failed to get scale set %q in resource group %q: %w", scaleSet.Name, scaleSet.resourceGroup, err)
+		}
+		if !exists {
+			klog.Warningf("Scale set %q of registered node group not found in resource group %q", scaleSet.Name, scaleSet.resourceGroup)
+			continue
+		}
+		sets[*vmss.Name] = vmss
+	}
+	return nil
+}
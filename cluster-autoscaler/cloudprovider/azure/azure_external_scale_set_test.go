@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/config/dynamic"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const testExternalScaleSetID = "/subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.Compute/virtualMachineScaleSets/byo-asg"
+
+func TestParseScaleSetResourceID(t *testing.T) {
+	subscriptionID, resourceGroup, name, ok := parseScaleSetResourceID(testExternalScaleSetID)
+	assert.True(t, ok)
+	assert.Equal(t, "sub", subscriptionID)
+	assert.Equal(t, "other-rg", resourceGroup)
+	assert.Equal(t, "byo-asg", name)
+
+	for _, id := range []string{
+		"byo-asg",
+		"pool/Standard_D2_v2",
+		"/subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.Compute/virtualMachines/vm",
+		testExternalScaleSetID + "/virtualMachines/0",
+	} {
+		_, _, _, ok := parseScaleSetResourceID(id)
+		assert.False(t, ok, id)
+	}
+}
+
+func TestNewScaleSetFromResourceID(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.config.SubscriptionID = "sub"
+
+	scaleSet, err := NewScaleSet(&dynamic.NodeGroupSpec{Name: testExternalScaleSetID, MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "byo-asg", scaleSet.Id())
+	assert.Equal(t, "other-rg", scaleSet.resourceGroupName())
+	assert.True(t, scaleSet.isExternal())
+
+	scaleSet, err = NewScaleSet(&dynamic.NodeGroupSpec{Name: testASG, MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, manager.config.ResourceGroup, scaleSet.resourceGroupName())
+	assert.False(t, scaleSet.isExternal())
+
+	manager.config.SubscriptionID = "other-sub"
+	_, err = NewScaleSet(&dynamic.NodeGroupSpec{Name: testExternalScaleSetID, MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.ErrorContains(t, err, "not in subscription")
+}
+
+func TestScaleSetKeyAndCachedModel(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.config.SubscriptionID = "sub"
+	external, err := NewScaleSet(&dynamic.NodeGroupSpec{Name: testExternalScaleSetID, MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.NoError(t, err)
+	local, err := NewScaleSet(&dynamic.NodeGroupSpec{Name: "byo-asg", MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, external.key(), local.key(), "same-named scale sets of different resource groups")
+
+	scaleSets := map[string]compute.VirtualMachineScaleSet{"byo-asg": {Name: to.StringPtr("byo-asg"), ID: to.StringPtr(testExternalScaleSetID)}}
+	_, found := external.cachedModel(scaleSets)
+	assert.True(t, found)
+	_, found = local.cachedModel(scaleSets)
+	assert.False(t, found, "the cached model belongs to the scale set of the other resource group")
+}
+
+func TestFetchScaleSetsWithExternalScaleSets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.config.SubscriptionID = "sub"
+	external, err := NewScaleSet(&dynamic.NodeGroupSpec{Name: testExternalScaleSetID, MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.NoError(t, err)
+	gone, err := NewScaleSet(&dynamic.NodeGroupSpec{Name: "/subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.Compute/virtualMachineScaleSets/gone",
+		MinSize: 1, MaxSize: 5}, manager, -1, false)
+	assert.NoError(t, err)
+	ac := manager.azureCache
+	ac.registeredNodeGroups = []cloudprovider.NodeGroup{newTestScaleSet(manager, testASG), external, gone}
+
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachineScaleSet{{Name: to.StringPtr(testASG)}}, nil)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "other-rg", "byo-asg").Return(compute.VirtualMachineScaleSet{Name: to.StringPtr("byo-asg")}, nil)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "other-rg", "gone").Return(compute.VirtualMachineScaleSet{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+	ac.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+
+	sets, err := ac.fetchScaleSets()
+	assert.NoError(t, err)
+	assert.Len(t, sets, 2)
+	assert.Contains(t, sets, testASG)
+	assert.Contains(t, sets, "byo-asg")
+
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachineScaleSet{{Name: to.StringPtr(testASG)}}, nil)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "other-rg", "byo-asg").Return(compute.VirtualMachineScaleSet{}, &retry.Error{HTTPStatusCode: http.StatusForbidden})
+	ac.registeredNodeGroups = ac.registeredNodeGroups[:2]
+	_, err = ac.fetchScaleSets()
+	assert.Error(t, err)
+}
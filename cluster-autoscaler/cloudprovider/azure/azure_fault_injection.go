@@ -0,0 +1,46 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"time"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// faultInjector fails or delays the ARM calls of the cache, so that tests can deterministically exercise its
+// throttling, back-off and degradation paths. See the internal/cachetest package.
+type faultInjector interface {
+	// Inject is called before the ARM call on target, and fails it with the returned error if not nil.
+	Inject(call, target string) *retry.Error
+}
+
+// injectFault returns the error injected into the ARM call on target, nil if none or no injector is set.
+func (m *azureCache) injectFault(call, target string) *retry.Error {
+	if m.faults == nil {
+		return nil
+	}
+	return m.faults.Inject(call, target)
+}
+
+// now returns the time of the clock of the cache, or the real time if it has none.
+func (m *azureCache) now() time.Time {
+	if m == nil || m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
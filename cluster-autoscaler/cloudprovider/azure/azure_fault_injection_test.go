@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	testingclock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/azure/internal/cachetest"
+)
+
+const (
+	listScaleSetsCall   = "VirtualMachineScaleSetsClient.List"
+	listScaleSetVMsCall = "VirtualMachineScaleSetVMsClient.List"
+)
+
+func TestCacheRefreshWithInjectedFaults(t *testing.T) {
+	manager := newTestAzureManager(t)
+	clk := testingclock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	injector := cachetest.NewInjector(clk, 1, cachetest.Faults{Calls: []string{listScaleSetsCall}})
+	manager.azureCache.clock = clk
+	manager.azureCache.faults = injector
+	manager.refreshHealth = newRefreshHealth(manager.config)
+	interval := manager.azureCache.refreshInterval
+	health := func() bool {
+		return manager.refreshHealth.health(manager.azureCache.callQueue.throttledUntilAt(), clk.Now()).Degraded
+	}
+
+	assert.NoError(t, manager.forceRefresh())
+	assert.Equal(t, 1, injector.Calls(listScaleSetsCall))
+
+	// The cache is only refreshed once its TTL expired.
+	clk.Step(interval / 2)
+	assert.NoError(t, manager.Refresh())
+	assert.Equal(t, 1, injector.Calls(listScaleSetsCall))
+	clk.Step(interval / 2)
+	assert.NoError(t, manager.Refresh())
+	assert.Equal(t, 2, injector.Calls(listScaleSetsCall))
+
+	// Throttled refreshes degrade ARM and are deferred until Retry-After, keeping the cached resources.
+	injector.SetFaults(cachetest.Faults{ThrottleRate: 1, RetryAfter: 2 * interval, Calls: []string{listScaleSetsCall}})
+	clk.Step(interval)
+	assert.Error(t, manager.Refresh())
+	assert.Equal(t, 3, injector.Calls(listScaleSetsCall))
+	assert.True(t, health())
+	injector.SetFaults(cachetest.Faults{Calls: []string{listScaleSetsCall}})
+	clk.Step(interval)
+	assert.NoError(t, manager.Refresh())
+	assert.Equal(t, 3, injector.Calls(listScaleSetsCall), "refresh deferred while throttled")
+	assert.NotEmpty(t, manager.azureCache.getScaleSets())
+	clk.Step(interval)
+	assert.NoError(t, manager.Refresh())
+	assert.Equal(t, 4, injector.Calls(listScaleSetsCall))
+
+	// Slow refreshes degrade ARM until a refresh is fast again.
+	injector.SetFaults(cachetest.Faults{Latency: 2 * defaultBackPressureLatencyThreshold, Calls: []string{listScaleSetsCall}})
+	clk.Step(interval)
+	assert.NoError(t, manager.Refresh())
+	assert.True(t, health())
+	injector.SetFaults(cachetest.Faults{Calls: []string{listScaleSetsCall}})
+	clk.Step(interval)
+	assert.NoError(t, manager.Refresh())
+	assert.False(t, health())
+}
+
+func TestScaleSetInstanceRefreshWithInjectedFaults(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestVMSSList(3, testASG, testLocation, compute.Uniform), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(newTestVMSSVMList(3), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	clk := testingclock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	injector := cachetest.NewInjector(clk, 1, cachetest.Faults{Calls: []string{listScaleSetVMsCall}})
+	manager.azureCache.clock = clk
+	manager.azureCache.faults = injector
+	scaleSet := newTestScaleSet(manager, testASG)
+	scaleSet.instancesRefreshPeriod = time.Minute
+	assert.True(t, manager.RegisterNodeGroup(scaleSet))
+	manager.explicitlyConfigured[testASG] = true
+	assert.NoError(t, manager.forceRefresh())
+
+	nodes, err := scaleSet.Nodes()
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 3)
+	assert.Equal(t, 1, injector.Calls(listScaleSetVMsCall))
+
+	// The instances are only listed again once their TTL expired.
+	clk.Step(scaleSet.instancesRefreshPeriod / 2)
+	_, err = scaleSet.Nodes()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, injector.Calls(listScaleSetVMsCall))
+	clk.Step(scaleSet.instancesRefreshPeriod / 2)
+	_, err = scaleSet.Nodes()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, injector.Calls(listScaleSetVMsCall))
+
+	// Failed listings are reported.
+	injector.SetFaults(cachetest.Faults{ErrorRate: 1, Calls: []string{listScaleSetVMsCall}})
+	clk.Step(scaleSet.instancesRefreshPeriod)
+	_, err = scaleSet.Nodes()
+	assert.Error(t, err)
+	assert.Equal(t, 3, injector.Calls(listScaleSetVMsCall))
+}
@@ -67,7 +67,7 @@ func (scaleSet *ScaleSet) deleteInstances(ctx context.Context, requiredIds *comp
 	defer scaleSet.instanceMutex.Unlock()
 
 	skuName := scaleSet.getSKU()
-	resourceGroup := scaleSet.manager.config.ResourceGroup
+	resourceGroup := scaleSet.resourceGroupName()
 	forceDelete := shouldForceDelete(skuName, scaleSet)
 	future, rerr := scaleSet.manager.azClient.virtualMachineScaleSetsClient.DeleteInstancesAsync(ctx, resourceGroup, commonAsgId, *requiredIds, forceDelete)
 	if forceDelete && isOperationNotAllowed(rerr) {
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// healthPenaltyHalfLife is how long it takes for the penalty of node group failures to halve.
+	healthPenaltyHalfLife = 10 * time.Minute
+	// unhealthyScore is the health score under which node groups are deprioritized by the Azure expander.
+	unhealthyScore = 0.5
+	// recoveredPenalty is the penalty under which the failures of a node group are forgotten.
+	recoveredPenalty = 0.01
+	// healthScoreAnnotationKey is set on node infos to the health score of their node group, between 0 and 1,
+	// when it failed recently, so that expanders can steer away from unhealthy node groups.
+	healthScoreAnnotationKey = "cluster-autoscaler.kubernetes.io/azure-health-score"
+)
+
+// failureKind is a kind of node group failure.
+type failureKind string
+
+const (
+	failureStockout     failureKind = "stockout"
+	failureProvisioning failureKind = "provisioning"
+	failureThrottling   failureKind = "throttling"
+	// failurePlatformIssue is recorded while Resource Health reports a platform issue for the node group.
+	failurePlatformIssue failureKind = "platform-issue"
+)
+
+// failurePenalties are the penalties added to the health of a node group by each kind of failure.
+var failurePenalties = map[failureKind]float64{
+	failureStockout:      2,
+	failureProvisioning:  1,
+	failureThrottling:    0.25,
+	failurePlatformIssue: 2,
+}
+
+// nodeGroupHealth scores node groups by their recent failures. Each failure adds a penalty to its node group,
+// halving every healthPenaltyHalfLife, and the health score of a node group is 1/(1+penalty): 1 without recent
+// failures, under unhealthyScore after a stockout or repeated failures. The zero value is ready to use.
+type nodeGroupHealth struct {
+	mutex  sync.Mutex
+	groups map[string]*healthRecord
+}
+
+type healthRecord struct {
+	penalty     float64
+	updatedAt   time.Time
+	lastFailure failureKind
+}
+
+// decayed returns the penalty of the record at now.
+func (r *healthRecord) decayed(now time.Time) float64 {
+	return r.penalty * math.Pow(0.5, float64(now.Sub(r.updatedAt))/float64(healthPenaltyHalfLife))
+}
+
+func (h *nodeGroupHealth) record(nodeGroup string, kind failureKind, now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.groups == nil {
+		h.groups = make(map[string]*healthRecord)
+	}
+	r, found := h.groups[nodeGroup]
+	if !found {
+		r = &healthRecord{updatedAt: now}
+		h.groups[nodeGroup] = r
+	}
+	r.penalty = r.decayed(now) + failurePenalties[kind]
+	r.updatedAt = now
+	r.lastFailure = kind
+	nodeGroupHealthScore.WithLabelValues(nodeGroup).Set(healthScore(r.penalty))
+}
+
+// score returns the health score of the node group at now, and the kind of its last failure if it failed recently.
+func (h *nodeGroupHealth) score(nodeGroup string, now time.Time) (float64, failureKind, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	r, found := h.groups[nodeGroup]
+	if !found {
+		return 1, "", false
+	}
+	penalty := r.decayed(now)
+	if penalty < recoveredPenalty {
+		return 1, "", false
+	}
+	return healthScore(penalty), r.lastFailure, true
+}
+
+// report updates the health score metric of the node groups which failed recently, and forgets the recovered ones.
+func (h *nodeGroupHealth) report(now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for nodeGroup, r := range h.groups {
+		penalty := r.decayed(now)
+		if penalty < recoveredPenalty {
+			delete(h.groups, nodeGroup)
+			nodeGroupHealthScore.Delete(map[string]string{"node_group": nodeGroup})
+			continue
+		}
+		nodeGroupHealthScore.WithLabelValues(nodeGroup).Set(healthScore(penalty))
+	}
+}
+
+// debugScore returns the health score of the node group, and the kind of its last failure if it failed recently.
+func (h *nodeGroupHealth) debugScore(nodeGroup string, now time.Time) (float64, failureKind) {
+	score, lastFailure, _ := h.score(nodeGroup, now)
+	return score, lastFailure
+}
+
+// describeHealth returns the health of a node group for its debug string, empty if it didn't fail recently.
+func describeHealth(score float64, lastFailure failureKind) string {
+	if lastFailure == "" {
+		return ""
+	}
+	if score < unhealthyScore {
+		return fmt.Sprintf(" unhealthy (score %.2f, last failure: %s)", score, lastFailure)
+	}
+	return fmt.Sprintf(" health score %.2f", score)
+}
+
+func healthScore(penalty float64) float64 {
+	return 1 / (1 + penalty)
+}
+
+// recordScaleUpFailure records a failed scale-up of the node group in its health, and as a stockout if
+// caused by lack of capacity or quota.
+func (m *AzureManager) recordScaleUpFailure(nodeGroup string, err error) {
+	if isOutOfResourcesError(err) {
+		m.recordStockout(nodeGroup, err)
+		return
+	}
+	m.health.record(nodeGroup, failureProvisioning, m.azureCache.now())
+}
+
+// recordThrottling records in the health of the node group that a call mutating it was throttled.
+func (m *AzureManager) recordThrottling(nodeGroup string, rerr *retry.Error) {
+	if rerr != nil && isAzureRequestsThrottled(rerr) {
+		m.health.record(nodeGroup, failureThrottling, m.azureCache.now())
+	}
+}
+
+// annotateHealthScore sets the health score of the node group on the node, if it failed recently.
+func (m *AzureManager) annotateHealthScore(nodeGroup string, node *apiv1.Node) {
+	score, _, found := m.health.score(nodeGroup, m.azureCache.now())
+	if !found {
+		return
+	}
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[healthScoreAnnotationKey] = fmt.Sprintf("%.2f", score)
+}
+
+// NodeGroupAnnotations returns the annotations describing the recent stockouts and health of the node group, so that
+// expanders see them for node groups with ready nodes, whose node infos aren't built from templates.
+func (azure *AzureCloudProvider) NodeGroupAnnotations(nodeGroup cloudprovider.NodeGroup) map[string]string {
+	node := &apiv1.Node{}
+	azure.azureManager.annotateLastStockout(nodeGroup.Id(), node)
+	azure.azureManager.annotateHealthScore(nodeGroup.Id(), node)
+	return node.Annotations
+}
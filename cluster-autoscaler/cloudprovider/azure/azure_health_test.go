@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestNodeGroupHealth(t *testing.T) {
+	now := time.Now()
+	health := nodeGroupHealth{}
+
+	score, _, found := health.score("ng", now)
+	assert.False(t, found)
+	assert.Equal(t, 1.0, score)
+	assert.Empty(t, describeHealth(health.debugScore("ng", now)))
+
+	health.record("ng", failureProvisioning, now)
+	score, lastFailure, found := health.score("ng", now)
+	assert.True(t, found)
+	assert.InDelta(t, 0.5, score, 0.001)
+	assert.Equal(t, failureProvisioning, lastFailure)
+	assert.Equal(t, " health score 0.50", describeHealth(health.debugScore("ng", now)))
+
+	health.record("ng", failureStockout, now)
+	assert.Equal(t, " unhealthy (score 0.25, last failure: stockout)", describeHealth(health.debugScore("ng", now)))
+
+	// The penalty of 3 halves every half-life.
+	score, _, _ = health.score("ng", now.Add(healthPenaltyHalfLife))
+	assert.InDelta(t, 0.4, score, 0.001)
+
+	health.report(now.Add(10 * healthPenaltyHalfLife))
+	_, _, found = health.score("ng", now)
+	assert.False(t, found, "recovered node groups are forgotten")
+}
+
+func TestRecordNodeGroupFailures(t *testing.T) {
+	manager := newTestAzureManager(t)
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	manager.recordThrottling(testASG, &retry.Error{HTTPStatusCode: http.StatusInternalServerError})
+	manager.recordThrottling(testASG, nil)
+	assert.NotContains(t, scaleSet.Debug(), "health")
+
+	manager.recordThrottling(testASG, &retry.Error{HTTPStatusCode: http.StatusTooManyRequests})
+	_, lastFailure, _ := manager.health.score(testASG, time.Now())
+	assert.Equal(t, failureThrottling, lastFailure)
+
+	manager.recordScaleUpFailure(testASG, &azure.ServiceError{Code: "InternalServerError"})
+	_, lastFailure, _ = manager.health.score(testASG, time.Now())
+	assert.Equal(t, failureProvisioning, lastFailure)
+
+	manager.recordScaleUpFailure(testASG, &azure.ServiceError{Code: "ZonalAllocationFailed"})
+	_, lastFailure, _ = manager.health.score(testASG, time.Now())
+	assert.Equal(t, failureStockout, lastFailure)
+	_, found := manager.stockouts.last(testASG, time.Now())
+	assert.True(t, found)
+
+	assert.Contains(t, scaleSet.Debug(), " unhealthy (score ")
+	node := &apiv1.Node{}
+	manager.annotateHealthScore(testASG, node)
+	assert.Equal(t, "0.24", node.Annotations[healthScoreAnnotationKey])
+}
+
+func TestNodeGroupAnnotations(t *testing.T) {
+	provider := newTestProvider(t)
+	scaleSet := newTestScaleSet(provider.azureManager, testASG)
+	assert.Empty(t, provider.NodeGroupAnnotations(scaleSet))
+
+	provider.azureManager.recordScaleUpFailure(testASG, &azure.ServiceError{Code: "InternalServerError"})
+	assert.Equal(t, map[string]string{healthScoreAnnotationKey: "0.50"}, provider.NodeGroupAnnotations(scaleSet))
+
+	provider.azureManager.recordScaleUpFailure(testASG, &azure.ServiceError{Code: "ZonalAllocationFailed"})
+	annotations := provider.NodeGroupAnnotations(scaleSet)
+	assert.Contains(t, []string{"0.24", "0.25"}, annotations[healthScoreAnnotationKey])
+	at, err := time.Parse(time.RFC3339, annotations[lastStockoutAnnotationKey])
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), at, time.Minute)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+
+	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// InstanceFilterStandaloneVMs omits standalone VMs while all the scale sets are Uniform and the cluster has no
+	// VMs pool, as no node group can own them.
+	InstanceFilterStandaloneVMs = "standaloneVMs"
+	// InstanceFilterVMResourceID omits instances whose provider ID is not a VM resource ID.
+	InstanceFilterVMResourceID = "vmResourceID"
+	// InstanceFilterComputeResourceID omits instances whose provider ID is neither a VM nor a scale set VM resource ID.
+	InstanceFilterComputeResourceID = "computeResourceID"
+)
+
+// InstanceFilterResult is the outcome of an InstanceFilter.
+type InstanceFilterResult int
+
+const (
+	// InstanceFilterContinue passes the instance to the next filter, or looks it up after the last one.
+	InstanceFilterContinue InstanceFilterResult = iota
+	// InstanceFilterOmit omits the instance: it belongs to no node group, and is not filtered again until the cache
+	// of unowned instances is reset.
+	InstanceFilterOmit
+	// InstanceFilterLookUp looks the instance up without running the next filters.
+	InstanceFilterLookUp
+)
+
+// FilteredInstance is an instance whose node group is looked up, as seen by instance filters.
+type FilteredInstance struct {
+	// ProviderID is the provider ID of the instance, with a lower-cased resource group.
+	ProviderID string
+	// VMType is the configured vmType.
+	VMType string
+	// HasVMsPools is whether the cluster had VMs pools when agent pools were last listed.
+	HasVMsPools bool
+
+	allScaleSetsUniform func() bool
+}
+
+// AllScaleSetsUniform returns whether all the listed scale sets are Uniform.
+func (i FilteredInstance) AllScaleSetsUniform() bool {
+	return i.allScaleSetsUniform != nil && i.allScaleSetsUniform()
+}
+
+// InstanceFilter is a step of the ordered chain deciding, before looking it up, whether an instance may belong to a
+// node group. Filters are tested in isolation, and new instance formats are supported by adding filters.
+type InstanceFilter interface {
+	// Name identifies the filter in the instanceFilters config and in the logs.
+	Name() string
+	// Filter returns the outcome of the filter for instance, and the reason it is omitted, if so.
+	Filter(instance FilteredInstance) (InstanceFilterResult, string)
+}
+
+type instanceFilterFunc struct {
+	name   string
+	filter func(FilteredInstance) (InstanceFilterResult, string)
+}
+
+// NewInstanceFilter returns an InstanceFilter named name, filtering instances with filter.
+func NewInstanceFilter(name string, filter func(FilteredInstance) (InstanceFilterResult, string)) InstanceFilter {
+	return instanceFilterFunc{name: name, filter: filter}
+}
+
+func (f instanceFilterFunc) Name() string {
+	return f.name
+}
+
+func (f instanceFilterFunc) Filter(instance FilteredInstance) (InstanceFilterResult, string) {
+	return f.filter(instance)
+}
+
+// builtinInstanceFilters are the filters which can be named in the instanceFilters config.
+var builtinInstanceFilters = map[string]InstanceFilter{
+	InstanceFilterStandaloneVMs: NewInstanceFilter(InstanceFilterStandaloneVMs, func(instance FilteredInstance) (InstanceFilterResult, string) {
+		// Flexible scale sets and VMs pools are made of standalone VMs.
+		if !instance.HasVMsPools && virtualMachineRE.MatchString(instance.ProviderID) && instance.AllScaleSetsUniform() {
+			return InstanceFilterOmit, "is not managed by vmss"
+		}
+		return InstanceFilterContinue, ""
+	}),
+	InstanceFilterVMResourceID: NewInstanceFilter(InstanceFilterVMResourceID, func(instance FilteredInstance) (InstanceFilterResult, string) {
+		if !virtualMachineRE.MatchString(instance.ProviderID) {
+			return InstanceFilterOmit, "is not in Azure resource ID format"
+		}
+		return InstanceFilterContinue, ""
+	}),
+	InstanceFilterComputeResourceID: NewInstanceFilter(InstanceFilterComputeResourceID, func(instance FilteredInstance) (InstanceFilterResult, string) {
+		if !virtualMachineRE.MatchString(instance.ProviderID) && !scaleSetVMProviderIDRE.MatchString(instance.ProviderID) {
+			return InstanceFilterOmit, "is neither a VM nor a scale set VM"
+		}
+		return InstanceFilterContinue, ""
+	}),
+}
+
+// supportedInstanceFilters are the filters supported by each vmType, and defaultInstanceFilters the chain of
+// each vmType when none is configured.
+var (
+	supportedInstanceFilters = map[string][]string{
+		providerazureconsts.VMTypeVMSS:     {InstanceFilterStandaloneVMs, InstanceFilterComputeResourceID},
+		providerazureconsts.VMTypeStandard: {InstanceFilterVMResourceID},
+	}
+	defaultInstanceFilters = map[string][]string{
+		providerazureconsts.VMTypeVMSS:     {InstanceFilterStandaloneVMs},
+		providerazureconsts.VMTypeStandard: {InstanceFilterVMResourceID},
+	}
+)
+
+// validateInstanceFilters returns an error if any of the named filters is unknown or not supported by vmType.
+func validateInstanceFilters(names []string, vmType string) error {
+	for _, name := range names {
+		supported := false
+		for _, s := range supportedInstanceFilters[vmType] {
+			supported = supported || s == name
+		}
+		if !supported {
+			return fmt.Errorf("instance filter %q is not supported for vmType %q, must be one of %v", name, vmType, supportedInstanceFilters[vmType])
+		}
+	}
+	return nil
+}
+
+// newInstanceFilterChain returns the named filters, or the default filters of vmType if none is named.
+func newInstanceFilterChain(names []string, vmType string) ([]InstanceFilter, error) {
+	if err := validateInstanceFilters(names, vmType); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		names = defaultInstanceFilters[vmType]
+	}
+	chain := make([]InstanceFilter, 0, len(names))
+	for _, name := range names {
+		chain = append(chain, builtinInstanceFilters[name])
+	}
+	return chain, nil
+}
+
+// filterInstance runs the instance filter chain on the instance with providerID, and returns whether it is omitted,
+// by which filter and why. Should be called with lock.
+func (m *azureCache) filterInstance(providerID, vmType string, hasVMsPools bool) (bool, string, string) {
+	chain := m.instanceFilters
+	if chain == nil {
+		chain, _ = newInstanceFilterChain(nil, vmType)
+	}
+	instance := FilteredInstance{
+		ProviderID:          providerID,
+		VMType:              vmType,
+		HasVMsPools:         hasVMsPools,
+		allScaleSetsUniform: m.areAllScaleSetsUniform,
+	}
+	for _, filter := range chain {
+		switch result, reason := filter.Filter(instance); result {
+		case InstanceFilterOmit:
+			return true, filter.Name(), reason
+		case InstanceFilterLookUp:
+			return false, filter.Name(), ""
+		}
+	}
+	return false, "", ""
+}
+
+// appendInstanceFilters appends filters to the instance filter chain, and forgets the instances omitted so far.
+func (m *azureCache) appendInstanceFilters(filters []InstanceFilter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.instanceFilters == nil {
+		m.instanceFilters, _ = newInstanceFilterChain(nil, m.vmType)
+	}
+	m.instanceFilters = append(m.instanceFilters, filters...)
+	m.unownedInstances = make(map[azureRef]bool)
+}
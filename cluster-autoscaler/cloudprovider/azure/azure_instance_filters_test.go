@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	testStandaloneVMProviderID = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm-0"
+	testScaleSetVMProviderID   = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/pool/virtualMachines/3"
+	testMachineProviderID      = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerService/managedClusters/c/agentPools/p/machines/m-0"
+)
+
+func TestStandaloneVMsInstanceFilter(t *testing.T) {
+	filter := builtinInstanceFilters[InstanceFilterStandaloneVMs]
+	uniform := func() bool { return true }
+	flexible := func() bool { return false }
+	for _, tc := range []struct {
+		instance FilteredInstance
+		expected InstanceFilterResult
+	}{
+		{FilteredInstance{ProviderID: testStandaloneVMProviderID, allScaleSetsUniform: uniform}, InstanceFilterOmit},
+		{FilteredInstance{ProviderID: testStandaloneVMProviderID, allScaleSetsUniform: flexible}, InstanceFilterContinue},
+		{FilteredInstance{ProviderID: testStandaloneVMProviderID, HasVMsPools: true, allScaleSetsUniform: uniform}, InstanceFilterContinue},
+		{FilteredInstance{ProviderID: testScaleSetVMProviderID, allScaleSetsUniform: uniform}, InstanceFilterContinue},
+	} {
+		result, _ := filter.Filter(tc.instance)
+		assert.Equal(t, tc.expected, result, "%+v", tc.instance)
+	}
+}
+
+func TestVMResourceIDInstanceFilter(t *testing.T) {
+	filter := builtinInstanceFilters[InstanceFilterVMResourceID]
+	result, _ := filter.Filter(FilteredInstance{ProviderID: testStandaloneVMProviderID})
+	assert.Equal(t, InstanceFilterContinue, result)
+	result, reason := filter.Filter(FilteredInstance{ProviderID: testScaleSetVMProviderID})
+	assert.Equal(t, InstanceFilterOmit, result)
+	assert.Equal(t, "is not in Azure resource ID format", reason)
+}
+
+func TestComputeResourceIDInstanceFilter(t *testing.T) {
+	filter := builtinInstanceFilters[InstanceFilterComputeResourceID]
+	result, _ := filter.Filter(FilteredInstance{ProviderID: testStandaloneVMProviderID})
+	assert.Equal(t, InstanceFilterContinue, result)
+	result, _ = filter.Filter(FilteredInstance{ProviderID: testScaleSetVMProviderID})
+	assert.Equal(t, InstanceFilterContinue, result)
+	result, _ = filter.Filter(FilteredInstance{ProviderID: testMachineProviderID})
+	assert.Equal(t, InstanceFilterOmit, result)
+}
+
+func TestNewInstanceFilterChain(t *testing.T) {
+	names := func(chain []InstanceFilter) []string {
+		var names []string
+		for _, filter := range chain {
+			names = append(names, filter.Name())
+		}
+		return names
+	}
+
+	chain, err := newInstanceFilterChain(nil, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{InstanceFilterStandaloneVMs}, names(chain))
+	chain, err = newInstanceFilterChain(nil, providerazureconsts.VMTypeStandard)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{InstanceFilterVMResourceID}, names(chain))
+	chain, err = newInstanceFilterChain([]string{InstanceFilterComputeResourceID, InstanceFilterStandaloneVMs}, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{InstanceFilterComputeResourceID, InstanceFilterStandaloneVMs}, names(chain))
+
+	_, err = newInstanceFilterChain([]string{InstanceFilterVMResourceID}, providerazureconsts.VMTypeVMSS)
+	assert.Error(t, err)
+	assert.Error(t, validateInstanceFilters([]string{"unknown"}, providerazureconsts.VMTypeStandard))
+}
+
+func TestFindForInstanceFilterChain(t *testing.T) {
+	manager := newTestAzureManager(t)
+	ac := manager.azureCache
+	ac.unownedInstances = make(map[azureRef]bool)
+	ac.instanceToNodeGroup = make(map[azureRef]cloudprovider.NodeGroup)
+	ac.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		"pool": {VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{OrchestrationMode: compute.Flexible}},
+	}
+	pool := newTestScaleSet(manager, "pool")
+	ac.registeredNodeGroups = []cloudprovider.NodeGroup{pool}
+	machine := azureRef{Name: testMachineProviderID}
+	ac.instanceToNodeGroup[machine] = pool
+
+	nodeGroup, err := ac.FindForInstance(&machine, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	assert.Equal(t, pool, nodeGroup, "instances of any format are looked up by default")
+
+	ac.instanceFilters, err = newInstanceFilterChain([]string{InstanceFilterComputeResourceID}, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	nodeGroup, err = ac.FindForInstance(&machine, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	assert.Nil(t, nodeGroup)
+	assert.True(t, ac.unownedInstances[machine], "omitted instances are not filtered again")
+
+	// Filters added by an embedding controller are appended to the configured ones, and omitted instances are
+	// filtered again.
+	machines := NewInstanceFilter("machines", func(instance FilteredInstance) (InstanceFilterResult, string) {
+		if strings.Contains(instance.ProviderID, "/machines/") {
+			return InstanceFilterLookUp, ""
+		}
+		return InstanceFilterContinue, ""
+	})
+	ac.appendInstanceFilters([]InstanceFilter{machines})
+	assert.Len(t, ac.instanceFilters, 2)
+	assert.Empty(t, ac.unownedInstances)
+
+	// A filter looking instances up ends the chain.
+	ac.instanceFilters = []InstanceFilter{machines, builtinInstanceFilters[InstanceFilterComputeResourceID]}
+	nodeGroup, err = ac.FindForInstance(&machine, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	assert.Equal(t, pool, nodeGroup)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	apiv1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// vmHealthStateUnhealthy is reported by the application health extension or the load balancer probe of the scale set.
+	vmHealthStateUnhealthy = "HealthState/unhealthy"
+
+	// unhealthyInstanceGracePeriod is how long an instance must have been seen unhealthy before its node is hinted
+	// to the core, so that restarts and transient health probe failures don't count.
+	unhealthyInstanceGracePeriod = 2 * time.Minute
+)
+
+// unhealthyInstance is an instance seen unhealthy in its instance view.
+type unhealthyInstance struct {
+	reason string
+	since  time.Time
+}
+
+// unhealthyReason returns why the instance view of the VM shows it unhealthy, empty if it does not.
+// Only VMs which completed provisioning are considered, as failed provisioning is handled on its own.
+func unhealthyReason(vm *compute.VirtualMachineScaleSetVM) string {
+	if vm.InstanceView == nil || vm.ProvisioningState == nil || *vm.ProvisioningState != provisioningStateSucceeded {
+		return ""
+	}
+	if vm.InstanceView.Statuses != nil {
+		switch powerState := vmPowerStateFromStatuses(*vm.InstanceView.Statuses); powerState {
+		case vmPowerStateStopped, vmPowerStateDeallocated:
+			return "VM is " + strings.TrimPrefix(powerState, "PowerState/")
+		}
+	}
+	if health := vm.InstanceView.VMHealth; health != nil && health.Status != nil && health.Status.Code != nil &&
+		strings.EqualFold(*health.Status.Code, vmHealthStateUnhealthy) {
+		return "VM health probe is failing"
+	}
+	return ""
+}
+
+// updateUnhealthyInstances records the instances of the listed VMs which are unhealthy, keeping when they were
+// first seen unhealthy. Caller must hold instanceMutex.
+func (scaleSet *ScaleSet) updateUnhealthyInstances(vms []compute.VirtualMachineScaleSetVM, now time.Time) {
+	unhealthy := make(map[string]unhealthyInstance)
+	for i := range vms {
+		reason := unhealthyReason(&vms[i])
+		if reason == "" || vms[i].ID == nil {
+			continue
+		}
+		resourceID, err := convertResourceGroupNameToLower(*vms[i].ID)
+		if err != nil {
+			continue
+		}
+		id := azurePrefix + resourceID
+		instance := unhealthyInstance{reason: reason, since: now}
+		if previous, found := scaleSet.unhealthyInstances[id]; found {
+			instance.since = previous.since
+		} else {
+			klog.V(2).Infof("Instance %s of scale set %s is unhealthy: %s", id, scaleSet.Name, reason)
+		}
+		unhealthy[id] = instance
+	}
+	scaleSet.unhealthyInstances = unhealthy
+	unhealthyInstances.WithLabelValues(scaleSet.Name).Set(float64(len(unhealthy)))
+}
+
+// instanceUnhealthy returns whether the instance has been seen unhealthy for longer than the grace period, and why.
+func (scaleSet *ScaleSet) instanceUnhealthy(providerID string, now time.Time) (bool, string) {
+	resourceID, err := convertResourceGroupNameToLower(strings.TrimPrefix(providerID, azurePrefix))
+	if err != nil {
+		return false, ""
+	}
+
+	scaleSet.instanceMutex.Lock()
+	defer scaleSet.instanceMutex.Unlock()
+	instance, found := scaleSet.unhealthyInstances[azurePrefix+resourceID]
+	if !found || now.Sub(instance.since) < unhealthyInstanceGracePeriod {
+		return false, ""
+	}
+	return true, instance.reason
+}
+
+// UnhealthyInstance implements cloudprovider.InstanceHealthHinter. Instances of uniform scale sets are hinted
+// unhealthy when their instance view, listed with the scale set instances, shows them stopped, deallocated or
+// failing their health probe since the grace period. The core then removes their node if it is unready,
+// without waiting for the scale-down unready time.
+func (azure *AzureCloudProvider) UnhealthyInstance(node *apiv1.Node) (bool, string) {
+	nodeGroup, err := azure.NodeGroupForNode(node)
+	if err != nil {
+		return false, ""
+	}
+	scaleSet, ok := nodeGroup.(*ScaleSet)
+	if !ok {
+		return false, ""
+	}
+	return scaleSet.instanceUnhealthy(node.Spec.ProviderID, time.Now())
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVMSSVMWithInstanceView(i int, powerState, healthState string) compute.VirtualMachineScaleSetVM {
+	vm := newTestVMSSVMList(i + 1)[i]
+	vm.ProvisioningState = to.StringPtr(provisioningStateSucceeded)
+	vm.InstanceView = &compute.VirtualMachineScaleSetVMInstanceView{
+		Statuses: &[]compute.InstanceViewStatus{{Code: to.StringPtr("ProvisioningState/succeeded")}, {Code: to.StringPtr(powerState)}},
+	}
+	if healthState != "" {
+		vm.InstanceView.VMHealth = &compute.VirtualMachineHealthStatus{Status: &compute.InstanceViewStatus{Code: to.StringPtr(healthState)}}
+	}
+	return vm
+}
+
+func TestUnhealthyReason(t *testing.T) {
+	vm := newTestVMSSVMWithInstanceView(0, vmPowerStateRunning, "HealthState/healthy")
+	assert.Empty(t, unhealthyReason(&vm))
+	vm = newTestVMSSVMWithInstanceView(0, vmPowerStateDeallocated, "")
+	assert.Equal(t, "VM is deallocated", unhealthyReason(&vm))
+	vm = newTestVMSSVMWithInstanceView(0, vmPowerStateRunning, vmHealthStateUnhealthy)
+	assert.Equal(t, "VM health probe is failing", unhealthyReason(&vm))
+
+	// VMs still provisioning, or without instance view, are not considered.
+	vm.ProvisioningState = to.StringPtr(provisioningStateCreating)
+	assert.Empty(t, unhealthyReason(&vm))
+	vm = newTestVMSSVMList(1)[0]
+	assert.Empty(t, unhealthyReason(&vm))
+}
+
+func TestInstanceUnhealthy(t *testing.T) {
+	manager := newTestAzureManager(t)
+	scaleSet := newTestScaleSet(manager, testASG)
+	providerID := func(i int) string {
+		return azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, i)
+	}
+
+	now := time.Now()
+	scaleSet.updateUnhealthyInstances([]compute.VirtualMachineScaleSetVM{
+		newTestVMSSVMWithInstanceView(0, vmPowerStateStopped, ""),
+		newTestVMSSVMWithInstanceView(1, vmPowerStateRunning, ""),
+	}, now)
+	unhealthy, _ := scaleSet.instanceUnhealthy(providerID(0), now.Add(time.Minute))
+	assert.False(t, unhealthy, "within the grace period")
+
+	// Still stopped on the next refresh, seen unhealthy since the first one.
+	scaleSet.updateUnhealthyInstances([]compute.VirtualMachineScaleSetVM{
+		newTestVMSSVMWithInstanceView(0, vmPowerStateStopped, ""),
+		newTestVMSSVMWithInstanceView(1, vmPowerStateRunning, ""),
+	}, now.Add(time.Minute))
+	unhealthy, reason := scaleSet.instanceUnhealthy(providerID(0), now.Add(unhealthyInstanceGracePeriod))
+	assert.True(t, unhealthy)
+	assert.Equal(t, "VM is stopped", reason)
+	unhealthy, _ = scaleSet.instanceUnhealthy(providerID(1), now.Add(unhealthyInstanceGracePeriod))
+	assert.False(t, unhealthy)
+
+	// Started again.
+	scaleSet.updateUnhealthyInstances([]compute.VirtualMachineScaleSetVM{
+		newTestVMSSVMWithInstanceView(0, vmPowerStateRunning, ""),
+	}, now.Add(2*unhealthyInstanceGracePeriod))
+	unhealthy, _ = scaleSet.instanceUnhealthy(providerID(0), now.Add(2*unhealthyInstanceGracePeriod))
+	assert.False(t, unhealthy)
+}
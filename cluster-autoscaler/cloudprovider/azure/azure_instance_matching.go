@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// InstanceMatchingExact resolves the node group of an instance from the instances listed by each node group.
+	InstanceMatchingExact = "exact"
+	// InstanceMatchingPrefix resolves the node group of an instance from the name of its scale set, or the name
+	// of the VM for Flexible scale sets, whose VMs are named after their scale set.
+	InstanceMatchingPrefix = "prefix"
+	// InstanceMatchingProviderID resolves the node group of a Uniform scale set instance from the resource group
+	// and scale set name in its provider ID.
+	InstanceMatchingProviderID = "providerID"
+)
+
+// instanceMatchingStrategies are the strategies supported by each vmType, the first one being the default.
+var instanceMatchingStrategies = map[string][]string{
+	providerazureconsts.VMTypeVMSS:     {InstanceMatchingExact, InstanceMatchingPrefix, InstanceMatchingProviderID},
+	providerazureconsts.VMTypeStandard: {InstanceMatchingExact},
+}
+
+var (
+	scaleSetVMProviderIDRE = regexp.MustCompile(`(?i)^azure:///subscriptions/[^/]+/resourceGroups/([^/]+)/providers/Microsoft\.Compute/virtualMachineScaleSets/([^/]+)/virtualMachines/[^/]+$`)
+	vmProviderIDRE         = regexp.MustCompile(`(?i)^azure:///subscriptions/[^/]+/resourceGroups/([^/]+)/providers/Microsoft\.Compute/virtualMachines/([^/]+)$`)
+)
+
+// validateInstanceMatchingStrategy returns an error if strategy is not supported by vmType.
+func validateInstanceMatchingStrategy(strategy, vmType string) error {
+	if strategy == "" {
+		return nil
+	}
+	for _, supported := range instanceMatchingStrategies[vmType] {
+		if strategy == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("instanceMatchingStrategy %q is not supported for vmType %q, must be one of %v",
+		strategy, vmType, instanceMatchingStrategies[vmType])
+}
+
+// matchInstance returns the registered node group of the instance with providerID according to the instance
+// matching strategy of the cache, nil if it doesn't match any. Instances that don't match are looked up among the
+// instances listed by each node group. Should be called with lock.
+func (m *azureCache) matchInstance(providerID string) cloudprovider.NodeGroup {
+	switch m.instanceMatchingStrategy {
+	case InstanceMatchingPrefix:
+		return m.matchInstanceByPrefix(providerID)
+	case InstanceMatchingProviderID:
+		return m.matchInstanceByProviderID(providerID)
+	}
+	return nil
+}
+
+// matchInstanceByPrefix matches Uniform scale set instances by their scale set name, and Flexible scale set VMs,
+// named <scale set>_<suffix>, by the prefix of their name. The resource group of the instance must be the resource
+// group of the scale set.
+func (m *azureCache) matchInstanceByPrefix(providerID string) cloudprovider.NodeGroup {
+	var resourceGroup, name string
+	if match := scaleSetVMProviderIDRE.FindStringSubmatch(providerID); match != nil {
+		resourceGroup, name = match[1], match[2]
+	} else if match := vmProviderIDRE.FindStringSubmatch(providerID); match != nil {
+		resourceGroup, name = match[1], match[2]
+	} else {
+		return nil
+	}
+
+	var matched cloudprovider.NodeGroup
+	for _, nodeGroup := range m.registeredNodeGroups {
+		scaleSet, ok := nodeGroup.(*ScaleSet)
+		if !ok || !strings.EqualFold(scaleSet.resourceGroupName(), resourceGroup) {
+			continue
+		}
+		id := nodeGroup.Id()
+		if !strings.EqualFold(name, id) && !hasPrefixFold(name, id+"_") {
+			continue
+		}
+		// Prefer the longest scale set name, e.g. pool2 over pool for pool2_xxxx.
+		if matched == nil || len(id) > len(matched.Id()) {
+			matched = nodeGroup
+		}
+	}
+	return matched
+}
+
+// matchInstanceByProviderID matches Uniform scale set instances by the resource group and name of their scale set.
+func (m *azureCache) matchInstanceByProviderID(providerID string) cloudprovider.NodeGroup {
+	match := scaleSetVMProviderIDRE.FindStringSubmatch(providerID)
+	if match == nil {
+		return nil
+	}
+	resourceGroup, name := match[1], match[2]
+	for _, nodeGroup := range m.registeredNodeGroups {
+		scaleSet, ok := nodeGroup.(*ScaleSet)
+		if ok && strings.EqualFold(scaleSet.Name, name) && strings.EqualFold(scaleSet.resourceGroupName(), resourceGroup) {
+			return scaleSet
+		}
+	}
+	return nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	providerazureconsts "sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestFindForInstanceMatchingStrategies(t *testing.T) {
+	manager := newTestAzureManager(t)
+	ac := manager.azureCache
+	ac.unownedInstances = make(map[azureRef]bool)
+	ac.instanceToNodeGroup = make(map[azureRef]cloudprovider.NodeGroup)
+	ac.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		"pool":  {VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{OrchestrationMode: compute.Uniform}},
+		"pool2": {VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{OrchestrationMode: compute.Flexible}},
+	}
+	pool, pool2 := newTestScaleSet(manager, "pool"), newTestScaleSet(manager, "pool2")
+	ac.registeredNodeGroups = []cloudprovider.NodeGroup{pool, pool2}
+
+	uniformVM := azureRef{Name: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/pool/virtualMachines/3"}
+	flexibleVM := azureRef{Name: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/pool2_1a2b3c4d"}
+	otherGroupVM := azureRef{Name: "azure:///subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.Compute/virtualMachineScaleSets/pool/virtualMachines/3"}
+	otherGroupFlexibleVM := azureRef{Name: "azure:///subscriptions/sub/resourceGroups/other-rg/providers/Microsoft.Compute/virtualMachines/pool2_1a2b3c4d"}
+	unknownVM := azureRef{Name: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/poolish_1a2b3c4d"}
+
+	for _, tc := range []struct {
+		strategy string
+		instance azureRef
+		expected cloudprovider.NodeGroup
+	}{
+		{InstanceMatchingExact, uniformVM, nil},
+		{InstanceMatchingPrefix, uniformVM, pool},
+		{InstanceMatchingPrefix, flexibleVM, pool2},
+		{InstanceMatchingPrefix, unknownVM, nil},
+		{InstanceMatchingPrefix, otherGroupVM, nil},
+		{InstanceMatchingPrefix, otherGroupFlexibleVM, nil},
+		{InstanceMatchingProviderID, uniformVM, pool},
+		{InstanceMatchingProviderID, otherGroupVM, nil},
+		{InstanceMatchingProviderID, flexibleVM, nil},
+	} {
+		ac.instanceMatchingStrategy = tc.strategy
+		nodeGroup, err := ac.FindForInstance(&tc.instance, providerazureconsts.VMTypeVMSS)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, nodeGroup, "%s %s", tc.strategy, tc.instance.Name)
+	}
+
+	// Instances which don't match fall back to the instances listed by the node groups.
+	ac.instanceToNodeGroup[flexibleVM] = pool2
+	ac.instanceMatchingStrategy = InstanceMatchingProviderID
+	nodeGroup, err := ac.FindForInstance(&flexibleVM, providerazureconsts.VMTypeVMSS)
+	assert.NoError(t, err)
+	assert.Equal(t, pool2, nodeGroup)
+}
+
+func TestValidateInstanceMatchingStrategy(t *testing.T) {
+	assert.NoError(t, validateInstanceMatchingStrategy("", providerazureconsts.VMTypeStandard))
+	assert.NoError(t, validateInstanceMatchingStrategy(InstanceMatchingExact, providerazureconsts.VMTypeStandard))
+	assert.NoError(t, validateInstanceMatchingStrategy(InstanceMatchingPrefix, providerazureconsts.VMTypeVMSS))
+	assert.NoError(t, validateInstanceMatchingStrategy(InstanceMatchingProviderID, providerazureconsts.VMTypeVMSS))
+	assert.Error(t, validateInstanceMatchingStrategy(InstanceMatchingPrefix, providerazureconsts.VMTypeStandard))
+	assert.Error(t, validateInstanceMatchingStrategy("fuzzy", providerazureconsts.VMTypeVMSS))
+}
@@ -0,0 +1,417 @@
+//go:build integration
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient"
+)
+
+// The integration tests drive a full AzureManager against an in-memory fake of the ARM compute API.
+// They don't need an Azure subscription, run them with:
+//
+//	go test -tags integration -run Integration ./cloudprovider/azure/...
+
+const (
+	integrationSubscriptionID = "sub"
+	integrationResourceGroup  = "rg"
+)
+
+// fakeARM serves the ARM compute endpoints used by the VMSS node groups: listing, getting and updating
+// scale sets, listing their instances and deleting instances. Long-running operations complete synchronously.
+type fakeARM struct {
+	mutex     sync.Mutex
+	scaleSets map[string]*fakeScaleSet
+	// requests counts the requests served, by method and path relative to the resource group.
+	requests map[string]int
+}
+
+type fakeScaleSet struct {
+	sku            string
+	instanceIDs    []int
+	nextInstanceID int
+}
+
+func newFakeARM() *fakeARM {
+	return &fakeARM{
+		scaleSets: make(map[string]*fakeScaleSet),
+		requests:  make(map[string]int),
+	}
+}
+
+// addScaleSet adds a uniform scale set of size instances.
+func (f *fakeARM) addScaleSet(name, sku string, size int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	scaleSet := &fakeScaleSet{sku: sku}
+	scaleSet.resize(size)
+	f.scaleSets[name] = scaleSet
+}
+
+func (f *fakeARM) size(name string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.scaleSets[name].instanceIDs)
+}
+
+func (f *fakeARM) requestCount(method, path string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.requests[method+" "+path]
+}
+
+func (s *fakeScaleSet) resize(size int) {
+	for len(s.instanceIDs) < size {
+		s.instanceIDs = append(s.instanceIDs, s.nextInstanceID)
+		s.nextInstanceID++
+	}
+	s.instanceIDs = s.instanceIDs[:size]
+}
+
+func (f *fakeARM) scaleSetID(name string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s",
+		integrationSubscriptionID, integrationResourceGroup, name)
+}
+
+func (f *fakeARM) instanceID(name string, instanceID int) string {
+	return fmt.Sprintf("%s/virtualMachines/%d", f.scaleSetID(name), instanceID)
+}
+
+// The compute SDK marshalers drop read-only fields, like IDs and names, which ARM does return.
+func withReadOnlyFields(v interface{}, fields map[string]interface{}) map[string]interface{} {
+	encoded, _ := json.Marshal(v)
+	object := make(map[string]interface{})
+	_ = json.Unmarshal(encoded, &object)
+	for key, value := range fields {
+		object[key] = value
+	}
+	return object
+}
+
+func (f *fakeARM) scaleSetJSON(name string, scaleSet *fakeScaleSet) map[string]interface{} {
+	vmss := compute.VirtualMachineScaleSet{
+		Location: to.StringPtr("eastus"),
+		Sku: &compute.Sku{
+			Name:     to.StringPtr(scaleSet.sku),
+			Capacity: to.Int64Ptr(int64(len(scaleSet.instanceIDs))),
+		},
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+			OrchestrationMode: compute.Uniform,
+			ProvisioningState: to.StringPtr("Succeeded"),
+		},
+	}
+	return withReadOnlyFields(vmss, map[string]interface{}{"id": f.scaleSetID(name), "name": name})
+}
+
+func (f *fakeARM) instancesJSON(name string, scaleSet *fakeScaleSet) []interface{} {
+	instances := []interface{}{}
+	for _, instanceID := range scaleSet.instanceIDs {
+		vm := compute.VirtualMachineScaleSetVM{
+			VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
+				ProvisioningState:  to.StringPtr("Succeeded"),
+				LatestModelApplied: to.BoolPtr(true),
+			},
+		}
+		instances = append(instances, withReadOnlyFields(vm, map[string]interface{}{
+			"id":         f.instanceID(name, instanceID),
+			"name":       fmt.Sprintf("%s_%d", name, instanceID),
+			"instanceId": strconv.Itoa(instanceID),
+		}))
+	}
+	return instances
+}
+
+func (f *fakeARM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	prefix := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/", integrationSubscriptionID, integrationResourceGroup)
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	f.requests[r.Method+" "+path]++
+
+	segments := strings.Split(path, "/")
+	switch {
+	case r.Method == http.MethodGet && path == "virtualMachines":
+		writeARMJSON(w, map[string]interface{}{"value": []interface{}{}})
+	case r.Method == http.MethodGet && path == "virtualMachineScaleSets":
+		scaleSets := []interface{}{}
+		for name, scaleSet := range f.scaleSets {
+			scaleSets = append(scaleSets, f.scaleSetJSON(name, scaleSet))
+		}
+		writeARMJSON(w, map[string]interface{}{"value": scaleSets})
+	case len(segments) >= 2 && segments[0] == "virtualMachineScaleSets":
+		scaleSet, found := f.scaleSets[segments[1]]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		f.serveScaleSet(w, r, segments[1], scaleSet, segments[2:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeARM) serveScaleSet(w http.ResponseWriter, r *http.Request, name string, scaleSet *fakeScaleSet, action []string) {
+	switch {
+	case r.Method == http.MethodGet && len(action) == 0:
+		writeARMJSON(w, f.scaleSetJSON(name, scaleSet))
+	case r.Method == http.MethodPut && len(action) == 0:
+		var update compute.VirtualMachineScaleSet
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if update.Sku != nil && update.Sku.Capacity != nil {
+			scaleSet.resize(int(*update.Sku.Capacity))
+		}
+		writeARMJSON(w, f.scaleSetJSON(name, scaleSet))
+	case r.Method == http.MethodGet && len(action) == 1 && action[0] == "virtualMachines":
+		writeARMJSON(w, map[string]interface{}{"value": f.instancesJSON(name, scaleSet)})
+	case r.Method == http.MethodPost && len(action) == 1 && action[0] == "delete":
+		var requiredIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs
+		if err := json.NewDecoder(r.Body).Decode(&requiredIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		deleted := make(map[string]bool)
+		for _, instanceID := range *requiredIDs.InstanceIds {
+			deleted[instanceID] = true
+		}
+		remaining := []int{}
+		for _, instanceID := range scaleSet.instanceIDs {
+			if !deleted[strconv.Itoa(instanceID)] {
+				remaining = append(remaining, instanceID)
+			}
+		}
+		scaleSet.instanceIDs = remaining
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeARMJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newFakeARMClient returns an azClient whose compute clients call the fake ARM server at endpoint.
+func newFakeARMClient(endpoint string) *azClient {
+	pollingDelay := 10 * time.Millisecond
+	clientConfig := &azclients.ClientConfig{
+		Location:                "eastus",
+		SubscriptionID:          integrationSubscriptionID,
+		ResourceManagerEndpoint: endpoint,
+		Authorizer:              autorest.NullAuthorizer{},
+		RestClientConfig: azclients.RestClientConfig{
+			PollingDelay: &pollingDelay,
+		},
+	}
+	return &azClient{
+		virtualMachineScaleSetsClient:   vmssclient.New(clientConfig),
+		virtualMachineScaleSetVMsClient: vmssvmclient.New(clientConfig),
+		virtualMachinesClient:           vmclient.New(clientConfig),
+	}
+}
+
+// integrationCacheMode is a way for the manager to fetch the Azure resources of its cache.
+type integrationCacheMode struct {
+	name string
+	// setup returns the configuration overrides of the mode, given the azClient of the fake ARM server.
+	setup func(t *testing.T, client *azClient) map[string]interface{}
+}
+
+var integrationCacheModes = []integrationCacheMode{
+	{
+		name: "ARM",
+		setup: func(*testing.T, *azClient) map[string]interface{} {
+			return nil
+		},
+	},
+	{
+		name: "resource cache service",
+		setup: func(t *testing.T, client *azClient) map[string]interface{} {
+			cfg, err := BuildAzureConfig(strings.NewReader(integrationConfig(nil)))
+			require.NoError(t, err)
+			cache, err := newAzureCache(client, time.Second, *cfg)
+			require.NoError(t, err)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			server := &ResourceCacheServer{cache: cache}
+			go func() {
+				_ = server.Serve(ctx, listener)
+			}()
+			require.Eventually(t, func() bool {
+				return server.snapshot() != nil
+			}, 5*time.Second, 10*time.Millisecond)
+			return map[string]interface{}{"resourceCacheServiceAddress": listener.Addr().String()}
+		},
+	},
+}
+
+func integrationConfig(overrides map[string]interface{}) string {
+	cfg := map[string]interface{}{
+		"cloud":          "AzurePublicCloud",
+		"tenantId":       "tenant",
+		"subscriptionId": integrationSubscriptionID,
+		"aadClientId":    "client",
+		"resourceGroup":  integrationResourceGroup,
+		"location":       "eastus",
+		"vmType":         "vmss",
+	}
+	for key, value := range overrides {
+		cfg[key] = value
+	}
+	encoded, _ := json.Marshal(cfg)
+	return string(encoded)
+}
+
+// newIntegrationProvider builds an Azure cloud provider with the given node group specs, calling the fake ARM server.
+func newIntegrationProvider(t *testing.T, arm *fakeARM, mode integrationCacheMode, nodeGroupSpecs ...string) *AzureCloudProvider {
+	server := httptest.NewServer(arm)
+	t.Cleanup(server.Close)
+	client := newFakeARMClient(server.URL)
+
+	discoveryOpts := cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: nodeGroupSpecs}
+	config := integrationConfig(mode.setup(t, client))
+	manager, err := createAzureManagerInternal(strings.NewReader(config), discoveryOpts, client)
+	require.NoError(t, err)
+	t.Cleanup(manager.Cleanup)
+
+	provider, err := BuildAzureCloudProvider(manager, nil)
+	require.NoError(t, err)
+	return provider.(*AzureCloudProvider)
+}
+
+func integrationNode(arm *fakeARM, scaleSet string, instanceID int) *apiv1.Node {
+	node := &apiv1.Node{Spec: apiv1.NodeSpec{ProviderID: azurePrefix + arm.instanceID(scaleSet, instanceID)}}
+	node.Name = fmt.Sprintf("%s-%d", scaleSet, instanceID)
+	return node
+}
+
+func TestIntegrationScaleUp(t *testing.T) {
+	for _, mode := range integrationCacheModes {
+		t.Run(mode.name, func(t *testing.T) {
+			arm := newFakeARM()
+			arm.addScaleSet("pool0", "Standard_D4_v2", 2)
+			provider := newIntegrationProvider(t, arm, mode, "1:5:pool0")
+
+			nodeGroups := provider.NodeGroups()
+			require.Len(t, nodeGroups, 1)
+			nodeGroup := nodeGroups[0]
+			targetSize, err := nodeGroup.TargetSize()
+			assert.NoError(t, err)
+			assert.Equal(t, 2, targetSize)
+
+			assert.NoError(t, nodeGroup.IncreaseSize(2))
+			assert.Equal(t, 4, arm.size("pool0"))
+			targetSize, err = nodeGroup.TargetSize()
+			assert.NoError(t, err)
+			assert.Equal(t, 4, targetSize)
+			assert.Error(t, nodeGroup.IncreaseSize(2), "increasing beyond the max size")
+
+			// New instances map to the node group once listed.
+			assert.NoError(t, provider.azureManager.forceRefresh())
+			assert.Eventually(t, func() bool {
+				instances, err := nodeGroup.Nodes()
+				return err == nil && len(instances) == 4
+			}, 5*time.Second, 100*time.Millisecond)
+			found, err := provider.NodeGroupForNode(integrationNode(arm, "pool0", 3))
+			assert.NoError(t, err)
+			if assert.NotNil(t, found) {
+				assert.Equal(t, nodeGroup.Id(), found.Id())
+			}
+		})
+	}
+}
+
+func TestIntegrationScaleDown(t *testing.T) {
+	for _, mode := range integrationCacheModes {
+		t.Run(mode.name, func(t *testing.T) {
+			arm := newFakeARM()
+			arm.addScaleSet("pool0", "Standard_D4_v2", 3)
+			provider := newIntegrationProvider(t, arm, mode, "1:5:pool0")
+
+			nodeGroup := provider.NodeGroups()[0]
+			assert.NoError(t, nodeGroup.DeleteNodes([]*apiv1.Node{integrationNode(arm, "pool0", 1)}))
+			assert.Eventually(t, func() bool {
+				return arm.size("pool0") == 2
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.Equal(t, 1, arm.requestCount(http.MethodPost, "virtualMachineScaleSets/pool0/delete"))
+			targetSize, err := nodeGroup.TargetSize()
+			assert.NoError(t, err)
+			assert.Equal(t, 2, targetSize)
+
+			// The min size is enforced against the fake ARM state.
+			assert.NoError(t, nodeGroup.DeleteNodes([]*apiv1.Node{integrationNode(arm, "pool0", 0)}))
+			assert.Eventually(t, func() bool {
+				return arm.size("pool0") == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.Error(t, nodeGroup.DeleteNodes([]*apiv1.Node{integrationNode(arm, "pool0", 2)}))
+			assert.Equal(t, 1, arm.size("pool0"))
+		})
+	}
+}
+
+func TestIntegrationCacheModes(t *testing.T) {
+	for _, mode := range integrationCacheModes {
+		t.Run(mode.name, func(t *testing.T) {
+			arm := newFakeARM()
+			arm.addScaleSet("pool0", "Standard_D4_v2", 1)
+			arm.addScaleSet("pool1", "Standard_D8_v3", 1)
+			provider := newIntegrationProvider(t, arm, mode, "1:5:pool0", "0:5:pool1")
+
+			assert.Len(t, provider.NodeGroups(), 2)
+			scaleSets := provider.azureManager.azureCache.getScaleSets()
+			assert.Contains(t, scaleSets, "pool0")
+			assert.Contains(t, scaleSets, "pool1")
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	klog "k8s.io/klog/v2"
+)
+
+// launchConfigHashAnnotationKey is set on template nodes to the hash of the launch configuration they are built from.
+const launchConfigHashAnnotationKey = "cluster-autoscaler.kubernetes.io/azure-launch-config-hash"
+
+// launchConfig is the part of a scale set model that determines how new instances are bootstrapped.
+// Custom data is left out: ARM never returns it, so its changes can't be detected.
+type launchConfig struct {
+	Extensions     *[]compute.VirtualMachineScaleSetExtension `json:"extensions,omitempty"`
+	ImageReference *compute.ImageReference                    `json:"imageReference,omitempty"`
+}
+
+// launchConfigHash returns a hash of the extensions and image of the scale set model,
+// or an empty string if the scale set has no VM profile.
+func launchConfigHash(vmss compute.VirtualMachineScaleSet) string {
+	if vmss.VirtualMachineScaleSetProperties == nil || vmss.VirtualMachineProfile == nil {
+		return ""
+	}
+
+	profile := vmss.VirtualMachineProfile
+	config := launchConfig{}
+	if profile.ExtensionProfile != nil {
+		config.Extensions = profile.ExtensionProfile.Extensions
+	}
+	if profile.StorageProfile != nil {
+		config.ImageReference = profile.StorageProfile.ImageReference
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		klog.Warningf("Failed to marshal launch configuration of scale set %q: %v", to.String(vmss.Name), err)
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// countOutdatedInstances returns the number of scale set instances which are not running the latest scale set model.
+// Such instances keep the launch configuration they were created or last upgraded with until they are upgraded.
+func countOutdatedInstances(vms []compute.VirtualMachineScaleSetVM) int {
+	outdated := 0
+	for _, vm := range vms {
+		if vm.VirtualMachineScaleSetVMProperties != nil && vm.LatestModelApplied != nil && !*vm.LatestModelApplied {
+			outdated++
+		}
+	}
+	return outdated
+}
+
+// regenerateLaunchConfigHashes hashes the launch configuration of the cached scale sets, reporting
+// the scale sets whose live model drifted from the previously cached one.
+func regenerateLaunchConfigHashes(scaleSets map[string]compute.VirtualMachineScaleSet, previous map[azureRef]string) map[azureRef]string {
+	hashes := make(map[azureRef]string, len(scaleSets))
+	for _, vmss := range scaleSets {
+		ref := azureRef{Name: to.String(vmss.Name)}
+		hash := launchConfigHash(vmss)
+		if oldHash, found := previous[ref]; found && oldHash != hash {
+			klog.V(2).Infof("Launch configuration of scale set %q changed", to.String(vmss.Name))
+			launchConfigChanges.WithLabelValues(to.String(vmss.Name)).Inc()
+		}
+		hashes[ref] = hash
+	}
+	return hashes
+}
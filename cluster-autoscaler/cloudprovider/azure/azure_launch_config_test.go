@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLaunchConfigVMSS(imageVersion string) compute.VirtualMachineScaleSet {
+	return compute.VirtualMachineScaleSet{
+		Name:     to.StringPtr(testASG),
+		Sku:      &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(3)},
+		Location: to.StringPtr(testLocation),
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+				StorageProfile: &compute.VirtualMachineScaleSetStorageProfile{
+					ImageReference: &compute.ImageReference{Version: to.StringPtr(imageVersion)},
+				},
+			},
+		},
+	}
+}
+
+func TestLaunchConfigHash(t *testing.T) {
+	vmss := newTestLaunchConfigVMSS("1.0.0")
+	hash := launchConfigHash(vmss)
+	assert.NotEmpty(t, hash)
+
+	resized := newTestLaunchConfigVMSS("1.0.0")
+	resized.Sku.Capacity = to.Int64Ptr(10)
+	assert.Equal(t, hash, launchConfigHash(resized))
+
+	// ARM doesn't return the custom data of scale sets, it isn't part of the launch configuration.
+	withCustomData := newTestLaunchConfigVMSS("1.0.0")
+	withCustomData.VirtualMachineProfile.OsProfile = &compute.VirtualMachineScaleSetOSProfile{CustomData: to.StringPtr("data")}
+	assert.Equal(t, hash, launchConfigHash(withCustomData))
+	assert.NotEqual(t, hash, launchConfigHash(newTestLaunchConfigVMSS("2.0.0")))
+
+	withExtension := newTestLaunchConfigVMSS("1.0.0")
+	withExtension.VirtualMachineProfile.ExtensionProfile = &compute.VirtualMachineScaleSetExtensionProfile{
+		Extensions: &[]compute.VirtualMachineScaleSetExtension{{Name: to.StringPtr("cse")}},
+	}
+	assert.NotEqual(t, hash, launchConfigHash(withExtension))
+
+	assert.Empty(t, launchConfigHash(compute.VirtualMachineScaleSet{Name: to.StringPtr(testASG)}))
+}
+
+func TestRegenerateLaunchConfigHashes(t *testing.T) {
+	ref := azureRef{Name: testASG}
+	hashes := regenerateLaunchConfigHashes(map[string]compute.VirtualMachineScaleSet{
+		testASG: newTestLaunchConfigVMSS("1.0.0"),
+	}, nil)
+	assert.Equal(t, launchConfigHash(newTestLaunchConfigVMSS("1.0.0")), hashes[ref])
+
+	updated := regenerateLaunchConfigHashes(map[string]compute.VirtualMachineScaleSet{
+		testASG: newTestLaunchConfigVMSS("2.0.0"),
+	}, hashes)
+	assert.NotEqual(t, hashes[ref], updated[ref])
+
+	template, err := buildNodeTemplateFromVMSS(newTestLaunchConfigVMSS("2.0.0"), map[string]string{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, updated[ref], template.VMSSNodeTemplate.LaunchConfigHash)
+}
+
+func TestCountOutdatedInstances(t *testing.T) {
+	vms := newTestVMSSVMList(4)
+	assert.Equal(t, 0, countOutdatedInstances(vms))
+
+	vms[0].LatestModelApplied = to.BoolPtr(false)
+	vms[1].LatestModelApplied = to.BoolPtr(true)
+	vms[2].VirtualMachineScaleSetVMProperties = nil
+	assert.Equal(t, 1, countOutdatedInstances(vms))
+}
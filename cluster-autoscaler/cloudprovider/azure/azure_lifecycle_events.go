@@ -0,0 +1,258 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	klog "k8s.io/klog/v2"
+)
+
+// Instance lifecycle states reported by InstanceLifecycleEvent.
+const (
+	InstanceLifecycleCreating     = "creating"
+	InstanceLifecycleCreateError  = "create-error"
+	InstanceLifecycleRunning      = "running"
+	InstanceLifecycleDeleting     = "deleting"
+	InstanceLifecycleDeleted      = "deleted"
+	InstanceLifecycleRestarting   = "restarting"
+	InstanceLifecycleRestartError = "restart-error"
+)
+
+const (
+	lifecycleWebhookBufferSize = 1000
+	lifecycleWebhookTimeout    = 10 * time.Second
+)
+
+// InstanceLifecycleEvent is a lifecycle transition of a scale set instance observed by the provider.
+type InstanceLifecycleEvent struct {
+	NodeGroup  string `json:"nodeGroup"`
+	ProviderID string `json:"providerID"`
+	// From is the previously observed state of the instance, empty for instances observed for the first time.
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	// ErrorCode and ErrorMessage describe the error of instances which failed to be created.
+	ErrorCode    string    `json:"errorCode,omitempty"`
+	ErrorMessage string    `json:"errorMessage,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// lifecycleEventStream publishes instance lifecycle events to subscribed channels and, if configured, to a
+// webhook. Publishing never blocks: events are dropped for subscribers, or the webhook, lagging behind.
+// A nil stream publishes nothing.
+type lifecycleEventStream struct {
+	mutex       sync.Mutex
+	subscribers []chan InstanceLifecycleEvent
+
+	webhookURL    string
+	webhookEvents chan InstanceLifecycleEvent
+	httpClient    *http.Client
+	cancel        context.CancelFunc
+	// stopped is closed once events are no longer posted.
+	stopped chan struct{}
+}
+
+// newLifecycleEventStream returns a stream, posting events to webhookURL if set.
+func newLifecycleEventStream(webhookURL string) *lifecycleEventStream {
+	s := &lifecycleEventStream{webhookURL: webhookURL}
+	if webhookURL != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		s.webhookEvents = make(chan InstanceLifecycleEvent, lifecycleWebhookBufferSize)
+		s.httpClient = &http.Client{Timeout: lifecycleWebhookTimeout}
+		s.stopped = make(chan struct{})
+		go func() {
+			defer close(s.stopped)
+			s.postEvents(ctx)
+		}()
+	}
+	return s
+}
+
+// subscribe returns a channel receiving the events published from now on.
+func (s *lifecycleEventStream) subscribe(buffer int) <-chan InstanceLifecycleEvent {
+	ch := make(chan InstanceLifecycleEvent, buffer)
+	if s == nil {
+		return ch
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+func (s *lifecycleEventStream) publish(events []InstanceLifecycleEvent) {
+	if s == nil || len(events) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, event := range events {
+		klog.V(4).Infof("Instance %s of %s transitioned from %q to %q", event.ProviderID, event.NodeGroup, event.From, event.To)
+		instanceLifecycleEvents.WithLabelValues(event.To).Inc()
+		for _, ch := range s.subscribers {
+			select {
+			case ch <- event:
+			default:
+				droppedLifecycleEvents.Inc()
+			}
+		}
+		if s.webhookEvents != nil {
+			select {
+			case s.webhookEvents <- event:
+			default:
+				droppedLifecycleEvents.Inc()
+			}
+		}
+	}
+}
+
+// postEvents posts the events to the webhook, one JSON object per request, until ctx is done.
+func (s *lifecycleEventStream) postEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.webhookEvents:
+			if err := s.post(ctx, event); err != nil {
+				klog.Warningf("Failed to post the lifecycle event of instance %s: %v", event.ProviderID, err)
+				droppedLifecycleEvents.Inc()
+			}
+		}
+	}
+}
+
+func (s *lifecycleEventStream) post(ctx context.Context, event InstanceLifecycleEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// stop stops posting events to the webhook, waiting for the event being posted, if any, to be dropped.
+func (s *lifecycleEventStream) stop() {
+	if s != nil && s.cancel != nil {
+		s.cancel()
+		<-s.stopped
+	}
+}
+
+// lifecycleState returns the lifecycle state of an instance with the given status, empty if unknown.
+func lifecycleState(status *cloudprovider.InstanceStatus) string {
+	if status == nil {
+		return ""
+	}
+	switch status.State {
+	case cloudprovider.InstanceCreating:
+		if status.ErrorInfo != nil {
+			return InstanceLifecycleCreateError
+		}
+		return InstanceLifecycleCreating
+	case cloudprovider.InstanceDeleting:
+		return InstanceLifecycleDeleting
+	default:
+		return InstanceLifecycleRunning
+	}
+}
+
+// lifecycleEvent returns the event of an instance transitioning from one status to the other, and whether
+// its lifecycle state changed.
+func lifecycleEvent(nodeGroup, providerID string, from, to *cloudprovider.InstanceStatus, now time.Time) (InstanceLifecycleEvent, bool) {
+	event := InstanceLifecycleEvent{
+		NodeGroup:  nodeGroup,
+		ProviderID: providerID,
+		From:       lifecycleState(from),
+		To:         lifecycleState(to),
+		Time:       now,
+	}
+	if event.To == "" || event.From == event.To {
+		return event, false
+	}
+	if event.To == InstanceLifecycleCreateError {
+		event.ErrorCode = to.ErrorInfo.ErrorCode
+		event.ErrorMessage = to.ErrorInfo.ErrorMessage
+	}
+	return event, true
+}
+
+// diffInstanceLifecycles returns the lifecycle events of the instances of a node group between two
+// successive listings. Instances missing from the current listing were deleted.
+func diffInstanceLifecycles(nodeGroup string, previous, current []cloudprovider.Instance, now time.Time) []InstanceLifecycleEvent {
+	previousStatuses := make(map[string]*cloudprovider.InstanceStatus, len(previous))
+	for _, instance := range previous {
+		previousStatuses[instance.Id] = instance.Status
+	}
+
+	var events []InstanceLifecycleEvent
+	for _, instance := range current {
+		from := previousStatuses[instance.Id]
+		delete(previousStatuses, instance.Id)
+		if event, changed := lifecycleEvent(nodeGroup, instance.Id, from, instance.Status, now); changed {
+			events = append(events, event)
+		}
+	}
+	for providerID, status := range previousStatuses {
+		events = append(events, InstanceLifecycleEvent{
+			NodeGroup:  nodeGroup,
+			ProviderID: providerID,
+			From:       lifecycleState(status),
+			To:         InstanceLifecycleDeleted,
+			Time:       now,
+		})
+	}
+	return events
+}
+
+// setInstanceCache replaces the cached instances of the scale set, publishing their lifecycle transitions
+// once the scale set was listed before. Caller must hold scaleSet.instanceMutex.
+func (scaleSet *ScaleSet) setInstanceCache(instances []cloudprovider.Instance) {
+	if scaleSet.instancesListed {
+		events := diffInstanceLifecycles(scaleSet.Name, scaleSet.instanceCache, instances, time.Now())
+		scaleSet.manager.lifecycleEvents.publish(events)
+	}
+	scaleSet.instanceCache = instances
+	scaleSet.instancesListed = true
+}
+
+// InstanceLifecycleEvents returns a channel receiving the lifecycle transitions of scale set instances observed
+// by the provider from now on, as instances are listed or deleted. Events are dropped while the channel is full.
+func (azure *AzureCloudProvider) InstanceLifecycleEvents(buffer int) <-chan InstanceLifecycleEvent {
+	return azure.azureManager.lifecycleEvents.subscribe(buffer)
+}
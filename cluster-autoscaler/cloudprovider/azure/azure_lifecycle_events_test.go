@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+)
+
+func TestDiffInstanceLifecycles(t *testing.T) {
+	now := time.Now()
+	previous := []cloudprovider.Instance{
+		{Id: "creating", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceCreating}},
+		{Id: "failing", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceCreating}},
+		{Id: "running", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceRunning}},
+		{Id: "deleting", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceDeleting}},
+	}
+	current := []cloudprovider.Instance{
+		{Id: "creating", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceRunning}},
+		{Id: "failing", Status: &cloudprovider.InstanceStatus{
+			State:     cloudprovider.InstanceCreating,
+			ErrorInfo: &cloudprovider.InstanceErrorInfo{ErrorCode: "provisioning-state-failed", ErrorMessage: "failed"},
+		}},
+		{Id: "running", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceRunning}},
+		{Id: "new", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceCreating}},
+		{Id: "unknown"},
+	}
+
+	events := diffInstanceLifecycles("ng", previous, current, now)
+	assert.ElementsMatch(t, []InstanceLifecycleEvent{
+		{NodeGroup: "ng", ProviderID: "creating", From: InstanceLifecycleCreating, To: InstanceLifecycleRunning, Time: now},
+		{NodeGroup: "ng", ProviderID: "failing", From: InstanceLifecycleCreating, To: InstanceLifecycleCreateError,
+			ErrorCode: "provisioning-state-failed", ErrorMessage: "failed", Time: now},
+		{NodeGroup: "ng", ProviderID: "new", To: InstanceLifecycleCreating, Time: now},
+		{NodeGroup: "ng", ProviderID: "deleting", From: InstanceLifecycleDeleting, To: InstanceLifecycleDeleted, Time: now},
+	}, events)
+}
+
+func TestLifecycleEventStream(t *testing.T) {
+	received := make(chan InstanceLifecycleEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event InstanceLifecycleEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+	}))
+	defer webhook.Close()
+
+	stream := newLifecycleEventStream(webhook.URL)
+	defer stream.stop()
+	subscription := stream.subscribe(1)
+
+	event := InstanceLifecycleEvent{NodeGroup: "ng", ProviderID: "id", From: InstanceLifecycleRunning, To: InstanceLifecycleDeleting}
+	stream.publish([]InstanceLifecycleEvent{event, event})
+	assert.Equal(t, event, <-subscription)
+	assert.Empty(t, subscription, "events are dropped while the subscription is full")
+
+	select {
+	case posted := <-received:
+		assert.Equal(t, event.ProviderID, posted.ProviderID)
+		assert.Equal(t, event.To, posted.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("lifecycle event was not posted to the webhook")
+	}
+
+	var nilStream *lifecycleEventStream
+	nilStream.publish([]InstanceLifecycleEvent{event})
+	nilStream.stop()
+	assert.NotNil(t, nilStream.subscribe(1))
+}
+
+func TestScaleSetPublishesLifecycleEvents(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.lifecycleEvents = newLifecycleEventStream("")
+	provider := &AzureCloudProvider{azureManager: manager}
+	events := provider.InstanceLifecycleEvents(10)
+	scaleSet := newTestScaleSet(manager, testASG)
+	scaleSet.lastInstanceRefresh = time.Now()
+	scaleSet.instancesRefreshPeriod = time.Hour
+
+	instance := cloudprovider.Instance{Id: "id", Status: &cloudprovider.InstanceStatus{State: cloudprovider.InstanceRunning}}
+	scaleSet.setInstanceCache([]cloudprovider.Instance{instance})
+	assert.Empty(t, events, "instances listed for the first time are not published")
+
+	scaleSet.setInstanceStatusByProviderID("id", cloudprovider.InstanceStatus{State: cloudprovider.InstanceDeleting})
+	event := <-events
+	assert.Equal(t, InstanceLifecycleRunning, event.From)
+	assert.Equal(t, InstanceLifecycleDeleting, event.To)
+
+	scaleSet.setInstanceCache(nil)
+	event = <-events
+	assert.Equal(t, InstanceLifecycleDeleted, event.To)
+	assert.Equal(t, testASG, event.NodeGroup)
+}
@@ -23,6 +23,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest/azure"
@@ -65,6 +66,35 @@ type AzureManager struct {
 
 	autoDiscoverySpecs   []labelAutoDiscoveryConfig
 	explicitlyConfigured map[string]bool
+
+	// stockouts keeps the recent stockouts of node groups, reported on their template nodes.
+	stockouts stockoutHistory
+	// health scores node groups by their recent failures, reported on their template nodes.
+	health nodeGroupHealth
+	// lastResourceHealthRefresh is when Resource Health was last queried for the managed scale sets.
+	lastResourceHealthRefresh time.Time
+	// zoneFailures keeps the recent allocation failures of SKUs by zone, avoided by multi-zone template nodes.
+	zoneFailures zoneFailureHistory
+
+	// operations keeps the in-flight ARM mutations, drained on Cleanup.
+	operations *operationTracker
+	// deletions tracks the instance deletions requested from scale sets until they are confirmed.
+	deletions *deletionTracker
+	// lifecycleEvents publishes the lifecycle transitions of scale set instances.
+	lifecycleEvents *lifecycleEventStream
+	// state persists the provider state across restarts, if a state ConfigMap is configured.
+	state *stateStore
+	// resumedOperations are the capacity operations left unfinished by the previous leader on scale sets still
+	// updating, polled on every refresh until they settle.
+	resumedOperations []armOperation
+	// refreshHealth reports ARM as degraded to the autoscaler loop when cache refreshes are slow or failing.
+	refreshHealth *refreshHealth
+	// decisions reports what the provider saw and did in every loop, if a decision report address or file is configured.
+	decisions *decisionReporter
+	// refreshEffectsMutex serializes the side effects of cache refreshes, e.g. resuming operations, tagging
+	// scale sets or restarting instances, as refreshes run from both the main loop and the goroutines waiting for
+	// instance deletions with StrictCacheUpdates. It guards resumedOperations and lastResourceHealthRefresh.
+	refreshEffectsMutex sync.Mutex
 }
 
 // createAzureManagerInternal allows for a custom azClient to be passed in by tests.
@@ -73,17 +103,21 @@ func createAzureManagerInternal(configReader io.Reader, discoveryOpts cloudprovi
 	if err != nil {
 		return nil, err
 	}
+	return newAzureManager(cfg, discoveryOpts, azClient)
+}
 
-	// Defaulting env to Azure Public Cloud.
-	env := azure.PublicCloud
-	if cfg.Cloud != "" {
-		env, err = azure.EnvironmentFromName(cfg.Cloud)
-		if err != nil {
-			return nil, err
-		}
+// newAzureManager creates the manager of a complete config, creating the Azure clients if azClient is nil,
+// registers the node groups and fills the cache.
+func newAzureManager(cfg *Config, discoveryOpts cloudprovider.NodeGroupDiscoveryOptions, azClient *azClient) (*AzureManager, error) {
+	env, err := azureEnvironment(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	klog.Infof("Starting azure manager with subscription ID %q", cfg.SubscriptionID)
+	if cfg.DryRun {
+		klog.Warningf("Dry run is enabled, capacity updates, instance deletions and agent pool changes are only logged")
+	}
 
 	if azClient == nil {
 		azClient, err = newAzClient(cfg, &env)
@@ -98,6 +132,10 @@ func createAzureManagerInternal(configReader io.Reader, discoveryOpts cloudprovi
 		env:                  env,
 		azClient:             azClient,
 		explicitlyConfigured: make(map[string]bool),
+		operations:           newOperationTracker(time.Now),
+		deletions:            newDeletionTracker(),
+		lifecycleEvents:      newLifecycleEventStream(cfg.LifecycleEventWebhookURL),
+		refreshHealth:        newRefreshHealth(cfg),
 	}
 
 	cacheTTL := refreshInterval
@@ -109,6 +147,13 @@ func createAzureManagerInternal(configReader io.Reader, discoveryOpts cloudprovi
 		return nil, err
 	}
 	manager.azureCache = cache
+	manager.operations.now = func() time.Time { return manager.azureCache.now() }
+
+	manager.decisions, err = newDecisionReporter(cfg.DecisionReportAddress, cfg.DecisionReportFile, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	cache.errors.decisions = manager.decisions
 
 	if !manager.azureCache.HasVMSKUs() {
 		klog.Warning("No VM SKU info loaded, using only static SKU list")
@@ -120,6 +165,9 @@ func createAzureManagerInternal(configReader io.Reader, discoveryOpts cloudprovi
 		return nil, err
 	}
 	manager.autoDiscoverySpecs = specs
+	if cfg.RefreshRegisteredNodeGroupsOnly && len(specs) > 0 {
+		return nil, fmt.Errorf("refreshRegisteredNodeGroupsOnly cannot be used with node group autodiscovery")
+	}
 
 	if err := manager.fetchExplicitNodeGroups(discoveryOpts.NodeGroupSpecs); err != nil {
 		return nil, err
@@ -144,11 +192,29 @@ func createAzureManagerInternal(configReader io.Reader, discoveryOpts cloudprovi
 	return manager, nil
 }
 
+// azureEnvironment returns the Azure environment of the configured cloud, defaulting to Azure Public Cloud.
+func azureEnvironment(cfg *Config) (azure.Environment, error) {
+	if cfg.Cloud == "" {
+		return azure.PublicCloud, nil
+	}
+	return azure.EnvironmentFromName(cfg.Cloud)
+}
+
 // CreateAzureManager creates Azure Manager object to work with Azure.
 func CreateAzureManager(configReader io.Reader, discoveryOpts cloudprovider.NodeGroupDiscoveryOptions) (*AzureManager, error) {
 	return createAzureManagerInternal(configReader, discoveryOpts, nil)
 }
 
+// CreateAzureManagerWithOverrides creates Azure Manager object to work with Azure, overriding fields of the config
+// as described by BuildAzureConfigWithOverrides.
+func CreateAzureManagerWithOverrides(configReader io.Reader, discoveryOpts cloudprovider.NodeGroupDiscoveryOptions, configOverrides []string) (*AzureManager, error) {
+	cfg, err := BuildAzureConfigWithOverrides(configReader, configOverrides)
+	if err != nil {
+		return nil, err
+	}
+	return newAzureManager(cfg, discoveryOpts, nil)
+}
+
 func (m *AzureManager) fetchExplicitNodeGroups(specs []string) error {
 	changed := false
 	for _, spec := range specs {
@@ -216,29 +282,65 @@ func (m *AzureManager) buildNodeGroupFromSpec(spec string) (cloudprovider.NodeGr
 // Refresh is called before every main loop and can be used to dynamically update cloud provider state.
 // In particular the list of node groups returned by NodeGroups can change as a result of CloudProvider.Refresh().
 func (m *AzureManager) Refresh() error {
-	if m.lastRefresh.Add(m.azureCache.refreshInterval).After(time.Now()) {
+	now := m.azureCache.now()
+	m.decisions.next(now)
+	defer func() {
+		m.decisions.recordCacheAge(m.azureCache.now().Sub(m.lastRefresh))
+	}()
+	m.azureCache.evictExpiredNodeGroupResources(now)
+	m.flushState()
+	m.health.report(now)
+	m.azureCache.errors.summarize(now)
+	m.reconcileDeletions(now)
+	if m.lastRefresh.Add(m.azureCache.refreshInterval).After(now) {
 		return nil
 	}
 	return m.forceRefresh()
 }
 
-func (m *AzureManager) forceRefresh() error {
+func (m *AzureManager) forceRefresh() (err error) {
+	start := m.azureCache.now()
+	defer func() {
+		m.refreshHealth.observe(m.azureCache.now().Sub(start), err != nil)
+	}()
+
+	if err := m.azureCache.fetchAzureResources(); err != nil {
+		m.azureCache.errors.errorf(callCacheRefresh, m.config.ResourceGroup, err, m.azureCache.now(), "Failed to regenerate Azure cache: %v", err)
+		return err
+	}
+	// Autodiscovery runs on the scale sets listed just above, so that new scale sets are registered,
+	// and deleted ones unregistered, before instances are mapped to node groups.
 	if err := m.fetchAutoNodeGroups(); err != nil {
 		klog.Errorf("Failed to fetch autodiscovered nodegroups: %v", err)
 	}
-	if err := m.azureCache.regenerate(); err != nil {
+	modelChanges, err := m.azureCache.regenerateMappings()
+	if err != nil {
 		klog.Errorf("Failed to regenerate Azure cache: %v", err)
 		return err
 	}
-	m.lastRefresh = time.Now()
+	m.reportScaleSetModelChanges(modelChanges)
+
+	m.refreshEffectsMutex.Lock()
+	defer m.refreshEffectsMutex.Unlock()
+	m.pollResumedOperations()
+	m.lastRefresh = m.azureCache.now()
 	klog.V(2).Infof("Refreshed Azure VM and VMSS list, next refresh after %v", m.lastRefresh.Add(m.azureCache.refreshInterval))
+	if m.config.EnableDynamicInstanceList {
+		m.azureCache.refreshSKUCache(m.config.Location, m.lastRefresh)
+	}
+	m.refreshQuotaMetrics()
+	m.refreshResourceHealth(m.azureCache.now())
+	m.ensurePropagatedTags()
+	m.processRestartRequests()
+	m.reportEstimatedCost()
+	m.recordListedResources()
 	return nil
 }
 
 // invalidateCache forces cache reload on the next check
 // by manipulating lastRefresh timestamp
 func (m *AzureManager) invalidateCache() {
-	m.lastRefresh = time.Now().Add(-1 * m.azureCache.refreshInterval)
+	m.lastRefresh = m.azureCache.now().Add(-1 * m.azureCache.refreshInterval)
 	klog.V(2).Infof("Invalidated Azure cache")
 }
 
@@ -277,7 +379,7 @@ func (m *AzureManager) fetchAutoNodeGroups() error {
 	}
 
 	if changed {
-		m.invalidateCache()
+		klog.V(2).Infof("Autodiscovered NodeGroups changed, %d NodeGroups registered", len(m.getNodeGroups()))
 	}
 
 	return nil
@@ -299,7 +401,9 @@ func (m *AzureManager) UnregisterNodeGroup(nodeGroup cloudprovider.NodeGroup) bo
 
 // GetNodeGroupForInstance returns the NodeGroup of the given Instance
 func (m *AzureManager) GetNodeGroupForInstance(instance *azureRef) (cloudprovider.NodeGroup, error) {
-	return m.azureCache.FindForInstance(instance, m.config.VMType)
+	nodeGroup, err := m.azureCache.FindForInstance(instance, m.config.VMType)
+	m.decisions.recordLookup(nodeGroup != nil, err)
+	return nodeGroup, err
 }
 
 // GetScaleSetOptions parse options extracted from VMSS tags and merges them with provided defaults
@@ -327,6 +431,14 @@ func (m *AzureManager) GetScaleSetOptions(scaleSetName string, defaults config.N
 
 // Cleanup the cache.
 func (m *AzureManager) Cleanup() {
+	timeout := defaultShutdownOperationTimeout
+	if m.config.ShutdownOperationTimeoutInSeconds > 0 {
+		timeout = time.Duration(m.config.ShutdownOperationTimeoutInSeconds) * time.Second
+	}
+	m.recordUnfinishedOperations(m.operations.drain(timeout))
+	m.flushState()
+	m.lifecycleEvents.stop()
+	m.decisions.stop()
 	m.azureCache.Cleanup()
 }
 
@@ -412,6 +524,8 @@ func (m *AzureManager) getFilteredScaleSets(filter []labelAutoDiscoveryConfig) (
 			klog.Warningf("ignoring vmss %q %s", *scaleSet.Name, err)
 			continue
 		}
+		// Pin paused scale sets right away, so they compare equal to their registered node group.
+		vmss.updatePaused(scaleSet.Tags, curSize)
 		nodeGroups = append(nodeGroups, vmss)
 	}
 
@@ -1283,6 +1283,69 @@ func TestFetchAutoAsgsVmss(t *testing.T) {
 	assert.Equal(t, 1, len(asgs))
 }
 
+func TestForceRefreshAutodiscoversNewScaleSets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	vmssName := "test-vmss"
+	vmssTag := "fake-tag"
+	vmssTagValue := "fake-value"
+	minString := "1"
+	maxString := "5"
+	newMaxString := "10"
+
+	taggedScaleSet := func(maxSize *string) compute.VirtualMachineScaleSet {
+		vmss := fakeVMSSWithTags(vmssName, map[string]*string{vmssTag: &vmssTagValue, "min": &minString, "max": maxSize})
+		vmss.VirtualMachineScaleSetProperties = &compute.VirtualMachineScaleSetProperties{OrchestrationMode: compute.Uniform}
+		return vmss
+	}
+
+	manager := newTestAzureManager(t)
+	specs, err := ParseLabelAutoDiscoverySpecs(cloudprovider.NodeGroupDiscoveryOptions{
+		NodeGroupAutoDiscoverySpecs: []string{fmt.Sprintf("label:%s=%s", vmssTag, vmssTagValue)},
+	})
+	assert.NoError(t, err)
+	manager.autoDiscoverySpecs = specs
+
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	gomock.InOrder(
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachineScaleSet{}, nil),
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachineScaleSet{taggedScaleSet(&maxString)}, nil),
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachineScaleSet{taggedScaleSet(&newMaxString)}, nil),
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachineScaleSet{}, nil),
+	)
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, vmssName, gomock.Any()).Return(newTestVMSSVMList(1), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	mockVMClient := mockvmclient.NewMockInterface(ctrl)
+	mockVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachine{}, nil).AnyTimes()
+	manager.azClient.virtualMachinesClient = mockVMClient
+
+	assert.NoError(t, manager.forceRefresh())
+	assert.Empty(t, manager.getNodeGroups())
+
+	// The scale set is registered and its instances mapped by the refresh that first lists it.
+	assert.NoError(t, manager.forceRefresh())
+	asgs := manager.getNodeGroups()
+	assert.Equal(t, 1, len(asgs))
+	assert.Equal(t, 5, asgs[0].MaxSize())
+	nodeGroup := manager.azureCache.getInstanceFromCache(azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, 0))
+	if assert.NotNil(t, nodeGroup) {
+		assert.Equal(t, vmssName, nodeGroup.Id())
+	}
+
+	// Size tag changes are re-synced to the registered node group.
+	assert.NoError(t, manager.forceRefresh())
+	asgs = manager.getNodeGroups()
+	assert.Equal(t, 1, len(asgs))
+	assert.Equal(t, 10, asgs[0].MaxSize())
+
+	// Scale sets that are gone are unregistered.
+	assert.NoError(t, manager.forceRefresh())
+	assert.Empty(t, manager.getNodeGroups())
+}
+
 func TestManagerRefreshAndCleanup(t *testing.T) {
 	originalEnv := saveAndClearEnv()
 	t.Cleanup(func() {
@@ -0,0 +1,340 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sync"
+	"time"
+
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	caNamespace = "cluster_autoscaler"
+)
+
+var (
+	/**** Metrics related to Azure API usage ****/
+	agentPoolListPageDuration = k8smetrics.NewHistogramVec(
+		&k8smetrics.HistogramOpts{
+			Namespace: caNamespace,
+			Name:      "azure_agent_pool_list_page_duration_seconds",
+			Help:      "Time taken to fetch a single page of agent pools, by status, in seconds",
+			Buckets:   []float64{0.05, 0.1, 0.2, 0.5, 1.0, 2.0, 5.0, 10.0, 20.0, 30.0, 60.0},
+		}, []string{"status"},
+	)
+
+	skuRestrictedScaleUps = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_sku_restricted_scale_ups_total",
+			Help:      "Number of scale-ups failed early because the SKU is restricted in the location or zones of the node group, by SKU",
+		}, []string{"sku"},
+	)
+
+	capacityProbeStockouts = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_capacity_probe_stockouts_total",
+			Help:      "Number of large scale-ups not issued because a capacity probe detected a stockout, by SKU",
+		}, []string{"sku"},
+	)
+
+	apiVersionInfo = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_api_version_info",
+			Help:      "A metric with a constant '1' value labeled by Azure client and the ARM API version it uses",
+		}, []string{"client", "api_version"},
+	)
+
+	launchConfigChanges = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_launch_config_changes_total",
+			Help:      "Number of launch configuration (extensions, image) changes detected in scale set models, by node group",
+		}, []string{"node_group"},
+	)
+
+	skuChanges = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_sku_changes_total",
+			Help:      "Number of in-place VM SKU changes detected in scale set models, by node group",
+		}, []string{"node_group"},
+	)
+
+	zoneChanges = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_zone_changes_total",
+			Help:      "Number of availability zone changes detected in scale set models, by node group",
+		}, []string{"node_group"},
+	)
+
+	tagDrifts = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_tag_drifts_total",
+			Help:      "Number of times propagated tags were found missing from scale sets and restored, by node group",
+		}, []string{"node_group"},
+	)
+
+	nodeGroupHealthScore = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_node_group_health_score",
+			Help:      "Health score of node groups which failed recently, between 0 and 1, by node group",
+		}, []string{"node_group"},
+	)
+
+	instanceLifecycleEvents = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_instance_lifecycle_events_total",
+			Help:      "Number of scale set instance lifecycle transitions observed, by state transitioned to",
+		}, []string{"state"},
+	)
+
+	droppedLifecycleEvents = k8smetrics.NewCounter(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_dropped_lifecycle_events_total",
+			Help:      "Number of instance lifecycle events dropped because a subscriber lagged behind or the webhook failed",
+		},
+	)
+
+	providerDegraded = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_provider_degraded",
+			Help:      "Whether ARM is reported as degraded to the autoscaler loop, because cache refreshes are slow, failing or throttled",
+		},
+	)
+
+	dryRunOperations = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_dry_run_operations_total",
+			Help:      "Number of mutating operations logged but not executed in dry run mode, by operation",
+		}, []string{"operation"},
+	)
+
+	cacheErrors = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_cache_errors_total",
+			Help:      "Number of failed ARM calls refreshing the Azure cache, by call and error code",
+		}, []string{"call", "code"},
+	)
+
+	deferredCalls = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_deferred_calls_total",
+			Help:      "Number of background ARM calls deferred while ARM requests are throttled, by call",
+		}, []string{"call"},
+	)
+
+	outOfBandResizes = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_out_of_band_resizes_total",
+			Help:      "Number of scale sets found resized out of band on startup, by node group",
+		}, []string{"node_group"},
+	)
+
+	outdatedInstances = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_outdated_instances",
+			Help:      "Number of instances of a uniform scale set not running its latest model, by node group",
+		}, []string{"node_group"},
+	)
+
+	unhealthyInstances = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_unhealthy_instances",
+			Help:      "Number of instances of a uniform scale set stopped, deallocated or failing their health probe, by node group",
+		}, []string{"node_group"},
+	)
+
+	resourceHealthDegraded = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_resource_health_degraded",
+			Help:      "Whether Resource Health reported a platform issue for a scale set on its last query, by node group",
+		}, []string{"node_group"},
+	)
+
+	unmappedVirtualMachines = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_unmapped_virtual_machines",
+			Help:      "Number of VMs in the resource group not mapped to any agent pool, by tag or name pattern, on the last listing",
+		},
+	)
+
+	streamedVirtualMachineListings = k8smetrics.NewCounter(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_streamed_virtual_machine_listings_total",
+			Help:      "Number of VM listings processed page by page",
+		},
+	)
+
+	streamedVirtualMachineListPages = k8smetrics.NewCounter(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_streamed_virtual_machine_list_pages_total",
+			Help:      "Number of VM list pages processed by streamed VM listings",
+		},
+	)
+
+	pendingDeletions = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_pending_deletions",
+			Help:      "Number of scale set instance deletions requested but not confirmed yet, in flight or awaiting retry, by node group",
+		}, []string{"node_group"},
+	)
+
+	deletionRetries = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_deletion_retries_total",
+			Help:      "Number of scale set instance deletions retried after failing, by node group",
+		}, []string{"node_group"},
+	)
+
+	resurrectedInstances = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_resurrected_instances_total",
+			Help:      "Number of scale set instances listed again after their deletion succeeded, by node group",
+		}, []string{"node_group"},
+	)
+
+	estimatedHourlyCost = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_estimated_hourly_cost",
+			Help:      "Estimated hourly cost of the managed node groups at their target size, in the normalized prices of the pricing model",
+		},
+	)
+
+	costCeilingExceeded = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_cost_ceiling_exceeded_total",
+			Help:      "Number of scale-ups exceeding the cost ceiling, by node group and action (refused, warned or overridden)",
+		}, []string{"node_group", "action"},
+	)
+
+	deletionHolds = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_deletion_holds_total",
+			Help:      "Number of node deletions refused because the nodes were held from deletion, by node group",
+		}, []string{"node_group"},
+	)
+
+	zoneAllocationFailures = k8smetrics.NewCounterVec(
+		&k8smetrics.CounterOpts{
+			Namespace: caNamespace,
+			Name:      "azure_zone_allocation_failures_total",
+			Help:      "Number of allocation failures of a SKU in a zone without another failure in the last 30 minutes, by SKU and zone",
+		}, []string{"sku", "zone"},
+	)
+
+	skuCacheAge = k8smetrics.NewGauge(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_sku_cache_age_seconds",
+			Help:      "Time since the VM SKU cache was last fetched, when dynamic instance list is enabled",
+		},
+	)
+
+	quotaUsage = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_quota_usage",
+			Help:      "vCPU quota consumed in the SKU family of a node group, by node group and family",
+		}, []string{"node_group", "family"},
+	)
+
+	quotaLimit = k8smetrics.NewGaugeVec(
+		&k8smetrics.GaugeOpts{
+			Namespace: caNamespace,
+			Name:      "azure_quota_limit",
+			Help:      "vCPU quota limit of the SKU family of a node group, by node group and family",
+		}, []string{"node_group", "family"},
+	)
+)
+
+var registerMetricsOnce sync.Once
+
+// RegisterMetrics registers all Azure metrics. It is safe to call more than once.
+func RegisterMetrics() {
+	registerMetricsOnce.Do(registerMetrics)
+}
+
+func registerMetrics() {
+	legacyregistry.MustRegister(agentPoolListPageDuration)
+	legacyregistry.MustRegister(skuRestrictedScaleUps)
+	legacyregistry.MustRegister(capacityProbeStockouts)
+	legacyregistry.MustRegister(apiVersionInfo)
+	legacyregistry.MustRegister(launchConfigChanges)
+	legacyregistry.MustRegister(skuChanges)
+	legacyregistry.MustRegister(zoneChanges)
+	legacyregistry.MustRegister(tagDrifts)
+	legacyregistry.MustRegister(outOfBandResizes)
+	legacyregistry.MustRegister(cacheErrors)
+	legacyregistry.MustRegister(dryRunOperations)
+	legacyregistry.MustRegister(providerDegraded)
+	legacyregistry.MustRegister(deferredCalls)
+	legacyregistry.MustRegister(nodeGroupHealthScore)
+	legacyregistry.MustRegister(instanceLifecycleEvents)
+	legacyregistry.MustRegister(droppedLifecycleEvents)
+	legacyregistry.MustRegister(outdatedInstances)
+	legacyregistry.MustRegister(unhealthyInstances)
+	legacyregistry.MustRegister(zoneAllocationFailures)
+	legacyregistry.MustRegister(deletionHolds)
+	legacyregistry.MustRegister(estimatedHourlyCost)
+	legacyregistry.MustRegister(pendingDeletions)
+	legacyregistry.MustRegister(resourceHealthDegraded)
+	legacyregistry.MustRegister(unmappedVirtualMachines)
+	legacyregistry.MustRegister(streamedVirtualMachineListings)
+	legacyregistry.MustRegister(streamedVirtualMachineListPages)
+	legacyregistry.MustRegister(deletionRetries)
+	legacyregistry.MustRegister(resurrectedInstances)
+	legacyregistry.MustRegister(costCeilingExceeded)
+	legacyregistry.MustRegister(skuCacheAge)
+	legacyregistry.MustRegister(quotaUsage)
+	legacyregistry.MustRegister(quotaLimit)
+}
+
+// observeAgentPoolListPage records the duration of an agent pool page fetch.
+func observeAgentPoolListPage(err error, start time.Time) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	agentPoolListPageDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+}
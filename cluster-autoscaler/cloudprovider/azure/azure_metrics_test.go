@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// gatheredValue returns the value of the gauge or counter named name with the labels, as gathered from the
+// legacy registry, or -1 if it is not exported.
+func gatheredValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != caNamespace+"_"+name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, found := labels[label.GetName()]; found && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched != len(labels) {
+				continue
+			}
+			if metric.GetCounter() != nil {
+				return metric.GetCounter().GetValue()
+			}
+			return metric.GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestRegisterMetricsTwice(t *testing.T) {
+	assert.NotPanics(t, RegisterMetrics)
+	assert.NotPanics(t, RegisterMetrics, "a second provider or an embedding controller may register the metrics again")
+}
+
+func TestAPIVersionExported(t *testing.T) {
+	RegisterMetrics()
+	recordAPIVersion(computeClientName, "2023-03-01")
+	assert.Equal(t, 1.0, gatheredValue(t, "azure_api_version_info", map[string]string{"client": computeClientName, "api_version": "2023-03-01"}))
+}
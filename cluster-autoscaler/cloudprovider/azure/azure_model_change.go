@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	apiv1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// scaleSetSKUChangedReason is the reason of events about scale sets resized to another VM SKU in place.
+	scaleSetSKUChangedReason = "ScaleSetSKUChanged"
+	// scaleSetZonesChangedReason is the reason of events about zones added to or removed from scale sets out of band.
+	scaleSetZonesChangedReason = "ScaleSetZonesChanged"
+)
+
+// scaleSetModelChange is a change of the model of a scale set detected on a cache refresh.
+type scaleSetModelChange struct {
+	scaleSet string
+	reason   string
+	message  string
+}
+
+// diffScaleSetModels records a property of the models of the cached scale sets, returning the scale sets whose
+// property changed since the previous refresh with reason. property returns the property of a model and whether
+// it is set, describe returns the message of a change of the property of a scale set, empty if there is none.
+func diffScaleSetModels[T any](scaleSets map[string]compute.VirtualMachineScaleSet, previous map[azureRef]T, reason string,
+	property func(compute.VirtualMachineScaleSet) (T, bool), describe func(name string, old, current T) string) (map[azureRef]T, []scaleSetModelChange) {
+	values := make(map[azureRef]T, len(scaleSets))
+	var changes []scaleSetModelChange
+	for _, vmss := range scaleSets {
+		current, ok := property(vmss)
+		if !ok {
+			continue
+		}
+		name := to.String(vmss.Name)
+		ref := azureRef{Name: name}
+		if old, found := previous[ref]; found {
+			if message := describe(name, old, current); message != "" {
+				changes = append(changes, scaleSetModelChange{scaleSet: name, reason: reason, message: message})
+			}
+		}
+		values[ref] = current
+	}
+	return values, changes
+}
+
+// reportScaleSetModelChanges logs and counts the changes of scale set models detected on the last refresh, and
+// records them as events. Template nodes are built from the current models, but node infos built from the
+// existing nodes of a scale set keep reflecting the previous model until these nodes are replaced.
+func (m *AzureManager) reportScaleSetModelChanges(changes []scaleSetModelChange) {
+	for _, change := range changes {
+		klog.Warningf("%s, new nodes are simulated from the current model", change.message)
+		switch change.reason {
+		case scaleSetSKUChangedReason:
+			skuChanges.WithLabelValues(change.scaleSet).Inc()
+		case scaleSetZonesChangedReason:
+			zoneChanges.WithLabelValues(change.scaleSet).Inc()
+		}
+		m.state.eventf(apiv1.EventTypeWarning, change.reason,
+			"%s; node infos built from its existing nodes reflect the previous model until they are replaced", change.message)
+	}
+}
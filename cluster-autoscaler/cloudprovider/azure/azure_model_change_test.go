@@ -0,0 +1,46 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReportScaleSetModelChanges(t *testing.T) {
+	manager := newTestAzureManager(t)
+	// Changes are only logged without a state store.
+	manager.reportScaleSetModelChanges([]scaleSetModelChange{{scaleSet: testASG, reason: scaleSetSKUChangedReason, message: "changed"}})
+
+	recorder := record.NewFakeRecorder(10)
+	manager.state = newStateStore(fake.NewSimpleClientset(), recorder, "kube-system", "cluster-autoscaler-azure-state")
+	manager.reportScaleSetModelChanges(nil)
+	assert.Empty(t, recorder.Events)
+
+	manager.reportScaleSetModelChanges([]scaleSetModelChange{{
+		scaleSet: testASG,
+		reason:   scaleSetSKUChangedReason,
+		message:  "SKU of scale set " + testASG + " changed from Standard_D4_v2 to Standard_D8_v3",
+	}})
+	assert.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.Contains(t, event, scaleSetSKUChangedReason)
+	assert.Contains(t, event, "changed from Standard_D4_v2 to Standard_D8_v3")
+}
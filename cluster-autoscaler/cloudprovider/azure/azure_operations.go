@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	operationUpdateCapacity   = "updateCapacity"
+	operationDeleteInstances  = "deleteInstances"
+	operationUpdateTags       = "updateTags"
+	operationRestartInstances = "restartInstances"
+
+	// defaultShutdownOperationTimeout bounds how long in-flight operations are waited for on shutdown.
+	defaultShutdownOperationTimeout = 20 * time.Second
+	operationDrainPollInterval      = 100 * time.Millisecond
+)
+
+// armOperation is a mutation of a node group issued to ARM, from its request until its completion.
+type armOperation struct {
+	Kind      string    `json:"kind"`
+	NodeGroup string    `json:"nodeGroup"`
+	StartedAt time.Time `json:"startedAt"`
+	// TargetSize is the capacity requested by an updateCapacity operation.
+	TargetSize int64 `json:"targetSize,omitempty"`
+	// InstanceIDs are the instances deleted by a deleteInstances operation.
+	InstanceIDs []string `json:"instanceIDs,omitempty"`
+}
+
+func (op armOperation) String() string {
+	switch op.Kind {
+	case operationUpdateCapacity:
+		return fmt.Sprintf("%s of %s to %d, started at %v", op.Kind, op.NodeGroup, op.TargetSize, op.StartedAt)
+	case operationUpdateTags:
+		return fmt.Sprintf("%s of %s, started at %v", op.Kind, op.NodeGroup, op.StartedAt)
+	}
+	return fmt.Sprintf("%s of %s instances %v, started at %v", op.Kind, op.NodeGroup, op.InstanceIDs, op.StartedAt)
+}
+
+// changesCapacity returns whether op changes the capacity of its node group.
+func (op armOperation) changesCapacity() bool {
+	return op.Kind == operationUpdateCapacity || op.Kind == operationDeleteInstances
+}
+
+// operationTracker keeps the in-flight ARM operations, so that shutdown can wait for them, and refuses
+// new operations once draining. A nil tracker tracks nothing.
+type operationTracker struct {
+	mutex    sync.Mutex
+	draining bool
+	nextID   int
+	inFlight map[int]armOperation
+	// now returns the start time of operations.
+	now func() time.Time
+}
+
+func newOperationTracker(now func() time.Time) *operationTracker {
+	return &operationTracker{inFlight: make(map[int]armOperation), now: now}
+}
+
+// start records op as in flight. The returned function must be called once op completes, successfully or not.
+func (t *operationTracker) start(op armOperation) (func(), error) {
+	if t == nil {
+		return func() {}, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.draining {
+		return nil, fmt.Errorf("shutting down, not starting %s of %s", op.Kind, op.NodeGroup)
+	}
+	op.StartedAt = t.now()
+	id := t.nextID
+	t.nextID++
+	t.inFlight[id] = op
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			delete(t.inFlight, id)
+		})
+	}, nil
+}
+
+// drain refuses new operations and waits up to timeout for the in-flight ones to complete.
+// It returns the operations still in flight.
+func (t *operationTracker) drain(timeout time.Duration) []armOperation {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	t.draining = true
+	t.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_ = wait.PollUntilContextCancel(ctx, operationDrainPollInterval, true, func(context.Context) (bool, error) {
+		return len(t.unfinished()) == 0, nil
+	})
+
+	unfinished := t.unfinished()
+	for _, op := range unfinished {
+		klog.Warningf("Shutting down with unfinished operation: %v", op)
+	}
+	return unfinished
+}
+
+func (t *operationTracker) unfinished() []armOperation {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ops := make([]armOperation, 0, len(t.inFlight))
+	for _, op := range t.inFlight {
+		ops = append(ops, op)
+	}
+	return ops
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationTracker(t *testing.T) {
+	startedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newOperationTracker(func() time.Time { return startedAt })
+	done, err := tracker.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: "ng", TargetSize: 3})
+	assert.NoError(t, err)
+	_, err = tracker.start(armOperation{Kind: operationDeleteInstances, NodeGroup: "ng", InstanceIDs: []string{"1"}})
+	assert.NoError(t, err)
+
+	done()
+	done()
+	unfinished := tracker.drain(10 * time.Millisecond)
+	assert.Len(t, unfinished, 1)
+	assert.Equal(t, operationDeleteInstances, unfinished[0].Kind)
+	assert.Equal(t, []string{"1"}, unfinished[0].InstanceIDs)
+	assert.Equal(t, startedAt, unfinished[0].StartedAt)
+
+	_, err = tracker.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: "ng", TargetSize: 4})
+	assert.ErrorContains(t, err, "shutting down")
+}
+
+func TestOperationTrackerDrainWaits(t *testing.T) {
+	tracker := newOperationTracker(time.Now)
+	done, err := tracker.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: "ng", TargetSize: 3})
+	assert.NoError(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		done()
+	}()
+	assert.Empty(t, tracker.drain(5*time.Second))
+}
+
+func TestNilOperationTracker(t *testing.T) {
+	var tracker *operationTracker
+	done, err := tracker.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: "ng"})
+	assert.NoError(t, err)
+	done()
+	assert.Nil(t, tracker.drain(time.Second))
+}
+
+func TestScaleSetRefusesOperationsWhenDraining(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.operations = newOperationTracker(time.Now)
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{testASG: {
+		Name: to.StringPtr(testASG),
+		Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(3)},
+	}}
+	scaleSet := newTestScaleSet(manager, testASG)
+	manager.Cleanup()
+
+	err := scaleSet.IncreaseSize(1)
+	assert.ErrorContains(t, err, "shutting down")
+}
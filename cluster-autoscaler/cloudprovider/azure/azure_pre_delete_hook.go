@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// PreDeleteHookFailurePolicyIgnore proceeds with the deletion when the pre-delete hook fails.
+	PreDeleteHookFailurePolicyIgnore = "Ignore"
+	// PreDeleteHookFailurePolicyFail aborts the deletion when the pre-delete hook fails.
+	PreDeleteHookFailurePolicyFail = "Fail"
+
+	defaultPreDeleteHookTimeout = 30 * time.Second
+
+	// Autoscaling options overriding the pre-delete hook settings for a node group, set through
+	// scale set tags prefixed by nodeOptionsTagName.
+	preDeleteHookTimeoutOption       = "pre-delete-hook-timeout"
+	preDeleteHookFailurePolicyOption = "pre-delete-hook-failure-policy"
+)
+
+// PreDeleteHookRequest is the payload POSTed to the pre-delete hook before instances are deleted.
+// Any 2xx response acknowledges the deletion.
+type PreDeleteHookRequest struct {
+	NodeGroup   string   `json:"nodeGroup"`
+	ProviderIDs []string `json:"providerIDs"`
+}
+
+// runPreDeleteHook notifies the configured pre-delete hook of the imminent deletion of the given instances
+// and waits for its acknowledgment. Hook failures only abort the deletion with the Fail failure policy.
+func (m *AzureManager) runPreDeleteHook(nodeGroup string, providerIDs []string) error {
+	if m.config.PreDeleteHookURL == "" || len(providerIDs) == 0 {
+		return nil
+	}
+
+	timeout, failurePolicy := m.getPreDeleteHookOptions(nodeGroup)
+	ctx, cancel := getContextWithTimeout(timeout)
+	defer cancel()
+
+	klog.V(3).Infof("Calling pre-delete hook for node group %s with instances %v", nodeGroup, providerIDs)
+	err := callPreDeleteHook(ctx, m.config.PreDeleteHookURL, PreDeleteHookRequest{NodeGroup: nodeGroup, ProviderIDs: providerIDs})
+	if err == nil {
+		return nil
+	}
+	if strings.EqualFold(failurePolicy, PreDeleteHookFailurePolicyFail) {
+		klog.Errorf("Pre-delete hook for node group %s failed, aborting deletion: %v", nodeGroup, err)
+		return fmt.Errorf("pre-delete hook for node group %s failed: %w", nodeGroup, err)
+	}
+	klog.Warningf("Pre-delete hook for node group %s failed, proceeding with deletion: %v", nodeGroup, err)
+	return nil
+}
+
+// getPreDeleteHookOptions returns the pre-delete hook timeout and failure policy of a node group,
+// from its autoscaling options if set or from the config otherwise. Only scale sets have autoscaling options.
+func (m *AzureManager) getPreDeleteHookOptions(nodeGroup string) (time.Duration, string) {
+	timeout := defaultPreDeleteHookTimeout
+	if m.config.PreDeleteHookTimeoutInSeconds > 0 {
+		timeout = time.Duration(m.config.PreDeleteHookTimeoutInSeconds) * time.Second
+	}
+	failurePolicy := m.config.PreDeleteHookFailurePolicy
+
+	options := m.azureCache.getAutoscalingOptions(azureRef{Name: nodeGroup})
+	if opt, ok := getDurationOption(options, nodeGroup, preDeleteHookTimeoutOption); ok {
+		timeout = opt
+	}
+	if opt, ok := options[preDeleteHookFailurePolicyOption]; ok {
+		failurePolicy = opt
+	}
+	return timeout, failurePolicy
+}
+
+func callPreDeleteHook(ctx context.Context, url string, request PreDeleteHookRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPreDeleteHook(t *testing.T) {
+	providerIDs := []string{"azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/test-asg/virtualMachines/0"}
+
+	testCases := map[string]struct {
+		statusCode         int
+		failurePolicy      string
+		autoscalingOptions map[string]string
+		expectErr          bool
+	}{
+		"acknowledged hook": {
+			statusCode:    http.StatusOK,
+			failurePolicy: PreDeleteHookFailurePolicyFail,
+		},
+		"failed hook is ignored by default": {
+			statusCode: http.StatusInternalServerError,
+		},
+		"failed hook aborts deletion with the Fail policy": {
+			statusCode:    http.StatusInternalServerError,
+			failurePolicy: PreDeleteHookFailurePolicyFail,
+			expectErr:     true,
+		},
+		"node group failure policy overrides the config": {
+			statusCode:         http.StatusInternalServerError,
+			failurePolicy:      PreDeleteHookFailurePolicyIgnore,
+			autoscalingOptions: map[string]string{preDeleteHookFailurePolicyOption: "fail"},
+			expectErr:          true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var received PreDeleteHookRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer server.Close()
+
+			manager := newTestAzureManager(t)
+			manager.config.PreDeleteHookURL = server.URL
+			manager.config.PreDeleteHookFailurePolicy = tc.failurePolicy
+			manager.azureCache.autoscalingOptions[azureRef{Name: testASG}] = tc.autoscalingOptions
+
+			err := manager.runPreDeleteHook(testASG, providerIDs)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, PreDeleteHookRequest{NodeGroup: testASG, ProviderIDs: providerIDs}, received)
+		})
+	}
+}
+
+func TestGetPreDeleteHookOptions(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.config.PreDeleteHookTimeoutInSeconds = 10
+	manager.config.PreDeleteHookFailurePolicy = PreDeleteHookFailurePolicyFail
+
+	timeout, failurePolicy := manager.getPreDeleteHookOptions(testASG)
+	assert.Equal(t, 10*time.Second, timeout)
+	assert.Equal(t, PreDeleteHookFailurePolicyFail, failurePolicy)
+
+	manager.azureCache.autoscalingOptions[azureRef{Name: testASG}] = map[string]string{
+		preDeleteHookTimeoutOption:       "1m",
+		preDeleteHookFailurePolicyOption: "ignore",
+	}
+	timeout, failurePolicy = manager.getPreDeleteHookOptions(testASG)
+	assert.Equal(t, time.Minute, timeout)
+	assert.Equal(t, "ignore", failurePolicy)
+}
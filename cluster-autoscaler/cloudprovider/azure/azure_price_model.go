@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"math"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+)
+
+const (
+	// Normalized per-hour prices of the resources of an on-demand VM, approximating general purpose pay-as-you-go prices.
+	// They are meant to rank nodes relative to each other rather than to reflect the actual bill.
+	cpuPricePerHour         = 0.0325
+	memoryPricePerHourPerGb = 0.0044
+	gpuPricePerHour         = 0.9
+	// spotPriceRatio is the approximate price of a spot VM relative to the same VM on-demand.
+	// Spot VMs have dynamic pricing but are always cheaper than their on-demand counterpart.
+	spotPriceRatio = 0.2
+
+	// spotPriorityNodeLabelKey is the label AKS sets on spot nodes.
+	spotPriorityNodeLabelKey   = AKSLabelKeyPrefixValue + "scalesetpriority"
+	spotPriorityNodeLabelValue = "spot"
+	// hourlyCostAnnotationKey annotates template nodes with their normalized hourly cost.
+	hourlyCostAnnotationKey = "cluster-autoscaler.kubernetes.io/azure-hourly-cost"
+)
+
+// AzurePriceModel implements cloudprovider.PricingModel for Azure with normalized prices.
+type AzurePriceModel struct{}
+
+// NodePrice returns a price of running the given node for a given period of time.
+// Spot nodes are discounted by spotPriceRatio.
+func (model *AzurePriceModel) NodePrice(node *apiv1.Node, startTime time.Time, endTime time.Time) (float64, error) {
+	price := resourcesPrice(node.Status.Capacity, getHours(startTime, endTime))
+	if isSpotNode(node) {
+		price *= spotPriceRatio
+	}
+	return price, nil
+}
+
+// PodPrice returns a theoretical minimum price of running a pod for a given
+// period of time on a perfectly matching on-demand machine.
+func (model *AzurePriceModel) PodPrice(pod *apiv1.Pod, startTime time.Time, endTime time.Time) (float64, error) {
+	hours := getHours(startTime, endTime)
+	price := 0.0
+	for _, container := range pod.Spec.Containers {
+		price += resourcesPrice(container.Resources.Requests, hours)
+	}
+	return price, nil
+}
+
+func resourcesPrice(resources apiv1.ResourceList, hours float64) float64 {
+	price := 0.0
+	if cpu, found := resources[apiv1.ResourceCPU]; found {
+		price += float64(cpu.MilliValue()) / 1000.0 * cpuPricePerHour * hours
+	}
+	if mem, found := resources[apiv1.ResourceMemory]; found {
+		price += float64(mem.Value()) / (1024.0 * 1024.0 * 1024.0) * memoryPricePerHourPerGb * hours
+	}
+	if gpus, found := resources[gpu.ResourceNvidiaGPU]; found {
+		price += float64(gpus.Value()) * gpuPricePerHour * hours
+	}
+	return price
+}
+
+func getHours(startTime time.Time, endTime time.Time) float64 {
+	minutes := math.Ceil(float64(endTime.Sub(startTime)) / float64(time.Minute))
+	return minutes / 60.0
+}
+
+func isSpotNode(node *apiv1.Node) bool {
+	return node.Labels[spotPriorityNodeLabelKey] == spotPriorityNodeLabelValue
+}
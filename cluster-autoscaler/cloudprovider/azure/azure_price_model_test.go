@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func TestNodePrice(t *testing.T) {
+	now := time.Now()
+	model := &AzurePriceModel{}
+
+	onDemand := BuildTestNode("ondemand", 4000, 16*1024*1024*1024)
+	spot := BuildTestNode("spot", 4000, 16*1024*1024*1024)
+	spot.Labels = map[string]string{spotPriorityNodeLabelKey: spotPriorityNodeLabelValue}
+	withGPU := BuildTestNode("gpu", 4000, 16*1024*1024*1024)
+	withGPU.Status.Capacity[gpu.ResourceNvidiaGPU] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	onDemandPrice, err := model.NodePrice(onDemand, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.InDelta(t, 4*cpuPricePerHour+16*memoryPricePerHourPerGb, onDemandPrice, 1e-9)
+
+	twoHoursPrice, err := model.NodePrice(onDemand, now, now.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.InDelta(t, 2*onDemandPrice, twoHoursPrice, 1e-9)
+
+	spotPrice, err := model.NodePrice(spot, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.InDelta(t, onDemandPrice*spotPriceRatio, spotPrice, 1e-9)
+
+	gpuPrice, err := model.NodePrice(withGPU, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.InDelta(t, onDemandPrice+gpuPricePerHour, gpuPrice, 1e-9)
+}
+
+func TestPodPrice(t *testing.T) {
+	now := time.Now()
+	model := &AzurePriceModel{}
+
+	pod := BuildTestPod("pod", 500, 1024*1024*1024)
+	price, err := model.PodPrice(pod, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5*cpuPricePerHour+memoryPricePerHourPerGb, price, 1e-9)
+
+	empty := &apiv1.Pod{}
+	price, err = model.PodPrice(empty, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, price)
+}
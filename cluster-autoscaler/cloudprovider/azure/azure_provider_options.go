@@ -0,0 +1,216 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	kube_client "k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/deploymentclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/storageaccountclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient"
+)
+
+// CacheMode selects which Azure resources the provider cache refreshes.
+type CacheMode string
+
+const (
+	// CacheModeResourceGroup refreshes all the scale sets and VMs of the resource group, and of the
+	// registered scale sets outside of it.
+	CacheModeResourceGroup CacheMode = "resourceGroup"
+	// CacheModeRegisteredNodeGroups only refreshes the Azure resources backing registered node groups,
+	// see Config.RefreshRegisteredNodeGroupsOnly. It cannot be used with node group autodiscovery.
+	CacheModeRegisteredNodeGroups CacheMode = "registeredNodeGroups"
+)
+
+// Clients are the Azure API clients used by the provider, e.g. fakes or clients sharing the rate limiters
+// and credentials of an embedding controller. Nil clients are created from the config.
+type Clients struct {
+	VirtualMachineScaleSets   vmssclient.Interface
+	VirtualMachineScaleSetVMs vmssvmclient.Interface
+	VirtualMachines           vmclient.Interface
+	Deployments               deploymentclient.Interface
+	Interfaces                interfaceclient.Interface
+	Disks                     diskclient.Interface
+	StorageAccounts           storageaccountclient.Interface
+	ResourceSKUs              *compute.ResourceSkusClient
+	Usages                    UsagesClient
+	AgentPools                AgentPoolsClient
+	ScaleSetRestarts          ScaleSetRestartClient
+	ResourceHealth            ResourceHealthClient
+	VirtualMachinePages       VirtualMachinePagesClient
+}
+
+// ProviderOptions are the options of NewAzureCloudProvider.
+type ProviderOptions struct {
+	// Config is the provider config. Unlike BuildAzureConfig, no config file, environment variable or
+	// command-line override is read: callers are expected to start from NewDefaultConfig. Nonstatic
+	// defaults are set and the config is validated.
+	Config *Config
+	// Clients overrides the Azure API clients created from Config.
+	Clients Clients
+	// CacheMode, if set, overrides Config.RefreshRegisteredNodeGroupsOnly.
+	CacheMode CacheMode
+	// Discovery holds the explicitly configured node groups and the autodiscovery specs.
+	Discovery cloudprovider.NodeGroupDiscoveryOptions
+	// ResourceLimiter is returned by GetResourceLimiter.
+	ResourceLimiter *cloudprovider.ResourceLimiter
+	// InstanceFilters are appended to the instance filter chain of Config.InstanceFilters, to omit instances of
+	// formats the built-in filters don't know about.
+	InstanceFilters []InstanceFilter
+	// KubeClient persists the provider state in Namespace, if Config.StateConfigMapName is set.
+	KubeClient kube_client.Interface
+	Namespace  string
+}
+
+// NewAzureCloudProvider creates the Azure cloud provider from options, for controllers embedding the Azure
+// node group management without going through BuildAzure, which reads the config from a file and the
+// environment. Node groups are registered and the cache is filled before returning. Azure metrics are
+// not registered: embedding controllers exposing them call RegisterMetrics first, as the metrics written
+// before registration, e.g. the API versions of the clients, are dropped.
+func NewAzureCloudProvider(opts ProviderOptions) (*AzureCloudProvider, error) {
+	if opts.Config == nil {
+		return nil, fmt.Errorf("config must be set")
+	}
+	cfg := *opts.Config
+	switch opts.CacheMode {
+	case "":
+	case CacheModeResourceGroup:
+		cfg.RefreshRegisteredNodeGroupsOnly = false
+	case CacheModeRegisteredNodeGroups:
+		cfg.RefreshRegisteredNodeGroupsOnly = true
+	default:
+		return nil, fmt.Errorf("unsupported cache mode %q", opts.CacheMode)
+	}
+	if err := cfg.complete(); err != nil {
+		return nil, err
+	}
+	if cfg.StateConfigMapName != "" && opts.KubeClient == nil {
+		return nil, fmt.Errorf("stateConfigMapName requires a kube client")
+	}
+
+	client, err := opts.Clients.azClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := newAzureManager(&cfg, opts.Discovery, client)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.InstanceFilters) > 0 {
+		manager.azureCache.appendInstanceFilters(opts.InstanceFilters)
+	}
+	if cfg.StateConfigMapName != "" {
+		manager.initState(opts.KubeClient, kube_util.CreateEventRecorder(opts.KubeClient, false), opts.Namespace)
+	}
+	return &AzureCloudProvider{
+		azureManager:    manager,
+		resourceLimiter: opts.ResourceLimiter,
+	}, nil
+}
+
+// azClient returns the clients, creating the missing ones from cfg.
+func (c Clients) azClient(cfg *Config) (*azClient, error) {
+	client := &azClient{
+		virtualMachineScaleSetsClient:   c.VirtualMachineScaleSets,
+		virtualMachineScaleSetVMsClient: c.VirtualMachineScaleSetVMs,
+		virtualMachinesClient:           c.VirtualMachines,
+		deploymentClient:                c.Deployments,
+		interfacesClient:                c.Interfaces,
+		disksClient:                     c.Disks,
+		storageAccountsClient:           c.StorageAccounts,
+		usagesClient:                    c.Usages,
+		usagesRateLimiter:               newUsagesRateLimiter(cfg),
+		agentPoolClient:                 c.AgentPools,
+		scaleSetRestartClient:           c.ScaleSetRestarts,
+		resourceHealthClient:            c.ResourceHealth,
+		virtualMachinePagesClient:       c.VirtualMachinePages,
+		virtualMachinePagesRateLimiter:  newVirtualMachinePagesRateLimiter(cfg),
+		scaleSetRestartRateLimiter:      newScaleSetRestartRateLimiter(cfg),
+	}
+	if c.ResourceSKUs != nil {
+		client.skuClient = *c.ResourceSKUs
+	}
+	if c.complete(cfg) {
+		return client, nil
+	}
+
+	env, err := azureEnvironment(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := newAzClient(cfg, &env)
+	if err != nil {
+		return nil, err
+	}
+	if client.virtualMachineScaleSetsClient == nil {
+		client.virtualMachineScaleSetsClient = defaults.virtualMachineScaleSetsClient
+	}
+	if client.virtualMachineScaleSetVMsClient == nil {
+		client.virtualMachineScaleSetVMsClient = defaults.virtualMachineScaleSetVMsClient
+	}
+	if client.virtualMachinesClient == nil {
+		client.virtualMachinesClient = defaults.virtualMachinesClient
+	}
+	if client.deploymentClient == nil {
+		client.deploymentClient = defaults.deploymentClient
+	}
+	if client.interfacesClient == nil {
+		client.interfacesClient = defaults.interfacesClient
+	}
+	if client.disksClient == nil {
+		client.disksClient = defaults.disksClient
+	}
+	if client.storageAccountsClient == nil {
+		client.storageAccountsClient = defaults.storageAccountsClient
+	}
+	if c.ResourceSKUs == nil {
+		client.skuClient = defaults.skuClient
+	}
+	if client.usagesClient == nil {
+		client.usagesClient = defaults.usagesClient
+	}
+	if client.agentPoolClient == nil {
+		client.agentPoolClient = defaults.agentPoolClient
+	}
+	if client.scaleSetRestartClient == nil {
+		client.scaleSetRestartClient = defaults.scaleSetRestartClient
+	}
+	if client.resourceHealthClient == nil {
+		client.resourceHealthClient = defaults.resourceHealthClient
+	}
+	if client.virtualMachinePagesClient == nil {
+		client.virtualMachinePagesClient = defaults.virtualMachinePagesClient
+	}
+	return client, nil
+}
+
+// complete returns whether no client needs to be created for cfg. The agent pools client is only
+// needed by VMs agent pools, the usages client by quota metrics, and the VM pages client by streamed VM listings.
+func (c Clients) complete(cfg *Config) bool {
+	return c.VirtualMachineScaleSets != nil && c.VirtualMachineScaleSetVMs != nil && c.VirtualMachines != nil &&
+		c.Deployments != nil && c.Interfaces != nil && c.Disks != nil && c.StorageAccounts != nil &&
+		c.ResourceSKUs != nil && (c.Usages != nil || !cfg.EnableQuotaMetrics) && c.ScaleSetRestarts != nil && (c.AgentPools != nil || !cfg.EnableVMsAgentPool) &&
+		(c.ResourceHealth != nil || !cfg.EnableResourceHealth) && (c.VirtualMachinePages != nil || !cfg.StreamVirtualMachineList)
+}
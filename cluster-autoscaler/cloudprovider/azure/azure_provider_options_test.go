@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/deploymentclient/mockdeploymentclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diskclient/mockdiskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/storageaccountclient/mockstorageaccountclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+)
+
+func newTestClients(ctrl *gomock.Controller) Clients {
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), "rg").Return(newTestVMSSList(3, testASG, "eastus", compute.Uniform), nil).AnyTimes()
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), "rg", testASG, gomock.Any()).Return(newTestVMSSVMList(3), nil).AnyTimes()
+	mockVMClient := mockvmclient.NewMockInterface(ctrl)
+	mockVMClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil).AnyTimes()
+	return Clients{
+		VirtualMachineScaleSets:   mockVMSSClient,
+		VirtualMachineScaleSetVMs: mockVMSSVMClient,
+		VirtualMachines:           mockVMClient,
+		Deployments:               mockdeploymentclient.NewMockInterface(ctrl),
+		Interfaces:                mockinterfaceclient.NewMockInterface(ctrl),
+		Disks:                     mockdiskclient.NewMockInterface(ctrl),
+		StorageAccounts:           mockstorageaccountclient.NewMockInterface(ctrl),
+		ResourceSKUs:              &compute.ResourceSkusClient{},
+		Usages:                    &fakeUsagesClient{},
+		ScaleSetRestarts:          &fakeScaleSetRestartClient{},
+	}
+}
+
+func newTestProviderConfig() *Config {
+	cfg := NewDefaultConfig()
+	cfg.SubscriptionID = "subscription"
+	cfg.ResourceGroup = "rg"
+	cfg.Location = "eastus"
+	cfg.TenantID = "tenant"
+	cfg.AADClientID = "client"
+	cfg.AADClientSecret = "secret"
+	return cfg
+}
+
+func TestNewAzureCloudProvider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := newTestProviderConfig()
+	provider, err := NewAzureCloudProvider(ProviderOptions{
+		Config:    cfg,
+		Clients:   newTestClients(ctrl),
+		CacheMode: CacheModeResourceGroup,
+		Discovery: cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: []string{"1:5:" + testASG}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "vmss", provider.azureManager.config.VMType)
+	// The config of the caller is left untouched.
+	assert.Empty(t, cfg.CloudProviderRateLimitConfig.CloudProviderRateLimitQPS)
+
+	nodeGroups := provider.NodeGroups()
+	assert.Len(t, nodeGroups, 1)
+	assert.Equal(t, testASG, nodeGroups[0].Id())
+	size, err := nodeGroups[0].TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, size)
+}
+
+func TestNewAzureCloudProviderInvalidOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, err := NewAzureCloudProvider(ProviderOptions{Clients: newTestClients(ctrl)})
+	assert.ErrorContains(t, err, "config must be set")
+
+	_, err = NewAzureCloudProvider(ProviderOptions{Config: newTestProviderConfig(), Clients: newTestClients(ctrl), CacheMode: "unknown"})
+	assert.ErrorContains(t, err, "unsupported cache mode")
+
+	cfg := newTestProviderConfig()
+	cfg.StateConfigMapName = "cluster-autoscaler-azure-state"
+	_, err = NewAzureCloudProvider(ProviderOptions{Config: cfg, Clients: newTestClients(ctrl)})
+	assert.ErrorContains(t, err, "requires a kube client")
+}
+
+func TestNewAzureCloudProviderWithoutUsagesClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clients := newTestClients(ctrl)
+	clients.Usages = nil
+	cfg := newTestProviderConfig()
+	assert.True(t, clients.complete(cfg))
+	cfg.EnableQuotaMetrics = true
+	assert.False(t, clients.complete(cfg))
+
+	provider, err := NewAzureCloudProvider(ProviderOptions{
+		Config:    newTestProviderConfig(),
+		Clients:   clients,
+		Discovery: cloudprovider.NodeGroupDiscoveryOptions{NodeGroupSpecs: []string{"1:5:" + testASG}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, provider.azureManager.azClient.usagesClient)
+	assert.Len(t, provider.NodeGroups(), 1)
+
+	// An injected usages client is not called unless quota metrics are enabled.
+	usages := &fakeUsagesClient{}
+	provider.azureManager.azClient.usagesClient = usages
+	provider.azureManager.refreshQuotaMetrics()
+	assert.Equal(t, 0, usages.calls)
+}
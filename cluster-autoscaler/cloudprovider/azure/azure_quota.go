@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/client-go/util/flowcontrol"
+	klog "k8s.io/klog/v2"
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// UsagesClient lists the compute resource usages of a location.
+type UsagesClient interface {
+	ListComplete(ctx context.Context, location string) (compute.ListUsagesResultIterator, error)
+}
+
+// nodeGroupQuota is the vCPU quota consumed and limit of the SKU family of a node group.
+type nodeGroupQuota struct {
+	nodeGroup string
+	family    string
+	usage     int32
+	limit     int64
+}
+
+// refreshQuotaMetrics exports the vCPU family quota consumed and limit of every registered node group, if quota
+// metrics are enabled.
+func (m *AzureManager) refreshQuotaMetrics() {
+	if !m.config.EnableQuotaMetrics || m.azClient.usagesClient == nil {
+		return
+	}
+
+	quotaUsage.Reset()
+	quotaLimit.Reset()
+	for _, quota := range m.getNodeGroupQuotas() {
+		quotaUsage.WithLabelValues(quota.nodeGroup, quota.family).Set(float64(quota.usage))
+		quotaLimit.WithLabelValues(quota.nodeGroup, quota.family).Set(float64(quota.limit))
+	}
+}
+
+// getNodeGroupQuotas returns the quotas of the registered node groups from the Usages API.
+// The SKU family of the node groups is resolved from the SKU cache, so no quota is returned
+// unless enableDynamicInstanceList is on.
+func (m *AzureManager) getNodeGroupQuotas() []nodeGroupQuota {
+	if !m.azureCache.HasVMSKUs() {
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	var quotas []nodeGroupQuota
+	usagesByLocation := make(map[string]map[string]compute.Usage)
+	for _, ng := range m.getNodeGroups() {
+		skuName, location, ok := m.getNodeGroupSKU(ng)
+		if !ok {
+			continue
+		}
+		sku, err := m.azureCache.GetSKU(ctx, skuName, location)
+		if err != nil {
+			klog.V(4).Infof("Skipping quota of node group %s: %v", ng.Id(), err)
+			continue
+		}
+
+		usages, found := usagesByLocation[location]
+		if !found {
+			usages, err = m.listUsages(ctx, location)
+			if err != nil {
+				klog.Warningf("Failed to list compute usages in location %s: %v", location, err)
+				continue
+			}
+			usagesByLocation[location] = usages
+		}
+
+		family := sku.GetFamilyName()
+		usage, found := usages[strings.ToLower(family)]
+		if !found || usage.CurrentValue == nil || usage.Limit == nil {
+			klog.V(4).Infof("No quota usage of family %s found in location %s for node group %s", family, location, ng.Id())
+			continue
+		}
+		quotas = append(quotas, nodeGroupQuota{nodeGroup: ng.Id(), family: family, usage: *usage.CurrentValue, limit: *usage.Limit})
+	}
+	return quotas
+}
+
+// getNodeGroupSKU returns the SKU and location of the instances of a node group, if known.
+func (m *AzureManager) getNodeGroupSKU(ng cloudprovider.NodeGroup) (string, string, bool) {
+	switch nodeGroup := ng.(type) {
+	case *ScaleSet:
+		vmss, err := nodeGroup.getVMSSFromCache()
+		if err != nil || vmss.Sku == nil || vmss.Sku.Name == nil || vmss.Location == nil {
+			return "", "", false
+		}
+		return *vmss.Sku.Name, *vmss.Location, true
+	case *VMPool:
+		return nodeGroup.sku, m.config.Location, true
+	}
+	return "", "", false
+}
+
+// newUsagesRateLimiter returns the limiter of usages requests, with the default read rate limit of the clients.
+func newUsagesRateLimiter(cfg *Config) flowcontrol.RateLimiter {
+	readLimiter, _ := azclients.NewRateLimiter(&cfg.CloudProviderRateLimitConfig.RateLimitConfig)
+	return readLimiter
+}
+
+// listUsages returns the compute usages of a location, keyed by lower-cased usage name.
+func (m *AzureManager) listUsages(ctx context.Context, location string) (map[string]compute.Usage, error) {
+	if limiter := m.azClient.usagesRateLimiter; limiter != nil && !limiter.TryAccept() {
+		return nil, retry.GetRateLimitError(false, "UsagesList").Error()
+	}
+	iterator, err := m.azClient.usagesClient.ListComplete(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[string]compute.Usage)
+	for ; iterator.NotDone(); err = iterator.NextWithContext(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		usage := iterator.Value()
+		if usage.Name != nil && usage.Name.Value != nil {
+			usages[strings.ToLower(to.String(usage.Name.Value))] = usage
+		}
+	}
+	return usages, err
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/Azure/skewer"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+type fakeUsagesClient struct {
+	usages map[string][]compute.Usage
+	calls  int
+}
+
+func (c *fakeUsagesClient) ListComplete(_ context.Context, location string) (compute.ListUsagesResultIterator, error) {
+	c.calls++
+	usages, found := c.usages[location]
+	if !found {
+		return compute.ListUsagesResultIterator{}, fmt.Errorf("location %s not found", location)
+	}
+	page := compute.NewListUsagesResultPage(compute.ListUsagesResult{Value: &usages},
+		func(context.Context, compute.ListUsagesResult) (compute.ListUsagesResult, error) {
+			return compute.ListUsagesResult{}, nil
+		})
+	return compute.NewListUsagesResultIterator(page), nil
+}
+
+func newTestUsage(name string, current int32, limit int64) compute.Usage {
+	return compute.Usage{
+		Name:         &compute.UsageName{Value: to.StringPtr(name)},
+		CurrentValue: to.Int32Ptr(current),
+		Limit:        to.Int64Ptr(limit),
+	}
+}
+
+func TestGetNodeGroupQuotas(t *testing.T) {
+	manager := newTestAzureManager(t)
+	usagesClient := &fakeUsagesClient{usages: map[string][]compute.Usage{
+		testLocation: {
+			newTestUsage("cores", 100, 1000),
+			newTestUsage("standardDSv3Family", 48, 64),
+		},
+	}}
+	manager.azClient.usagesClient = usagesClient
+
+	assert.Empty(t, manager.getNodeGroupQuotas(), "no quota is returned without SKU cache")
+
+	sku := newTestSKU("Standard_D4s_v3")
+	sku.Family = to.StringPtr("standardDSv3Family")
+	skus, err := skewer.NewStaticCache([]skewer.SKU{sku})
+	assert.NoError(t, err)
+	manager.azureCache.skus = skus
+
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		"ss-1": {Name: to.StringPtr("ss-1"), Location: to.StringPtr(testLocation), Sku: &compute.Sku{Name: to.StringPtr("Standard_D4s_v3")}},
+		"ss-2": {Name: to.StringPtr("ss-2"), Location: to.StringPtr(testLocation), Sku: &compute.Sku{Name: to.StringPtr("Standard_D4s_v3")}},
+		"ss-3": {Name: to.StringPtr("ss-3"), Location: to.StringPtr(testLocation), Sku: &compute.Sku{Name: to.StringPtr("Standard_Unknown")}},
+	}
+	for _, name := range []string{"ss-1", "ss-2", "ss-3"} {
+		assert.True(t, manager.RegisterNodeGroup(newTestScaleSet(manager, name)))
+	}
+
+	quotas := manager.getNodeGroupQuotas()
+	assert.ElementsMatch(t, []nodeGroupQuota{
+		{nodeGroup: "ss-1", family: "standardDSv3Family", usage: 48, limit: 64},
+		{nodeGroup: "ss-2", family: "standardDSv3Family", usage: 48, limit: 64},
+	}, quotas)
+	// Usages are listed once per location.
+	assert.Equal(t, 1, usagesClient.calls)
+
+	// Usages requests are rate limited.
+	manager.azClient.usagesRateLimiter = flowcontrol.NewFakeNeverRateLimiter()
+	assert.Empty(t, manager.getNodeGroupQuotas())
+	assert.Equal(t, 1, usagesClient.calls)
+}
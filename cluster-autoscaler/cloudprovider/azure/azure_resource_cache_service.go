@@ -0,0 +1,243 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/apimachinery/pkg/util/wait"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	resourceCacheServiceName  = "azure.ResourceCache"
+	getResourcesMethod        = "/" + resourceCacheServiceName + "/GetResources"
+	resourceCacheFetchTimeout = 30 * time.Second
+)
+
+func init() {
+	// Extension settings are decoded from JSON into these types.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// resourceSnapshot is the content of a resource cache, as served by the resource cache service.
+// It is gob-encoded: the JSON marshalers of the compute SDK drop read-only fields, like names and IDs.
+type resourceSnapshot struct {
+	ResourceGroup   string
+	RefreshedAt     time.Time
+	ScaleSets       map[string]compute.VirtualMachineScaleSet
+	VirtualMachines map[string][]compute.VirtualMachine
+	VMsPools        map[string]armcontainerservice.AgentPool
+}
+
+// resourceCacheService is the gRPC service shared by cluster-autoscaler replicas to read the listed Azure resources.
+type resourceCacheService interface {
+	GetResources(context.Context, *emptypb.Empty) (*wrapperspb.BytesValue, error)
+}
+
+var resourceCacheServiceDesc = grpc.ServiceDesc{
+	ServiceName: resourceCacheServiceName,
+	HandlerType: (*resourceCacheService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetResources",
+			Handler:    getResourcesHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "azure_resource_cache_service.go",
+}
+
+func getResourcesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(resourceCacheService).GetResources(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: getResourcesMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(resourceCacheService).GetResources(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ResourceCacheServer lists the scale sets, VMs and VMs pools of a resource group on every refresh interval
+// and serves them to the cluster-autoscaler replicas configured with its address in resourceCacheServiceAddress.
+// Replicas then skip listing these resources from ARM themselves, and standby replicas start from a warm cache.
+type ResourceCacheServer struct {
+	cache *azureCache
+
+	mutex       sync.Mutex
+	refreshedAt time.Time
+}
+
+// NewResourceCacheServer creates a resource cache server listing resources with the given configuration.
+func NewResourceCacheServer(cfg *Config) (*ResourceCacheServer, error) {
+	env := azure.PublicCloud
+	if cfg.Cloud != "" {
+		var err error
+		env, err = azure.EnvironmentFromName(cfg.Cloud)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client, err := newAzClient(cfg, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL := refreshInterval
+	if cfg.VmssCacheTTLInSeconds != 0 {
+		cacheTTL = time.Duration(cfg.VmssCacheTTLInSeconds) * time.Second
+	}
+	// The server lists every resource itself, whatever node groups the replicas register.
+	serverCfg := *cfg
+	serverCfg.ResourceCacheServiceAddress = ""
+	serverCfg.RefreshRegisteredNodeGroupsOnly = false
+	serverCfg.EnableDynamicInstanceList = false
+	serverCfg.StandbyCacheRefreshIntervalInSeconds = 0
+	cache, err := newAzureCache(client, cacheTTL, serverCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ResourceCacheServer{cache: cache}, nil
+}
+
+// Serve refreshes the cache and serves it on listener until ctx is done.
+func (s *ResourceCacheServer) Serve(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer()
+	server.RegisterService(&resourceCacheServiceDesc, s)
+
+	interval := s.cache.refreshInterval
+	if interval <= 0 {
+		interval = refreshInterval
+	}
+	go wait.UntilWithContext(ctx, s.refresh, interval)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	klog.Infof("Serving Azure resource cache of resource group %q on %s", s.cache.resourceGroup, listener.Addr())
+	return server.Serve(listener)
+}
+
+func (s *ResourceCacheServer) refresh(_ context.Context) {
+	if err := s.cache.fetchAzureResources(); err != nil {
+		klog.Errorf("Failed to refresh Azure resource cache: %v", err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refreshedAt = time.Now()
+}
+
+// snapshot returns the resources listed on the last refresh, or nil if the cache was never refreshed.
+func (s *ResourceCacheServer) snapshot() *resourceSnapshot {
+	s.mutex.Lock()
+	refreshedAt := s.refreshedAt
+	s.mutex.Unlock()
+	if refreshedAt.IsZero() {
+		return nil
+	}
+
+	s.cache.mutex.Lock()
+	defer s.cache.mutex.Unlock()
+	return &resourceSnapshot{
+		ResourceGroup:   s.cache.resourceGroup,
+		RefreshedAt:     refreshedAt,
+		ScaleSets:       s.cache.scaleSets,
+		VirtualMachines: s.cache.virtualMachines,
+		VMsPools:        s.cache.vmsPoolMap,
+	}
+}
+
+// GetResources returns the gob-encoded resourceSnapshot of the cache.
+func (s *ResourceCacheServer) GetResources(_ context.Context, _ *emptypb.Empty) (*wrapperspb.BytesValue, error) {
+	snapshot := s.snapshot()
+	if snapshot == nil {
+		return nil, status.Error(codes.Unavailable, "resource cache not populated yet")
+	}
+
+	// The cached maps are replaced, never updated in place, on refresh, so they can be encoded without the lock.
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshot); err != nil {
+		return nil, status.Errorf(codes.Internal, "encoding resource cache: %v", err)
+	}
+	return wrapperspb.Bytes(buf.Bytes()), nil
+}
+
+// resourceCacheClient reads the resources listed by a resource cache service.
+type resourceCacheClient struct {
+	conn *grpc.ClientConn
+	// maxAge is the age beyond which served resources are considered stale and are not used.
+	maxAge time.Duration
+}
+
+func newResourceCacheClient(address string, maxAge time.Duration) (*resourceCacheClient, error) {
+	// The service is meant to be co-located with the replicas, e.g. in the same pod network namespace.
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource cache service client for %s: %w", address, err)
+	}
+	return &resourceCacheClient{conn: conn, maxAge: maxAge}, nil
+}
+
+// getResources fetches the resources of resourceGroup from the service.
+func (c *resourceCacheClient) getResources(resourceGroup string) (*resourceSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resourceCacheFetchTimeout)
+	defer cancel()
+
+	out := new(wrapperspb.BytesValue)
+	if err := c.conn.Invoke(ctx, getResourcesMethod, &emptypb.Empty{}, out); err != nil {
+		return nil, err
+	}
+	snapshot := &resourceSnapshot{}
+	if err := gob.NewDecoder(bytes.NewReader(out.GetValue())).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("decoding resource cache: %w", err)
+	}
+	if !strings.EqualFold(snapshot.ResourceGroup, resourceGroup) {
+		return nil, fmt.Errorf("resource cache service serves resource group %q, expected %q", snapshot.ResourceGroup, resourceGroup)
+	}
+	if age := time.Since(snapshot.RefreshedAt); age > c.maxAge {
+		return nil, fmt.Errorf("resource cache service was last refreshed %v ago", age.Round(time.Second))
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func TestResourceCacheService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := &ResourceCacheServer{cache: newTestAzureManager(t).azureCache}
+	_, err := server.GetResources(ctx, &emptypb.Empty{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		assert.NoError(t, server.Serve(ctx, listener))
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := server.GetResources(ctx, &emptypb.Empty{})
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The replica lists neither scale sets nor VMs from ARM while the service is up.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	replica := newTestAzureManager(t)
+	replica.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{}
+	replica.azureCache.virtualMachines = map[string][]compute.VirtualMachine{}
+	replica.azureCache.azClient.virtualMachineScaleSetsClient = mockvmssclient.NewMockInterface(ctrl)
+	replica.azureCache.azClient.virtualMachinesClient = mockvmclient.NewMockInterface(ctrl)
+	replica.azureCache.resourceCacheClient, err = newResourceCacheClient(listener.Addr().String(), time.Minute)
+	assert.NoError(t, err)
+	defer replica.azureCache.Cleanup()
+
+	assert.NoError(t, replica.azureCache.fetchAzureResources())
+	scaleSets := replica.azureCache.getScaleSets()
+	if assert.Contains(t, scaleSets, testASG) {
+		assert.Equal(t, testASG, *scaleSets[testASG].Name)
+		assert.Equal(t, int64(3), *scaleSets[testASG].Sku.Capacity)
+		assert.Equal(t, compute.Uniform, scaleSets[testASG].OrchestrationMode)
+	}
+	assert.Equal(t, server.cache.getVirtualMachines(), replica.azureCache.getVirtualMachines())
+
+	_, err = replica.azureCache.resourceCacheClient.getResources("other-rg")
+	assert.ErrorContains(t, err, "other-rg")
+
+	stale, err := newResourceCacheClient(listener.Addr().String(), time.Nanosecond)
+	assert.NoError(t, err)
+	defer stale.conn.Close()
+	_, err = stale.getResources("rg")
+	assert.ErrorContains(t, err, "last refreshed")
+}
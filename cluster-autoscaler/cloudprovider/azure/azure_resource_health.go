@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/resourcehealth/mgmt/2020-05-01/resourcehealth"
+	"github.com/Azure/go-autorest/autorest/to"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// resourceHealthPollInterval is how often Resource Health is queried for the managed scale sets.
+	resourceHealthPollInterval = 5 * time.Minute
+	// resourceHealthStatusSuffix separates the ID of a resource from the ID of its availability status.
+	resourceHealthStatusSuffix = "/providers/microsoft.resourcehealth/"
+	// computeProviderSegment is part of the ID of compute resources.
+	computeProviderSegment = "/providers/microsoft.compute/"
+)
+
+// ResourceHealthClient lists the Resource Health availability statuses of the resources of a resource group.
+type ResourceHealthClient interface {
+	ListByResourceGroupComplete(ctx context.Context, resourceGroupName string, filter string, expand string) (resourcehealth.AvailabilityStatusListResultIterator, error)
+}
+
+// platformIssue returns whether the availability status reports the resource unavailable or degraded by the
+// platform, rather than by the user, e.g. while stopping a VM.
+func platformIssue(status resourcehealth.AvailabilityStatus) bool {
+	properties := status.Properties
+	if properties == nil {
+		return false
+	}
+	if properties.AvailabilityState != resourcehealth.AvailabilityStateValuesUnavailable &&
+		properties.AvailabilityState != resourcehealth.AvailabilityStateValuesDegraded {
+		return false
+	}
+	return !strings.EqualFold(to.String(properties.ReasonType), "UserInitiated") &&
+		!strings.EqualFold(to.String(properties.HealthEventCause), "UserInitiated")
+}
+
+// serviceIncident returns whether the availability status of a compute resource lists service impacting events,
+// i.e. an incident affecting the compute service in the location of the resource.
+func serviceIncident(status resourcehealth.AvailabilityStatus) bool {
+	return status.Properties != nil && status.Properties.ServiceImpactingEvents != nil &&
+		len(*status.Properties.ServiceImpactingEvents) > 0 &&
+		strings.Contains(strings.ToLower(to.String(status.ID)), computeProviderSegment)
+}
+
+// statusResourceID returns the lower-cased ID of the resource an availability status belongs to.
+func statusResourceID(status resourcehealth.AvailabilityStatus) string {
+	id := strings.ToLower(to.String(status.ID))
+	if i := strings.Index(id, resourceHealthStatusSuffix); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// refreshResourceHealth queries Resource Health for the resource groups of the managed scale sets, at most
+// every resourceHealthPollInterval, and records a platform issue in the health of the scale sets which are,
+// or whose instances are, unavailable or degraded by the platform, and of the scale sets in locations with
+// a compute service incident. The expander then places replacement capacity in healthier node groups.
+func (m *AzureManager) refreshResourceHealth(now time.Time) {
+	if m.azClient.resourceHealthClient == nil || now.Sub(m.lastResourceHealthRefresh) < resourceHealthPollInterval {
+		return
+	}
+	m.lastResourceHealthRefresh = now
+
+	scaleSetsByResourceGroup := make(map[string][]*ScaleSet)
+	for _, nodeGroup := range m.getNodeGroups() {
+		if scaleSet, ok := nodeGroup.(*ScaleSet); ok {
+			resourceGroup := strings.ToLower(scaleSet.resourceGroupName())
+			scaleSetsByResourceGroup[resourceGroup] = append(scaleSetsByResourceGroup[resourceGroup], scaleSet)
+		}
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	resourceHealthDegraded.Reset()
+	for resourceGroup, scaleSets := range scaleSetsByResourceGroup {
+		statuses, err := m.listAvailabilityStatuses(ctx, resourceGroup)
+		if err != nil {
+			klog.Warningf("Failed to list the Resource Health availability statuses of resource group %s: %v", resourceGroup, err)
+			continue
+		}
+
+		incidentLocations := make(map[string]bool)
+		for _, status := range statuses {
+			if serviceIncident(status) {
+				incidentLocations[strings.ToLower(to.String(status.Location))] = true
+			}
+		}
+		for _, scaleSet := range scaleSets {
+			vmss, err := scaleSet.getVMSSFromCache()
+			if err != nil || vmss.ID == nil {
+				continue
+			}
+			vmssID := strings.ToLower(*vmss.ID)
+			reason := ""
+			for _, status := range statuses {
+				if resourceID := statusResourceID(status); platformIssue(status) &&
+					(resourceID == vmssID || strings.HasPrefix(resourceID, vmssID+"/")) {
+					reason = to.String(status.Properties.Summary)
+					break
+				}
+			}
+			if reason == "" && incidentLocations[strings.ToLower(to.String(vmss.Location))] {
+				reason = "service incident in location " + to.String(vmss.Location)
+			}
+			if reason == "" {
+				continue
+			}
+			klog.Warningf("Resource Health reports a platform issue for scale set %s: %s", scaleSet.Name, reason)
+			m.health.record(scaleSet.Name, failurePlatformIssue, now)
+			resourceHealthDegraded.WithLabelValues(scaleSet.Name).Set(1)
+		}
+	}
+}
+
+// listAvailabilityStatuses returns the availability statuses of the resources of the resource group.
+func (m *AzureManager) listAvailabilityStatuses(ctx context.Context, resourceGroup string) ([]resourcehealth.AvailabilityStatus, error) {
+	iterator, err := m.azClient.resourceHealthClient.ListByResourceGroupComplete(ctx, resourceGroup, "", "")
+	if err != nil {
+		return nil, err
+	}
+	var statuses []resourcehealth.AvailabilityStatus
+	for iterator.NotDone() {
+		statuses = append(statuses, iterator.Value())
+		if err := iterator.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
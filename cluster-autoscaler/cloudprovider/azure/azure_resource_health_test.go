@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/resourcehealth/mgmt/2020-05-01/resourcehealth"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+)
+
+const testScaleSetID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/"
+
+type fakeResourceHealthClient struct {
+	statuses []resourcehealth.AvailabilityStatus
+	calls    int
+}
+
+func (c *fakeResourceHealthClient) ListByResourceGroupComplete(ctx context.Context, resourceGroupName string, filter string, expand string) (resourcehealth.AvailabilityStatusListResultIterator, error) {
+	c.calls++
+	statuses := c.statuses
+	page := resourcehealth.NewAvailabilityStatusListResultPage(resourcehealth.AvailabilityStatusListResult{Value: &statuses},
+		func(context.Context, resourcehealth.AvailabilityStatusListResult) (resourcehealth.AvailabilityStatusListResult, error) {
+			return resourcehealth.AvailabilityStatusListResult{}, nil
+		})
+	return resourcehealth.NewAvailabilityStatusListResultIterator(page), nil
+}
+
+func newTestAvailabilityStatus(resourceID string, state resourcehealth.AvailabilityStateValues, reasonType string) resourcehealth.AvailabilityStatus {
+	return resourcehealth.AvailabilityStatus{
+		ID:       to.StringPtr(resourceID + "/providers/Microsoft.ResourceHealth/availabilityStatuses/current"),
+		Location: to.StringPtr(testLocation),
+		Properties: &resourcehealth.AvailabilityStatusProperties{
+			AvailabilityState: state,
+			ReasonType:        to.StringPtr(reasonType),
+			Summary:           to.StringPtr("The host of the virtual machine is unavailable."),
+		},
+	}
+}
+
+func TestPlatformIssue(t *testing.T) {
+	assert.False(t, platformIssue(resourcehealth.AvailabilityStatus{}))
+	assert.False(t, platformIssue(newTestAvailabilityStatus(testScaleSetID+"a", resourcehealth.AvailabilityStateValuesAvailable, "")))
+	assert.True(t, platformIssue(newTestAvailabilityStatus(testScaleSetID+"a", resourcehealth.AvailabilityStateValuesUnavailable, "Unplanned")))
+	assert.True(t, platformIssue(newTestAvailabilityStatus(testScaleSetID+"a", resourcehealth.AvailabilityStateValuesDegraded, "Unplanned")))
+	assert.False(t, platformIssue(newTestAvailabilityStatus(testScaleSetID+"a", resourcehealth.AvailabilityStateValuesUnavailable, "UserInitiated")))
+}
+
+func TestServiceIncident(t *testing.T) {
+	status := newTestAvailabilityStatus(testScaleSetID+"a", resourcehealth.AvailabilityStateValuesAvailable, "")
+	assert.False(t, serviceIncident(status))
+	status.Properties.ServiceImpactingEvents = &[]resourcehealth.ServiceImpactingEvent{{}}
+	assert.True(t, serviceIncident(status))
+	status.ID = to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/providers/Microsoft.ResourceHealth/availabilityStatuses/current")
+	assert.False(t, serviceIncident(status), "incidents are only considered for compute resources")
+}
+
+func TestStatusResourceID(t *testing.T) {
+	status := newTestAvailabilityStatus(testScaleSetID+"A/virtualMachines/0", resourcehealth.AvailabilityStateValuesAvailable, "")
+	assert.Equal(t, "/subscriptions/sub/resourcegroups/rg/providers/microsoft.compute/virtualmachinescalesets/a/virtualmachines/0", statusResourceID(status))
+	assert.Equal(t, "other", statusResourceID(resourcehealth.AvailabilityStatus{ID: to.StringPtr("OTHER")}))
+}
+
+func TestRefreshResourceHealth(t *testing.T) {
+	manager := newTestAzureManager(t)
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{}
+	for _, name := range []string{"asg-a", "asg-b", "asg-c"} {
+		manager.azureCache.scaleSets[name] = compute.VirtualMachineScaleSet{
+			Name:     to.StringPtr(name),
+			ID:       to.StringPtr(testScaleSetID + name),
+			Location: to.StringPtr(testLocation),
+		}
+		assert.True(t, manager.RegisterNodeGroup(newTestScaleSet(manager, name)))
+	}
+
+	client := &fakeResourceHealthClient{statuses: []resourcehealth.AvailabilityStatus{
+		newTestAvailabilityStatus(testScaleSetID+"asg-a/virtualMachines/0", resourcehealth.AvailabilityStateValuesUnavailable, "Unplanned"),
+		newTestAvailabilityStatus(testScaleSetID+"asg-b/virtualMachines/0", resourcehealth.AvailabilityStateValuesUnavailable, "UserInitiated"),
+		newTestAvailabilityStatus(testScaleSetID+"asg-c", resourcehealth.AvailabilityStateValuesAvailable, ""),
+	}}
+	now := time.Now()
+
+	manager.refreshResourceHealth(now)
+	_, _, found := manager.health.score("asg-a", now)
+	assert.False(t, found, "Resource Health is not queried without a client")
+
+	manager.azClient.resourceHealthClient = client
+	manager.refreshResourceHealth(now)
+	assert.Equal(t, 1, client.calls)
+	score, lastFailure, found := manager.health.score("asg-a", now)
+	assert.True(t, found)
+	assert.Equal(t, failurePlatformIssue, lastFailure)
+	assert.Less(t, score, 1.0)
+	// The degradation reaches expanders through the node infos of the scale set, including those built from ready nodes.
+	provider := &AzureCloudProvider{azureManager: manager}
+	assert.Contains(t, provider.NodeGroupAnnotations(newTestScaleSet(manager, "asg-a")), healthScoreAnnotationKey)
+	assert.NotContains(t, provider.NodeGroupAnnotations(newTestScaleSet(manager, "asg-c")), healthScoreAnnotationKey)
+	_, _, found = manager.health.score("asg-b", now)
+	assert.False(t, found, "user initiated unavailability is not a platform issue")
+	_, _, found = manager.health.score("asg-c", now)
+	assert.False(t, found)
+
+	// Resource Health is polled at most every resourceHealthPollInterval.
+	client.statuses[2].Properties.ServiceImpactingEvents = &[]resourcehealth.ServiceImpactingEvent{{}}
+	manager.refreshResourceHealth(now.Add(time.Minute))
+	assert.Equal(t, 1, client.calls)
+
+	later := now.Add(resourceHealthPollInterval)
+	manager.refreshResourceHealth(later)
+	assert.Equal(t, 2, client.calls)
+	_, lastFailure, found = manager.health.score("asg-b", later)
+	assert.True(t, found, "a service incident in the location affects all its scale sets")
+	assert.Equal(t, failurePlatformIssue, lastFailure)
+}
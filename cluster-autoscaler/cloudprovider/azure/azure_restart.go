@@ -0,0 +1,390 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/client-go/util/flowcontrol"
+	klog "k8s.io/klog/v2"
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// Instance restart states reported by InstanceRestart.
+const (
+	InstanceRestartInProgress = "InProgress"
+	InstanceRestartSucceeded  = "Succeeded"
+	InstanceRestartFailed     = "Failed"
+)
+
+const (
+	instanceRestartFailedErrorCode = "restart-failed"
+
+	// restartInstancesTagName is the scale set tag requesting the restart of instances of the scale set, set to their
+	// comma separated instance IDs. The tag is removed once their restart is started.
+	restartInstancesTagName = "k8s.io_cluster-autoscaler_restart-instances"
+
+	// restartStatusRetention is how long the status of a finished restart is reported.
+	restartStatusRetention = time.Hour
+)
+
+// ScaleSetRestartClient restarts scale set instances.
+type ScaleSetRestartClient interface {
+	// Restart restarts the given instances of the scale set, and waits for the restart to complete.
+	Restart(ctx context.Context, resourceGroupName, vmScaleSetName string, instanceIDs []string) error
+}
+
+// scaleSetRestartClient implements ScaleSetRestartClient with the compute scale sets client.
+type scaleSetRestartClient struct {
+	client compute.VirtualMachineScaleSetsClient
+}
+
+func (c scaleSetRestartClient) Restart(ctx context.Context, resourceGroupName, vmScaleSetName string, instanceIDs []string) error {
+	future, err := c.client.Restart(ctx, resourceGroupName, vmScaleSetName, &compute.VirtualMachineScaleSetVMInstanceIDs{InstanceIds: &instanceIDs})
+	if err != nil {
+		return err
+	}
+	return future.WaitForCompletionRef(ctx, c.client.Client)
+}
+
+// newScaleSetRestartRateLimiter returns the limiter of restart requests, sharing the write rate limit of the scale
+// set client.
+func newScaleSetRestartRateLimiter(cfg *Config) flowcontrol.RateLimiter {
+	_, writeLimiter := azclients.NewRateLimiter(cfg.VirtualMachineScaleSetRateLimit)
+	return writeLimiter
+}
+
+// InstanceRestart is the status of the last restart of an instance requested with RestartInstances.
+type InstanceRestart struct {
+	State      string    `json:"state"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RestartInstances restarts instances of the scale set, by provider ID, as a cheaper remediation than deleting
+// and re-provisioning them. The restart runs in the background: its progress is reported by InstanceRestartStatus
+// and by the restarting lifecycle event, and a failed restart sets an error on the instance status. Only instances
+// of uniform scale sets can be restarted.
+func (scaleSet *ScaleSet) RestartInstances(providerIDs []string) error {
+	if len(providerIDs) == 0 {
+		return nil
+	}
+	client := scaleSet.manager.azClient.scaleSetRestartClient
+	if client == nil {
+		return fmt.Errorf("no restart client configured, cannot restart instances of scale set %s", scaleSet.Name)
+	}
+	orchestrationMode, err := scaleSet.getOrchestrationMode()
+	if err != nil {
+		return err
+	}
+	if orchestrationMode != compute.Uniform {
+		return fmt.Errorf("restarting instances is only supported for uniform scale sets, %s is %s", scaleSet.Name, orchestrationMode)
+	}
+
+	instanceIDs := make([]string, 0, len(providerIDs))
+	for _, providerID := range providerIDs {
+		if err := scaleSet.verifyNodeGroup(&azureRef{Name: providerID}, scaleSet.Id()); err != nil {
+			return err
+		}
+		instanceID, err := getLastSegment(providerID)
+		if err != nil {
+			return err
+		}
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	if scaleSet.manager.dryRun(operationRestartInstances, scaleSet.Name, "restart instances %v", instanceIDs) {
+		return nil
+	}
+	if limiter := scaleSet.manager.azClient.scaleSetRestartRateLimiter; limiter != nil && !limiter.TryAccept() {
+		return retry.GetRateLimitError(true, "VMSSRestart").Error()
+	}
+	done, err := scaleSet.manager.operations.start(armOperation{Kind: operationRestartInstances, NodeGroup: scaleSet.Name, InstanceIDs: instanceIDs})
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Restarting instances %v of scale set %s", instanceIDs, scaleSet.Name)
+	scaleSet.startRestarts(providerIDs, scaleSet.now())
+	go func() {
+		defer done()
+		ctx, cancel := getContextWithTimeout(asyncContextTimeout)
+		defer cancel()
+		err := client.Restart(ctx, scaleSet.resourceGroupName(), scaleSet.Name, instanceIDs)
+		scaleSet.manager.recordMutation(operationRestartInstances, scaleSet.Name, err, "restart instances %v", instanceIDs)
+		if err != nil {
+			klog.Errorf("Failed to restart instances %v of scale set %s: %v", instanceIDs, scaleSet.Name, err)
+		} else {
+			klog.V(2).Infof("Restarted instances %v of scale set %s", instanceIDs, scaleSet.Name)
+		}
+		scaleSet.finishRestarts(providerIDs, err, scaleSet.now())
+	}()
+	return nil
+}
+
+// InstanceRestartStatus returns the status of the last restart of the instance, if any.
+func (scaleSet *ScaleSet) InstanceRestartStatus(providerID string) (InstanceRestart, bool) {
+	scaleSet.instanceMutex.Lock()
+	defer scaleSet.instanceMutex.Unlock()
+	restart, found := scaleSet.restarts[providerID]
+	return restart, found
+}
+
+func (scaleSet *ScaleSet) startRestarts(providerIDs []string, now time.Time) {
+	scaleSet.instanceMutex.Lock()
+	defer scaleSet.instanceMutex.Unlock()
+	if scaleSet.restarts == nil {
+		scaleSet.restarts = make(map[string]InstanceRestart)
+	}
+	events := make([]InstanceLifecycleEvent, 0, len(providerIDs))
+	for _, providerID := range providerIDs {
+		scaleSet.restarts[providerID] = InstanceRestart{State: InstanceRestartInProgress, StartedAt: now}
+		events = append(events, InstanceLifecycleEvent{
+			NodeGroup:  scaleSet.Name,
+			ProviderID: providerID,
+			From:       InstanceLifecycleRunning,
+			To:         InstanceLifecycleRestarting,
+			Time:       now,
+		})
+	}
+	scaleSet.manager.lifecycleEvents.publish(events)
+}
+
+// finishRestarts records the outcome of the restart of the instances. Failed restarts set an error on the
+// status of the instances, until the instances are next refreshed.
+func (scaleSet *ScaleSet) finishRestarts(providerIDs []string, err error, now time.Time) {
+	scaleSet.instanceMutex.Lock()
+	events := make([]InstanceLifecycleEvent, 0, len(providerIDs))
+	for _, providerID := range providerIDs {
+		restart, found := scaleSet.restarts[providerID]
+		if !found {
+			// The instance disappeared while restarting.
+			continue
+		}
+		restart.FinishedAt = now
+		event := InstanceLifecycleEvent{
+			NodeGroup:  scaleSet.Name,
+			ProviderID: providerID,
+			From:       InstanceLifecycleRestarting,
+			To:         InstanceLifecycleRunning,
+			Time:       now,
+		}
+		if err != nil {
+			restart.State = InstanceRestartFailed
+			restart.Error = err.Error()
+			event.To = InstanceLifecycleRestartError
+			event.ErrorCode = instanceRestartFailedErrorCode
+			event.ErrorMessage = err.Error()
+		} else {
+			restart.State = InstanceRestartSucceeded
+		}
+		scaleSet.restarts[providerID] = restart
+		events = append(events, event)
+	}
+	scaleSet.instanceMutex.Unlock()
+	scaleSet.manager.lifecycleEvents.publish(events)
+
+	if err == nil {
+		return
+	}
+	for _, providerID := range providerIDs {
+		scaleSet.setInstanceStatusByProviderID(providerID, cloudprovider.InstanceStatus{
+			State: cloudprovider.InstanceRunning,
+			ErrorInfo: &cloudprovider.InstanceErrorInfo{
+				ErrorClass:   cloudprovider.OtherErrorClass,
+				ErrorCode:    instanceRestartFailedErrorCode,
+				ErrorMessage: err.Error(),
+			},
+		})
+	}
+}
+
+// pruneRestarts forgets the restarts of the instances no longer listed, and the restarts which finished more than
+// restartStatusRetention ago. Caller must hold instanceMutex.
+func (scaleSet *ScaleSet) pruneRestarts(instances []cloudprovider.Instance, now time.Time) {
+	if len(scaleSet.restarts) == 0 {
+		return
+	}
+	listed := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		listed[instance.Id] = true
+	}
+	for providerID, restart := range scaleSet.restarts {
+		id := providerID
+		if resourceID, err := convertResourceGroupNameToLower(strings.TrimPrefix(providerID, azurePrefix)); err == nil {
+			id = azurePrefix + resourceID
+		}
+		expired := restart.State != InstanceRestartInProgress && now.Sub(restart.FinishedAt) > restartStatusRetention
+		if !listed[id] || expired {
+			delete(scaleSet.restarts, providerID)
+		}
+	}
+}
+
+// processRestartRequests restarts the instances requested with the restart tag of the registered scale sets.
+func (m *AzureManager) processRestartRequests() {
+	scaleSets := m.azureCache.getScaleSets()
+	for _, nodeGroup := range m.azureCache.getRegisteredNodeGroups() {
+		scaleSet, ok := nodeGroup.(*ScaleSet)
+		if !ok {
+			continue
+		}
+		vmss, found := scaleSet.cachedModel(scaleSets)
+		if !found {
+			continue
+		}
+		if err := scaleSet.processRestartRequest(vmss); err != nil {
+			klog.Errorf("Failed to restart instances requested by the %s tag of scale set %s: %v", restartInstancesTagName, scaleSet.Name, err)
+		}
+	}
+}
+
+// handleRestartRequest records request as the last value of the restart tag, returning whether it wasn't handled yet.
+// Refreshes run both from the main loop and from the goroutines waiting for instance deletions, so the request is
+// checked and recorded atomically for the tag to trigger a single restart.
+func (scaleSet *ScaleSet) handleRestartRequest(request string) bool {
+	scaleSet.instanceMutex.Lock()
+	defer scaleSet.instanceMutex.Unlock()
+	if request == scaleSet.restartRequest {
+		return false
+	}
+	scaleSet.restartRequest = request
+	return request != ""
+}
+
+// processRestartRequest restarts the instances listed by the restart tag of the scale set, if any, and removes the
+// tag. A request is only handled once, as the cached scale set keeps the tag until it is next listed; setting the tag
+// to the same value again, once removed, requests another restart.
+func (scaleSet *ScaleSet) processRestartRequest(vmss compute.VirtualMachineScaleSet) error {
+	value, _ := lookupTag(vmss.Tags, restartInstancesTagName)
+	request := strings.TrimSpace(to.String(value))
+	if !scaleSet.handleRestartRequest(request) {
+		return nil
+	}
+
+	requested := make(map[string]bool)
+	for _, instanceID := range strings.Split(request, ",") {
+		if instanceID = strings.TrimSpace(instanceID); instanceID != "" {
+			requested[instanceID] = true
+		}
+	}
+	instances, err := scaleSet.Nodes()
+	if err != nil {
+		return err
+	}
+	var providerIDs []string
+	for _, instance := range instances {
+		instanceID, err := getLastSegment(instance.Id)
+		if err == nil && requested[instanceID] {
+			providerIDs = append(providerIDs, instance.Id)
+			delete(requested, instanceID)
+		}
+	}
+	for instanceID := range requested {
+		klog.Warningf("Not restarting instance %s of scale set %s requested by the %s tag: no such instance", instanceID, scaleSet.Name, restartInstancesTagName)
+	}
+
+	klog.V(2).Infof("Restarting instances %v of scale set %s requested by the %s tag", providerIDs, scaleSet.Name, restartInstancesTagName)
+	if err := scaleSet.RestartInstances(providerIDs); err != nil {
+		return err
+	}
+	return scaleSet.removeRestartRequest(vmss)
+}
+
+// removeRestartRequest starts removing the restart tag of the scale set, keeping its other tags, and leaving its
+// capacity and model untouched. The update is waited for in the background.
+func (scaleSet *ScaleSet) removeRestartRequest(vmss compute.VirtualMachineScaleSet) error {
+	if scaleSet.manager.dryRun(operationUpdateTags, scaleSet.Name, "remove tag %s", restartInstancesTagName) {
+		return nil
+	}
+	done, err := scaleSet.manager.operations.start(armOperation{Kind: operationUpdateTags, NodeGroup: scaleSet.Name})
+	if err != nil {
+		return err
+	}
+	tags := make(map[string]*string, len(vmss.Tags))
+	for key, value := range vmss.Tags {
+		if !strings.EqualFold(key, restartInstancesTagName) {
+			tags[key] = value
+		}
+	}
+	future, err := scaleSet.updateTagsAsync(vmss, tags)
+	scaleSet.manager.recordMutation(operationUpdateTags, scaleSet.Name, err, "remove tag %s", restartInstancesTagName)
+	if err != nil {
+		done()
+		return err
+	}
+
+	go func() {
+		defer done()
+		ctx, cancel := getContextWithTimeout(asyncContextTimeout)
+		defer cancel()
+		httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForCreateOrUpdateResult(ctx, future, scaleSet.resourceGroupName())
+		if isSuccess, err := isSuccessHTTPResponse(httpResponse, err); !isSuccess {
+			klog.Errorf("Failed to remove the %s tag of scale set %s: %v", restartInstancesTagName, scaleSet.Name, err)
+		}
+	}()
+	return nil
+}
+
+// RestartNodes restarts the instances backing the given nodes, for node problem remediation controllers
+// embedding the provider. See ScaleSet.RestartInstances.
+func (azure *AzureCloudProvider) RestartNodes(nodes []*apiv1.Node) error {
+	byScaleSet := make(map[*ScaleSet][]string)
+	var scaleSets []*ScaleSet
+	for _, node := range nodes {
+		nodeGroup, err := azure.NodeGroupForNode(node)
+		if err != nil {
+			return err
+		}
+		scaleSet, ok := nodeGroup.(*ScaleSet)
+		if !ok || scaleSet == nil {
+			return fmt.Errorf("node %s is not backed by an autoscaled scale set", node.Name)
+		}
+		if _, found := byScaleSet[scaleSet]; !found {
+			scaleSets = append(scaleSets, scaleSet)
+		}
+		byScaleSet[scaleSet] = append(byScaleSet[scaleSet], node.Spec.ProviderID)
+	}
+	for _, scaleSet := range scaleSets {
+		if err := scaleSet.RestartInstances(byScaleSet[scaleSet]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NodeRestartStatus returns the status of the last restart of the instance backing the node, if any.
+func (azure *AzureCloudProvider) NodeRestartStatus(node *apiv1.Node) (InstanceRestart, bool) {
+	nodeGroup, err := azure.NodeGroupForNode(node)
+	if err != nil {
+		return InstanceRestart{}, false
+	}
+	scaleSet, ok := nodeGroup.(*ScaleSet)
+	if !ok || scaleSet == nil {
+		return InstanceRestart{}, false
+	}
+	return scaleSet.InstanceRestartStatus(node.Spec.ProviderID)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+)
+
+type fakeScaleSetRestartClient struct {
+	mutex     sync.Mutex
+	restarted map[string][]string
+	err       error
+}
+
+func (c *fakeScaleSetRestartClient) Restart(_ context.Context, _, vmScaleSetName string, instanceIDs []string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.restarted == nil {
+		c.restarted = make(map[string][]string)
+	}
+	c.restarted[vmScaleSetName] = append(c.restarted[vmScaleSetName], instanceIDs...)
+	return c.err
+}
+
+func newTestRestartProvider(t *testing.T, orchestrationMode compute.OrchestrationMode) (*AzureCloudProvider, *fakeScaleSetRestartClient) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	manager := newTestAzureManager(t)
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestVMSSList(3, testASG, "eastus", orchestrationMode), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(newTestVMSSVMList(3), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	if orchestrationMode == compute.Flexible {
+		manager.config.EnableVmssFlexNodes = true
+		mockVMClient := mockvmclient.NewMockInterface(ctrl)
+		mockVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestVMList(3), nil).AnyTimes()
+		mockVMClient.EXPECT().ListVmssFlexVMsWithoutInstanceView(gomock.Any(), testASG).Return(newTestVMList(3), nil).AnyTimes()
+		manager.azClient.virtualMachinesClient = mockVMClient
+	}
+	restartClient := &fakeScaleSetRestartClient{}
+	manager.azClient.scaleSetRestartClient = restartClient
+	manager.lifecycleEvents = newLifecycleEventStream("")
+
+	assert.True(t, manager.RegisterNodeGroup(newTestScaleSet(manager, testASG)))
+	manager.explicitlyConfigured[testASG] = true
+	assert.NoError(t, manager.forceRefresh())
+	return &AzureCloudProvider{azureManager: manager}, restartClient
+}
+
+func newTestRestartNode(i int) *apiv1.Node {
+	node := &apiv1.Node{}
+	node.Name = fmt.Sprintf("node-%d", i)
+	node.Spec.ProviderID = azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, i)
+	return node
+}
+
+func waitForRestart(t *testing.T, provider *AzureCloudProvider, node *apiv1.Node) InstanceRestart {
+	var restart InstanceRestart
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		var found bool
+		restart, found = provider.NodeRestartStatus(node)
+		return found && restart.State != InstanceRestartInProgress, nil
+	})
+	assert.NoError(t, err)
+	return restart
+}
+
+func TestRestartNodes(t *testing.T) {
+	provider, restartClient := newTestRestartProvider(t, compute.Uniform)
+	events := provider.InstanceLifecycleEvents(10)
+
+	nodes := []*apiv1.Node{newTestRestartNode(0), newTestRestartNode(2)}
+	assert.NoError(t, provider.RestartNodes(nodes))
+	restart := waitForRestart(t, provider, nodes[1])
+	assert.Equal(t, InstanceRestartSucceeded, restart.State)
+	assert.False(t, restart.FinishedAt.Before(restart.StartedAt))
+
+	restartClient.mutex.Lock()
+	assert.Equal(t, map[string][]string{testASG: {"0", "2"}}, restartClient.restarted)
+	restartClient.mutex.Unlock()
+	assert.Equal(t, InstanceLifecycleRestarting, (<-events).To)
+	assert.Equal(t, InstanceLifecycleRestarting, (<-events).To)
+	assert.Equal(t, InstanceLifecycleRunning, (<-events).To)
+
+	_, found := provider.NodeRestartStatus(newTestRestartNode(1))
+	assert.False(t, found)
+}
+
+func TestRestartNodesFailed(t *testing.T) {
+	provider, restartClient := newTestRestartProvider(t, compute.Uniform)
+	restartClient.err = fmt.Errorf("conflict")
+
+	node := newTestRestartNode(1)
+	assert.NoError(t, provider.RestartNodes([]*apiv1.Node{node}))
+	restart := waitForRestart(t, provider, node)
+	assert.Equal(t, InstanceRestartFailed, restart.State)
+	assert.Equal(t, "conflict", restart.Error)
+
+	scaleSet := provider.NodeGroups()[0].(*ScaleSet)
+	instance, found, err := scaleSet.getInstanceByProviderID(node.Spec.ProviderID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, cloudprovider.InstanceRunning, instance.Status.State)
+	assert.Equal(t, instanceRestartFailedErrorCode, instance.Status.ErrorInfo.ErrorCode)
+}
+
+func TestRestartNodesRateLimited(t *testing.T) {
+	provider, restartClient := newTestRestartProvider(t, compute.Uniform)
+	provider.azureManager.azClient.scaleSetRestartRateLimiter = flowcontrol.NewFakeNeverRateLimiter()
+
+	node := newTestRestartNode(1)
+	assert.ErrorContains(t, provider.RestartNodes([]*apiv1.Node{node}), "rate limited")
+	_, found := provider.NodeRestartStatus(node)
+	assert.False(t, found)
+	assert.Empty(t, restartClient.restarted)
+}
+
+func TestRestartNodesUnsupported(t *testing.T) {
+	provider, restartClient := newTestRestartProvider(t, compute.Flexible)
+	scaleSet := provider.NodeGroups()[0].(*ScaleSet)
+	err := scaleSet.RestartInstances([]string{azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, 0)})
+	assert.ErrorContains(t, err, "only supported for uniform scale sets")
+	assert.Empty(t, restartClient.restarted)
+
+	err = provider.RestartNodes([]*apiv1.Node{{Spec: apiv1.NodeSpec{ProviderID: "aws:///i-123"}}})
+	assert.ErrorContains(t, err, "not backed by an autoscaled scale set")
+}
+
+func TestRestartRequestedByTag(t *testing.T) {
+	provider, restartClient := newTestRestartProvider(t, compute.Uniform)
+	manager := provider.azureManager
+	mockVMSSClient := manager.azClient.virtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	setRequest := func(value *string) compute.VirtualMachineScaleSet {
+		vmss := manager.azureCache.scaleSets[testASG]
+		vmss.Tags = map[string]*string{"poolName": to.StringPtr("pool")}
+		if value != nil {
+			vmss.Tags[restartInstancesTagName] = value
+		}
+		manager.azureCache.scaleSets[testASG] = vmss
+		return vmss
+	}
+	vmss := setRequest(to.StringPtr("1, 7"))
+	mockVMSSClient.EXPECT().CreateOrUpdateAsync(gomock.Any(), manager.config.ResourceGroup, testASG, compute.VirtualMachineScaleSet{
+		Name:     vmss.Name,
+		Location: vmss.Location,
+		Tags:     map[string]*string{"poolName": to.StringPtr("pool")},
+	}).Return(nil, nil).Times(2)
+	mockVMSSClient.EXPECT().WaitForCreateOrUpdateResult(gomock.Any(), gomock.Any(), manager.config.ResourceGroup).Return(&http.Response{StatusCode: http.StatusOK}, nil).Times(2)
+	restarted := func() []string {
+		restartClient.mutex.Lock()
+		defer restartClient.mutex.Unlock()
+		return restartClient.restarted[testASG]
+	}
+
+	manager.processRestartRequests()
+	assert.Equal(t, InstanceRestartSucceeded, waitForRestart(t, provider, newTestRestartNode(1)).State)
+	assert.Equal(t, []string{"1"}, restarted(), "unknown instances are ignored")
+
+	// The cached scale set keeps the tag until it is listed again.
+	manager.processRestartRequests()
+	assert.Equal(t, []string{"1"}, restarted())
+
+	// Once removed, the tag can request the same restart again.
+	setRequest(nil)
+	manager.processRestartRequests()
+	setRequest(to.StringPtr("1,7"))
+	manager.processRestartRequests()
+	assert.Eventually(t, func() bool { return len(restarted()) == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPruneRestarts(t *testing.T) {
+	scaleSet := newTestScaleSet(newTestAzureManager(t), testASG)
+	now := time.Now()
+	providerID := func(i int) string {
+		return azurePrefix + fmt.Sprintf(fakeVirtualMachineScaleSetVMID, i)
+	}
+	scaleSet.restarts = map[string]InstanceRestart{
+		providerID(0): {State: InstanceRestartInProgress, StartedAt: now.Add(-2 * restartStatusRetention)},
+		providerID(1): {State: InstanceRestartSucceeded, FinishedAt: now.Add(-time.Minute)},
+		providerID(2): {State: InstanceRestartFailed, FinishedAt: now.Add(-2 * restartStatusRetention)},
+		providerID(3): {State: InstanceRestartInProgress, StartedAt: now},
+	}
+	instances := []cloudprovider.Instance{{Id: providerID(0)}, {Id: providerID(1)}, {Id: providerID(2)}}
+
+	scaleSet.pruneRestarts(instances, now)
+	assert.Len(t, scaleSet.restarts, 2)
+	assert.Contains(t, scaleSet.restarts, providerID(0), "restarts in progress are kept")
+	assert.Contains(t, scaleSet.restarts, providerID(1), "recently finished restarts are kept")
+
+	// The restart of an instance which disappeared isn't recorded when it finishes.
+	scaleSet.finishRestarts([]string{providerID(3)}, nil, now)
+	assert.NotContains(t, scaleSet.restarts, providerID(3))
+}
@@ -21,6 +21,7 @@ import (
 	"math/rand"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -56,6 +57,8 @@ const (
 type ScaleSet struct {
 	azureRef
 	manager *AzureManager
+	// resourceGroup is the resource group of the scale set if registered by resource ID, the configured one otherwise.
+	resourceGroup string
 
 	minSize int
 	maxSize int
@@ -82,6 +85,18 @@ type ScaleSet struct {
 	getVmssSizeRefreshPeriod time.Duration
 	// sizeMutex protects curSize (the number of VMs in the ScaleSet) from concurrent access
 	sizeMutex sync.Mutex
+	// paused is set while the VMSS carries the paused tag, pausedSize then pins both min and max size.
+	// They are refreshed along with curSize and read without locking, as MinSize and MaxSize may be
+	// called while the azureCache lock is held.
+	paused     atomic.Bool
+	pausedSize atomic.Int64
+	// outdatedInstanceCount is the number of instances not running the latest scale set model,
+	// as of the last instance cache refresh.
+	outdatedInstanceCount atomic.Int64
+	// capacityProbe tracks the capacity probe of large scale-ups.
+	capacityProbe capacityProbeState
+	// tagUpdate tracks the updates restoring the propagated tags.
+	tagUpdate tagUpdateState
 
 	InstanceCache
 
@@ -93,10 +108,19 @@ type ScaleSet struct {
 
 // NewScaleSet creates a new NewScaleSet.
 func NewScaleSet(spec *dynamic.NodeGroupSpec, az *AzureManager, curSize int64, dedicatedHost bool) (*ScaleSet, error) {
+	name, resourceGroup := spec.Name, ""
+	if subscriptionID, rg, vmssName, ok := parseScaleSetResourceID(spec.Name); ok {
+		if !strings.EqualFold(subscriptionID, az.config.SubscriptionID) {
+			return nil, fmt.Errorf("scale set %s is not in subscription %s", spec.Name, az.config.SubscriptionID)
+		}
+		name, resourceGroup = vmssName, rg
+	}
+
 	scaleSet := &ScaleSet{
 		azureRef: azureRef{
-			Name: spec.Name,
+			Name: name,
 		},
+		resourceGroup: resourceGroup,
 
 		minSize: spec.MinSize,
 		maxSize: spec.MaxSize,
@@ -137,6 +161,9 @@ func NewScaleSet(spec *dynamic.NodeGroupSpec, az *AzureManager, curSize int64, d
 
 // MinSize returns minimum size of the node group.
 func (scaleSet *ScaleSet) MinSize() int {
+	if size, paused := scaleSet.getPausedSize(); paused {
+		return size
+	}
 	return scaleSet.minSize
 }
 
@@ -179,6 +206,9 @@ func (scaleSet *ScaleSet) GetOptions(defaults config.NodeGroupAutoscalingOptions
 
 // MaxSize returns maximum size of the node group.
 func (scaleSet *ScaleSet) MaxSize() int {
+	if size, paused := scaleSet.getPausedSize(); paused {
+		return size
+	}
 	return scaleSet.maxSize
 }
 
@@ -222,7 +252,7 @@ func (scaleSet *ScaleSet) getCurSize() (int64, *GetVMSSFailedError) {
 		effectiveSizeRefreshPeriod = scaleSet.getVmssSizeRefreshPeriod
 	}
 
-	if scaleSet.lastSizeRefresh.Add(effectiveSizeRefreshPeriod).After(time.Now()) {
+	if scaleSet.lastSizeRefresh.Add(effectiveSizeRefreshPeriod).After(scaleSet.now()) {
 		klog.V(3).Infof("VMSS: %s, returning in-memory size: %d", scaleSet.Name, scaleSet.curSize)
 		return scaleSet.curSize, nil
 	}
@@ -233,7 +263,7 @@ func (scaleSet *ScaleSet) getCurSize() (int64, *GetVMSSFailedError) {
 		defer cancel()
 
 		var rerr *retry.Error
-		set, rerr = scaleSet.manager.azClient.virtualMachineScaleSetsClient.Get(ctx, scaleSet.manager.config.ResourceGroup, scaleSet.Name)
+		set, rerr = scaleSet.manager.azClient.virtualMachineScaleSetsClient.Get(ctx, scaleSet.resourceGroupName(), scaleSet.Name)
 		if rerr != nil {
 			klog.Errorf("failed to get information for VMSS: %s, error: %v", scaleSet.Name, rerr)
 			return -1, newGetVMSSFailedError(rerr.Error(), rerr.IsNotFound())
@@ -252,7 +282,8 @@ func (scaleSet *ScaleSet) getCurSize() (int64, *GetVMSSFailedError) {
 	klog.V(3).Infof("VMSS: %s, in-memory size: %d, new size: %d", scaleSet.Name, scaleSet.curSize, curSize)
 
 	scaleSet.curSize = curSize
-	scaleSet.lastSizeRefresh = time.Now()
+	scaleSet.lastSizeRefresh = scaleSet.now()
+	scaleSet.updatePaused(set.Tags, curSize)
 	return scaleSet.curSize, nil
 }
 
@@ -286,7 +317,7 @@ func (scaleSet *ScaleSet) waitForCreateOrUpdateInstances(future *azure.Future) {
 	defer cancel()
 
 	klog.V(3).Infof("Calling virtualMachineScaleSetsClient.WaitForCreateOrUpdateResult(%s)", scaleSet.Name)
-	httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForCreateOrUpdateResult(ctx, future, scaleSet.manager.config.ResourceGroup)
+	httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForCreateOrUpdateResult(ctx, future, scaleSet.resourceGroupName())
 
 	isSuccess, err := isSuccessHTTPResponse(httpResponse, err)
 	if isSuccess {
@@ -295,16 +326,11 @@ func (scaleSet *ScaleSet) waitForCreateOrUpdateInstances(future *azure.Future) {
 	}
 
 	klog.Errorf("waitForCreateOrUpdateInstances(%s) failed, err: %v", scaleSet.Name, err)
+	scaleSet.manager.recordScaleUpFailure(scaleSet.Name, err)
 }
 
 // setScaleSetSize sets ScaleSet size.
-func (scaleSet *ScaleSet) setScaleSetSize(size int64, delta int) error {
-	vmssInfo, err := scaleSet.getVMSSFromCache()
-	if err != nil {
-		klog.Errorf("Failed to get information for VMSS (%q): %v", scaleSet.Name, err)
-		return err
-	}
-
+func (scaleSet *ScaleSet) setScaleSetSize(vmssInfo compute.VirtualMachineScaleSet, size int64, delta int) error {
 	requiredInstances := delta
 
 	// If after reallocating instances we still need more instances or we're just in Delete mode
@@ -339,6 +365,10 @@ func (scaleSet *ScaleSet) IncreaseSize(delta int) error {
 		return err
 	}
 
+	if scaleSet.paused.Load() {
+		return fmt.Errorf("scale set %s is paused by tag %s, skipping IncreaseSize", scaleSet.Name, scaleSetPausedTag)
+	}
+
 	if size == -1 {
 		return fmt.Errorf("the scale set %s is under initialization, skipping IncreaseSize", scaleSet.Name)
 	}
@@ -347,7 +377,39 @@ func (scaleSet *ScaleSet) IncreaseSize(delta int) error {
 		return fmt.Errorf("size increase too large - desired:%d max:%d", int(size)+delta, scaleSet.MaxSize())
 	}
 
-	return scaleSet.setScaleSetSize(size+int64(delta), delta)
+	if outdated := scaleSet.outdatedInstanceCount.Load(); outdated > 0 {
+		klog.V(2).Infof("Scaling up scale set %s with %d instances not running its latest model, new instances are created from the latest model", scaleSet.Name, outdated)
+	}
+
+	vmss, err := scaleSet.getVMSSFromCache()
+	if err != nil {
+		klog.Errorf("Failed to get information for VMSS (%q): %v", scaleSet.Name, err)
+		return err
+	}
+
+	if vmss.Sku != nil && vmss.Location != nil {
+		var zones []string
+		if vmss.Zones != nil {
+			zones = *vmss.Zones
+		}
+		if err := checkSKURestrictions(scaleSet.manager.azureCache, to.String(vmss.Sku.Name), *vmss.Location, zones); err != nil {
+			klog.Errorf("Failed to scale up scale set %s: %v", scaleSet.Name, err)
+			return err
+		}
+	}
+
+	if err := scaleSet.manager.checkCostCeiling(scaleSet, delta, vmss.Tags); err != nil {
+		klog.Errorf("Failed to scale up scale set %s: %v", scaleSet.Name, err)
+		return err
+	}
+
+	if threshold := scaleSet.manager.config.CapacityProbeThreshold; threshold > 0 && delta >= threshold {
+		if err := scaleSet.probeCapacity(vmss, size); err != nil {
+			return err
+		}
+	}
+
+	return scaleSet.setScaleSetSize(vmss, size+int64(delta), delta)
 }
 
 // AtomicIncreaseSize is not implemented.
@@ -360,8 +422,13 @@ func (scaleSet *ScaleSet) GetScaleSetVms() ([]compute.VirtualMachineScaleSetVM,
 	ctx, cancel := getContextWithTimeout(vmssContextTimeout)
 	defer cancel()
 
-	vmList, rerr := scaleSet.manager.azClient.virtualMachineScaleSetVMsClient.List(ctx, scaleSet.manager.config.ResourceGroup,
-		scaleSet.Name, string(compute.InstanceViewTypesInstanceView))
+	var vmList []compute.VirtualMachineScaleSetVM
+	rerr := scaleSet.manager.azureCache.injectFault("VirtualMachineScaleSetVMsClient.List", scaleSet.Name)
+	if rerr == nil {
+		vmList, rerr = scaleSet.manager.azClient.virtualMachineScaleSetVMsClient.List(ctx, scaleSet.resourceGroupName(),
+			scaleSet.Name, string(compute.InstanceViewTypesInstanceView))
+	}
+	scaleSet.manager.azureCache.callQueue.observe(rerr, scaleSet.now())
 
 	klog.V(4).Infof("GetScaleSetVms: scaleSet.Name: %s, vmList: %v", scaleSet.Name, vmList)
 
@@ -389,7 +456,12 @@ func (scaleSet *ScaleSet) GetFlexibleScaleSetVms() ([]compute.VirtualMachine, *r
 		}
 		return nil, rerr
 	}
-	vmList, rerr := scaleSet.manager.azClient.virtualMachinesClient.ListVmssFlexVMsWithoutInstanceView(ctx, *vmssInfo.ID)
+	var vmList []compute.VirtualMachine
+	rerr := scaleSet.manager.azureCache.injectFault("VirtualMachinesClient.ListVmssFlexVMsWithoutInstanceView", scaleSet.Name)
+	if rerr == nil {
+		vmList, rerr = scaleSet.manager.azClient.virtualMachinesClient.ListVmssFlexVMsWithoutInstanceView(ctx, *vmssInfo.ID)
+	}
+	scaleSet.manager.azureCache.callQueue.observe(rerr, scaleSet.now())
 	if rerr != nil {
 		klog.Errorf("VirtualMachineScaleSetVMsClient.List failed for %s: %v", scaleSet.Name, rerr)
 		return nil, rerr
@@ -436,8 +508,32 @@ func (scaleSet *ScaleSet) Belongs(node *apiv1.Node) (bool, error) {
 }
 
 func (scaleSet *ScaleSet) createOrUpdateInstances(vmssInfo *compute.VirtualMachineScaleSet, newSize int64) error {
+	if scaleSet.manager.dryRun(operationUpdateCapacity, scaleSet.Name, "set capacity to %d", newSize) {
+		return nil
+	}
+	done, err := scaleSet.manager.operations.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: scaleSet.Name, TargetSize: newSize})
+	if err != nil {
+		return err
+	}
+	future, err := scaleSet.updateCapacityAsync(vmssInfo, newSize)
+	scaleSet.manager.recordMutation(operationUpdateCapacity, scaleSet.Name, err, "set capacity to %d", newSize)
+	if err != nil {
+		done()
+		return err
+	}
+
+	go func() {
+		defer done()
+		scaleSet.waitForCreateOrUpdateInstances(future)
+	}()
+	return nil
+}
+
+// updateCapacityAsync starts updating the scale set capacity to newSize and proactively sets the cached size.
+// Callers are responsible for waiting on the returned future.
+func (scaleSet *ScaleSet) updateCapacityAsync(vmssInfo *compute.VirtualMachineScaleSet, newSize int64) (*azure.Future, error) {
 	if vmssInfo == nil {
-		return fmt.Errorf("vmssInfo cannot be nil while increating scaleSet capacity")
+		return nil, fmt.Errorf("vmssInfo cannot be nil while increating scaleSet capacity")
 	}
 
 	scaleSet.sizeMutex.Lock()
@@ -467,18 +563,20 @@ func (scaleSet *ScaleSet) createOrUpdateInstances(vmssInfo *compute.VirtualMachi
 	ctx, cancel := getContextWithTimeout(vmssContextTimeout)
 	defer cancel()
 	klog.V(3).Infof("Waiting for virtualMachineScaleSetsClient.CreateOrUpdateAsync(%s)", scaleSet.Name)
-	future, rerr := scaleSet.manager.azClient.virtualMachineScaleSetsClient.CreateOrUpdateAsync(ctx, scaleSet.manager.config.ResourceGroup, scaleSet.Name, op)
+	future, rerr := scaleSet.manager.azClient.virtualMachineScaleSetsClient.CreateOrUpdateAsync(ctx, scaleSet.resourceGroupName(), scaleSet.Name, op)
+	scaleSet.manager.azureCache.callQueue.observe(rerr, scaleSet.now())
+	scaleSet.manager.recordThrottling(scaleSet.Name, rerr)
 	if rerr != nil {
 		klog.Errorf("virtualMachineScaleSetsClient.CreateOrUpdate for scale set %q failed: %+v", scaleSet.Name, rerr)
-		return rerr.Error()
+		return nil, rerr.Error()
 	}
 
 	// Proactively set the VMSS size so autoscaler makes better decisions.
 	scaleSet.curSize = newSize
-	scaleSet.lastSizeRefresh = time.Now()
+	scaleSet.lastSizeRefresh = scaleSet.now()
+	scaleSet.manager.state.setTargetSize(scaleSet.Name, newSize)
 
-	go scaleSet.waitForCreateOrUpdateInstances(future)
-	return nil
+	return future, nil
 }
 
 // DeleteInstances deletes the given instances. All instances must be controlled by the same nodegroup.
@@ -516,6 +614,7 @@ func (scaleSet *ScaleSet) DeleteInstances(instances []*azureRef, hasUnregistered
 	}
 
 	instanceIDs := []string{}
+	providerIDs := []string{}
 	for _, instance := range instancesToDelete {
 		instanceID, err := getLastSegment(instance.Name)
 		if err != nil {
@@ -523,21 +622,50 @@ func (scaleSet *ScaleSet) DeleteInstances(instances []*azureRef, hasUnregistered
 			return err
 		}
 		instanceIDs = append(instanceIDs, instanceID)
+		providerIDs = append(providerIDs, instance.Name)
+	}
+
+	if scaleSet.manager.dryRun(operationDeleteInstances, scaleSet.Name, "delete instances %v", instanceIDs) {
+		return nil
+	}
+
+	if err := scaleSet.manager.runPreDeleteHook(commonAsg.Id(), providerIDs); err != nil {
+		scaleSet.manager.recordMutation(operationDeleteInstances, scaleSet.Name, err, "delete instances %v", instanceIDs)
+		return err
 	}
 
 	requiredIds := &compute.VirtualMachineScaleSetVMInstanceRequiredIDs{
 		InstanceIds: &instanceIDs,
 	}
 
+	done, err := scaleSet.manager.operations.start(armOperation{Kind: operationDeleteInstances, NodeGroup: scaleSet.Name, InstanceIDs: instanceIDs})
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := getContextWithTimeout(vmssContextTimeout)
 	defer cancel()
 
+	scaleSet.manager.deletions.start(scaleSet.key(), providerIDs, scaleSet.now())
 	future, rerr := scaleSet.deleteInstances(ctx, requiredIds, commonAsg.Id())
+	scaleSet.manager.azureCache.callQueue.observe(rerr, scaleSet.now())
+	scaleSet.manager.recordThrottling(scaleSet.Name, rerr)
+	scaleSet.manager.recordMutation(operationDeleteInstances, scaleSet.Name, rerr.Error(), "delete instances %v", instanceIDs)
 	if rerr != nil {
+		done()
+		scaleSet.manager.deletions.finish(providerIDs, rerr.Error(), scaleSet.now())
 		klog.Errorf("virtualMachineScaleSetsClient.DeleteInstancesAsync for instances %v for %s failed: %+v", requiredIds.InstanceIds, scaleSet.Name, rerr)
 		return rerr.Error()
 	}
 
+	scaleSet.sizeMutex.Lock()
+	targetSize := scaleSet.curSize
+	scaleSet.sizeMutex.Unlock()
+	if !hasUnregisteredNodes {
+		targetSize -= int64(len(instanceIDs))
+	}
+	scaleSet.manager.state.setTargetSize(scaleSet.Name, targetSize)
+
 	if !scaleSet.manager.config.StrictCacheUpdates {
 		// Proactively decrement scale set size so that we don't
 		// go below minimum node count if cache data is stale
@@ -546,7 +674,7 @@ func (scaleSet *ScaleSet) DeleteInstances(instances []*azureRef, hasUnregistered
 		if !hasUnregisteredNodes {
 			scaleSet.sizeMutex.Lock()
 			scaleSet.curSize -= int64(len(instanceIDs))
-			scaleSet.lastSizeRefresh = time.Now()
+			scaleSet.lastSizeRefresh = scaleSet.now()
 			scaleSet.sizeMutex.Unlock()
 		}
 
@@ -556,18 +684,22 @@ func (scaleSet *ScaleSet) DeleteInstances(instances []*azureRef, hasUnregistered
 		}
 	}
 
-	go scaleSet.waitForDeleteInstances(future, requiredIds)
+	go func() {
+		defer done()
+		scaleSet.waitForDeleteInstances(future, requiredIds, providerIDs)
+	}()
 	return nil
 }
 
-func (scaleSet *ScaleSet) waitForDeleteInstances(future *azure.Future, requiredIds *compute.VirtualMachineScaleSetVMInstanceRequiredIDs) {
+func (scaleSet *ScaleSet) waitForDeleteInstances(future *azure.Future, requiredIds *compute.VirtualMachineScaleSetVMInstanceRequiredIDs, providerIDs []string) {
 	ctx, cancel := getContextWithTimeout(asyncContextTimeout)
 
 	defer cancel()
 	klog.V(3).Infof("Calling virtualMachineScaleSetsClient.WaitForDeleteInstancesResult(%v) for %s", requiredIds.InstanceIds, scaleSet.Name)
-	httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForDeleteInstancesResult(ctx, future, scaleSet.manager.config.ResourceGroup)
+	httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForDeleteInstancesResult(ctx, future, scaleSet.resourceGroupName())
 	isSuccess, err := isSuccessHTTPResponse(httpResponse, err)
 	if isSuccess {
+		scaleSet.manager.deletions.finish(providerIDs, nil, scaleSet.now())
 		klog.V(3).Infof(".WaitForDeleteInstancesResult(%v) for %s success", requiredIds.InstanceIds, scaleSet.Name)
 		if scaleSet.manager.config.StrictCacheUpdates {
 			if err := scaleSet.manager.forceRefresh(); err != nil {
@@ -581,6 +713,7 @@ func (scaleSet *ScaleSet) waitForDeleteInstances(future *azure.Future, requiredI
 		// On failure, invalidate the instanceCache - cannot have instances in deletingState
 		scaleSet.invalidateInstanceCache()
 	}
+	scaleSet.manager.deletions.finish(providerIDs, err, scaleSet.now())
 	klog.Errorf("WaitForDeleteInstancesResult(%v) for %s failed with error: %v", requiredIds.InstanceIds, scaleSet.Name, err)
 }
 
@@ -592,10 +725,22 @@ func (scaleSet *ScaleSet) DeleteNodes(nodes []*apiv1.Node) error {
 		return err
 	}
 
+	if scaleSet.paused.Load() {
+		return fmt.Errorf("scale set %s is paused by tag %s, nodes will not be deleted", scaleSet.Name, scaleSetPausedTag)
+	}
+
 	if int(size) <= scaleSet.MinSize() {
 		return fmt.Errorf("min size reached, nodes will not be deleted")
 	}
 
+	var tags map[string]*string
+	if vmss, err := scaleSet.getVMSSFromCache(); err == nil {
+		tags = vmss.Tags
+	}
+	if err := checkDeletionHold(scaleSet.Name, nodes, tags); err != nil {
+		return err
+	}
+
 	// Distinguish between unregistered node deletion and normal node deletion
 	refs := make([]*azureRef, 0, len(nodes))
 	hasUnregisteredNodes := false
@@ -626,6 +771,7 @@ func (scaleSet *ScaleSet) DeleteNodes(nodes []*apiv1.Node) error {
 		}
 	}
 
+	defer scaleSet.manager.deletions.recordNodes(nodes)
 	if len(unregisteredRefs) > 0 {
 		klog.V(3).Infof("Removing unregisteredNodes: %v", unregisteredRefs)
 		return scaleSet.DeleteInstances(unregisteredRefs, true)
@@ -646,7 +792,7 @@ func (scaleSet *ScaleSet) Id() string {
 
 // Debug returns a debug string for the Scale Set.
 func (scaleSet *ScaleSet) Debug() string {
-	return fmt.Sprintf("%s (%d:%d)", scaleSet.Id(), scaleSet.MinSize(), scaleSet.MaxSize())
+	return scaleSet.DebugInfo().String()
 }
 
 // TemplateNodeInfo returns a node template for this scale set.
@@ -667,6 +813,10 @@ func (scaleSet *ScaleSet) TemplateNodeInfo() (*framework.NodeInfo, error) {
 		return nil, err
 	}
 
+	scaleSet.manager.annotateLastStockout(scaleSet.Name, node)
+	scaleSet.manager.annotateHealthScore(scaleSet.Name, node)
+	scaleSet.manager.preferZonesWithoutFailures(template, node)
+
 	nodeInfo := framework.NewNodeInfo(node, nil, &framework.PodInfo{Pod: cloudprovider.BuildKubeProxy(scaleSet.Name)})
 	return nodeInfo, nil
 }
@@ -686,7 +836,7 @@ func (scaleSet *ScaleSet) Nodes() ([]cloudprovider.Instance, error) {
 	defer scaleSet.instanceMutex.Unlock()
 
 	if int64(len(scaleSet.instanceCache)) == curSize &&
-		scaleSet.lastInstanceRefresh.Add(scaleSet.instancesRefreshPeriod).After(time.Now()) {
+		scaleSet.lastInstanceRefresh.Add(scaleSet.instancesRefreshPeriod).After(scaleSet.now()) {
 		klog.V(4).Infof("Nodes: returns with curSize %d", curSize)
 		return scaleSet.instanceCache, nil
 	}
@@ -706,7 +856,7 @@ func (scaleSet *ScaleSet) buildScaleSetCacheForFlex() error {
 	klog.V(3).Infof("buildScaleSetCacheForFlex: resetting instance Cache for scaleSet %s",
 		scaleSet.Name)
 	splay := rand.New(rand.NewSource(time.Now().UnixNano())).Intn(scaleSet.instancesRefreshJitter + 1)
-	lastRefresh := time.Now().Add(-time.Second * time.Duration(splay))
+	lastRefresh := scaleSet.now().Add(-time.Second * time.Duration(splay))
 
 	vms, rerr := scaleSet.GetFlexibleScaleSetVms()
 	if rerr != nil {
@@ -719,7 +869,7 @@ func (scaleSet *ScaleSet) buildScaleSetCacheForFlex() error {
 		return rerr.Error()
 	}
 
-	scaleSet.instanceCache = buildInstanceCacheForFlex(vms, scaleSet.enableFastDeleteOnFailedProvisioning)
+	scaleSet.setInstanceCache(buildInstanceCacheForFlex(vms, scaleSet.enableFastDeleteOnFailedProvisioning))
 	scaleSet.lastInstanceRefresh = lastRefresh
 
 	return nil
@@ -729,7 +879,7 @@ func (scaleSet *ScaleSet) buildScaleSetCacheForUniform() error {
 	klog.V(3).Infof("updateInstanceCache: resetting instance Cache for scaleSet %s",
 		scaleSet.Name)
 	splay := rand.New(rand.NewSource(time.Now().UnixNano())).Intn(scaleSet.instancesRefreshJitter + 1)
-	lastRefresh := time.Now().Add(-time.Second * time.Duration(splay))
+	lastRefresh := scaleSet.now().Add(-time.Second * time.Duration(splay))
 	vms, rerr := scaleSet.GetScaleSetVms()
 	if rerr != nil {
 		if isAzureRequestsThrottled(rerr) {
@@ -768,7 +918,15 @@ func (scaleSet *ScaleSet) buildScaleSetCacheForUniform() error {
 		})
 	}
 
-	scaleSet.instanceCache = instances
+	outdated := countOutdatedInstances(vms)
+	scaleSet.outdatedInstanceCount.Store(int64(outdated))
+	outdatedInstances.WithLabelValues(scaleSet.Name).Set(float64(outdated))
+	scaleSet.updateUnhealthyInstances(vms, scaleSet.now())
+	scaleSet.recordZoneFailures(vms, scaleSet.now())
+
+	scaleSet.pruneRestarts(instances, scaleSet.now())
+
+	scaleSet.setInstanceCache(instances)
 	scaleSet.lastInstanceRefresh = lastRefresh
 
 	return nil
@@ -860,9 +1018,14 @@ func isSpot(vmss *compute.VirtualMachineScaleSet) bool {
 		vmss.VirtualMachineScaleSetProperties.VirtualMachineProfile.Priority == compute.Spot
 }
 
+// now returns the time of the clock of the cache of the manager.
+func (scaleSet *ScaleSet) now() time.Time {
+	return scaleSet.manager.azureCache.now()
+}
+
 func (scaleSet *ScaleSet) invalidateLastSizeRefreshWithLock() {
 	scaleSet.sizeMutex.Lock()
-	scaleSet.lastSizeRefresh = time.Now().Add(-1 * scaleSet.sizeRefreshPeriod)
+	scaleSet.lastSizeRefresh = scaleSet.now().Add(-1 * scaleSet.sizeRefreshPeriod)
 	scaleSet.sizeMutex.Unlock()
 }
 
@@ -68,6 +68,14 @@ type InstanceCache struct {
 	instancesRefreshJitter int
 	// instanceMutex is used for protecting instance cache from concurrent access
 	instanceMutex sync.Mutex
+	// instancesListed is set once instanceCache was listed from VMSS, from when lifecycle transitions are published.
+	instancesListed bool
+	// unhealthyInstances are the instances seen unhealthy in their instance view, by provider ID.
+	unhealthyInstances map[string]unhealthyInstance
+	// restarts are the last restarts of instances requested with RestartInstances, by provider ID.
+	restarts map[string]InstanceRestart
+	// restartRequest is the last value of the restart tag handled by processRestartRequest, guarded by instanceMutex.
+	restartRequest string
 }
 
 // invalidateInstanceCache invalidates the instanceCache by modifying the lastInstanceRefresh.
@@ -76,7 +84,7 @@ func (scaleSet *ScaleSet) invalidateInstanceCache() {
 	defer scaleSet.instanceMutex.Unlock()
 	// Set the instanceCache as outdated.
 	klog.V(3).Infof("invalidating instanceCache for %s", scaleSet.Name)
-	scaleSet.lastInstanceRefresh = time.Now().Add(-1 * scaleSet.instancesRefreshPeriod)
+	scaleSet.lastInstanceRefresh = scaleSet.now().Add(-1 * scaleSet.instancesRefreshPeriod)
 }
 
 // validateInstanceCache updates the instanceCache if it has expired. It acquires lock.
@@ -88,7 +96,7 @@ func (scaleSet *ScaleSet) validateInstanceCache() error {
 
 // validateInstanceCacheWithoutLock is used a helper function for validateInstanceCache, get and set methods.
 func (scaleSet *ScaleSet) validateInstanceCacheWithoutLock() error {
-	if scaleSet.lastInstanceRefresh.Add(scaleSet.instancesRefreshPeriod).After(time.Now()) {
+	if scaleSet.lastInstanceRefresh.Add(scaleSet.instancesRefreshPeriod).After(scaleSet.now()) {
 		klog.V(3).Infof("validateInstanceCacheWithoutLock: no need to reset instance Cache for scaleSet %s",
 			scaleSet.Name)
 		return nil
@@ -100,6 +108,12 @@ func (scaleSet *ScaleSet) validateInstanceCacheWithoutLock() error {
 // updateInstanceCache forcefully updates the cache without checking the timer - lastInstanceRefresh.
 // Caller is responsible for acquiring lock on the instanceCache.
 func (scaleSet *ScaleSet) updateInstanceCache() error {
+	// The instances are kept as cached while background ARM calls are deferred.
+	if !scaleSet.lastInstanceRefresh.IsZero() &&
+		!scaleSet.manager.azureCache.callQueue.admitBackground(callInstanceRefresh, scaleSet.Name, scaleSet.now()) {
+		return nil
+	}
+
 	orchestrationMode, err := scaleSet.getOrchestrationMode()
 	if err != nil {
 		klog.Errorf("failed to get information for VMSS: %s, error: %v", scaleSet.Name, err)
@@ -191,6 +205,9 @@ func (scaleSet *ScaleSet) setInstanceStatusByProviderID(providerID string, statu
 		if instance.Id == providerID {
 			klog.V(3).Infof("setInstanceStatusByProviderID: setting instance state for %s for scaleSet "+
 				"%s to %d", instance.Id, scaleSet.Name, status.State)
+			if event, changed := lifecycleEvent(scaleSet.Name, instance.Id, instance.Status, &status, scaleSet.now()); changed {
+				scaleSet.manager.lifecycleEvents.publish([]InstanceLifecycleEvent{event})
+			}
 			scaleSet.instanceCache[k].Status = &status
 			break
 		}
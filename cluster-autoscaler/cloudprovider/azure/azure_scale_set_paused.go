@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"strings"
+
+	klog "k8s.io/klog/v2"
+)
+
+// scaleSetPausedTag excludes a registered scale set from scale-up and scale-down while set to "true",
+// e.g. for maintenance windows, without unregistering it.
+const scaleSetPausedTag = "cluster-autoscaler-paused"
+
+func isScaleSetPaused(tags map[string]*string) bool {
+	value, ok := tags[scaleSetPausedTag]
+	return ok && value != nil && strings.EqualFold(strings.TrimSpace(*value), "true")
+}
+
+// updatePaused refreshes the paused state of the scale set from its VMSS tags. Paused scale sets
+// report size as both their min and max size, so the core neither scales them up nor down and the
+// pinned sizes show up in the status ConfigMap.
+func (scaleSet *ScaleSet) updatePaused(tags map[string]*string, size int64) {
+	paused := isScaleSetPaused(tags) && size >= 0
+	if paused {
+		scaleSet.pausedSize.Store(size)
+	}
+	if scaleSet.paused.Swap(paused) != paused {
+		if paused {
+			klog.V(2).Infof("Scale set %s paused by tag %s at size %d", scaleSet.Name, scaleSetPausedTag, size)
+		} else {
+			klog.V(2).Infof("Scale set %s resumed, tag %s removed", scaleSet.Name, scaleSetPausedTag)
+		}
+	}
+}
+
+// getPausedSize returns the size the scale set is pinned to and whether it is paused.
+func (scaleSet *ScaleSet) getPausedSize() (int, bool) {
+	if !scaleSet.paused.Load() {
+		return 0, false
+	}
+	return int(scaleSet.pausedSize.Load()), true
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsScaleSetPaused(t *testing.T) {
+	assert.False(t, isScaleSetPaused(nil))
+	assert.False(t, isScaleSetPaused(map[string]*string{scaleSetPausedTag: nil}))
+	assert.False(t, isScaleSetPaused(map[string]*string{scaleSetPausedTag: to.StringPtr("false")}))
+	assert.True(t, isScaleSetPaused(map[string]*string{scaleSetPausedTag: to.StringPtr("true")}))
+	assert.True(t, isScaleSetPaused(map[string]*string{scaleSetPausedTag: to.StringPtr(" True ")}))
+}
+
+func TestScaleSetPaused(t *testing.T) {
+	manager := newTestAzureManager(t)
+	vmss := compute.VirtualMachineScaleSet{
+		Name: to.StringPtr(testASG),
+		Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(3)},
+		Tags: map[string]*string{scaleSetPausedTag: to.StringPtr("true")},
+	}
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{testASG: vmss}
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	size, err := scaleSet.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, size)
+	assert.Equal(t, 3, scaleSet.MinSize())
+	assert.Equal(t, 3, scaleSet.MaxSize())
+	assert.Regexp(t, `^`+testASG+` \(3:3\) size=0/3 .* paused$`, scaleSet.Debug())
+
+	err = scaleSet.IncreaseSize(1)
+	assert.ErrorContains(t, err, "paused")
+	err = scaleSet.DeleteNodes([]*apiv1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node"}}})
+	assert.ErrorContains(t, err, "paused")
+
+	vmss.Tags = nil
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{testASG: vmss}
+	_, err = scaleSet.TargetSize()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, scaleSet.MinSize())
+	assert.Equal(t, 5, scaleSet.MaxSize())
+	assert.NotContains(t, scaleSet.Debug(), "paused")
+}
@@ -17,12 +17,16 @@ limitations under the License.
 package azure
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
@@ -32,6 +36,7 @@ import (
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
 )
 
 const (
@@ -593,6 +598,138 @@ func TestScaleSetIncreaseSizeOnVMSSUpdating(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestScaleSetIncreaseSizeWithCapacityProbe(t *testing.T) {
+	testCases := map[string]struct {
+		probeErr           error
+		expectedCapacities []int64
+		expectStockout     bool
+	}{
+		"successful probe proceeds with the scale-up": {
+			expectedCapacities: []int64{4, 13},
+		},
+		"stockout detected by the probe fails the scale-up": {
+			probeErr:           &azure.ServiceError{Code: "ZonalAllocationFailed", Message: "Allocation failed"},
+			expectedCapacities: []int64{4},
+			expectStockout:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			manager := newTestAzureManager(t)
+			manager.config.CapacityProbeThreshold = 5
+			expectedScaleSets := newTestVMSSList(3, testASG, "eastus", compute.Uniform)
+			expectedVMSSVMs := newTestVMSSVMList(3)
+
+			var capacities []int64
+			var mu sync.Mutex
+			mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+			mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(expectedScaleSets, nil).AnyTimes()
+			mockVMSSClient.EXPECT().CreateOrUpdateAsync(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _ string, vmss compute.VirtualMachineScaleSet) (*azure.Future, *retry.Error) {
+					mu.Lock()
+					defer mu.Unlock()
+					capacities = append(capacities, *vmss.Sku.Capacity)
+					return nil, nil
+				}).Times(len(tc.expectedCapacities))
+			mockVMSSClient.EXPECT().WaitForCreateOrUpdateResult(gomock.Any(), gomock.Any(), manager.config.ResourceGroup).Return(
+				&http.Response{StatusCode: http.StatusOK}, tc.probeErr).Times(1)
+			mockVMSSClient.EXPECT().WaitForCreateOrUpdateResult(gomock.Any(), gomock.Any(), manager.config.ResourceGroup).Return(
+				&http.Response{StatusCode: http.StatusOK}, nil).AnyTimes()
+			manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+			mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+			mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+			manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+			mockVMClient := mockvmclient.NewMockInterface(ctrl)
+			mockVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachine{}, nil).AnyTimes()
+			manager.azClient.virtualMachinesClient = mockVMClient
+			assert.NoError(t, manager.forceRefresh())
+
+			scaleSet := newTestScaleSet(manager, testASG)
+			scaleSet.maxSize = 20
+			assert.True(t, manager.RegisterNodeGroup(scaleSet))
+
+			err := scaleSet.IncreaseSize(10)
+			if tc.expectStockout {
+				var probeErr *CapacityProbeError
+				assert.True(t, errors.As(err, &probeErr))
+				assert.Equal(t, testASG, probeErr.ScaleSet)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tc.expectedCapacities, capacities)
+		})
+	}
+}
+
+func TestScaleSetCapacityProbeTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.config.CapacityProbeThreshold = 5
+	manager.config.CapacityProbeTimeoutInSeconds = 1
+	expectedScaleSets := newTestVMSSList(3, testASG, "eastus", compute.Uniform)
+
+	var capacities []int64
+	var mu sync.Mutex
+	release := make(chan struct{})
+	probed := make(chan struct{})
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(expectedScaleSets, nil).AnyTimes()
+	mockVMSSClient.EXPECT().CreateOrUpdateAsync(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, vmss compute.VirtualMachineScaleSet) (*azure.Future, *retry.Error) {
+			mu.Lock()
+			defer mu.Unlock()
+			capacities = append(capacities, *vmss.Sku.Capacity)
+			return nil, nil
+		}).Times(2)
+	mockVMSSClient.EXPECT().WaitForCreateOrUpdateResult(gomock.Any(), gomock.Any(), manager.config.ResourceGroup).DoAndReturn(
+		func(context.Context, *azure.Future, string) (*http.Response, error) {
+			<-release
+			defer close(probed)
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}).Times(1)
+	mockVMSSClient.EXPECT().WaitForCreateOrUpdateResult(gomock.Any(), gomock.Any(), manager.config.ResourceGroup).Return(
+		&http.Response{StatusCode: http.StatusOK}, nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	mockVMSSVMClient := mockvmssvmclient.NewMockInterface(ctrl)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup, testASG, gomock.Any()).Return(newTestVMSSVMList(3), nil).AnyTimes()
+	manager.azClient.virtualMachineScaleSetVMsClient = mockVMSSVMClient
+	mockVMClient := mockvmclient.NewMockInterface(ctrl)
+	mockVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachine{}, nil).AnyTimes()
+	manager.azClient.virtualMachinesClient = mockVMClient
+	assert.NoError(t, manager.forceRefresh())
+
+	scaleSet := newTestScaleSet(manager, testASG)
+	scaleSet.maxSize = 20
+	assert.True(t, manager.RegisterNodeGroup(scaleSet))
+
+	// The scale-up doesn't wait for the probe beyond its timeout, and only the probe is issued.
+	assert.Error(t, scaleSet.IncreaseSize(10))
+	// Large scale-ups are not issued while the probe is in progress.
+	assert.Error(t, scaleSet.IncreaseSize(10))
+	close(release)
+	<-probed
+	assert.Eventually(t, func() bool {
+		scaleSet.capacityProbe.mutex.Lock()
+		defer scaleSet.capacityProbe.mutex.Unlock()
+		return !scaleSet.capacityProbe.inFlight
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Once the probe succeeded, large scale-ups skip probing.
+	assert.NoError(t, scaleSet.IncreaseSize(10))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int64{4, 14}, capacities)
+}
+
 func TestScaleSetBelongs(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1087,7 +1224,7 @@ func TestAgentPoolDebug(t *testing.T) {
 		maxSize: 55,
 	}
 	asg.Name = "test-scale-set"
-	assert.Equal(t, asg.Debug(), "test-scale-set (5:55)")
+	assert.Equal(t, asg.Debug(), "test-scale-set (5:55) size=?/0")
 }
 
 func TestScaleSetNodes(t *testing.T) {
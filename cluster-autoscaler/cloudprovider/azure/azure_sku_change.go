@@ -0,0 +1,41 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+)
+
+// regenerateScaleSetSKUs records the VM SKU of the cached scale sets, returning the scale sets
+// resized to a different SKU in place since the previous refresh.
+func regenerateScaleSetSKUs(scaleSets map[string]compute.VirtualMachineScaleSet, previous map[azureRef]string) (map[azureRef]string, []scaleSetModelChange) {
+	return diffScaleSetModels(scaleSets, previous, scaleSetSKUChangedReason,
+		func(vmss compute.VirtualMachineScaleSet) (string, bool) {
+			if vmss.Sku == nil || vmss.Sku.Name == nil {
+				return "", false
+			}
+			return *vmss.Sku.Name, true
+		},
+		func(name string, oldSKU, sku string) string {
+			if oldSKU == sku {
+				return ""
+			}
+			return fmt.Sprintf("SKU of scale set %s changed from %s to %s", name, oldSKU, sku)
+		})
+}
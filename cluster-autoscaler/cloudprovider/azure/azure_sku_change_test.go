@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func TestRegenerateScaleSetSKUs(t *testing.T) {
+	ref := azureRef{Name: testASG}
+	scaleSets := map[string]compute.VirtualMachineScaleSet{testASG: newTestVMSSList(3, testASG, testLocation, compute.Uniform)[0]}
+	skus, changes := regenerateScaleSetSKUs(scaleSets, nil)
+	assert.Equal(t, "Standard_D4_v2", skus[ref])
+	assert.Empty(t, changes)
+
+	resized := newTestVMSSList(3, testASG, testLocation, compute.Uniform)[0]
+	resized.Sku.Name = to.StringPtr("Standard_D8_v3")
+	skus, changes = regenerateScaleSetSKUs(map[string]compute.VirtualMachineScaleSet{testASG: resized}, skus)
+	assert.Equal(t, "Standard_D8_v3", skus[ref])
+	assert.Equal(t, []scaleSetModelChange{{
+		scaleSet: testASG,
+		reason:   scaleSetSKUChangedReason,
+		message:  "SKU of scale set " + testASG + " changed from Standard_D4_v2 to Standard_D8_v3",
+	}}, changes)
+
+	skus, changes = regenerateScaleSetSKUs(map[string]compute.VirtualMachineScaleSet{testASG: {Name: to.StringPtr(testASG)}}, skus)
+	assert.Empty(t, skus)
+	assert.Empty(t, changes)
+}
+
+func TestScaleSetTemplateNodeInfoAfterSKUChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	original := newTestVMSSList(3, testASG, testLocation, compute.Uniform)
+	resized := newTestVMSSList(3, testASG, testLocation, compute.Uniform)
+	resized[0].Sku.Name = to.StringPtr("Standard_D16_v3")
+
+	// Other tests override the instance type lookup, pin it to the SKU vCPU counts used here.
+	getInstanceTypeStatically := GetInstanceTypeStatically
+	t.Cleanup(func() { GetInstanceTypeStatically = getInstanceTypeStatically })
+	GetInstanceTypeStatically = func(template NodeTemplate) (*InstanceType, error) {
+		vcpus := map[string]int64{"Standard_D4_v2": 8, "Standard_D16_v3": 16}
+		return &InstanceType{InstanceType: template.SkuName, VCPU: vcpus[template.SkuName], MemoryMb: 1024}, nil
+	}
+
+	manager := newTestAzureManager(t)
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	gomock.InOrder(
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(original, nil),
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(resized, nil),
+	)
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	assert.NoError(t, manager.forceRefresh())
+	nodeInfo, err := scaleSet.TemplateNodeInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, "Standard_D4_v2", nodeInfo.Node().Labels[apiv1.LabelInstanceTypeStable])
+	assert.Equal(t, *resource.NewQuantity(8, resource.DecimalSI), *nodeInfo.Node().Status.Capacity.Cpu())
+
+	assert.NoError(t, manager.forceRefresh())
+	assert.Equal(t, "Standard_D16_v3", manager.azureCache.getScaleSetSKUs()[azureRef{Name: testASG}])
+	nodeInfo, err = scaleSet.TemplateNodeInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, "Standard_D16_v3", nodeInfo.Node().Labels[apiv1.LabelInstanceTypeStable])
+	assert.Equal(t, *resource.NewQuantity(16, resource.DecimalSI), *nodeInfo.Node().Status.Capacity.Cpu())
+}
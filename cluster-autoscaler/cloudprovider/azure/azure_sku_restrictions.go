@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	klog "k8s.io/klog/v2"
+)
+
+// SKURestrictedError is returned when scaling up a node group whose SKU is restricted
+// for the subscription in the location, or in all the zones, of the node group.
+type SKURestrictedError struct {
+	SKU      string
+	Location string
+	// Zones are the restricted zones of the node group, empty if the whole location is restricted.
+	Zones []string
+}
+
+// Error implements the error interface.
+func (e *SKURestrictedError) Error() string {
+	if len(e.Zones) == 0 {
+		return fmt.Sprintf("SKU %s is restricted in location %s for the subscription", e.SKU, e.Location)
+	}
+	return fmt.Sprintf("SKU %s is restricted in zones %s of location %s for the subscription", e.SKU, strings.Join(e.Zones, ","), e.Location)
+}
+
+// checkSKURestrictions returns a SKURestrictedError if the SKU can't be deployed in the location,
+// or in any of the given zones, based on the restrictions reported by the SKU API.
+// Nothing is checked when the SKU cache isn't populated, i.e. enableDynamicInstanceList is off.
+func checkSKURestrictions(cache *azureCache, skuName, location string, zones []string) error {
+	if !cache.HasVMSKUs() {
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	sku, err := cache.GetSKU(ctx, skuName, location)
+	if err != nil {
+		klog.V(4).Infof("Skipping restriction check of SKU %s in location %s: %v", skuName, location, err)
+		return nil
+	}
+
+	if sku.HasLocationRestriction(location) || !sku.IsAvailable(location) {
+		skuRestrictedScaleUps.WithLabelValues(skuName).Inc()
+		return &SKURestrictedError{SKU: skuName, Location: location}
+	}
+
+	if len(zones) == 0 {
+		return nil
+	}
+	availableZones := sku.AvailabilityZones(location)
+	for _, zone := range zones {
+		if availableZones[zone] {
+			// Instances can still be placed in an unrestricted zone.
+			return nil
+		}
+	}
+	skuRestrictedScaleUps.WithLabelValues(skuName).Inc()
+	return &SKURestrictedError{SKU: skuName, Location: location, Zones: zones}
+}
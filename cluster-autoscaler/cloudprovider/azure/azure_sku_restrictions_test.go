@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/Azure/skewer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSKU(name string, restrictions ...compute.ResourceSkuRestrictions) skewer.SKU {
+	return skewer.SKU{
+		Name:         to.StringPtr(name),
+		ResourceType: to.StringPtr(string(skewer.VirtualMachines)),
+		Locations:    &[]string{"eastus"},
+		LocationInfo: &[]compute.ResourceSkuLocationInfo{
+			{Location: to.StringPtr("eastus"), Zones: &[]string{"1", "2", "3"}},
+		},
+		Restrictions: &restrictions,
+	}
+}
+
+func TestCheckSKURestrictions(t *testing.T) {
+	locationRestriction := compute.ResourceSkuRestrictions{
+		Type:   compute.Location,
+		Values: &[]string{"eastus"},
+	}
+	zoneRestriction := compute.ResourceSkuRestrictions{
+		Type:            compute.Zone,
+		Values:          &[]string{"eastus"},
+		RestrictionInfo: &compute.ResourceSkuRestrictionInfo{Zones: &[]string{"1", "2"}},
+	}
+	skus, err := skewer.NewStaticCache([]skewer.SKU{
+		newTestSKU("Standard_Unrestricted"),
+		newTestSKU("Standard_LocationRestricted", locationRestriction),
+		newTestSKU("Standard_ZoneRestricted", zoneRestriction),
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		sku           string
+		zones         []string
+		expectedError *SKURestrictedError
+	}{
+		{
+			name: "unrestricted",
+			sku:  "Standard_Unrestricted",
+		},
+		{
+			name:  "unrestricted in zones",
+			sku:   "Standard_Unrestricted",
+			zones: []string{"1", "2"},
+		},
+		{
+			name:          "restricted in location",
+			sku:           "Standard_LocationRestricted",
+			expectedError: &SKURestrictedError{SKU: "Standard_LocationRestricted", Location: "eastus"},
+		},
+		{
+			name:          "restricted in all zones",
+			sku:           "Standard_ZoneRestricted",
+			zones:         []string{"1", "2"},
+			expectedError: &SKURestrictedError{SKU: "Standard_ZoneRestricted", Location: "eastus", Zones: []string{"1", "2"}},
+		},
+		{
+			name:  "restricted in some zones",
+			sku:   "Standard_ZoneRestricted",
+			zones: []string{"1", "3"},
+		},
+		{
+			name: "unknown SKU",
+			sku:  "Standard_Unknown",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := &azureCache{skus: skus}
+			err := checkSKURestrictions(cache, tc.sku, "eastus", tc.zones)
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+
+	// Without SKU data, nothing can be checked.
+	assert.NoError(t, checkSKURestrictions(&azureCache{skus: &skewer.Cache{}}, "Standard_LocationRestricted", "eastus", nil))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/autoscaler/cluster-autoscaler/config"
+	klog "k8s.io/klog/v2"
+)
+
+var (
+	standbySnapshotMutex sync.Mutex
+	// standbySnapshot holds the resources last listed by WarmStandbyCache, until a cache takes it.
+	standbySnapshot *resourceSnapshot
+)
+
+// WarmStandbyCache lists the Azure resources every standbyCacheRefreshIntervalInSeconds until ctx is done.
+// It is meant to run on replicas waiting for leadership: the cache created once elected starts from the last
+// listed resources instead of listing them first. It returns immediately if the interval is not configured.
+func WarmStandbyCache(ctx context.Context, opts config.AutoscalingOptions) {
+	var configReader io.Reader
+	if opts.CloudConfig != "" {
+		configFile, err := os.Open(opts.CloudConfig)
+		if err != nil {
+			klog.Errorf("Couldn't open cloud provider configuration %s, not warming the Azure cache: %v", opts.CloudConfig, err)
+			return
+		}
+		defer configFile.Close()
+		configReader = configFile
+	}
+	cfg, err := BuildAzureConfigWithOverrides(configReader, opts.AzureOptions.ConfigOverrides)
+	if err != nil {
+		klog.Errorf("Failed to build Azure config, not warming the Azure cache: %v", err)
+		return
+	}
+	if cfg.StandbyCacheRefreshIntervalInSeconds == 0 {
+		return
+	}
+
+	// The resource cache server lists the same resources as the cache created once elected, without serving them here.
+	server, err := NewResourceCacheServer(cfg)
+	if err != nil {
+		klog.Errorf("Failed to create the standby Azure cache: %v", err)
+		return
+	}
+	interval := time.Duration(cfg.StandbyCacheRefreshIntervalInSeconds) * time.Second
+	klog.Infof("Warming the Azure cache of resource group %q every %v while on standby", cfg.ResourceGroup, interval)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		server.refresh(ctx)
+		if snapshot := server.snapshot(); snapshot != nil {
+			setStandbySnapshot(snapshot)
+		}
+	}, interval)
+}
+
+func setStandbySnapshot(snapshot *resourceSnapshot) {
+	standbySnapshotMutex.Lock()
+	defer standbySnapshotMutex.Unlock()
+	standbySnapshot = snapshot
+}
+
+// takeStandbySnapshot returns the resources listed on standby for resourceGroup, if not older than maxAge,
+// and forgets them: later refreshes must list resources again.
+func takeStandbySnapshot(resourceGroup string, maxAge time.Duration) *resourceSnapshot {
+	standbySnapshotMutex.Lock()
+	defer standbySnapshotMutex.Unlock()
+
+	snapshot := standbySnapshot
+	standbySnapshot = nil
+	if snapshot == nil || !strings.EqualFold(snapshot.ResourceGroup, resourceGroup) {
+		return nil
+	}
+	if age := time.Since(snapshot.RefreshedAt); age > maxAge {
+		klog.Warningf("Not using the Azure resources listed on standby %v ago", age.Round(time.Second))
+		return nil
+	}
+	return snapshot
+}
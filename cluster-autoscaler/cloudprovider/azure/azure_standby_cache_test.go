@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func TestTakeStandbySnapshot(t *testing.T) {
+	t.Cleanup(func() { setStandbySnapshot(nil) })
+
+	assert.Nil(t, takeStandbySnapshot("rg", time.Minute))
+
+	setStandbySnapshot(&resourceSnapshot{ResourceGroup: "other-rg", RefreshedAt: time.Now()})
+	assert.Nil(t, takeStandbySnapshot("rg", time.Minute))
+
+	setStandbySnapshot(&resourceSnapshot{ResourceGroup: "rg", RefreshedAt: time.Now().Add(-2 * time.Minute)})
+	assert.Nil(t, takeStandbySnapshot("rg", time.Minute))
+
+	setStandbySnapshot(&resourceSnapshot{ResourceGroup: "RG", RefreshedAt: time.Now()})
+	assert.NotNil(t, takeStandbySnapshot("rg", time.Minute))
+	// The snapshot is only used once.
+	assert.Nil(t, takeStandbySnapshot("rg", time.Minute))
+}
+
+func TestNewAzureCacheFromStandbySnapshot(t *testing.T) {
+	t.Cleanup(func() { setStandbySnapshot(nil) })
+
+	standby := &ResourceCacheServer{cache: newTestAzureManager(t).azureCache}
+	standby.refresh(context.Background())
+	setStandbySnapshot(standby.snapshot())
+
+	// The elected replica lists neither scale sets nor VMs from ARM on its first fetch.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	manager := newTestAzureManager(t)
+	manager.azClient.virtualMachineScaleSetsClient = mockvmssclient.NewMockInterface(ctrl)
+	manager.azClient.virtualMachinesClient = mockvmclient.NewMockInterface(ctrl)
+	cfg := *manager.config
+	cfg.StandbyCacheRefreshIntervalInSeconds = 60
+	cache, err := newAzureCache(manager.azClient, refreshInterval, cfg)
+	assert.NoError(t, err)
+	assert.NotNil(t, cache.standbySnapshot)
+
+	assert.NoError(t, cache.fetchAzureResources())
+	assert.Nil(t, cache.standbySnapshot)
+	assert.Contains(t, cache.getScaleSets(), testASG)
+	assert.Equal(t, standby.cache.getVirtualMachines(), cache.getVirtualMachines())
+}
@@ -0,0 +1,409 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+	kube_record "k8s.io/client-go/tools/record"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	providerStateKey  = "state.json"
+	stateStoreTimeout = 10 * time.Second
+
+	// scaleSetResizedOutOfBandReason is the reason of events about scale sets resized while no leader was running.
+	scaleSetResizedOutOfBandReason = "ScaleSetResizedOutOfBand"
+)
+
+// providerState is the state of the provider persisted across restarts and leader changes.
+type providerState struct {
+	// UnfinishedOperations are the operations still in flight when the previous leader shut down.
+	UnfinishedOperations []armOperation `json:"unfinishedOperations,omitempty"`
+	// TargetSizes are the target sizes last requested by the provider, by node group.
+	TargetSizes map[string]int64 `json:"targetSizes,omitempty"`
+}
+
+// stateStore persists the provider state in a ConfigMap, and reports on it the events about that state.
+// A nil store persists nothing.
+type stateStore struct {
+	client    kube_client.Interface
+	recorder  kube_record.EventRecorder
+	namespace string
+	name      string
+
+	// ioMutex serializes the updates of the ConfigMap.
+	ioMutex sync.Mutex
+
+	mutex       sync.Mutex
+	targetSizes map[string]int64
+	dirty       bool
+}
+
+func newStateStore(client kube_client.Interface, recorder kube_record.EventRecorder, namespace, name string) *stateStore {
+	return &stateStore{
+		client:      client,
+		recorder:    recorder,
+		namespace:   namespace,
+		name:        name,
+		targetSizes: make(map[string]int64),
+	}
+}
+
+// load returns the persisted state, empty if none.
+func (s *stateStore) load(ctx context.Context) (providerState, error) {
+	state := providerState{}
+	if s == nil {
+		return state, nil
+	}
+
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to get state ConfigMap %s/%s: %w", s.namespace, s.name, err)
+	}
+	if data := configMap.Data[providerStateKey]; data != "" {
+		if err := json.NewDecoder(strings.NewReader(data)).Decode(&state); err != nil {
+			return state, fmt.Errorf("failed to decode state ConfigMap %s/%s: %w", s.namespace, s.name, err)
+		}
+	}
+	return state, nil
+}
+
+// save persists state, creating the ConfigMap if needed.
+func (s *stateStore) save(ctx context.Context, state providerState) error {
+	if s == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = &apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{providerStateKey: string(data)},
+		}
+		_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	} else if err == nil {
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[providerStateKey] = string(data)
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save state ConfigMap %s/%s: %w", s.namespace, s.name, err)
+	}
+	klog.V(4).Infof("Saved Azure provider state to ConfigMap %s/%s", s.namespace, s.name)
+	return nil
+}
+
+// update applies fn to the persisted state and saves it.
+func (s *stateStore) update(ctx context.Context, fn func(*providerState)) error {
+	if s == nil {
+		return nil
+	}
+
+	s.ioMutex.Lock()
+	defer s.ioMutex.Unlock()
+	state, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	fn(&state)
+	return s.save(ctx, state)
+}
+
+// setTargetSize records size as the target size requested for nodeGroup, persisted on the next flush.
+func (s *stateStore) setTargetSize(nodeGroup string, size int64) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if current, found := s.targetSizes[nodeGroup]; found && current == size {
+		return
+	}
+	s.targetSizes[nodeGroup] = size
+	s.dirty = true
+}
+
+// resetTargetSizes replaces the recorded target sizes by targetSizes, persisted on the next flush even if unchanged,
+// so that the target sizes of node groups left out are forgotten.
+func (s *stateStore) resetTargetSizes(targetSizes map[string]int64) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.targetSizes = targetSizes
+	s.dirty = true
+}
+
+// flush persists the target sizes recorded since the last flush.
+func (s *stateStore) flush(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	targetSizes := make(map[string]int64, len(s.targetSizes))
+	for nodeGroup, size := range s.targetSizes {
+		targetSizes[nodeGroup] = size
+	}
+	s.dirty = false
+	s.mutex.Unlock()
+
+	err := s.update(ctx, func(state *providerState) {
+		state.TargetSizes = targetSizes
+	})
+	if err != nil {
+		s.mutex.Lock()
+		s.dirty = true
+		s.mutex.Unlock()
+	}
+	return err
+}
+
+// eventf reports an event on the state ConfigMap.
+func (s *stateStore) eventf(eventType, reason, messageFmt string, args ...interface{}) {
+	if s == nil || s.recorder == nil {
+		return
+	}
+	ref := &apiv1.ObjectReference{Kind: "ConfigMap", Namespace: s.namespace, Name: s.name, APIVersion: "v1"}
+	s.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+// flushState persists the target sizes requested since the last flush.
+func (m *AzureManager) flushState() {
+	if m.state == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateStoreTimeout)
+	defer cancel()
+	if err := m.state.flush(ctx); err != nil {
+		klog.Errorf("Failed to persist target sizes: %v", err)
+	}
+}
+
+// recordUnfinishedOperations persists the operations still in flight on shutdown, and those resumed from the
+// previous leader which didn't settle yet, for the next leader to reconcile.
+func (m *AzureManager) recordUnfinishedOperations(ops []armOperation) {
+	m.refreshEffectsMutex.Lock()
+	ops = append(ops, m.resumedOperations...)
+	m.refreshEffectsMutex.Unlock()
+	if m.state == nil || len(ops) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateStoreTimeout)
+	defer cancel()
+	err := m.state.update(ctx, func(state *providerState) {
+		state.UnfinishedOperations = ops
+	})
+	if err != nil {
+		klog.Errorf("Failed to record unfinished operations: %v", err)
+	}
+}
+
+// initState persists the provider state in the configured state ConfigMap of namespace, and reconciles the
+// state persisted by the previous leader. Metrics are registered first, so that the out of band resizes found
+// on startup are exported.
+func (m *AzureManager) initState(client kube_client.Interface, recorder kube_record.EventRecorder, namespace string) {
+	RegisterMetrics()
+	m.state = newStateStore(client, recorder, namespace, m.config.StateConfigMapName)
+	m.reconcileState()
+}
+
+// reconcileState reconciles the state persisted by the previous leader with the current state of the scale sets.
+// Capacity operations left unfinished on scale sets still updating are resumed: they are polled on every refresh
+// until the scale set settles, see pollResumedOperations. The other operations left unfinished are reported, and
+// the size of their node group refreshed. Scale sets whose capacity differs from the target size last requested,
+// while no capacity operation was left unfinished on them, were resized out of band: this is reported with a
+// warning event, and the target size last requested is kept until the provider requests another one, so that
+// the next leader reports the resize again if it still stands.
+func (m *AzureManager) reconcileState() {
+	if m.state == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateStoreTimeout)
+	defer cancel()
+	state, err := m.state.load(ctx)
+	if err != nil {
+		klog.Errorf("Failed to reconcile the Azure provider state: %v", err)
+		return
+	}
+
+	scaleSets := m.azureCache.getScaleSets()
+	unfinished := make(map[string]bool)
+	var resumed []armOperation
+	for _, op := range state.UnfinishedOperations {
+		if !op.changesCapacity() {
+			klog.Warningf("Previous leader left %v unfinished", op)
+			continue
+		}
+		unfinished[op.NodeGroup] = true
+		if vmss, found := scaleSets[op.NodeGroup]; found && scaleSetUpdating(vmss) {
+			klog.Infof("Previous leader left %v unfinished, waiting for scale set %s to finish updating", op, op.NodeGroup)
+			resumed = append(resumed, op)
+			continue
+		}
+		m.settleOperation(op, scaleSets)
+	}
+	m.resumedOperations = resumed
+
+	resizedOutOfBand := make(map[string]int64)
+	for nodeGroup, targetSize := range state.TargetSizes {
+		vmss, found := scaleSets[nodeGroup]
+		if !found || vmss.Sku == nil || vmss.Sku.Capacity == nil {
+			klog.V(2).Infof("Forgetting the target size of scale set %s, not found", nodeGroup)
+			continue
+		}
+		if capacity := *vmss.Sku.Capacity; capacity != targetSize && !unfinished[nodeGroup] {
+			klog.Warningf("Scale set %s was resized out of band to %d, the last requested target size was %d", nodeGroup, capacity, targetSize)
+			outOfBandResizes.WithLabelValues(nodeGroup).Inc()
+			m.state.eventf(apiv1.EventTypeWarning, scaleSetResizedOutOfBandReason,
+				"Scale set %s was resized out of band to %d, the last requested target size was %d", nodeGroup, capacity, targetSize)
+			resizedOutOfBand[nodeGroup] = targetSize
+		}
+	}
+
+	// Adopt the current capacity of the other registered scale sets as their target size, so that the next
+	// leader detects the resizes happening while no leader is running.
+	targetSizes := make(map[string]int64)
+	for _, nodeGroup := range m.azureCache.getRegisteredNodeGroups() {
+		if _, ok := nodeGroup.(*ScaleSet); !ok {
+			continue
+		}
+		if targetSize, found := resizedOutOfBand[nodeGroup.Id()]; found {
+			targetSizes[nodeGroup.Id()] = targetSize
+			continue
+		}
+		vmss, found := scaleSets[nodeGroup.Id()]
+		if found && vmss.Sku != nil && vmss.Sku.Capacity != nil {
+			targetSizes[nodeGroup.Id()] = *vmss.Sku.Capacity
+		}
+	}
+	m.state.resetTargetSizes(targetSizes)
+
+	err = m.state.update(ctx, func(state *providerState) {
+		state.UnfinishedOperations = resumed
+	})
+	if err != nil {
+		klog.Errorf("Failed to forget reconciled operations: %v", err)
+	}
+	m.flushState()
+}
+
+// pollResumedOperations settles the operations resumed from the previous leader whose scale set finished
+// updating, adopting its capacity as target size, and persists the remaining ones.
+func (m *AzureManager) pollResumedOperations() {
+	if len(m.resumedOperations) == 0 {
+		return
+	}
+
+	scaleSets := m.azureCache.getScaleSets()
+	var remaining []armOperation
+	for _, op := range m.resumedOperations {
+		vmss, found := scaleSets[op.NodeGroup]
+		if found && scaleSetUpdating(vmss) {
+			remaining = append(remaining, op)
+			continue
+		}
+		m.settleOperation(op, scaleSets)
+		if found && vmss.Sku != nil && vmss.Sku.Capacity != nil {
+			m.state.setTargetSize(op.NodeGroup, *vmss.Sku.Capacity)
+		}
+	}
+	if len(remaining) == len(m.resumedOperations) {
+		return
+	}
+	m.resumedOperations = remaining
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateStoreTimeout)
+	defer cancel()
+	err := m.state.update(ctx, func(state *providerState) {
+		state.UnfinishedOperations = remaining
+	})
+	if err != nil {
+		klog.Errorf("Failed to forget settled operations: %v", err)
+	}
+}
+
+// settleOperation reports the outcome of the capacity operation left unfinished by the previous leader, and
+// refreshes the size of its node group, cached before the operation settled.
+func (m *AzureManager) settleOperation(op armOperation, scaleSets map[string]compute.VirtualMachineScaleSet) {
+	vmss, found := scaleSets[op.NodeGroup]
+	switch {
+	case !found:
+		klog.Warningf("Previous leader left %v unfinished, refreshing the size of its node group", op)
+	case op.Kind != operationUpdateCapacity:
+		klog.Warningf("Previous leader left %v unfinished, instances still present will be considered again for scale-down", op)
+	case vmss.Sku == nil || vmss.Sku.Capacity == nil:
+		klog.Warningf("Previous leader left %v unfinished, scale set capacity is unknown", op)
+	case *vmss.Sku.Capacity != op.TargetSize:
+		klog.Warningf("Previous leader left %v unfinished, scale set capacity is %d", op, *vmss.Sku.Capacity)
+	default:
+		klog.Infof("Previous leader left %v unfinished, it has completed since", op)
+	}
+
+	for _, nodeGroup := range m.azureCache.getRegisteredNodeGroups() {
+		if nodeGroup.Id() != op.NodeGroup {
+			continue
+		}
+		if scaleSet, ok := nodeGroup.(*ScaleSet); ok {
+			scaleSet.invalidateLastSizeRefreshWithLock()
+		} else {
+			m.invalidateCache()
+		}
+	}
+}
+
+// scaleSetUpdating returns whether an update of vmss, such as a change of its capacity, is in progress.
+func scaleSetUpdating(vmss compute.VirtualMachineScaleSet) bool {
+	if vmss.VirtualMachineScaleSetProperties == nil {
+		return false
+	}
+	state := to.String(vmss.ProvisioningState)
+	return strings.EqualFold(state, provisioningStateUpdating) || strings.EqualFold(state, provisioningStateCreating)
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestStateStore(t *testing.T) {
+	ctx := context.Background()
+	store := newStateStore(fake.NewSimpleClientset(), nil, "kube-system", "cluster-autoscaler-azure-state")
+
+	state, err := store.load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, state.UnfinishedOperations)
+
+	state.UnfinishedOperations = []armOperation{{Kind: operationUpdateCapacity, NodeGroup: "ng", TargetSize: 3}}
+	assert.NoError(t, store.save(ctx, state))
+	state.UnfinishedOperations[0].TargetSize = 4
+	assert.NoError(t, store.save(ctx, state))
+
+	loaded, err := store.load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+}
+
+func TestRecordAndReconcileUnfinishedOperations(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestAzureManager(t)
+	manager.state = newStateStore(fake.NewSimpleClientset(), nil, "kube-system", "cluster-autoscaler-azure-state")
+	manager.operations = newOperationTracker(time.Now)
+	manager.config.ShutdownOperationTimeoutInSeconds = 1
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{testASG: {
+		Name: to.StringPtr(testASG),
+		Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(3)},
+	}}
+
+	_, err := manager.operations.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: testASG, TargetSize: 5})
+	assert.NoError(t, err)
+	manager.Cleanup()
+
+	state, err := manager.state.load(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, state.UnfinishedOperations, 1)
+	assert.Equal(t, int64(5), state.UnfinishedOperations[0].TargetSize)
+
+	manager.reconcileState()
+	state, err = manager.state.load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, state.UnfinishedOperations)
+}
+
+func TestStateStoreFlushTargetSizes(t *testing.T) {
+	ctx := context.Background()
+	store := newStateStore(fake.NewSimpleClientset(), nil, "kube-system", "cluster-autoscaler-azure-state")
+	assert.NoError(t, store.update(ctx, func(state *providerState) {
+		state.UnfinishedOperations = []armOperation{{Kind: operationUpdateCapacity, NodeGroup: "ng", TargetSize: 3}}
+	}))
+
+	store.setTargetSize("ng", 3)
+	assert.NoError(t, store.flush(ctx))
+	assert.False(t, store.dirty)
+	store.setTargetSize("ng", 3)
+	assert.False(t, store.dirty)
+
+	state, err := store.load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"ng": 3}, state.TargetSizes)
+	assert.Len(t, state.UnfinishedOperations, 1)
+}
+
+func TestReconcileStateTargetSizes(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestAzureManager(t)
+	recorder := record.NewFakeRecorder(10)
+	manager.state = newStateStore(fake.NewSimpleClientset(), recorder, "kube-system", "cluster-autoscaler-azure-state")
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		testASG: {
+			Name: to.StringPtr(testASG),
+			Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(5)},
+		},
+		"resizing-asg": {
+			Name: to.StringPtr("resizing-asg"),
+			Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(2)},
+		},
+	}
+	manager.azureCache.registeredNodeGroups = []cloudprovider.NodeGroup{newTestScaleSet(manager, testASG)}
+	assert.NoError(t, manager.state.save(ctx, providerState{
+		UnfinishedOperations: []armOperation{{Kind: operationUpdateCapacity, NodeGroup: "resizing-asg", TargetSize: 4}},
+		TargetSizes:          map[string]int64{testASG: 3, "resizing-asg": 4, "deleted-asg": 1},
+	}))
+
+	manager.reconcileState()
+	assert.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.Contains(t, event, scaleSetResizedOutOfBandReason)
+	assert.Contains(t, event, testASG)
+
+	// The out of band resize is not adopted, until the provider requests another target size.
+	state, err := manager.state.load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, state.UnfinishedOperations)
+	assert.Equal(t, map[string]int64{testASG: 3}, state.TargetSizes)
+
+	manager.state.setTargetSize(testASG, 6)
+	manager.flushState()
+	state, err = manager.state.load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{testASG: 6}, state.TargetSizes)
+}
+
+func TestInitStateExportsOutOfBandResizes(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestAzureManager(t)
+	client := fake.NewSimpleClientset()
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		"startup-asg": {
+			Name: to.StringPtr("startup-asg"),
+			Sku:  &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(5)},
+		},
+	}
+	previous := newStateStore(client, nil, "kube-system", "cluster-autoscaler-azure-state")
+	assert.NoError(t, previous.save(ctx, providerState{TargetSizes: map[string]int64{"startup-asg": 3}}))
+
+	manager.config.StateConfigMapName = "cluster-autoscaler-azure-state"
+	manager.initState(client, record.NewFakeRecorder(10), "kube-system")
+	assert.Equal(t, 1.0, gatheredValue(t, "azure_out_of_band_resizes_total", map[string]string{"node_group": "startup-asg"}))
+}
+
+func TestReconcileStateResumesOperations(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestAzureManager(t)
+	recorder := record.NewFakeRecorder(10)
+	manager.state = newStateStore(fake.NewSimpleClientset(), recorder, "kube-system", "cluster-autoscaler-azure-state")
+	scaleSet := func(name, provisioningState string, capacity int64) compute.VirtualMachineScaleSet {
+		return compute.VirtualMachineScaleSet{
+			Name:                             to.StringPtr(name),
+			Sku:                              &compute.Sku{Name: to.StringPtr("Standard_D4s_v3"), Capacity: to.Int64Ptr(capacity)},
+			VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{ProvisioningState: to.StringPtr(provisioningState)},
+		}
+	}
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		testASG:        scaleSet(testASG, provisioningStateSucceeded, 5),
+		"resizing-asg": scaleSet("resizing-asg", provisioningStateUpdating, 2),
+	}
+	resizing := armOperation{Kind: operationUpdateCapacity, NodeGroup: "resizing-asg", TargetSize: 4}
+	assert.NoError(t, manager.state.save(ctx, providerState{
+		UnfinishedOperations: []armOperation{resizing, {Kind: operationUpdateTags, NodeGroup: testASG}},
+		TargetSizes:          map[string]int64{testASG: 3, "resizing-asg": 4},
+	}))
+
+	manager.reconcileState()
+	assert.Len(t, recorder.Events, 1, "unfinished tag updates don't hide out of band resizes")
+	assert.Contains(t, <-recorder.Events, testASG)
+	assert.Equal(t, []armOperation{resizing}, manager.resumedOperations)
+	state, err := manager.state.load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []armOperation{resizing}, state.UnfinishedOperations, "resumed operations are kept for the next leader")
+
+	// The operation is polled until the scale set is updated.
+	manager.pollResumedOperations()
+	assert.Equal(t, []armOperation{resizing}, manager.resumedOperations)
+
+	manager.azureCache.scaleSets["resizing-asg"] = scaleSet("resizing-asg", provisioningStateSucceeded, 4)
+	manager.pollResumedOperations()
+	assert.Empty(t, manager.resumedOperations)
+	state, err = manager.state.load(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, state.UnfinishedOperations)
+	assert.Equal(t, int64(4), manager.state.targetSizes["resizing-asg"])
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// stockoutHistoryWindow is how long a stockout of a node group is reported on its node infos.
+	stockoutHistoryWindow = 30 * time.Minute
+	// lastStockoutAnnotationKey is set on node infos to the RFC3339 time of the last stockout of their node group,
+	// so that expanders can steer away from node groups which recently lacked capacity.
+	lastStockoutAnnotationKey = "cluster-autoscaler.kubernetes.io/azure-last-stockout"
+)
+
+// stockoutHistory keeps the time of the last stockout of each node group. The zero value is ready to use.
+type stockoutHistory struct {
+	mutex         sync.Mutex
+	lastStockouts map[string]time.Time
+}
+
+func (h *stockoutHistory) record(nodeGroup string, at time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.lastStockouts == nil {
+		h.lastStockouts = make(map[string]time.Time)
+	}
+	h.lastStockouts[nodeGroup] = at
+}
+
+// last returns the time of the last stockout of the node group, if within stockoutHistoryWindow of now.
+func (h *stockoutHistory) last(nodeGroup string, now time.Time) (time.Time, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	at, found := h.lastStockouts[nodeGroup]
+	if !found || now.Sub(at) > stockoutHistoryWindow {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// recordStockout records a stockout of the node group if err is caused by lack of capacity or quota.
+func (m *AzureManager) recordStockout(nodeGroup string, err error) {
+	if isOutOfResourcesError(err) {
+		m.stockouts.record(nodeGroup, time.Now())
+		m.health.record(nodeGroup, failureStockout, time.Now())
+	}
+}
+
+// annotateLastStockout sets the time of the last stockout of the node group on the node.
+func (m *AzureManager) annotateLastStockout(nodeGroup string, node *apiv1.Node) {
+	at, found := m.stockouts.last(nodeGroup, time.Now())
+	if !found {
+		return
+	}
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[lastStockoutAnnotationKey] = at.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestStockoutHistory(t *testing.T) {
+	manager := newTestAzureManager(t)
+
+	manager.recordStockout(testASG, &azure.ServiceError{Code: "InternalServerError"})
+	manager.recordStockout(testASG, &azure.ServiceError{Code: "InternalServerError", Message: "not a ZonalAllocationFailed"})
+	node := &apiv1.Node{}
+	manager.annotateLastStockout(testASG, node)
+	assert.Empty(t, node.Annotations, "only out of resources error codes are stockouts")
+
+	manager.recordStockout(testASG, &azure.ServiceError{Code: "ZonalAllocationFailed"})
+	manager.annotateLastStockout(testASG, node)
+	at, err := time.Parse(time.RFC3339, node.Annotations[lastStockoutAnnotationKey])
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), at, time.Minute)
+
+	_, found := manager.stockouts.last(testASG, time.Now().Add(stockoutHistoryWindow+time.Minute))
+	assert.False(t, found, "stockouts expire after the history window")
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/azure"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	tagsFieldName = "tags"
+
+	// invalidTagNameCharacters are the characters Azure refuses in tag names.
+	invalidTagNameCharacters = "<>%&\\?/"
+
+	// aksManagedTagPrefix prefixes the tags AKS sets on the scale sets it manages.
+	aksManagedTagPrefix = "aks-managed-"
+
+	// tagUpdateInitialBackoff is how long a scale set isn't updated with the propagated tags after a failed update,
+	// doubling on every consecutive failure up to tagUpdateMaxBackoff.
+	tagUpdateInitialBackoff = time.Minute
+	tagUpdateMaxBackoff     = 30 * time.Minute
+)
+
+// tagUpdateState tracks the updates of the propagated tags of a scale set. The zero value is ready to use.
+type tagUpdateState struct {
+	mutex      sync.Mutex
+	inFlight   bool
+	failures   int
+	retryAfter time.Time
+}
+
+// begin returns whether a tag update can be started at now, and marks it in flight if so.
+func (s *tagUpdateState) begin(now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.inFlight || now.Before(s.retryAfter) {
+		return false
+	}
+	s.inFlight = true
+	return true
+}
+
+// end records the outcome of the tag update in flight, backing off further updates if it failed.
+func (s *tagUpdateState) end(now time.Time, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inFlight = false
+	if !failed {
+		s.failures = 0
+		s.retryAfter = time.Time{}
+		return
+	}
+	backoff := tagUpdateInitialBackoff << s.failures
+	if backoff <= 0 || backoff > tagUpdateMaxBackoff {
+		backoff = tagUpdateMaxBackoff
+	} else {
+		s.failures++
+	}
+	s.retryAfter = now.Add(backoff)
+}
+
+// parsePropagatedTags parses propagated tags from a comma separated list of key=value pairs.
+func parsePropagatedTags(value string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, tagValue, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("propagated tag %q is not a key=value pair", pair)
+		}
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(tagValue)
+	}
+	return tags, nil
+}
+
+func validatePropagatedTags(tags map[string]string) error {
+	for key := range tags {
+		if key == "" {
+			return fmt.Errorf("propagatedTags must not contain empty tag names")
+		}
+		if strings.ContainsAny(key, invalidTagNameCharacters) {
+			return fmt.Errorf("propagated tag name %q must not contain any of %q", key, invalidTagNameCharacters)
+		}
+	}
+	return nil
+}
+
+// missingPropagatedTags returns the propagated tags absent from tags, or set to another value. Tag names are
+// compared case-insensitively, like Azure does.
+func missingPropagatedTags(propagated map[string]string, tags map[string]*string) map[string]string {
+	missing := make(map[string]string)
+	for key, value := range propagated {
+		current, found := lookupTag(tags, key)
+		if !found || current == nil || *current != value {
+			missing[key] = value
+		}
+	}
+	return missing
+}
+
+// withPropagatedTags returns a copy of tags with the propagated tags set, replacing the tags of the same name.
+func withPropagatedTags(tags map[string]*string, propagated map[string]string) map[string]*string {
+	merged := make(map[string]*string, len(tags)+len(propagated))
+	for key, value := range tags {
+		merged[key] = value
+	}
+	for key, value := range propagated {
+		for existing := range merged {
+			if strings.EqualFold(existing, key) {
+				delete(merged, existing)
+			}
+		}
+		value := value
+		merged[key] = &value
+	}
+	return merged
+}
+
+func lookupTag(tags map[string]*string, key string) (*string, bool) {
+	if value, found := tags[key]; found {
+		return value, true
+	}
+	for name, value := range tags {
+		if strings.EqualFold(name, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// applyPropagatedTagsToTemplate sets the propagated tags on the VMs of an agent pool deployment template,
+// so that the VMs created by scale-ups are tagged at creation time.
+func applyPropagatedTagsToTemplate(templateMap map[string]interface{}, propagated map[string]string) {
+	if len(propagated) == 0 {
+		return
+	}
+	resources, _ := templateMap[resourcesFieldName].([]interface{})
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if resourceType, _ := resourceMap[typeFieldName].(string); !strings.EqualFold(resourceType, vmResourceType) {
+			continue
+		}
+		tags, ok := resourceMap[tagsFieldName].(map[string]interface{})
+		if !ok {
+			tags = make(map[string]interface{})
+			resourceMap[tagsFieldName] = tags
+		}
+		for key, value := range propagated {
+			for existing := range tags {
+				if strings.EqualFold(existing, key) {
+					delete(tags, existing)
+				}
+			}
+			tags[key] = value
+		}
+	}
+}
+
+// isAKSManagedScaleSet returns whether the scale set is managed by AKS, which reconciles its tags from its agent pool.
+func isAKSManagedScaleSet(vmss compute.VirtualMachineScaleSet) bool {
+	for key := range vmss.Tags {
+		if strings.HasPrefix(strings.ToLower(key), aksManagedTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensurePropagatedTags restores the propagated tags on the registered scale sets missing them, typically because
+// they were removed out of band. Drifts are reported by the azure_tag_drifts_total metric. Scale sets managed by AKS
+// are left alone, as AKS would revert their tags. A scale set is only updated once its previous update completed,
+// and updates failing are backed off per scale set.
+func (m *AzureManager) ensurePropagatedTags() {
+	if len(m.config.PropagatedTags) == 0 {
+		return
+	}
+	scaleSets := m.azureCache.getScaleSets()
+	for _, nodeGroup := range m.azureCache.getRegisteredNodeGroups() {
+		scaleSet, ok := nodeGroup.(*ScaleSet)
+		if !ok {
+			continue
+		}
+		vmss, found := scaleSet.cachedModel(scaleSets)
+		if !found || isAKSManagedScaleSet(vmss) {
+			continue
+		}
+		missing := missingPropagatedTags(m.config.PropagatedTags, vmss.Tags)
+		if len(missing) == 0 {
+			continue
+		}
+		if !scaleSet.tagUpdate.begin(time.Now()) {
+			klog.V(4).Infof("Scale set %s is missing propagated tags %s, its tag update is in progress or backed off", scaleSet.Name, formatTags(missing))
+			continue
+		}
+		klog.Warningf("Scale set %s is missing propagated tags %s, restoring them", scaleSet.Name, formatTags(missing))
+		tagDrifts.WithLabelValues(scaleSet.Name).Inc()
+		if err := scaleSet.setTags(vmss, missing); err != nil {
+			klog.Errorf("Failed to restore propagated tags of scale set %s: %v", scaleSet.Name, err)
+			scaleSet.tagUpdate.end(time.Now(), true)
+		}
+	}
+}
+
+// setTags starts setting the given tags on the scale set, keeping its other tags, and leaving its capacity and model
+// untouched. The update is waited for in the background, and its outcome recorded in the tag update state.
+func (scaleSet *ScaleSet) setTags(vmss compute.VirtualMachineScaleSet, tags map[string]string) error {
+	if scaleSet.manager.dryRun(operationUpdateTags, scaleSet.Name, "set tags %s", formatTags(tags)) {
+		scaleSet.tagUpdate.end(time.Now(), false)
+		return nil
+	}
+	done, err := scaleSet.manager.operations.start(armOperation{Kind: operationUpdateTags, NodeGroup: scaleSet.Name})
+	if err != nil {
+		return err
+	}
+	future, err := scaleSet.updateTagsAsync(vmss, withPropagatedTags(vmss.Tags, tags))
+	scaleSet.manager.recordMutation(operationUpdateTags, scaleSet.Name, err, "set tags %s", formatTags(tags))
+	if err != nil {
+		done()
+		return err
+	}
+
+	go func() {
+		defer done()
+		ctx, cancel := getContextWithTimeout(asyncContextTimeout)
+		defer cancel()
+		httpResponse, err := scaleSet.manager.azClient.virtualMachineScaleSetsClient.WaitForCreateOrUpdateResult(ctx, future, scaleSet.resourceGroupName())
+		isSuccess, err := isSuccessHTTPResponse(httpResponse, err)
+		if !isSuccess {
+			klog.Errorf("Failed to restore propagated tags of scale set %s: %v", scaleSet.Name, err)
+		}
+		scaleSet.tagUpdate.end(time.Now(), !isSuccess)
+	}()
+	return nil
+}
+
+// updateTagsAsync starts replacing the tags of the scale set with tags. It holds the size mutex while the request is
+// issued, so that it is serialized with the capacity updates of the scale set.
+func (scaleSet *ScaleSet) updateTagsAsync(vmss compute.VirtualMachineScaleSet, tags map[string]*string) (*azure.Future, error) {
+	scaleSet.sizeMutex.Lock()
+	defer scaleSet.sizeMutex.Unlock()
+
+	op := compute.VirtualMachineScaleSet{
+		Name:     vmss.Name,
+		Location: vmss.Location,
+		Tags:     tags,
+	}
+	if vmss.ExtendedLocation != nil {
+		op.ExtendedLocation = &compute.ExtendedLocation{
+			Name: vmss.ExtendedLocation.Name,
+			Type: vmss.ExtendedLocation.Type,
+		}
+	}
+
+	ctx, cancel := getContextWithTimeout(vmssContextTimeout)
+	defer cancel()
+	future, rerr := scaleSet.manager.azClient.virtualMachineScaleSetsClient.CreateOrUpdateAsync(ctx, scaleSet.resourceGroupName(), scaleSet.Name, op)
+	scaleSet.manager.azureCache.callQueue.observe(rerr, time.Now())
+	scaleSet.manager.recordThrottling(scaleSet.Name, rerr)
+	if rerr != nil {
+		return nil, rerr.Error()
+	}
+	return future, nil
+}
+
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func TestParsePropagatedTags(t *testing.T) {
+	tags, err := parsePropagatedTags("costCenter=42, owner = team-a,,expiry=")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"costCenter": "42", "owner": "team-a", "expiry": ""}, tags)
+
+	_, err = parsePropagatedTags("costCenter")
+	assert.Error(t, err)
+
+	assert.NoError(t, validatePropagatedTags(tags))
+	assert.Error(t, validatePropagatedTags(map[string]string{"": "42"}))
+	assert.Error(t, validatePropagatedTags(map[string]string{"cost/center": "42"}))
+}
+
+func TestMissingPropagatedTags(t *testing.T) {
+	propagated := map[string]string{"costCenter": "42", "owner": "team-a"}
+	assert.Equal(t, propagated, missingPropagatedTags(propagated, nil))
+	assert.Equal(t, map[string]string{"owner": "team-a"}, missingPropagatedTags(propagated, map[string]*string{
+		"CostCenter": to.StringPtr("42"),
+		"owner":      to.StringPtr("team-b"),
+	}))
+	assert.Empty(t, missingPropagatedTags(propagated, map[string]*string{
+		"costCenter": to.StringPtr("42"),
+		"owner":      to.StringPtr("team-a"),
+		"other":      to.StringPtr("value"),
+	}))
+
+	merged := withPropagatedTags(map[string]*string{"OWNER": to.StringPtr("team-b"), "other": to.StringPtr("value")}, propagated)
+	assert.Equal(t, map[string]*string{
+		"costCenter": to.StringPtr("42"),
+		"owner":      to.StringPtr("team-a"),
+		"other":      to.StringPtr("value"),
+	}, merged)
+}
+
+func TestApplyPropagatedTagsToTemplate(t *testing.T) {
+	templateMap := map[string]interface{}{
+		resourcesFieldName: []interface{}{
+			map[string]interface{}{typeFieldName: vmResourceType, tagsFieldName: map[string]interface{}{"Owner": "team-b", "poolName": "agentpool1"}},
+			map[string]interface{}{typeFieldName: "Microsoft.Network/networkInterfaces"},
+		},
+	}
+	applyPropagatedTagsToTemplate(templateMap, map[string]string{"owner": "team-a"})
+
+	resources := templateMap[resourcesFieldName].([]interface{})
+	assert.Equal(t, map[string]interface{}{"owner": "team-a", "poolName": "agentpool1"}, resources[0].(map[string]interface{})[tagsFieldName])
+	assert.NotContains(t, resources[1], tagsFieldName)
+}
+
+func TestEnsurePropagatedTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	manager.config.PropagatedTags = map[string]string{"owner": "team-a"}
+	scaleSet := newTestScaleSet(manager, testASG)
+	manager.azureCache.registeredNodeGroups = []cloudprovider.NodeGroup{scaleSet}
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		testASG: {Name: to.StringPtr(testASG), Location: to.StringPtr("eastus"), Tags: map[string]*string{"poolName": to.StringPtr("pool")}},
+	}
+
+	release := make(chan error)
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	mockVMSSClient.EXPECT().CreateOrUpdateAsync(gomock.Any(), manager.config.ResourceGroup, testASG, compute.VirtualMachineScaleSet{
+		Name:     to.StringPtr(testASG),
+		Location: to.StringPtr("eastus"),
+		Tags:     map[string]*string{"poolName": to.StringPtr("pool"), "owner": to.StringPtr("team-a")},
+	}).Return(nil, nil).Times(2)
+	mockVMSSClient.EXPECT().WaitForCreateOrUpdateResult(gomock.Any(), gomock.Any(), manager.config.ResourceGroup).DoAndReturn(
+		func(context.Context, *azure.Future, string) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK}, <-release
+		}).Times(2)
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	tagUpdateDone := func() bool {
+		scaleSet.tagUpdate.mutex.Lock()
+		defer scaleSet.tagUpdate.mutex.Unlock()
+		return !scaleSet.tagUpdate.inFlight
+	}
+
+	manager.ensurePropagatedTags()
+	// The scale set isn't updated again while its update is in progress.
+	manager.ensurePropagatedTags()
+	release <- fmt.Errorf("update failed")
+	assert.Eventually(t, tagUpdateDone, 5*time.Second, 10*time.Millisecond)
+	// Failed updates are backed off.
+	manager.ensurePropagatedTags()
+	scaleSet.tagUpdate.mutex.Lock()
+	scaleSet.tagUpdate.retryAfter = time.Now()
+	scaleSet.tagUpdate.mutex.Unlock()
+	manager.ensurePropagatedTags()
+	release <- nil
+	assert.Eventually(t, tagUpdateDone, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, scaleSet.tagUpdate.failures)
+
+	// Up to date scale sets are left alone.
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		testASG: {Name: to.StringPtr(testASG), Tags: map[string]*string{"owner": to.StringPtr("team-a")}},
+	}
+	manager.ensurePropagatedTags()
+
+	// So are scale sets managed by AKS.
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{
+		testASG: {Name: to.StringPtr(testASG), Tags: map[string]*string{"aks-managed-poolName": to.StringPtr("pool")}},
+	}
+	manager.ensurePropagatedTags()
+
+	// Drifts are only logged in dry run mode.
+	manager.config.DryRun = true
+	manager.azureCache.scaleSets = map[string]compute.VirtualMachineScaleSet{testASG: {Name: to.StringPtr(testASG)}}
+	manager.ensurePropagatedTags()
+}
+
+func TestTagUpdateBackoff(t *testing.T) {
+	now := time.Now()
+	state := tagUpdateState{}
+	assert.True(t, state.begin(now))
+	assert.False(t, state.begin(now), "a single update is in flight")
+
+	state.end(now, true)
+	assert.False(t, state.begin(now.Add(tagUpdateInitialBackoff-time.Second)))
+	assert.True(t, state.begin(now.Add(tagUpdateInitialBackoff)))
+	state.end(now, true)
+	assert.False(t, state.begin(now.Add(2*tagUpdateInitialBackoff-time.Second)), "backoff doubles on consecutive failures")
+	for i := 0; i < 10; i++ {
+		state.end(now, true)
+	}
+	assert.True(t, state.begin(now.Add(tagUpdateMaxBackoff)))
+
+	state.end(now, false)
+	assert.True(t, state.begin(now), "a successful update resets the backoff")
+}
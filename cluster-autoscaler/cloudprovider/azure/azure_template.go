@@ -30,6 +30,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/utils/gpu"
 	"k8s.io/klog/v2"
@@ -84,6 +85,28 @@ const (
 
 	// Cluster node label
 	clusterLabelKey = AKSLabelKeyPrefixValue + "cluster"
+
+	// Placement node labels, set to the name of the proximity placement group, dedicated host group and
+	// capacity reservation group of the nodes. Their prefix is configurable, and defaults to a prefix not reserved by
+	// AKS, as the nodes have to be given the same labels.
+	defaultPlacementLabelPrefix       = "placement.cluster-autoscaler.azure/"
+	proximityPlacementGroupLabelName  = "proximity-placement-group"
+	hostGroupLabelName                = "host-group"
+	capacityReservationGroupLabelName = "capacity-reservation-group"
+)
+
+const (
+	networkPluginKubenet = "kubenet"
+	networkPluginAzure   = "azure"
+	networkPluginNone    = "none"
+
+	networkPluginModeOverlay = "overlay"
+
+	// defaultMaxPods is the kubelet default, used unless the network plugin or the node group sets another one.
+	defaultMaxPods = 110
+	// Default max pods of AKS nodes using Azure CNI, with pod IPs from the node subnet or from an overlay network.
+	defaultAzureCNIMaxPods        = 30
+	defaultAzureCNIOverlayMaxPods = 250
 )
 
 // VMPoolNodeTemplate holds properties for node from VMPool
@@ -100,6 +123,8 @@ type VMSSNodeTemplate struct {
 	InputTaints string
 	Tags        map[string]*string
 	OSDisk      *compute.VirtualMachineScaleSetOSDisk
+	// LaunchConfigHash is the hash of the extensions and image of the scale set model.
+	LaunchConfigHash string
 }
 
 // NodeTemplate represents a template for an Azure node
@@ -108,8 +133,29 @@ type NodeTemplate struct {
 	InstanceOS         string
 	Location           string
 	Zones              []string
+	Spot               bool
 	VMPoolNodeTemplate *VMPoolNodeTemplate
 	VMSSNodeTemplate   *VMSSNodeTemplate
+
+	// MaxPods is the max number of pods of the nodes, if set by the node group.
+	MaxPods *int64
+
+	// ProximityPlacementGroup, HostGroup and CapacityReservationGroup are the resource IDs of the groups the nodes
+	// are placed in, if any.
+	ProximityPlacementGroup  string
+	HostGroup                string
+	CapacityReservationGroup string
+
+	// PlacementLabelPrefix is the prefix of the placement labels, defaultPlacementLabelPrefix if empty.
+	PlacementLabelPrefix string
+}
+
+// placementLabelKey returns the key of the placement label name.
+func (template NodeTemplate) placementLabelKey(name string) string {
+	if template.PlacementLabelPrefix == "" {
+		return defaultPlacementLabelPrefix + name
+	}
+	return template.PlacementLabelPrefix + name
 }
 
 func buildNodeTemplateFromVMSS(vmss compute.VirtualMachineScaleSet, inputLabels map[string]string, inputTaints string) (NodeTemplate, error) {
@@ -140,17 +186,39 @@ func buildNodeTemplateFromVMSS(vmss compute.VirtualMachineScaleSet, inputLabels
 		zones = *vmss.Zones
 	}
 
+	var proximityPlacementGroup, hostGroup, capacityReservationGroup string
+	if properties := vmss.VirtualMachineScaleSetProperties; properties != nil {
+		if properties.ProximityPlacementGroup != nil {
+			proximityPlacementGroup = to.String(properties.ProximityPlacementGroup.ID)
+		}
+		if properties.HostGroup != nil {
+			hostGroup = to.String(properties.HostGroup.ID)
+		}
+		if properties.VirtualMachineProfile != nil &&
+			properties.VirtualMachineProfile.CapacityReservation != nil &&
+			properties.VirtualMachineProfile.CapacityReservation.CapacityReservationGroup != nil {
+			capacityReservationGroup = to.String(properties.VirtualMachineProfile.CapacityReservation.CapacityReservationGroup.ID)
+		}
+	}
+
 	return NodeTemplate{
 		SkuName: *vmss.Sku.Name,
 
 		Location:   *vmss.Location,
 		Zones:      zones,
 		InstanceOS: instanceOS,
+		Spot:       isSpot(&vmss),
+
+		ProximityPlacementGroup:  proximityPlacementGroup,
+		HostGroup:                hostGroup,
+		CapacityReservationGroup: capacityReservationGroup,
 		VMSSNodeTemplate: &VMSSNodeTemplate{
 			InputLabels: inputLabels,
 			InputTaints: inputTaints,
 			OSDisk:      osDisk,
 			Tags:        vmss.Tags,
+
+			LaunchConfigHash: launchConfigHash(vmss),
 		},
 	}, nil
 }
@@ -197,11 +265,22 @@ func buildNodeTemplateFromVMPool(vmsPool armcontainerservice.AgentPool, location
 		instanceOS = strings.ToLower(string(*vmsPool.Properties.OSType))
 	}
 
+	var maxPods *int64
+	if vmsPool.Properties.MaxPods != nil {
+		maxPods = to.Int64Ptr(int64(*vmsPool.Properties.MaxPods))
+	}
+
 	return NodeTemplate{
 		SkuName:    skuName,
 		Zones:      zones,
 		InstanceOS: instanceOS,
 		Location:   location,
+		MaxPods:    maxPods,
+		Spot: vmsPool.Properties.ScaleSetPriority != nil &&
+			*vmsPool.Properties.ScaleSetPriority == armcontainerservice.ScaleSetPrioritySpot,
+		ProximityPlacementGroup:  to.String(vmsPool.Properties.ProximityPlacementGroupID),
+		HostGroup:                to.String(vmsPool.Properties.HostGroupID),
+		CapacityReservationGroup: to.String(vmsPool.Properties.CapacityReservationGroupID),
 		VMPoolNodeTemplate: &VMPoolNodeTemplate{
 			AgentPoolName: to.String(vmsPool.Name),
 			OSDiskType:    vmsPool.Properties.OSDiskType,
@@ -256,7 +335,14 @@ func buildNodeFromTemplate(nodeGroupName string, template NodeTemplate, manager
 		}
 	}
 
-	node.Status.Capacity[apiv1.ResourcePods] = *resource.NewQuantity(110, resource.DecimalSI)
+	var config *Config
+	if manager != nil {
+		config = manager.config
+	}
+	if config != nil {
+		template.PlacementLabelPrefix = config.PlacementLabelPrefix
+	}
+	node.Status.Capacity[apiv1.ResourcePods] = *resource.NewQuantity(templateMaxPods(template, config), resource.DecimalSI)
 	node.Status.Capacity[apiv1.ResourceCPU] = *resource.NewQuantity(vcpu, resource.DecimalSI)
 	// isNPSeries returns if a SKU is an NP-series SKU
 	// SKU API reports GPUs for NP-series but it's actually FPGAs
@@ -279,12 +365,44 @@ func buildNodeFromTemplate(nodeGroupName string, template NodeTemplate, manager
 		return nil, fmt.Errorf("invalid node template: missing both VMSS and VMPool templates")
 	}
 
+	if template.Spot {
+		node.Labels[spotPriorityNodeLabelKey] = spotPriorityNodeLabelValue
+	}
+	now := time.Now()
+	if cost, err := (&AzurePriceModel{}).NodePrice(&node, now, now.Add(time.Hour)); err == nil {
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		node.Annotations[hourlyCostAnnotationKey] = strconv.FormatFloat(cost, 'f', 4, 64)
+	}
+	if template.VMSSNodeTemplate != nil && template.VMSSNodeTemplate.LaunchConfigHash != "" {
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		node.Annotations[launchConfigHashAnnotationKey] = template.VMSSNodeTemplate.LaunchConfigHash
+	}
+
 	klog.V(4).Infof("Setting node %s labels to: %s", nodeName, node.Labels)
 	klog.V(4).Infof("Setting node %s taints to: %s", nodeName, node.Spec.Taints)
 	node.Status.Conditions = cloudprovider.BuildReadyConditions()
 	return &node, nil
 }
 
+// templateMaxPods returns the max number of pods of template nodes: the one of the node group if set,
+// else the default of the configured network plugin. Scale set nodes can override it with a resources tag.
+func templateMaxPods(template NodeTemplate, config *Config) int64 {
+	if template.MaxPods != nil {
+		return *template.MaxPods
+	}
+	if config != nil && strings.EqualFold(config.NetworkPlugin, networkPluginAzure) {
+		if strings.EqualFold(config.NetworkPluginMode, networkPluginModeOverlay) {
+			return defaultAzureCNIOverlayMaxPods
+		}
+		return defaultAzureCNIMaxPods
+	}
+	return defaultMaxPods
+}
+
 func processVMPoolTemplate(template NodeTemplate, nodeName string, node apiv1.Node) apiv1.Node {
 	labels := buildGenericLabels(template, nodeName)
 	labels[agentPoolNodeLabelKey] = template.VMPoolNodeTemplate.AgentPoolName
@@ -420,10 +538,28 @@ func buildGenericLabels(template NodeTemplate, nodeName string) map[string]strin
 		result[azureDiskTopologyKey] = ""
 	}
 
+	setPlacementGroupLabel(result, template.placementLabelKey(proximityPlacementGroupLabelName), template.ProximityPlacementGroup)
+	setPlacementGroupLabel(result, template.placementLabelKey(hostGroupLabelName), template.HostGroup)
+	setPlacementGroupLabel(result, template.placementLabelKey(capacityReservationGroupLabelName), template.CapacityReservationGroup)
+
 	result[apiv1.LabelHostname] = nodeName
 	return result
 }
 
+// setPlacementGroupLabel sets the label to the name of the group of resource ID groupID, unless the node is in no
+// such group or the name is not a valid label value, e.g. longer than 63 characters.
+func setPlacementGroupLabel(labels map[string]string, key, groupID string) {
+	if groupID == "" {
+		return
+	}
+	name := groupID[strings.LastIndex(groupID, "/")+1:]
+	if errs := validation.IsValidLabelValue(name); len(errs) > 0 {
+		klog.V(4).Infof("Not setting label %s to %q: %s", key, name, strings.Join(errs, ", "))
+		return
+	}
+	labels[key] = name
+}
+
 func extractLabelsFromTags(tags map[string]*string) map[string]string {
 	result := make(map[string]string)
 
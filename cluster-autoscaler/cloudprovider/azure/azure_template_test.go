@@ -18,6 +18,7 @@ package azure
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -197,6 +198,93 @@ func TestTopologyFromScaleSet(t *testing.T) {
 	assert.Contains(t, expectedZoneValues, azureDiskTopology)
 }
 
+func TestPlacementGroupLabelsFromScaleSet(t *testing.T) {
+	groupID := func(provider, name string) string {
+		return "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/" + provider + "/" + name
+	}
+	testVmss := compute.VirtualMachineScaleSet{
+		Sku: &compute.Sku{Name: to.StringPtr("Standard_D2_v2")},
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+			ProximityPlacementGroup: &compute.SubResource{ID: to.StringPtr(groupID("proximityPlacementGroups", "ppg1"))},
+			HostGroup:               &compute.SubResource{ID: to.StringPtr(groupID("hostGroups", strings.Repeat("h", 64)))},
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+				CapacityReservation: &compute.CapacityReservationProfile{
+					CapacityReservationGroup: &compute.SubResource{ID: to.StringPtr(groupID("capacityReservationGroups", "crg1"))},
+				},
+			},
+		},
+		Location: to.StringPtr("westus"),
+	}
+	proximityPlacementGroupLabelKey := defaultPlacementLabelPrefix + proximityPlacementGroupLabelName
+	hostGroupLabelKey := defaultPlacementLabelPrefix + hostGroupLabelName
+	capacityReservationGroupLabelKey := defaultPlacementLabelPrefix + capacityReservationGroupLabelName
+	template, err := buildNodeTemplateFromVMSS(testVmss, map[string]string{}, "")
+	assert.NoError(t, err)
+	labels := buildGenericLabels(template, "test-node")
+	assert.Equal(t, "ppg1", labels[proximityPlacementGroupLabelKey])
+	assert.Equal(t, "crg1", labels[capacityReservationGroupLabelKey])
+	assert.NotContains(t, labels, hostGroupLabelKey, "names too long for a label value are left out")
+
+	// explicit labels take precedence.
+	template, err = buildNodeTemplateFromVMSS(testVmss, map[string]string{proximityPlacementGroupLabelKey: "custom"}, "")
+	assert.NoError(t, err)
+	node, err := buildNodeFromTemplate("vmss", template, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "custom", node.Labels[proximityPlacementGroupLabelKey])
+	assert.Equal(t, "crg1", node.Labels[capacityReservationGroupLabelKey])
+
+	// the prefix is configurable.
+	manager := newTestAzureManager(t)
+	manager.config.PlacementLabelPrefix = "example.com/"
+	node, err = buildNodeFromTemplate("vmss", template, manager, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "crg1", node.Labels["example.com/"+capacityReservationGroupLabelName])
+	assert.NotContains(t, node.Labels, capacityReservationGroupLabelKey)
+
+	template, err = buildNodeTemplateFromVMSS(compute.VirtualMachineScaleSet{
+		Sku: &compute.Sku{Name: to.StringPtr("Standard_D2_v2")},
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{}},
+		Location: to.StringPtr("westus"),
+	}, map[string]string{}, "")
+	assert.NoError(t, err)
+	labels = buildGenericLabels(template, "test-node")
+	assert.NotContains(t, labels, proximityPlacementGroupLabelKey)
+	assert.NotContains(t, labels, hostGroupLabelKey)
+	assert.NotContains(t, labels, capacityReservationGroupLabelKey)
+}
+
+func TestBuildNodeFromTemplateSpotAndHourlyCost(t *testing.T) {
+	newVMSS := func(priority compute.VirtualMachinePriorityTypes) compute.VirtualMachineScaleSet {
+		return compute.VirtualMachineScaleSet{
+			Sku: &compute.Sku{Name: to.StringPtr("Standard_D2_v2")},
+			VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+				VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{Priority: priority}},
+			Location: to.StringPtr("westus"),
+		}
+	}
+
+	onDemandTemplate, err := buildNodeTemplateFromVMSS(newVMSS(compute.Regular), map[string]string{}, "")
+	assert.NoError(t, err)
+	assert.False(t, onDemandTemplate.Spot)
+	onDemand, err := buildNodeFromTemplate("ondemand", onDemandTemplate, nil, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, onDemand.Labels, spotPriorityNodeLabelKey)
+
+	spotTemplate, err := buildNodeTemplateFromVMSS(newVMSS(compute.Spot), map[string]string{}, "")
+	assert.NoError(t, err)
+	assert.True(t, spotTemplate.Spot)
+	spot, err := buildNodeFromTemplate("spot", spotTemplate, nil, false)
+	assert.NoError(t, err)
+	assert.Equal(t, spotPriorityNodeLabelValue, spot.Labels[spotPriorityNodeLabelKey])
+
+	onDemandCost, err := strconv.ParseFloat(onDemand.Annotations[hourlyCostAnnotationKey], 64)
+	assert.NoError(t, err)
+	spotCost, err := strconv.ParseFloat(spot.Annotations[hourlyCostAnnotationKey], 64)
+	assert.NoError(t, err)
+	assert.Greater(t, onDemandCost, spotCost)
+}
+
 func TestEmptyTopologyFromScaleSet(t *testing.T) {
 	testNodeName := "test-node"
 	testSkuName := "test-sku"
@@ -282,6 +370,43 @@ func TestBuildNodeTemplateFromVMPool(t *testing.T) {
 		{Key: "boo", Value: "fizz", Effect: apiv1.TaintEffectPreferNoSchedule},
 	}
 	assert.Equal(t, makeTaintSet(expectedTaints), taintSet)
+	assert.Nil(t, template.MaxPods)
+
+	vmpool.Properties.MaxPods = to.Int32Ptr(50)
+	template, err = buildNodeTemplateFromVMPool(vmpool, location, skuName, labelsFromSpec, taintsFromSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, to.Int64Ptr(50), template.MaxPods)
+
+	vmpool.Properties.HostGroupID = to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/hg1")
+	template, err = buildNodeTemplateFromVMPool(vmpool, location, skuName, labelsFromSpec, taintsFromSpec)
+	assert.NoError(t, err)
+	labels := buildGenericLabels(template, "test-node")
+	assert.Equal(t, "hg1", labels[defaultPlacementLabelPrefix+hostGroupLabelName])
+	assert.NotContains(t, labels, defaultPlacementLabelPrefix+proximityPlacementGroupLabelName)
+}
+
+func TestTemplateMaxPods(t *testing.T) {
+	tests := []struct {
+		name              string
+		maxPods           *int64
+		networkPlugin     string
+		networkPluginMode string
+		expected          int64
+	}{
+		{name: "default", expected: defaultMaxPods},
+		{name: "kubenet", networkPlugin: "kubenet", expected: defaultMaxPods},
+		{name: "azure CNI", networkPlugin: "azure", expected: defaultAzureCNIMaxPods},
+		{name: "azure CNI overlay", networkPlugin: "Azure", networkPluginMode: "Overlay", expected: defaultAzureCNIOverlayMaxPods},
+		{name: "node group max pods", maxPods: to.Int64Ptr(50), networkPlugin: "azure", expected: 50},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := NodeTemplate{MaxPods: test.maxPods}
+			config := &Config{NetworkPlugin: test.networkPlugin, NetworkPluginMode: test.networkPluginMode}
+			assert.Equal(t, test.expected, templateMaxPods(template, config))
+		})
+	}
+	assert.Equal(t, int64(defaultMaxPods), templateMaxPods(NodeTemplate{}, nil))
 }
 
 func makeTaintSet(taints []apiv1.Taint) map[apiv1.Taint]bool {
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// vmPoolMapper maps VMs to the name of their agent pool, by the aks-managed-poolName tag or the legacy poolName
+// tag, then by the configured fallback tag keys and VM name patterns, so that VMs of clusters migrating between
+// tagging schemes stay visible to the autoscaler. A nil mapper only maps VMs by the AKS tags.
+type vmPoolMapper struct {
+	// tagKeys are the other tag keys holding the agent pool name, in order of precedence.
+	tagKeys []string
+	// namePatterns match VM names, their first capture group being the agent pool name.
+	namePatterns []*regexp.Regexp
+}
+
+func newVMPoolMapper(tagKeys, namePatterns []string) (*vmPoolMapper, error) {
+	patterns, err := parseAgentPoolNamePatterns(namePatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &vmPoolMapper{
+		tagKeys:      tagKeys,
+		namePatterns: patterns,
+	}, nil
+}
+
+// parseAgentPoolNamePatterns compiles the VM name patterns of agent pools, which must capture the pool name.
+func parseAgentPoolNamePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent pool name pattern %q: %v", pattern, err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("agent pool name pattern %q must capture the agent pool name in a group", pattern)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// poolName returns the name of the agent pool of vm, or false if it can't be mapped to any.
+func (m *vmPoolMapper) poolName(vm compute.VirtualMachine) (string, bool) {
+	// Fall back to the legacy tag if the AKS managed one is not set.
+	for _, key := range []string{agentpoolNameTag, legacyAgentpoolNameTag} {
+		if name := to.String(vm.Tags[key]); name != "" {
+			return name, true
+		}
+	}
+	if m == nil {
+		return "", false
+	}
+	for _, key := range m.tagKeys {
+		if name := to.String(vm.Tags[key]); name != "" {
+			return name, true
+		}
+	}
+	vmName := to.String(vm.Name)
+	for _, pattern := range m.namePatterns {
+		if match := pattern.FindStringSubmatch(vmName); match != nil && match[1] != "" {
+			return match[1], true
+		}
+	}
+	return "", false
+}
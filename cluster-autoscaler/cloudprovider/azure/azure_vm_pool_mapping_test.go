@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+)
+
+func newTestPoolVM(name string, tags map[string]string) compute.VirtualMachine {
+	vm := compute.VirtualMachine{Name: to.StringPtr(name)}
+	if tags != nil {
+		vm.Tags = make(map[string]*string)
+		for key, value := range tags {
+			vm.Tags[key] = to.StringPtr(value)
+		}
+	}
+	return vm
+}
+
+func TestVMPoolMapper(t *testing.T) {
+	_, err := newVMPoolMapper(nil, []string{"aks-(pool"})
+	assert.Error(t, err)
+	_, err = newVMPoolMapper(nil, []string{"^aks-[a-z]+-vm$"})
+	assert.Error(t, err, "patterns must capture the agent pool name")
+
+	mapper, err := newVMPoolMapper([]string{"legacy-pool", "team-pool"}, []string{`^aks-([a-z0-9]+)-[0-9]+-vm[0-9]+$`})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		vm   compute.VirtualMachine
+		pool string
+	}{
+		{"aks managed tag", newTestPoolVM("vm", map[string]string{agentpoolNameTag: "pool1", legacyAgentpoolNameTag: "pool2", "legacy-pool": "pool3"}), "pool1"},
+		{"legacy tag", newTestPoolVM("vm", map[string]string{legacyAgentpoolNameTag: "pool2", "legacy-pool": "pool3"}), "pool2"},
+		{"custom tag keys in order", newTestPoolVM("vm", map[string]string{"team-pool": "pool4", "legacy-pool": "pool3"}), "pool3"},
+		{"name pattern", newTestPoolVM("aks-pool5-12345-vm0", nil), "pool5"},
+		{"name pattern with other tags", newTestPoolVM("aks-pool5-12345-vm1", map[string]string{"owner": "team"}), "pool5"},
+		{"empty tag", newTestPoolVM("aks-pool5-12345-vm2", map[string]string{agentpoolNameTag: ""}), "pool5"},
+		{"unmapped", newTestPoolVM("jumpbox", map[string]string{"owner": "team"}), ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pool, ok := mapper.poolName(tc.vm)
+			assert.Equal(t, tc.pool != "", ok)
+			assert.Equal(t, tc.pool, pool)
+		})
+	}
+
+	var defaultMapper *vmPoolMapper
+	pool, ok := defaultMapper.poolName(newTestPoolVM("vm", map[string]string{legacyAgentpoolNameTag: "pool2"}))
+	assert.True(t, ok)
+	assert.Equal(t, "pool2", pool)
+	_, ok = defaultMapper.poolName(newTestPoolVM("aks-pool5-12345-vm0", map[string]string{"legacy-pool": "pool3"}))
+	assert.False(t, ok, "only the AKS tags are used without fallback rules")
+}
+
+func TestFetchVirtualMachinesFallbackMapping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	mockVMClient := mockvmclient.NewMockInterface(ctrl)
+	mockVMClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return([]compute.VirtualMachine{
+		newTestPoolVM("aks-pool1-12345-vm0", map[string]string{agentpoolNameTag: "pool1"}),
+		newTestPoolVM("aks-pool1-12345-vm1", nil),
+		newTestPoolVM("vm2", map[string]string{"legacy-pool": "pool2"}),
+		newTestPoolVM("jumpbox", nil),
+	}, nil).Times(2)
+	manager.azClient.virtualMachinesClient = mockVMClient
+
+	vms, err := manager.azureCache.fetchVirtualMachines()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aks-pool1-12345-vm0"}, vmNames(vms["pool1"]))
+	assert.Empty(t, vms["pool2"])
+
+	manager.azureCache.vmPoolMapper, err = newVMPoolMapper([]string{"legacy-pool"}, []string{`^aks-([a-z0-9]+)-[0-9]+-vm[0-9]+$`})
+	assert.NoError(t, err)
+	vms, err = manager.azureCache.fetchVirtualMachines()
+	assert.NoError(t, err)
+	assert.Len(t, vms, 2)
+	assert.Equal(t, []string{"aks-pool1-12345-vm0", "aks-pool1-12345-vm1"}, vmNames(vms["pool1"]))
+	assert.Equal(t, []string{"vm2"}, vmNames(vms["pool2"]))
+}
+
+func vmNames(vms []compute.VirtualMachine) []string {
+	var names []string
+	for _, vm := range vms {
+		names = append(names, to.String(vm.Name))
+	}
+	return names
+}
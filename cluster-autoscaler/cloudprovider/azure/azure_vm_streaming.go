@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"k8s.io/client-go/util/flowcontrol"
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+
+	klog "k8s.io/klog/v2"
+)
+
+// VirtualMachinePagesClient lists the VMs of a resource group page by page.
+type VirtualMachinePagesClient interface {
+	List(ctx context.Context, resourceGroupName string, filter string) (compute.VirtualMachineListResultPage, error)
+}
+
+// streamVirtualMachines lists the VMs of the resource group page by page, keeping only the VMs mapped to an agent
+// pool, and, when only registered node groups are refreshed, to the agent pool of a registered node group. Pages are
+// released as soon as they are processed, so that the whole listing is never held in memory. Every page is listed:
+// the scale profile of a VMs pool only bounds its VMs from below, e.g. VMs being created or left behind by a failed
+// deletion may be listed on any page.
+// Caller must hold m.mutex.
+func (m *azureCache) streamVirtualMachines() (map[string][]compute.VirtualMachine, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	var registered map[string]bool
+	if m.refreshRegisteredNodeGroupsOnly {
+		registered = m.registeredVMPools()
+	}
+
+	instances := make(map[string][]compute.VirtualMachine)
+	unmapped, pages := 0, 0
+	page, rerr := m.listVirtualMachinesPage(ctx, nil)
+	for rerr == nil && page.NotDone() {
+		pages++
+		for _, instance := range page.Values() {
+			vmPoolName, ok := m.vmPoolMapper.poolName(instance)
+			if !ok {
+				klog.V(4).Infof("VM %s in resource group %q is not mapped to any agent pool", to.String(instance.Name), m.resourceGroup)
+				unmapped++
+				continue
+			}
+			if registered != nil && !registered[vmPoolName] {
+				continue
+			}
+			instances[vmPoolName] = append(instances[vmPoolName], instance)
+		}
+		page, rerr = m.listVirtualMachinesPage(ctx, &page)
+	}
+	m.callQueue.observe(rerr, m.now())
+	if rerr != nil {
+		m.errors.errorf("VirtualMachinesClient.List", m.resourceGroup, rerr, m.now(), "VirtualMachinesClient.List in resource group %q failed: %v", m.resourceGroup, rerr)
+		return nil, rerr.Error()
+	}
+
+	streamedVirtualMachineListings.Inc()
+	streamedVirtualMachineListPages.Add(float64(pages))
+	unmappedVirtualMachines.Set(float64(unmapped))
+	return instances, nil
+}
+
+// newVirtualMachinePagesRateLimiter returns the limiter of VM list page requests, sharing the read rate limit of
+// the VM client.
+func newVirtualMachinePagesRateLimiter(cfg *Config) flowcontrol.RateLimiter {
+	readLimiter, _ := azclients.NewRateLimiter(cfg.VirtualMachineRateLimit)
+	return readLimiter
+}
+
+// listVirtualMachinesPage returns the first page of VMs of the resource group if previous is nil, or the page
+// following previous.
+func (m *azureCache) listVirtualMachinesPage(ctx context.Context, previous *compute.VirtualMachineListResultPage) (compute.VirtualMachineListResultPage, *retry.Error) {
+	if rerr := m.injectFault("VirtualMachinesClient.List", m.resourceGroup); rerr != nil {
+		return compute.VirtualMachineListResultPage{}, rerr
+	}
+	// Every page is a request of its own, so each one is rate limited.
+	if limiter := m.azClient.virtualMachinePagesRateLimiter; limiter != nil && !limiter.TryAccept() {
+		return compute.VirtualMachineListResultPage{}, retry.GetRateLimitError(false, "VMList")
+	}
+	if previous == nil {
+		page, err := m.azClient.virtualMachinePagesClient.List(ctx, m.resourceGroup, "")
+		return page, retry.GetError(page.Response().Response.Response, err)
+	}
+	page := *previous
+	err := page.NextWithContext(ctx)
+	return page, retry.GetError(page.Response().Response.Response, err)
+}
+
+// registeredVMPools returns the names of the agent pools backing registered node groups.
+// Caller must hold m.mutex.
+func (m *azureCache) registeredVMPools() map[string]bool {
+	pools := make(map[string]bool)
+	for _, ng := range m.registeredNodeGroups {
+		switch pool := ng.(type) {
+		case *AgentPool:
+			pools[pool.Name] = true
+		case *VMPool:
+			pools[pool.agentPoolName] = true
+		}
+	}
+	return pools
+}
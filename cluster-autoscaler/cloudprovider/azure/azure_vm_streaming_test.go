@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// fakeVirtualMachinePagesClient serves pages of VMs, linked by their index, and records how many were fetched.
+type fakeVirtualMachinePagesClient struct {
+	pages   [][]compute.VirtualMachine
+	fetched int
+	err     error
+}
+
+func (c *fakeVirtualMachinePagesClient) List(ctx context.Context, resourceGroupName string, filter string) (compute.VirtualMachineListResultPage, error) {
+	if c.err != nil {
+		return compute.VirtualMachineListResultPage{}, c.err
+	}
+	return compute.NewVirtualMachineListResultPage(c.page(0), func(ctx context.Context, cur compute.VirtualMachineListResult) (compute.VirtualMachineListResult, error) {
+		if cur.NextLink == nil {
+			return compute.VirtualMachineListResult{}, nil
+		}
+		next, err := strconv.Atoi(*cur.NextLink)
+		if err != nil {
+			return compute.VirtualMachineListResult{}, err
+		}
+		return c.page(next), nil
+	}), nil
+}
+
+func (c *fakeVirtualMachinePagesClient) page(i int) compute.VirtualMachineListResult {
+	if i >= len(c.pages) {
+		return compute.VirtualMachineListResult{}
+	}
+	c.fetched++
+	values := c.pages[i]
+	result := compute.VirtualMachineListResult{
+		Response: autorest.Response{Response: &http.Response{StatusCode: http.StatusOK}},
+		Value:    &values,
+	}
+	if i+1 < len(c.pages) {
+		result.NextLink = to.StringPtr(strconv.Itoa(i + 1))
+	}
+	return result
+}
+
+func newTestStreamedVMs(pool string, count int) []compute.VirtualMachine {
+	vms := make([]compute.VirtualMachine, 0, count)
+	for i := 0; i < count; i++ {
+		vms = append(vms, newTestPoolVM(fmt.Sprintf("%s-vm%d", pool, i), map[string]string{agentpoolNameTag: pool}))
+	}
+	return vms
+}
+
+func TestStreamVirtualMachines(t *testing.T) {
+	manager := newTestAzureManager(t)
+	client := &fakeVirtualMachinePagesClient{pages: [][]compute.VirtualMachine{
+		append(newTestStreamedVMs("pool1", 2), newTestPoolVM("jumpbox", nil)),
+		newTestStreamedVMs("pool2", 2),
+		nil,
+		newTestStreamedVMs("pool3", 1),
+	}}
+	manager.azClient.virtualMachinePagesClient = client
+
+	vms, err := manager.azureCache.fetchVirtualMachines()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, client.fetched, "empty pages are skipped")
+	assert.Len(t, vms, 3)
+	assert.Equal(t, []string{"pool1-vm0", "pool1-vm1"}, vmNames(vms["pool1"]))
+	assert.Equal(t, []string{"pool3-vm0"}, vmNames(vms["pool3"]))
+
+	client.err = fmt.Errorf("list failed")
+	_, err = manager.azureCache.fetchVirtualMachines()
+	assert.Error(t, err)
+}
+
+func TestStreamVirtualMachinesRegisteredNodeGroupsOnly(t *testing.T) {
+	manager := newTestAzureManager(t)
+	client := &fakeVirtualMachinePagesClient{pages: [][]compute.VirtualMachine{
+		newTestStreamedVMs("other", 2),
+		newTestStreamedVMs(vmsAgentPoolName, 2),
+		newTestStreamedVMs(vmsAgentPoolName, 2)[1:],
+		newTestStreamedVMs("other", 1),
+	}}
+	manager.azClient.virtualMachinePagesClient = client
+	manager.azureCache.refreshRegisteredNodeGroupsOnly = true
+	manager.azureCache.registeredNodeGroups = []cloudprovider.NodeGroup{newTestVMsPool(manager)}
+
+	vms, err := manager.azureCache.fetchVirtualMachines()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, client.fetched)
+	assert.Len(t, vms, 1, "only the VMs of registered node groups are kept")
+	assert.Len(t, vms[vmsAgentPoolName], 3)
+
+	// VMs beyond the count of the VMs pool, 3, on later pages are listed too.
+	manager.azureCache.vmsPoolMap = map[string]armcontainerservice.AgentPool{vmsAgentPoolName: getTestVMsAgentPool(false)}
+	client.pages = append(client.pages, []compute.VirtualMachine{newTestPoolVM("surplus", map[string]string{agentpoolNameTag: vmsAgentPoolName})})
+	client.fetched = 0
+	vms, err = manager.azureCache.fetchVirtualMachines()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, client.fetched)
+	assert.Equal(t, []string{"test-vms-pool-vm0", "test-vms-pool-vm1", "test-vms-pool-vm1", "surplus"}, vmNames(vms[vmsAgentPoolName]))
+
+	// standard agent pools are kept too.
+	manager.azureCache.registeredNodeGroups = append(manager.azureCache.registeredNodeGroups, &AgentPool{azureRef: azureRef{Name: "other"}})
+	vms, err = manager.azureCache.fetchVirtualMachines()
+	assert.NoError(t, err)
+	assert.Len(t, vms["other"], 3)
+}
+
+func TestStreamVirtualMachinesRateLimited(t *testing.T) {
+	manager := newTestAzureManager(t)
+	client := &fakeVirtualMachinePagesClient{pages: [][]compute.VirtualMachine{newTestStreamedVMs("pool1", 1), newTestStreamedVMs("pool2", 1)}}
+	manager.azClient.virtualMachinePagesClient = client
+	manager.azClient.virtualMachinePagesRateLimiter = flowcontrol.NewFakeNeverRateLimiter()
+
+	_, err := manager.azureCache.fetchVirtualMachines()
+	assert.Error(t, err)
+	assert.Equal(t, 0, client.fetched, "pages are not requested over the rate limit")
+}
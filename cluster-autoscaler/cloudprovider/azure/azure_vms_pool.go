@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
@@ -34,6 +36,26 @@ import (
 	klog "k8s.io/klog/v2"
 )
 
+const (
+	// vmProvisioningFailedStatusPrefix prefixes the instance view status code of a VM which failed provisioning,
+	// followed by the error code.
+	vmProvisioningFailedStatusPrefix = "ProvisioningState/failed/"
+
+	// failedVMInstanceViewTTL is how long the instance view fetched for a VM which failed provisioning is reused.
+	failedVMInstanceViewTTL = 5 * time.Minute
+)
+
+// outOfResourcesErrorCodes are the VM provisioning error codes caused by lack of capacity or quota.
+var outOfResourcesErrorCodes = map[string]bool{
+	"AllocationFailed":                      true,
+	"ZonalAllocationFailed":                 true,
+	"OverconstrainedAllocationRequest":      true,
+	"OverconstrainedZonalAllocationRequest": true,
+	"SkuNotAvailable":                       true,
+	"QuotaExceeded":                         true,
+	"OperationNotAllowed":                   true,
+}
+
 // VMPool represents a group of standalone virtual machines (VMs) with a single SKU.
 // It is part of a mixed-SKU agent pool (an agent pool with type `VirtualMachines`).
 // Terminology:
@@ -48,6 +70,46 @@ type VMPool struct {
 
 	minSize int
 	maxSize int
+
+	// failedInstanceViews are the instance views fetched for the VMs which failed provisioning.
+	failedInstanceViews instanceViewCache
+}
+
+// instanceViewCache keeps the instance views of VMs for failedVMInstanceViewTTL, by VM ID.
+type instanceViewCache struct {
+	mutex   sync.Mutex
+	entries map[string]cachedInstanceView
+}
+
+type cachedInstanceView struct {
+	instanceView *compute.VirtualMachineInstanceView
+	fetchedAt    time.Time
+}
+
+// get returns the instance view of the VM id fetched less than failedVMInstanceViewTTL before now.
+func (c *instanceViewCache) get(id string, now time.Time) (*compute.VirtualMachineInstanceView, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, found := c.entries[id]
+	if !found || now.Sub(entry.fetchedAt) >= failedVMInstanceViewTTL {
+		return nil, false
+	}
+	return entry.instanceView, true
+}
+
+// set records the instance view of the VM id fetched at now, forgetting the expired ones.
+func (c *instanceViewCache) set(id string, instanceView *compute.VirtualMachineInstanceView, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedInstanceView)
+	}
+	for cachedID, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) >= failedVMInstanceViewTTL {
+			delete(c.entries, cachedID)
+		}
+	}
+	c.entries[id] = cachedInstanceView{instanceView: instanceView, fetchedAt: now}
 }
 
 // NewVMPool creates a new VMPool - a pool of standalone VMs of a single size.
@@ -139,6 +201,10 @@ func (vmPool *VMPool) IncreaseSize(delta int) error {
 		return fmt.Errorf("size-increasing request of %d is bigger than max size %d", int(currentSize)+delta, vmPool.MaxSize())
 	}
 
+	if err := vmPool.manager.checkCostCeiling(vmPool, delta, nil); err != nil {
+		return err
+	}
+
 	updateCtx, cancel := getContextWithTimeout(vmsAsyncContextTimeout)
 	defer cancel()
 
@@ -148,6 +214,17 @@ func (vmPool *VMPool) IncreaseSize(delta int) error {
 		return err
 	}
 
+	var zones []string
+	if versionedAP.Properties != nil {
+		for _, zone := range versionedAP.Properties.AvailabilityZones {
+			zones = append(zones, to.String(zone))
+		}
+	}
+	if err := checkSKURestrictions(vmPool.manager.azureCache, vmPool.sku, vmPool.manager.config.Location, zones); err != nil {
+		klog.Errorf("Failed to scale up vmPool %s: %v", vmPool.Name, err)
+		return err
+	}
+
 	count := currentSize + int32(delta)
 	requestBody := armcontainerservice.AgentPool{}
 	// self-hosted CAS will be using Manual scale profile
@@ -160,6 +237,14 @@ func (vmPool *VMPool) IncreaseSize(delta int) error {
 		updateCtx = policy.WithHTTPHeader(updateCtx, header)
 	}
 
+	if vmPool.manager.dryRun(operationUpdateCapacity, vmPool.Id(), "scale up agent pool %s to %d", vmPool.agentPoolName, count) {
+		return nil
+	}
+	done, err := vmPool.manager.operations.start(armOperation{Kind: operationUpdateCapacity, NodeGroup: vmPool.Id(), TargetSize: int64(count)})
+	if err != nil {
+		return err
+	}
+	defer done()
 	defer vmPool.manager.invalidateCache()
 	poller, err := vmPool.manager.azClient.agentPoolClient.BeginCreateOrUpdate(
 		updateCtx,
@@ -167,7 +252,7 @@ func (vmPool *VMPool) IncreaseSize(delta int) error {
 		vmPool.manager.config.ClusterName,
 		vmPool.agentPoolName,
 		requestBody, nil)
-
+	vmPool.manager.recordMutation(operationUpdateCapacity, vmPool.Id(), err, "scale up agent pool %s to %d", vmPool.agentPoolName, count)
 	if err != nil {
 		klog.Errorf("Failed to scale up agentpool %s in cluster %s for vmPool %s with error: %v",
 			vmPool.agentPoolName, vmPool.manager.config.ClusterName, vmPool.Name, err)
@@ -177,6 +262,7 @@ func (vmPool *VMPool) IncreaseSize(delta int) error {
 	if _, err := poller.PollUntilDone(updateCtx, nil /*default polling interval is 30s*/); err != nil {
 		klog.Errorf("agentPoolClient.BeginCreateOrUpdate for aks cluster %s agentpool %s for scaling up vmPool %s failed with error %s",
 			vmPool.manager.config.ClusterName, vmPool.agentPoolName, vmPool.Name, err)
+		vmPool.manager.recordScaleUpFailure(vmPool.Id(), err)
 		return err
 	}
 
@@ -229,6 +315,10 @@ func (vmPool *VMPool) DeleteNodes(nodes []*apiv1.Node) error {
 		return fmt.Errorf("cannot delete nodes as minimum size of %d has been reached", vmPool.MinSize())
 	}
 
+	if err := checkDeletionHold(vmPool.Name, nodes, nil); err != nil {
+		return err
+	}
+
 	providerIDs, err := vmPool.getProviderIDsForNodes(nodes)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve provider IDs for nodes: %w", err)
@@ -252,6 +342,21 @@ func (vmPool *VMPool) DeleteNodes(nodes []*apiv1.Node) error {
 		machineNames[i] = &machineName
 	}
 
+	if vmPool.manager.dryRun(operationDeleteInstances, vmPool.Id(), "delete machines %v from agent pool %s", providerIDs, vmPool.agentPoolName) {
+		return nil
+	}
+
+	if err := vmPool.manager.runPreDeleteHook(vmPool.Id(), providerIDs); err != nil {
+		vmPool.manager.recordMutation(operationDeleteInstances, vmPool.Id(), err, "delete machines %v from agent pool %s", providerIDs, vmPool.agentPoolName)
+		return err
+	}
+
+	done, err := vmPool.manager.operations.start(armOperation{Kind: operationDeleteInstances, NodeGroup: vmPool.Id(), InstanceIDs: providerIDs})
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	requestBody := armcontainerservice.AgentPoolDeleteMachinesParameter{
 		MachineNames: machineNames,
 	}
@@ -266,6 +371,7 @@ func (vmPool *VMPool) DeleteNodes(nodes []*apiv1.Node) error {
 		vmPool.manager.config.ClusterName,
 		vmPool.agentPoolName,
 		requestBody, nil)
+	vmPool.manager.recordMutation(operationDeleteInstances, vmPool.Id(), err, "delete machines %v from agent pool %s", providerIDs, vmPool.agentPoolName)
 	if err != nil {
 		klog.Errorf("Failed to delete nodes from agentpool %s in cluster %s with error: %v",
 			vmPool.agentPoolName, vmPool.manager.config.ClusterName, err)
@@ -343,7 +449,7 @@ func (vmPool *VMPool) Id() string {
 
 // Debug returns a string with basic details of the agentPool
 func (vmPool *VMPool) Debug() string {
-	return fmt.Sprintf("%s (%d:%d)", vmPool.Id(), vmPool.MinSize(), vmPool.MaxSize())
+	return vmPool.DebugInfo().String()
 }
 
 func isSpotAgentPool(ap armcontainerservice.AgentPool) bool {
@@ -451,12 +557,92 @@ func (vmPool *VMPool) Nodes() ([]cloudprovider.Instance, error) {
 		if err != nil {
 			return nil, err
 		}
-		nodes = append(nodes, cloudprovider.Instance{Id: resourceID})
+		nodes = append(nodes, cloudprovider.Instance{Id: resourceID, Status: vmPool.instanceStatusFromVM(vm)})
 	}
 
 	return nodes, nil
 }
 
+// instanceStatusFromVM converts the VM provisioning state to cloudprovider.InstanceStatus.
+// Failed provisionings are reported with an InstanceErrorInfo carrying the AKS error code, as done for VMSS instances.
+func (vmPool *VMPool) instanceStatusFromVM(vm compute.VirtualMachine) *cloudprovider.InstanceStatus {
+	enableFastDeleteOnFailedProvisioning := vmPool.manager.config.EnableFastDeleteOnFailedProvisioning
+	if vm.VirtualMachineProperties == nil || to.String(vm.ProvisioningState) != provisioningStateFailed || !enableFastDeleteOnFailedProvisioning {
+		var provisioningState *string
+		if vm.VirtualMachineProperties != nil {
+			provisioningState = vm.ProvisioningState
+		}
+		return instanceStatusFromProvisioningStateAndPowerState(to.String(vm.ID), provisioningState, vmPowerStateRunning, enableFastDeleteOnFailedProvisioning)
+	}
+
+	// The listed VMs don't carry their instance view, get it for failed ones only to find out the power state and
+	// error code. It is reused for failedVMInstanceViewTTL, rather than fetched for every VM on every loop.
+	instanceView := vm.InstanceView
+	if instanceView == nil {
+		instanceView = vmPool.getFailedInstanceView(vm)
+	}
+
+	powerState := vmPowerStateUnknown
+	var statuses []compute.InstanceViewStatus
+	if instanceView != nil && instanceView.Statuses != nil {
+		statuses = *instanceView.Statuses
+		powerState = vmPowerStateFromStatuses(statuses)
+	}
+	status := instanceStatusFromProvisioningStateAndPowerState(to.String(vm.ID), vm.ProvisioningState, powerState, enableFastDeleteOnFailedProvisioning)
+	if status.ErrorInfo != nil {
+		if errorCode, errorMessage, found := vmProvisioningErrorFromStatuses(statuses); found {
+			klog.V(3).Infof("VM %s of VMs pool %s failed provisioning with error code %s", to.String(vm.ID), vmPool.agentPoolName, errorCode)
+			status.ErrorInfo.ErrorCode = errorCode
+			status.ErrorInfo.ErrorMessage = errorMessage
+			if !outOfResourcesErrorCodes[errorCode] {
+				status.ErrorInfo.ErrorClass = cloudprovider.OtherErrorClass
+			}
+		}
+	}
+	return status
+}
+
+// getFailedInstanceView returns the instance view of vm, which failed provisioning, fetched less than
+// failedVMInstanceViewTTL ago. It returns nil if it can't be fetched.
+func (vmPool *VMPool) getFailedInstanceView(vm compute.VirtualMachine) *compute.VirtualMachineInstanceView {
+	id := to.String(vm.ID)
+	now := time.Now()
+	if instanceView, found := vmPool.failedInstanceViews.get(id, now); found {
+		return instanceView
+	}
+
+	ctx, cancel := getContextWithTimeout(vmsContextTimeout)
+	defer cancel()
+	fetched, rerr := vmPool.manager.azClient.virtualMachinesClient.Get(ctx, vmPool.manager.config.ResourceGroup, to.String(vm.Name), compute.InstanceViewTypesInstanceView)
+	if rerr != nil {
+		klog.Warningf("Failed to get instance view of VM %s with failed provisioning state: %v", id, rerr.Error())
+		return nil
+	}
+	var instanceView *compute.VirtualMachineInstanceView
+	if fetched.VirtualMachineProperties != nil {
+		instanceView = fetched.InstanceView
+	}
+	vmPool.failedInstanceViews.set(id, instanceView, now)
+	return instanceView
+}
+
+// vmProvisioningErrorFromStatuses returns the error code and message of a failed VM provisioning,
+// reported as an instance view status such as ProvisioningState/failed/AllocationFailed.
+func vmProvisioningErrorFromStatuses(statuses []compute.InstanceViewStatus) (string, string, bool) {
+	for _, status := range statuses {
+		code := to.String(status.Code)
+		if !strings.HasPrefix(code, vmProvisioningFailedStatusPrefix) {
+			continue
+		}
+		errorCode := strings.TrimPrefix(code, vmProvisioningFailedStatusPrefix)
+		if errorCode == "" {
+			continue
+		}
+		return errorCode, to.String(status.Message), true
+	}
+	return "", "", false
+}
+
 // TemplateNodeInfo returns a NodeInfo object that can be used to create a new node in the vmPool.
 func (vmPool *VMPool) TemplateNodeInfo() (*framework.NodeInfo, error) {
 	ap, err := vmPool.getAgentpoolFromCache()
@@ -474,6 +660,9 @@ func (vmPool *VMPool) TemplateNodeInfo() (*framework.NodeInfo, error) {
 		return nil, err
 	}
 
+	vmPool.manager.annotateLastStockout(vmPool.Id(), node)
+	vmPool.manager.annotateHealthScore(vmPool.Id(), node)
+
 	nodeInfo := framework.NewNodeInfo(node, nil, &framework.PodInfo{Pod: cloudprovider.BuildKubeProxy(vmPool.agentPoolName)})
 
 	return nodeInfo, nil
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v5"
@@ -223,7 +224,7 @@ func TestDebug(t *testing.T) {
 		maxSize: 5,
 	}
 
-	expectedDebugString := "test-debug (1:5)"
+	expectedDebugString := "test-debug (1:5) mode=VirtualMachines"
 	assert.Equal(t, expectedDebugString, agentPool.Debug())
 }
 func TestTemplateNodeInfo(t *testing.T) {
@@ -374,6 +375,120 @@ func TestNodes(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestVMsPoolInstanceStatusFromVM(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	failedVM := func(statuses ...compute.InstanceViewStatus) compute.VirtualMachine {
+		vm := newTestVMsPoolVMList(1)[0]
+		vm.Name = to.StringPtr("vm-0")
+		vm.ProvisioningState = to.StringPtr(provisioningStateFailed)
+		if statuses != nil {
+			vm.InstanceView = &compute.VirtualMachineInstanceView{Statuses: &statuses}
+		}
+		return vm
+	}
+	allocationFailed := compute.InstanceViewStatus{
+		Code:    to.StringPtr(vmProvisioningFailedStatusPrefix + "AllocationFailed"),
+		Message: to.StringPtr("Allocation failed."),
+	}
+	extensionFailed := compute.InstanceViewStatus{
+		Code:    to.StringPtr(vmProvisioningFailedStatusPrefix + "VMExtensionProvisioningError"),
+		Message: to.StringPtr("VM has reported a failure when processing extension."),
+	}
+	running := compute.InstanceViewStatus{Code: to.StringPtr(vmPowerStateRunning)}
+
+	testCases := []struct {
+		name              string
+		vm                compute.VirtualMachine
+		fastDelete        bool
+		fetchedStatuses   []compute.InstanceViewStatus
+		expectedState     cloudprovider.InstanceState
+		expectedErrorInfo *cloudprovider.InstanceErrorInfo
+	}{
+		{
+			name:          "succeeded",
+			vm:            newTestVMsPoolVMList(1)[0],
+			fastDelete:    true,
+			expectedState: cloudprovider.InstanceRunning,
+		},
+		{
+			name:          "failed without fast delete",
+			vm:            failedVM(allocationFailed),
+			expectedState: cloudprovider.InstanceRunning,
+		},
+		{
+			name:          "failed with out of resources error code",
+			vm:            failedVM(allocationFailed),
+			fastDelete:    true,
+			expectedState: cloudprovider.InstanceCreating,
+			expectedErrorInfo: &cloudprovider.InstanceErrorInfo{
+				ErrorClass:   cloudprovider.OutOfResourcesErrorClass,
+				ErrorCode:    "AllocationFailed",
+				ErrorMessage: "Allocation failed.",
+			},
+		},
+		{
+			name:            "failed with other error code from fetched instance view",
+			vm:              failedVM(),
+			fastDelete:      true,
+			fetchedStatuses: []compute.InstanceViewStatus{extensionFailed},
+			expectedState:   cloudprovider.InstanceCreating,
+			expectedErrorInfo: &cloudprovider.InstanceErrorInfo{
+				ErrorClass:   cloudprovider.OtherErrorClass,
+				ErrorCode:    "VMExtensionProvisioningError",
+				ErrorMessage: "VM has reported a failure when processing extension.",
+			},
+		},
+		{
+			name:          "failed while running",
+			vm:            failedVM(extensionFailed, running),
+			fastDelete:    true,
+			expectedState: cloudprovider.InstanceRunning,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ap := newTestVMsPool(newTestAzureManager(t))
+			ap.manager.config.EnableFastDeleteOnFailedProvisioning = tc.fastDelete
+			mockVMClient := mockvmclient.NewMockInterface(ctrl)
+			ap.manager.azClient.virtualMachinesClient = mockVMClient
+			if tc.fetchedStatuses != nil {
+				fetched := failedVM(tc.fetchedStatuses...)
+				mockVMClient.EXPECT().Get(gomock.Any(), ap.manager.config.ResourceGroup, "vm-0", compute.InstanceViewTypesInstanceView).Return(fetched, nil)
+			}
+
+			status := ap.instanceStatusFromVM(tc.vm)
+			assert.Equal(t, tc.expectedState, status.State)
+			assert.Equal(t, tc.expectedErrorInfo, status.ErrorInfo)
+			// The fetched instance view is reused on the next loops.
+			status = ap.instanceStatusFromVM(tc.vm)
+			assert.Equal(t, tc.expectedErrorInfo, status.ErrorInfo)
+		})
+	}
+}
+
+func TestInstanceViewCache(t *testing.T) {
+	now := time.Now()
+	cache := instanceViewCache{}
+	_, found := cache.get("vm-0", now)
+	assert.False(t, found)
+
+	instanceView := &compute.VirtualMachineInstanceView{}
+	cache.set("vm-0", instanceView, now)
+	cached, found := cache.get("vm-0", now.Add(failedVMInstanceViewTTL-time.Second))
+	assert.True(t, found)
+	assert.Same(t, instanceView, cached)
+	_, found = cache.get("vm-0", now.Add(failedVMInstanceViewTTL))
+	assert.False(t, found)
+
+	cache.set("vm-1", nil, now.Add(failedVMInstanceViewTTL))
+	assert.NotContains(t, cache.entries, "vm-0", "expired instance views are forgotten")
+	_, found = cache.get("vm-1", now.Add(failedVMInstanceViewTTL))
+	assert.True(t, found, "VMs without instance view aren't fetched again until expiry")
+}
+
 func TestGetCurSizeForVMsPool(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
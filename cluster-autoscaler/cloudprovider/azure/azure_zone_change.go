@@ -0,0 +1,48 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// regenerateScaleSetZones records the availability zones of the cached scale sets, returning the scale sets
+// whose zones were added to or removed from out of band since the previous refresh.
+func regenerateScaleSetZones(scaleSets map[string]compute.VirtualMachineScaleSet, previous map[azureRef][]string) (map[azureRef][]string, []scaleSetModelChange) {
+	return diffScaleSetModels(scaleSets, previous, scaleSetZonesChangedReason,
+		func(vmss compute.VirtualMachineScaleSet) ([]string, bool) {
+			var zones []string
+			if vmss.Zones != nil {
+				zones = append(zones, *vmss.Zones...)
+				sort.Strings(zones)
+			}
+			return zones, true
+		},
+		func(name string, oldZones, zones []string) string {
+			added := sets.New(zones...).Difference(sets.New(oldZones...))
+			removed := sets.New(oldZones...).Difference(sets.New(zones...))
+			if added.Len() == 0 && removed.Len() == 0 {
+				return ""
+			}
+			return fmt.Sprintf("Zones of scale set %s changed from %v to %v (added %v, removed %v)",
+				name, oldZones, zones, sets.List(added), sets.List(removed))
+		})
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	apiv1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+)
+
+func newTestZonalVMSSList(zones ...string) []compute.VirtualMachineScaleSet {
+	scaleSets := newTestVMSSList(3, testASG, testLocation, compute.Uniform)
+	scaleSets[0].Zones = &zones
+	return scaleSets
+}
+
+func TestRegenerateScaleSetZones(t *testing.T) {
+	ref := azureRef{Name: testASG}
+	zones, changes := regenerateScaleSetZones(map[string]compute.VirtualMachineScaleSet{testASG: newTestZonalVMSSList("2", "1")[0]}, nil)
+	assert.Equal(t, []string{"1", "2"}, zones[ref])
+	assert.Empty(t, changes)
+
+	zones, changes = regenerateScaleSetZones(map[string]compute.VirtualMachineScaleSet{testASG: newTestZonalVMSSList("1", "2")[0]}, zones)
+	assert.Empty(t, changes)
+
+	zones, changes = regenerateScaleSetZones(map[string]compute.VirtualMachineScaleSet{testASG: newTestZonalVMSSList("3", "1", "2")[0]}, zones)
+	assert.Equal(t, []string{"1", "2", "3"}, zones[ref])
+	assert.Equal(t, []scaleSetModelChange{{
+		scaleSet: testASG,
+		reason:   scaleSetZonesChangedReason,
+		message:  "Zones of scale set " + testASG + " changed from [1 2] to [1 2 3] (added [3], removed [])",
+	}}, changes)
+
+	zones, changes = regenerateScaleSetZones(map[string]compute.VirtualMachineScaleSet{testASG: newTestVMSSList(3, testASG, testLocation, compute.Uniform)[0]}, zones)
+	assert.Contains(t, zones, ref)
+	assert.Empty(t, zones[ref])
+	assert.Len(t, changes, 1)
+}
+
+func TestScaleSetTemplateNodeInfoAfterZoneChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := newTestAzureManager(t)
+	mockVMSSClient := mockvmssclient.NewMockInterface(ctrl)
+	gomock.InOrder(
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestZonalVMSSList("1"), nil),
+		mockVMSSClient.EXPECT().List(gomock.Any(), manager.config.ResourceGroup).Return(newTestZonalVMSSList("2"), nil),
+	)
+	manager.azClient.virtualMachineScaleSetsClient = mockVMSSClient
+	scaleSet := newTestScaleSet(manager, testASG)
+
+	assert.NoError(t, manager.forceRefresh())
+	nodeInfo, err := scaleSet.TemplateNodeInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, testLocation+"-1", nodeInfo.Node().Labels[apiv1.LabelTopologyZone])
+
+	assert.NoError(t, manager.forceRefresh())
+	assert.Equal(t, []string{"2"}, manager.azureCache.getScaleSetZones()[azureRef{Name: testASG}])
+	nodeInfo, err = scaleSet.TemplateNodeInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, testLocation+"-2", nodeInfo.Node().Labels[apiv1.LabelTopologyZone])
+	assert.Equal(t, testLocation+"-2", nodeInfo.Node().Labels[azureDiskTopologyKey])
+}
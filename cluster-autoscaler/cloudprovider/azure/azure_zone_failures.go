@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	apiv1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// zoneFailureWindow is how long an allocation failure of a SKU in a zone is remembered.
+	zoneFailureWindow = 30 * time.Minute
+	// failedZonesAnnotationKey is set on template nodes to the comma separated zones in which the SKU of their node
+	// group recently failed allocation, so that expanders and zone balancing can steer away from them.
+	failedZonesAnnotationKey = "cluster-autoscaler.kubernetes.io/azure-failed-zones"
+)
+
+// zoneFailureKey identifies a SKU in a zone.
+type zoneFailureKey struct {
+	sku  string
+	zone string
+}
+
+// zoneFailureHistory keeps the time of the last allocation failure of each SKU in each zone, forgotten after
+// zoneFailureWindow. The zero value is ready to use.
+type zoneFailureHistory struct {
+	mutex        sync.Mutex
+	lastFailures map[zoneFailureKey]time.Time
+}
+
+// record records an allocation failure of the SKU in the zone, and returns whether the zone had no recent failure.
+func (h *zoneFailureHistory) record(sku, zone string, at time.Time) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.lastFailures == nil {
+		h.lastFailures = make(map[zoneFailureKey]time.Time)
+	}
+	for key, last := range h.lastFailures {
+		if at.Sub(last) > zoneFailureWindow {
+			delete(h.lastFailures, key)
+		}
+	}
+	key := zoneFailureKey{sku: strings.ToLower(sku), zone: zone}
+	_, found := h.lastFailures[key]
+	h.lastFailures[key] = at
+	return !found
+}
+
+// failedZones returns the zones, among the given ones, in which the SKU failed allocation within zoneFailureWindow of now.
+func (h *zoneFailureHistory) failedZones(sku string, zones []string, now time.Time) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var failed []string
+	for _, zone := range zones {
+		last, found := h.lastFailures[zoneFailureKey{sku: strings.ToLower(sku), zone: zone}]
+		if found && now.Sub(last) <= zoneFailureWindow {
+			failed = append(failed, zone)
+		}
+	}
+	return failed
+}
+
+// recordZoneFailures records the allocation failures of the listed VMs in their zone. Failures of VMs outside
+// of a zone are not recorded, as there is no other zone to prefer.
+func (scaleSet *ScaleSet) recordZoneFailures(vms []compute.VirtualMachineScaleSetVM, now time.Time) {
+	for i := range vms {
+		vm := &vms[i]
+		if vm.Zones == nil || len(*vm.Zones) == 0 || vm.InstanceView == nil || vm.InstanceView.Statuses == nil ||
+			vm.ProvisioningState == nil || *vm.ProvisioningState != string(compute.GalleryProvisioningStateFailed) {
+			continue
+		}
+		errorCode, _, failed := vmProvisioningErrorFromStatuses(*vm.InstanceView.Statuses)
+		if !failed || !outOfResourcesErrorCodes[errorCode] {
+			continue
+		}
+		var sku string
+		if vm.Sku != nil && vm.Sku.Name != nil {
+			sku = *vm.Sku.Name
+		} else {
+			sku = scaleSet.getSKU()
+		}
+		zone := (*vm.Zones)[0]
+		if scaleSet.manager.zoneFailures.record(sku, zone, now) {
+			klog.Warningf("SKU %s failed allocation in zone %s for scale set %s: %s", sku, zone, scaleSet.Name, errorCode)
+			zoneAllocationFailures.WithLabelValues(sku, zone).Inc()
+		}
+	}
+}
+
+// preferZonesWithoutFailures annotates the template node with the zones of its node group in which the SKU recently
+// failed allocation and, if the template node was placed in one of them, moves it to another zone of the node group
+// without recent failures. Zones are left as is when all of them failed recently.
+func (m *AzureManager) preferZonesWithoutFailures(template NodeTemplate, node *apiv1.Node) {
+	failed := m.zoneFailures.failedZones(template.SkuName, template.Zones, time.Now())
+	if len(failed) == 0 {
+		return
+	}
+
+	location := strings.ToLower(template.Location)
+	failedDomains := make(map[string]bool, len(failed))
+	annotation := make([]string, 0, len(failed))
+	for _, zone := range failed {
+		failedDomains[location+"-"+zone] = true
+		annotation = append(annotation, location+"-"+zone)
+	}
+	sort.Strings(annotation)
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[failedZonesAnnotationKey] = strings.Join(annotation, ",")
+
+	if !failedDomains[node.Labels[apiv1.LabelTopologyZone]] {
+		return
+	}
+	var candidates []string
+	for _, zone := range template.Zones {
+		if domain := location + "-" + zone; !failedDomains[domain] {
+			candidates = append(candidates, domain)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	zone := candidates[rand.Intn(len(candidates))]
+	node.Labels[apiv1.LabelZoneFailureDomain] = zone
+	node.Labels[apiv1.LabelTopologyZone] = zone
+	node.Labels[azureDiskTopologyKey] = zone
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-08-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func newTestFailedVMSSVM(i int, zone, errorCode string) compute.VirtualMachineScaleSetVM {
+	vm := newTestVMSSVMList(i + 1)[i]
+	vm.Zones = &[]string{zone}
+	vm.Sku = &compute.Sku{Name: to.StringPtr("Standard_D4s_v3")}
+	vm.ProvisioningState = to.StringPtr(string(compute.GalleryProvisioningStateFailed))
+	vm.InstanceView = &compute.VirtualMachineScaleSetVMInstanceView{
+		Statuses: &[]compute.InstanceViewStatus{{Code: to.StringPtr(vmProvisioningFailedStatusPrefix + errorCode)}},
+	}
+	return vm
+}
+
+func TestZoneFailureHistory(t *testing.T) {
+	var history zoneFailureHistory
+	now := time.Now()
+	assert.True(t, history.record("Standard_D4s_v3", "1", now))
+	assert.False(t, history.record("standard_d4s_v3", "1", now.Add(time.Minute)), "SKUs are case-insensitive")
+	assert.Equal(t, []string{"1"}, history.failedZones("Standard_D4s_v3", []string{"1", "2", "3"}, now.Add(time.Minute)))
+	assert.Empty(t, history.failedZones("Standard_D8s_v3", []string{"1", "2", "3"}, now))
+	assert.Empty(t, history.failedZones("Standard_D4s_v3", []string{"1"}, now.Add(zoneFailureWindow+2*time.Minute)),
+		"failures are forgotten after the window")
+
+	// Expired failures are pruned, and count as new ones.
+	assert.True(t, history.record("Standard_D4s_v3", "2", now.Add(zoneFailureWindow+2*time.Minute)))
+	assert.True(t, history.record("Standard_D4s_v3", "1", now.Add(zoneFailureWindow+2*time.Minute)))
+}
+
+func TestRecordZoneFailures(t *testing.T) {
+	manager := newTestAzureManager(t)
+	scaleSet := newTestScaleSet(manager, testASG)
+	running := newTestVMSSVMList(1)[0]
+	running.Zones = &[]string{"3"}
+
+	scaleSet.recordZoneFailures([]compute.VirtualMachineScaleSetVM{
+		newTestFailedVMSSVM(0, "1", "ZonalAllocationFailed"),
+		newTestFailedVMSSVM(1, "2", "VMExtensionProvisioningError"),
+		running,
+	}, time.Now())
+	assert.Equal(t, []string{"1"}, manager.zoneFailures.failedZones("Standard_D4s_v3", []string{"1", "2", "3"}, time.Now()))
+}
+
+func TestPreferZonesWithoutFailures(t *testing.T) {
+	manager := newTestAzureManager(t)
+	template := NodeTemplate{SkuName: "Standard_D4s_v3", Location: "eastus", Zones: []string{"1", "2", "3"}}
+	node := &apiv1.Node{}
+	node.Labels = map[string]string{apiv1.LabelTopologyZone: "eastus-1"}
+	manager.preferZonesWithoutFailures(template, node)
+	assert.Empty(t, node.Annotations, "no recent failures")
+	assert.Equal(t, "eastus-1", node.Labels[apiv1.LabelTopologyZone])
+
+	manager.zoneFailures.record("Standard_D4s_v3", "2", time.Now())
+	manager.zoneFailures.record("Standard_D4s_v3", "1", time.Now())
+	manager.preferZonesWithoutFailures(template, node)
+	assert.Equal(t, "eastus-1,eastus-2", node.Annotations[failedZonesAnnotationKey])
+	assert.Equal(t, "eastus-3", node.Labels[apiv1.LabelTopologyZone])
+	assert.Equal(t, "eastus-3", node.Labels[apiv1.LabelZoneFailureDomain])
+	assert.Equal(t, "eastus-3", node.Labels[azureDiskTopologyKey])
+
+	// The zone is kept when all zones failed recently.
+	manager.zoneFailures.record("Standard_D4s_v3", "3", time.Now())
+	manager.preferZonesWithoutFailures(template, node)
+	assert.Equal(t, "eastus-1,eastus-2,eastus-3", node.Annotations[failedZonesAnnotationKey])
+	assert.Equal(t, "eastus-3", node.Labels[apiv1.LabelTopologyZone])
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/azure"
+	klog "k8s.io/klog/v2"
+)
+
+func main() {
+	cloudConfig := flag.String("cloud-config", "", "Path to the Azure cloud provider configuration file, settings may also be set through the environment")
+	address := flag.String("address", "127.0.0.1:7001", "Address to serve the resource cache on")
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	var configReader io.Reader
+	if *cloudConfig != "" {
+		config, err := os.Open(*cloudConfig)
+		if err != nil {
+			klog.Fatalf("Failed to open cloud config %s: %v", *cloudConfig, err)
+		}
+		defer config.Close()
+		configReader = config
+	}
+	cfg, err := azure.BuildAzureConfig(configReader)
+	if err != nil {
+		klog.Fatalf("Failed to build Azure config: %v", err)
+	}
+
+	server, err := azure.NewResourceCacheServer(cfg)
+	if err != nil {
+		klog.Fatalf("Failed to create resource cache server: %v", err)
+	}
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		klog.Fatalf("Failed to listen on %s: %v", *address, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.Serve(ctx, listener); err != nil {
+		klog.Fatalf("Failed to serve: %v", err)
+	}
+}
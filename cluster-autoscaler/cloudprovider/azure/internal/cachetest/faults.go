@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cachetest injects failures and latency into the ARM calls of the Azure cache, driven by a fake clock,
+// so that tests exercise its TTL expiry, back-off and degradation paths deterministically instead of sleeping.
+package cachetest
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// Faults are the failures injected into the ARM calls.
+type Faults struct {
+	// ErrorRate is the probability, between 0 and 1, of a call failing with an internal server error.
+	ErrorRate float64
+	// ThrottleRate is the probability, between 0 and 1, of a call being throttled.
+	ThrottleRate float64
+	// RetryAfter is the Retry-After of throttled calls, none if 0.
+	RetryAfter time.Duration
+	// Latency is added to every call, sleeping on the clock of the injector.
+	Latency time.Duration
+	// Calls are the calls to inject faults into, e.g. "VirtualMachineScaleSetsClient.List", all if empty.
+	Calls []string
+}
+
+// Injector injects Faults into ARM calls. Its outcomes only depend on its seed and the sequence of calls.
+type Injector struct {
+	clock clock.Clock
+
+	mutex    sync.Mutex
+	rand     *rand.Rand
+	faults   Faults
+	calls    map[string]int
+	injected map[string]int
+}
+
+// NewInjector returns an injector of faults, sleeping on clk and drawing failures from seed.
+// Pass a k8s.io/utils/clock/testing.FakeClock, so that latency advances the fake time instead of sleeping.
+func NewInjector(clk clock.Clock, seed int64, faults Faults) *Injector {
+	return &Injector{
+		clock:    clk,
+		rand:     rand.New(rand.NewSource(seed)),
+		faults:   faults,
+		calls:    make(map[string]int),
+		injected: make(map[string]int),
+	}
+}
+
+// SetFaults replaces the faults injected into the next calls.
+func (i *Injector) SetFaults(faults Faults) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.faults = faults
+}
+
+// Inject is called before the ARM call on target, and returns the error it must fail with, nil if none.
+func (i *Injector) Inject(call, target string) *retry.Error {
+	i.mutex.Lock()
+	faults := i.faults
+	if !faults.applies(call) {
+		i.mutex.Unlock()
+		return nil
+	}
+	i.calls[call]++
+	// Both draws are always made, so that changing one rate doesn't change the outcomes of the other.
+	throttled := i.rand.Float64() < faults.ThrottleRate
+	failed := i.rand.Float64() < faults.ErrorRate
+	if throttled || failed {
+		i.injected[call]++
+	}
+	i.mutex.Unlock()
+
+	if faults.Latency > 0 {
+		i.clock.Sleep(faults.Latency)
+	}
+	switch {
+	case throttled:
+		rerr := &retry.Error{
+			HTTPStatusCode: http.StatusTooManyRequests,
+			Retriable:      true,
+			RawError:       fmt.Errorf("injected throttling of %s on %s", call, target),
+		}
+		if faults.RetryAfter > 0 {
+			rerr.RetryAfter = i.clock.Now().Add(faults.RetryAfter)
+		}
+		return rerr
+	case failed:
+		return &retry.Error{
+			HTTPStatusCode: http.StatusInternalServerError,
+			Retriable:      true,
+			RawError:       fmt.Errorf("injected failure of %s on %s", call, target),
+		}
+	}
+	return nil
+}
+
+// Calls returns how many times faults could be injected into call.
+func (i *Injector) Calls(call string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.calls[call]
+}
+
+// Injected returns how many times call was failed or throttled.
+func (i *Injector) Injected(call string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.injected[call]
+}
+
+func (f Faults) applies(call string) bool {
+	if len(f.Calls) == 0 {
+		return true
+	}
+	for _, c := range f.Calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cachetest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func TestInjector(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := testingclock.NewFakeClock(start)
+	injector := NewInjector(clk, 1, Faults{})
+	assert.Nil(t, injector.Inject("VirtualMachinesClient.List", "rg"))
+
+	injector.SetFaults(Faults{ThrottleRate: 1, RetryAfter: time.Minute, Latency: time.Second, Calls: []string{"VirtualMachinesClient.List"}})
+	assert.Nil(t, injector.Inject("VirtualMachineScaleSetsClient.List", "rg"), "only the listed calls are faulted")
+	rerr := injector.Inject("VirtualMachinesClient.List", "rg")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusTooManyRequests, rerr.HTTPStatusCode)
+	assert.Equal(t, start.Add(time.Second), clk.Now(), "latency advances the fake clock")
+	assert.Equal(t, start.Add(time.Second+time.Minute), rerr.RetryAfter)
+
+	injector.SetFaults(Faults{ErrorRate: 1})
+	rerr = injector.Inject("VirtualMachinesClient.List", "rg")
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusInternalServerError, rerr.HTTPStatusCode)
+	assert.Equal(t, 3, injector.Calls("VirtualMachinesClient.List"))
+	assert.Equal(t, 2, injector.Injected("VirtualMachinesClient.List"))
+}
+
+func TestInjectorIsDeterministic(t *testing.T) {
+	outcomes := func() []bool {
+		injector := NewInjector(testingclock.NewFakeClock(time.Now()), 42, Faults{ErrorRate: 0.5})
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			failed = append(failed, injector.Inject("VirtualMachinesClient.List", "rg") != nil)
+		}
+		return failed
+	}
+	first := outcomes()
+	assert.Equal(t, first, outcomes())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
@@ -90,6 +90,10 @@ var AvailableCloudProviders = []string{
 // DefaultCloudProvider is GCE.
 const DefaultCloudProvider = cloudprovider.GceProviderName
 
+func init() {
+	standbyWarmers[cloudprovider.AzureProviderName] = azure.WarmStandbyCache
+}
+
 func buildCloudProvider(opts config.AutoscalingOptions,
 	do cloudprovider.NodeGroupDiscoveryOptions,
 	rl *cloudprovider.ResourceLimiter,
@@ -34,6 +34,10 @@ var AvailableCloudProviders = []string{
 // DefaultCloudProvider on Azure-only build is Azure.
 const DefaultCloudProvider = cloudprovider.AzureProviderName
 
+func init() {
+	standbyWarmers[cloudprovider.AzureProviderName] = azure.WarmStandbyCache
+}
+
 func buildCloudProvider(opts config.AutoscalingOptions, do cloudprovider.NodeGroupDiscoveryOptions, rl *cloudprovider.ResourceLimiter, _ informers.SharedInformerFactory) cloudprovider.CloudProvider {
 	switch opts.CloudProviderName {
 	case cloudprovider.AzureProviderName:
@@ -17,6 +17,8 @@ limitations under the License.
 package builder
 
 import (
+	ctx "context"
+
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/config"
 	"k8s.io/autoscaler/cluster-autoscaler/context"
@@ -51,3 +53,14 @@ func NewCloudProvider(opts config.AutoscalingOptions, informerFactory informers.
 	klog.Fatalf("Unknown cloud provider: %s", opts.CloudProviderName)
 	return nil // This will never happen because the Fatalf will os.Exit
 }
+
+// standbyWarmers keep the state of a cloud provider warm on replicas waiting for leadership, by provider name.
+var standbyWarmers = map[string]func(ctx.Context, config.AutoscalingOptions){}
+
+// WarmStandby keeps the state of the configured cloud provider warm until standbyCtx is done, if the provider
+// supports it, so that it starts faster once the replica is elected. It blocks until standbyCtx is done.
+func WarmStandby(standbyCtx ctx.Context, opts config.AutoscalingOptions) {
+	if warm, found := standbyWarmers[opts.CloudProviderName]; found {
+		warm(standbyCtx, opts)
+	}
+}
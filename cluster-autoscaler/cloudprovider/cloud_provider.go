@@ -334,6 +334,47 @@ type PricingModel interface {
 	PodPrice(pod *apiv1.Pod, startTime time.Time, endTime time.Time) (float64, error)
 }
 
+// ProviderHealth is the health of the cloud provider backend.
+type ProviderHealth struct {
+	// Degraded is true when the backend is slow or failing, e.g. throttling requests.
+	Degraded bool
+	// Reason describes why the backend is degraded.
+	Reason string
+	// LoopDelay is how much longer to wait before the next autoscaler iteration while degraded, so that
+	// iterations don't pile up requests against the struggling backend.
+	LoopDelay time.Duration
+}
+
+// ProviderHealthReporter is implemented by cloud providers which report the health of their backend,
+// so that the autoscaler loop backs off while it is degraded. Implementation optional.
+type ProviderHealthReporter interface {
+	// ProviderHealth returns the current health of the cloud provider backend.
+	ProviderHealth() ProviderHealth
+}
+
+// InstanceHealthHinter is implemented by cloud providers which detect that the instances backing nodes are
+// unhealthy, e.g. stopped or failing their health probes, so that the unready nodes they back are removed
+// without waiting for the scale-down unready time. Implementation optional.
+type InstanceHealthHinter interface {
+	// UnhealthyInstance returns whether the instance backing the node is known to be unhealthy, and why.
+	UnhealthyInstance(node *apiv1.Node) (bool, string)
+}
+
+// NodeGroupAnnotator is implemented by cloud providers which report signals about node groups, e.g. their recent
+// failures, as annotations for expanders. Unlike the annotations of template nodes, they are set on the node infos
+// of node groups whether these are built from a template or from a real node. Implementation optional.
+type NodeGroupAnnotator interface {
+	// NodeGroupAnnotations returns the annotations to set on the node infos of the node group.
+	NodeGroupAnnotations(nodeGroup NodeGroup) map[string]string
+}
+
+// DeletionHoldReporter is implemented by cloud providers which hold nodes from deletion, so that held nodes are
+// kept out of scale-down candidates before they are drained. Implementation optional.
+type DeletionHoldReporter interface {
+	// DeletionHeld returns whether the node is held from deletion, and why.
+	DeletionHeld(node *apiv1.Node) (bool, string)
+}
+
 const (
 	// ResourceNameCores is string name for cores. It's used by ResourceLimiter.
 	ResourceNameCores = "cpu"
@@ -71,6 +71,14 @@ type GCEOptions struct {
 	BulkMigInstancesListingEnabled bool
 }
 
+// AzureOptions contain autoscaling options specific to Azure cloud provider.
+type AzureOptions struct {
+	// ConfigOverrides is a list of key=value pairs overriding individual fields of the Azure cloud config,
+	// keyed by their JSON name (e.g. enableVMsAgentPool=true). They take precedence over both the
+	// config file and the environment variables.
+	ConfigOverrides []string
+}
+
 const (
 	// DefaultMaxAllocatableDifferenceRatio describes how Node.Status.Allocatable can differ between groups in the same NodeGroupSet
 	DefaultMaxAllocatableDifferenceRatio = 0.05
@@ -144,6 +152,9 @@ type AutoscalingOptions struct {
 	ScaleUpFromZero bool
 	// ParallelScaleUp defines whether CA can scale up node groups in parallel.
 	ParallelScaleUp bool
+	// MaxParallelScaleUps bounds how many node groups are scaled up concurrently when ParallelScaleUp is enabled.
+	// Unbounded if 0.
+	MaxParallelScaleUps int
 	// CloudConfig is the path to the cloud provider configuration file. Empty string for no configuration file.
 	CloudConfig string
 	// CloudProviderName sets the type of the cloud provider CA is about to run in. Allowed values: gce, aws
@@ -230,6 +241,8 @@ type AutoscalingOptions struct {
 	AWSUseStaticInstanceList bool
 	// GCEOptions contain autoscaling options specific to GCE cloud provider.
 	GCEOptions GCEOptions
+	// AzureOptions contain autoscaling options specific to Azure cloud provider.
+	AzureOptions AzureOptions
 	// KubeClientOpts specify options for kube client
 	KubeClientOpts KubeClientOptions
 	// ClusterAPICloudConfigAuthoritative tells the Cluster API provider to treat the CloudConfig option as authoritative and
@@ -123,6 +123,7 @@ var (
 	okTotalUnreadyCount       = flag.Int("ok-total-unready-count", 3, "Number of allowed unready nodes, irrespective of max-total-unready-percentage")
 	scaleUpFromZero           = flag.Bool("scale-up-from-zero", true, "Should CA scale up when there are 0 ready nodes.")
 	parallelScaleUp           = flag.Bool("parallel-scale-up", false, "Whether to allow parallel node groups scale up. Experimental: may not work on some cloud providers, enable at your own risk.")
+	maxParallelScaleUps       = flag.Int("max-parallel-scale-ups", 0, "Maximum number of node groups scaled up concurrently when parallel-scale-up is enabled. 0 means unbounded.")
 	maxNodeProvisionTime      = flag.Duration("max-node-provision-time", 15*time.Minute, "The default maximum time CA waits for node to be provisioned - the value can be overridden per node group")
 	maxPodEvictionTime        = flag.Duration("max-pod-eviction-time", 2*time.Minute, "Maximum time CA tries to evict a pod before giving up")
 	nodeGroupsFlag            = multiStringFlag(
@@ -167,6 +168,7 @@ var (
 	balancingIgnoreLabelsFlag = multiStringFlag("balancing-ignore-label", "Specifies a label to ignore in addition to the basic and cloud-provider set of labels when comparing if two node groups are similar")
 	balancingLabelsFlag       = multiStringFlag("balancing-label", "Specifies a label to use for comparing if two node groups are similar, rather than the built in heuristics. Setting this flag disables all other comparison logic, and cannot be combined with --balancing-ignore-label.")
 	awsUseStaticInstanceList  = flag.Bool("aws-use-static-instance-list", false, "Should CA fetch instance types in runtime or use a static list. AWS only")
+	azureConfigOverridesFlag  = multiStringFlag("azure-config-override", "Overrides a single Azure cloud config field after the config file and environment variables are parsed, in the format <jsonFieldName>=<value>, e.g. enableVMsAgentPool=true. Can be passed multiple times. Azure only")
 
 	// GCE specific flags
 	concurrentGceRefreshes             = flag.Int("gce-concurrent-refreshes", 1, "Maximum number of concurrent refreshes per cloud object type.")
@@ -297,6 +299,7 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 		OkTotalUnreadyCount:              *okTotalUnreadyCount,
 		ScaleUpFromZero:                  *scaleUpFromZero,
 		ParallelScaleUp:                  *parallelScaleUp,
+		MaxParallelScaleUps:              *maxParallelScaleUps,
 		EstimatorName:                    *estimatorFlag,
 		ExpanderNames:                    *expanderFlag,
 		GRPCExpanderCert:                 *grpcExpanderCert,
@@ -353,6 +356,9 @@ func createAutoscalingOptions() config.AutoscalingOptions {
 			LocalSSDDiskSizeProvider:       localssdsize.NewSimpleLocalSSDProvider(),
 			BulkMigInstancesListingEnabled: *bulkGceMigInstancesListingEnabled,
 		},
+		AzureOptions: config.AzureOptions{
+			ConfigOverrides: *azureConfigOverridesFlag,
+		},
 		ClusterAPICloudConfigAuthoritative: *clusterAPICloudConfigAuthoritative,
 		CordonNodeBeforeTerminate:          *cordonNodeBeforeTerminate,
 		DaemonSetEvictionForEmptyNodes:     *daemonSetEvictionForEmptyNodes,
@@ -170,6 +170,9 @@ func (n *Nodes) unremovableReason(context *context.AutoscalingContext, scaleDown
 		if !v.since.Add(unneededTime).Before(ts) {
 			return simulator.NotUnneededLongEnough
 		}
+	} else if unhealthy, reason := unhealthyInstance(context.CloudProvider, node); unhealthy {
+		// The node is not going to become ready, no point waiting for it.
+		klog.V(2).Infof("Node %s is unready and its instance is unhealthy (%s), not waiting for the scale-down unready time", node.Name, reason)
 	} else {
 		// Unready nodes may be deleted after a different time than underutilized nodes.
 		unreadyTime, err := n.sdtg.GetScaleDownUnreadyTime(nodeGroup)
@@ -212,6 +215,15 @@ func (n *Nodes) unremovableReason(context *context.AutoscalingContext, scaleDown
 	return simulator.NoReason
 }
 
+// unhealthyInstance returns whether the cloud provider hints that the instance backing the node is unhealthy.
+func unhealthyInstance(provider cloudprovider.CloudProvider, node *apiv1.Node) (bool, string) {
+	hinter, ok := provider.(cloudprovider.InstanceHealthHinter)
+	if !ok {
+		return false, ""
+	}
+	return hinter.UnhealthyInstance(node)
+}
+
 func (n *Nodes) splitEmptyAndNonEmptyNodes() (empty, needDrain map[string]*node) {
 	empty = make(map[string]*node)
 	needDrain = make(map[string]*node)
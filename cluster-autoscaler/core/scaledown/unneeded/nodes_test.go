@@ -215,6 +215,54 @@ func TestRemovableAt(t *testing.T) {
 	}
 }
 
+type fakeInstanceHealthHinter struct {
+	*testprovider.TestCloudProvider
+	unhealthy map[string]bool
+}
+
+func (f *fakeInstanceHealthHinter) UnhealthyInstance(node *apiv1.Node) (bool, string) {
+	return f.unhealthy[node.Name], "stopped"
+}
+
+func TestRemovableAtUnhealthyInstance(t *testing.T) {
+	ng := testprovider.NewTestNodeGroup("ng", 100, 0, 10, true, false, "", nil, nil)
+	var removableNodes []simulator.NodeToBeRemoved
+	for i := 0; i < 2; i++ {
+		node := BuildTestNode(fmt.Sprintf("unready-%d", i), 10, 100)
+		SetNodeReadyState(node, false, time.Now())
+		removableNodes = append(removableNodes, simulator.NodeToBeRemoved{Node: node})
+	}
+	provider := &fakeInstanceHealthHinter{
+		TestCloudProvider: testprovider.NewTestCloudProviderBuilder().Build(),
+		unhealthy:         map[string]bool{"unready-0": true},
+	}
+	provider.InsertNodeGroup(ng)
+	for _, node := range removableNodes {
+		provider.AddNode("ng", node.Node)
+	}
+
+	rsLister, err := kube_util.NewTestReplicaSetLister(nil)
+	assert.NoError(t, err)
+	registry := kube_util.NewListerRegistry(nil, nil, nil, nil, nil, nil, nil, rsLister, nil)
+	ctx, err := NewScaleTestAutoscalingContext(config.AutoscalingOptions{ScaleDownSimulationTimeout: 5 * time.Minute}, &fake.Clientset{}, registry, provider, nil, nil)
+	assert.NoError(t, err)
+
+	n := NewNodes(&fakeScaleDownTimeGetter{unreadyTime: time.Hour}, &resource.LimitsFinder{})
+	n.Update(removableNodes, time.Now())
+	empty, drain, unremovable := n.RemovableAt(&ctx, nodes.ScaleDownContext{
+		ActuationStatus:     &fakeActuationStatus{},
+		ResourcesLeft:       resource.Limits{},
+		ResourcesWithLimits: []string{},
+	}, time.Now())
+	assert.Empty(t, drain)
+	if assert.Len(t, empty, 1) {
+		assert.Equal(t, "unready-0", empty[0].Node.Name)
+	}
+	if assert.Len(t, unremovable, 1) {
+		assert.Equal(t, simulator.NotUnreadyLongEnough, unremovable[0].Reason)
+	}
+}
+
 type fakeActuationStatus struct {
 	recentEvictions []*apiv1.Pod
 	deletionCount   map[string]int
@@ -236,12 +284,14 @@ func (f *fakeActuationStatus) DeletionsCount(nodeGroup string) int {
 	return f.deletionCount[nodeGroup]
 }
 
-type fakeScaleDownTimeGetter struct{}
+type fakeScaleDownTimeGetter struct {
+	unreadyTime time.Duration
+}
 
 func (f *fakeScaleDownTimeGetter) GetScaleDownUnneededTime(cloudprovider.NodeGroup) (time.Duration, error) {
 	return 0 * time.Second, nil
 }
 
 func (f *fakeScaleDownTimeGetter) GetScaleDownUnreadyTime(cloudprovider.NodeGroup) (time.Duration, error) {
-	return 0 * time.Second, nil
+	return f.unreadyTime, nil
 }
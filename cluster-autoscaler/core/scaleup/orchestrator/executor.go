@@ -18,6 +18,7 @@ package orchestrator
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -79,17 +80,20 @@ func (e *scaleUpExecutor) executeScaleUpsSync(
 	atomic bool,
 ) (errors.AutoscalerError, []cloudprovider.NodeGroup) {
 	availableGPUTypes := e.autoscalingContext.CloudProvider.GetAvailableGPUTypes()
+	var results []scaleUpResult
 	for _, scaleUpInfo := range scaleUpInfos {
 		nodeInfo, ok := nodeInfos[scaleUpInfo.Group.Id()]
 		if !ok {
 			klog.Errorf("ExecuteScaleUp: failed to get node info for node group %s", scaleUpInfo.Group.Id())
 			continue
 		}
-		if aErr := e.executeScaleUp(scaleUpInfo, nodeInfo, availableGPUTypes, now, atomic); aErr != nil {
-			return aErr, []cloudprovider.NodeGroup{scaleUpInfo.Group}
+		result := e.timedScaleUp(scaleUpInfo, nodeInfo, availableGPUTypes, now, atomic)
+		results = append(results, result)
+		if result.err != nil {
+			break
 		}
 	}
-	return nil, nil
+	return aggregateScaleUpResults(results)
 }
 
 func (e *scaleUpExecutor) executeScaleUpsParallel(
@@ -101,44 +105,83 @@ func (e *scaleUpExecutor) executeScaleUpsParallel(
 	if err := checkUniqueNodeGroups(scaleUpInfos); err != nil {
 		return err, extractNodeGroups(scaleUpInfos)
 	}
-	type errResult struct {
-		err  errors.AutoscalerError
-		info *nodegroupset.ScaleUpInfo
+	// Each scale-up fills in its own result, skipped ones are left nil.
+	results := make([]*scaleUpResult, len(scaleUpInfos))
+	// slots bounds the number of concurrent scale-ups, unbounded if nil.
+	var slots chan struct{}
+	if limit := e.autoscalingContext.AutoscalingOptions.MaxParallelScaleUps; limit > 0 {
+		slots = make(chan struct{}, limit)
 	}
-	scaleUpsLen := len(scaleUpInfos)
-	errResults := make(chan errResult, scaleUpsLen)
 	var wg sync.WaitGroup
-	wg.Add(scaleUpsLen)
+	wg.Add(len(scaleUpInfos))
 	availableGPUTypes := e.autoscalingContext.CloudProvider.GetAvailableGPUTypes()
-	for _, scaleUpInfo := range scaleUpInfos {
-		go func(info nodegroupset.ScaleUpInfo) {
+	for i, scaleUpInfo := range scaleUpInfos {
+		go func(i int, info nodegroupset.ScaleUpInfo) {
 			defer wg.Done()
 			nodeInfo, ok := nodeInfos[info.Group.Id()]
 			if !ok {
 				klog.Errorf("ExecuteScaleUp: failed to get node info for node group %s", info.Group.Id())
 				return
 			}
-			if aErr := e.executeScaleUp(info, nodeInfo, availableGPUTypes, now, atomic); aErr != nil {
-				errResults <- errResult{err: aErr, info: &info}
+			if slots != nil {
+				slots <- struct{}{}
+				defer func() { <-slots }()
 			}
-		}(scaleUpInfo)
+			result := e.timedScaleUp(info, nodeInfo, availableGPUTypes, now, atomic)
+			results[i] = &result
+		}(i, scaleUpInfo)
 	}
 	wg.Wait()
-	close(errResults)
-	var results []errResult
-	for err := range errResults {
-		results = append(results, err)
-	}
-	if len(results) > 0 {
-		failedNodeGroups := make([]cloudprovider.NodeGroup, len(results))
-		scaleUpErrors := make([]errors.AutoscalerError, len(results))
-		for i, result := range results {
-			failedNodeGroups[i] = result.info.Group
-			scaleUpErrors[i] = result.err
+	var executed []scaleUpResult
+	for _, result := range results {
+		if result != nil {
+			executed = append(executed, *result)
 		}
-		return errors.Combine(scaleUpErrors), failedNodeGroups
 	}
-	return nil, nil
+	return aggregateScaleUpResults(executed)
+}
+
+// scaleUpResult is the outcome of the scale-up of a node group.
+type scaleUpResult struct {
+	info     nodegroupset.ScaleUpInfo
+	err      errors.AutoscalerError
+	duration time.Duration
+}
+
+func (e *scaleUpExecutor) timedScaleUp(
+	info nodegroupset.ScaleUpInfo,
+	nodeInfo *framework.NodeInfo,
+	availableGPUTypes map[string]struct{},
+	now time.Time,
+	atomic bool,
+) scaleUpResult {
+	start := time.Now()
+	err := e.executeScaleUp(info, nodeInfo, availableGPUTypes, now, atomic)
+	return scaleUpResult{info: info, err: err, duration: time.Since(start)}
+}
+
+// aggregateScaleUpResults logs the outcomes of the scale-ups of several node groups in one summary, and returns
+// the combined error of the failed ones, together with the failed node groups.
+func aggregateScaleUpResults(results []scaleUpResult) (errors.AutoscalerError, []cloudprovider.NodeGroup) {
+	var failedNodeGroups []cloudprovider.NodeGroup
+	var scaleUpErrors []errors.AutoscalerError
+	outcomes := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.err != nil {
+			failedNodeGroups = append(failedNodeGroups, result.info.Group)
+			scaleUpErrors = append(scaleUpErrors, result.err)
+			outcomes = append(outcomes, fmt.Sprintf("%s failed after %v", result.info.Group.Id(), result.duration))
+			continue
+		}
+		outcomes = append(outcomes, fmt.Sprintf("%s +%d in %v", result.info.Group.Id(), result.info.NewSize-result.info.CurrentSize, result.duration))
+	}
+	if len(results) > 1 {
+		klog.V(1).Infof("Scale-up of %d node groups, %d failed: %s", len(results), len(failedNodeGroups), strings.Join(outcomes, ", "))
+	}
+	if len(scaleUpErrors) == 0 {
+		return nil, nil
+	}
+	return errors.Combine(scaleUpErrors), failedNodeGroups
 }
 
 func (e *scaleUpExecutor) increaseSize(nodeGroup cloudprovider.NodeGroup, increase int, atomic bool) error {
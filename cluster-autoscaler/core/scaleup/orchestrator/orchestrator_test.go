@@ -546,6 +546,41 @@ func TestScaleUpTwoGroups(t *testing.T) {
 	}
 }
 
+func TestBoundedParallelScaleUp(t *testing.T) {
+	options := defaultOptions
+	options.BalanceSimilarNodeGroups = true
+	options.ParallelScaleUp = true
+	options.MaxParallelScaleUps = 1
+	var inFlight, maxInFlight atomic.Int32
+	config := &ScaleUpTestConfig{
+		Nodes: []NodeConfig{
+			{Name: "ng1-n1", Cpu: 1500, Memory: 1000 * utils.MiB, Ready: true, Group: "ng1"},
+			{Name: "ng2-n1", Cpu: 1500, Memory: 1000 * utils.MiB, Ready: true, Group: "ng2"},
+		},
+		Pods: []PodConfig{
+			{Name: "p1", Cpu: 1400, Node: "ng1-n1"},
+			{Name: "p2", Cpu: 1400, Node: "ng2-n1"},
+		},
+		ExtraPods: []PodConfig{
+			{Name: "p3", Cpu: 1400},
+			{Name: "p4", Cpu: 1400},
+		},
+		OnScaleUp: func(group string, increase int) error {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for max := maxInFlight.Load(); current > max && !maxInFlight.CompareAndSwap(max, current); max = maxInFlight.Load() {
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+		Options: &options,
+	}
+	result := runSimpleScaleUpTest(t, config)
+	assert.True(t, result.ScaleUpStatus.WasSuccessful())
+	assert.Equal(t, map[string]int{"ng1": 2, "ng2": 2}, result.GroupTargetSizes)
+	assert.Equal(t, int32(1), maxInFlight.Load())
+}
+
 func TestCloudProviderFailingToScaleUpGroups(t *testing.T) {
 	options := defaultOptions
 	options.BalanceSimilarNodeGroups = true
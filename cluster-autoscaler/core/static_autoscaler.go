@@ -211,6 +211,14 @@ func (a *StaticAutoscaler) LastScaleUpTime() time.Time {
 	return a.lastScaleUpTime
 }
 
+// ProviderHealth returns the health of the cloud provider backend, healthy if the cloud provider doesn't report it.
+func (a *StaticAutoscaler) ProviderHealth() cloudprovider.ProviderHealth {
+	if reporter, ok := a.AutoscalingContext.CloudProvider.(cloudprovider.ProviderHealthReporter); ok {
+		return reporter.ProviderHealth()
+	}
+	return cloudprovider.ProviderHealth{}
+}
+
 // LastScaleDownDeleteTime returns the last successful scale down time
 func (a *StaticAutoscaler) LastScaleDownDeleteTime() time.Time {
 	return a.lastScaleDownDeleteTime
@@ -54,6 +54,7 @@ import (
 	. "k8s.io/autoscaler/cluster-autoscaler/core/test"
 	core_utils "k8s.io/autoscaler/cluster-autoscaler/core/utils"
 	"k8s.io/autoscaler/cluster-autoscaler/estimator"
+	"k8s.io/autoscaler/cluster-autoscaler/loop"
 	"k8s.io/autoscaler/cluster-autoscaler/observers/loopstart"
 	ca_processors "k8s.io/autoscaler/cluster-autoscaler/processors"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/nodegroupconfig"
@@ -2875,3 +2876,24 @@ func assertNodesSoftTaintsStatus(t *testing.T, fakeClient *fake.Clientset, nodes
 		assert.Equal(t, tainted, taints.HasDeletionCandidateTaint(newNode))
 	}
 }
+
+type providerHealthReportingCloudProvider struct {
+	*testprovider.TestCloudProvider
+	health cloudprovider.ProviderHealth
+}
+
+func (p *providerHealthReportingCloudProvider) ProviderHealth() cloudprovider.ProviderHealth {
+	return p.health
+}
+
+func TestStaticAutoscalerProviderHealth(t *testing.T) {
+	provider := testprovider.NewTestCloudProviderBuilder().Build()
+	autoscaler := &StaticAutoscaler{AutoscalingContext: &context.AutoscalingContext{CloudProvider: provider}}
+	assert.Equal(t, cloudprovider.ProviderHealth{}, autoscaler.ProviderHealth(), "providers not reporting their health are healthy")
+	assert.Zero(t, loop.ProviderLoopDelay(autoscaler))
+
+	health := cloudprovider.ProviderHealth{Degraded: true, Reason: "throttled", LoopDelay: time.Minute}
+	autoscaler.CloudProvider = &providerHealthReportingCloudProvider{TestCloudProvider: provider, health: health}
+	assert.Equal(t, health, autoscaler.ProviderHealth())
+	assert.Equal(t, time.Minute, loop.ProviderLoopDelay(autoscaler))
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+
+	"k8s.io/autoscaler/cluster-autoscaler/expander/grpcplugin/azureexpander"
+	klog "k8s.io/klog/v2"
+)
+
+func main() {
+	certPath := flag.String("cert-path", "", "Path to cert file for gRPC Expander Server")
+	keyPath := flag.String("key-path", "", "Path to private key for gRPC Expander Server")
+	port := flag.Uint("port", 7000, "Port number for server to listen on")
+	retailPricesURL := flag.String("retail-prices-url", azureexpander.DefaultRetailPricesURL, "Azure Retail Prices API endpoint, empty to only use the node template costs")
+	priceCacheTTL := flag.Duration("price-cache-ttl", azureexpander.DefaultPriceCacheTTL, "How long retail prices are cached")
+	evictionRatesPath := flag.String("eviction-rates-path", "", "Path to a JSON object mapping VM SKU names to their spot eviction rate, between 0 and 1")
+	evictionRatePenalty := flag.Float64("eviction-rate-penalty", azureexpander.DefaultEvictionRatePenalty, "How much the spot eviction rate increases the effective cost of an option")
+	stockoutWindow := flag.Duration("stockout-window", azureexpander.DefaultStockoutWindow, "How long a node group is deprioritized after a stockout")
+	minHealthScore := flag.Float64("min-health-score", azureexpander.DefaultMinHealthScore, "Health score reported by the Azure provider under which a node group is deprioritized")
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	options := azureexpander.Options{
+		EvictionRatePenalty: *evictionRatePenalty,
+		StockoutWindow:      *stockoutWindow,
+		MinHealthScore:      *minHealthScore,
+	}
+	if *retailPricesURL != "" {
+		options.Prices = azureexpander.NewRetailPriceProvider(*retailPricesURL, *priceCacheTTL)
+	}
+	if *evictionRatesPath != "" {
+		rates, err := azureexpander.LoadEvictionRates(*evictionRatesPath)
+		if err != nil {
+			klog.Fatalf("Failed to load eviction rates: %v", err)
+		}
+		options.EvictionRates = rates
+	}
+
+	if err := azureexpander.Serve(*certPath, *keyPath, *port, options); err != nil {
+		klog.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexpander
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetailPricesURL is the endpoint of the public Azure Retail Prices API.
+	DefaultRetailPricesURL = "https://prices.azure.com/api/retail/prices"
+	// DefaultPriceCacheTTL is how long retail prices are cached.
+	DefaultPriceCacheTTL = 6 * time.Hour
+)
+
+// PriceProvider returns the hourly price of a VM SKU in a region.
+type PriceProvider interface {
+	HourlyPrice(ctx context.Context, sku, region string, spot bool) (float64, error)
+}
+
+// RetailPriceProvider is a PriceProvider backed by the Azure Retail Prices API, returning Linux pay-as-you-go prices.
+type RetailPriceProvider struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mutex  sync.Mutex
+	prices map[priceKey]cachedPrice
+}
+
+type priceKey struct {
+	sku    string
+	region string
+	spot   bool
+}
+
+type cachedPrice struct {
+	price     float64
+	fetchedAt time.Time
+}
+
+type retailPricesResponse struct {
+	Items        []retailPriceItem `json:"Items"`
+	NextPageLink string            `json:"NextPageLink"`
+}
+
+type retailPriceItem struct {
+	RetailPrice   float64 `json:"retailPrice"`
+	SkuName       string  `json:"skuName"`
+	ProductName   string  `json:"productName"`
+	UnitOfMeasure string  `json:"unitOfMeasure"`
+}
+
+// NewRetailPriceProvider returns a RetailPriceProvider querying the given Retail Prices API endpoint
+// and caching prices for ttl.
+func NewRetailPriceProvider(url string, ttl time.Duration) *RetailPriceProvider {
+	return &RetailPriceProvider{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 30 * time.Second},
+		prices: make(map[priceKey]cachedPrice),
+	}
+}
+
+// HourlyPrice returns the cached hourly price of the SKU, fetching it if missing or expired.
+func (p *RetailPriceProvider) HourlyPrice(ctx context.Context, sku, region string, spot bool) (float64, error) {
+	key := priceKey{sku: strings.ToLower(sku), region: strings.ToLower(region), spot: spot}
+	p.mutex.Lock()
+	cached, found := p.prices[key]
+	p.mutex.Unlock()
+	if found && time.Since(cached.fetchedAt) < p.ttl {
+		return cached.price, nil
+	}
+
+	price, err := p.fetchPrice(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	p.mutex.Lock()
+	p.prices[key] = cachedPrice{price: price, fetchedAt: time.Now()}
+	p.mutex.Unlock()
+	return price, nil
+}
+
+func (p *RetailPriceProvider) fetchPrice(ctx context.Context, key priceKey) (float64, error) {
+	filter := fmt.Sprintf("serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and armRegionName eq '%s' and armSkuName eq '%s'",
+		key.region, key.sku)
+	next := p.url + "?$filter=" + url.QueryEscape(filter)
+
+	for next != "" {
+		resp, err := p.fetchPage(ctx, next)
+		if err != nil {
+			return 0, err
+		}
+		for _, item := range resp.Items {
+			if matchesPriceItem(item, key.spot) {
+				return item.RetailPrice, nil
+			}
+		}
+		next = resp.NextPageLink
+	}
+	return 0, fmt.Errorf("no retail price found for SKU %s in region %s (spot: %t)", key.sku, key.region, key.spot)
+}
+
+func (p *RetailPriceProvider) fetchPage(ctx context.Context, pageURL string) (*retailPricesResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("retail prices API returned status code %d", httpResp.StatusCode)
+	}
+
+	resp := &retailPricesResponse{}
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// matchesPriceItem returns whether the item is the hourly Linux price of the requested priority.
+func matchesPriceItem(item retailPriceItem, spot bool) bool {
+	if item.UnitOfMeasure != "1 Hour" || strings.Contains(item.ProductName, "Windows") ||
+		strings.Contains(item.SkuName, "Low Priority") {
+		return false
+	}
+	return strings.HasSuffix(item.SkuName, " Spot") == spot
+}
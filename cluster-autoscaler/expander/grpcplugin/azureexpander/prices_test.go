@@ -0,0 +1,58 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexpander
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetailPriceProvider(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Contains(t, r.URL.Query().Get("$filter"), "armSkuName eq 'standard_d4s_v3'")
+		resp := retailPricesResponse{Items: []retailPriceItem{
+			{RetailPrice: 0.3, SkuName: "D4s v3", ProductName: "Virtual Machines DSv3 Series Windows", UnitOfMeasure: "1 Hour"},
+			{RetailPrice: 0.02, SkuName: "D4s v3 Low Priority", ProductName: "Virtual Machines DSv3 Series", UnitOfMeasure: "1 Hour"},
+			{RetailPrice: 0.04, SkuName: "D4s v3 Spot", ProductName: "Virtual Machines DSv3 Series", UnitOfMeasure: "1 Hour"},
+			{RetailPrice: 0.192, SkuName: "D4s v3", ProductName: "Virtual Machines DSv3 Series", UnitOfMeasure: "1 Hour"},
+		}}
+		assert.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	provider := NewRetailPriceProvider(server.URL, time.Hour)
+	price, err := provider.HourlyPrice(context.Background(), "Standard_D4s_v3", "eastus", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.192, price)
+
+	price, err = provider.HourlyPrice(context.Background(), "Standard_D4s_v3", "eastus", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.04, price)
+
+	// Prices are cached.
+	_, err = provider.HourlyPrice(context.Background(), "Standard_D4s_v3", "EastUS", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
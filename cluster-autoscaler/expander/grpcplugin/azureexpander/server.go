@@ -0,0 +1,237 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexpander
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/expander/grpcplugin/protos"
+	klog "k8s.io/klog/v2"
+)
+
+// Node template metadata set by the Azure cloud provider.
+const (
+	spotPriorityNodeLabelKey   = "kubernetes.azure.com/scalesetpriority"
+	spotPriorityNodeLabelValue = "spot"
+	hourlyCostAnnotationKey    = "cluster-autoscaler.kubernetes.io/azure-hourly-cost"
+	lastStockoutAnnotationKey  = "cluster-autoscaler.kubernetes.io/azure-last-stockout"
+	healthScoreAnnotationKey   = "cluster-autoscaler.kubernetes.io/azure-health-score"
+)
+
+const (
+	// DefaultStockoutWindow is how long a node group is deprioritized after a stockout.
+	DefaultStockoutWindow = 30 * time.Minute
+	// DefaultMinHealthScore is the health score under which a node group is deprioritized.
+	DefaultMinHealthScore = 0.5
+	// DefaultEvictionRatePenalty scales how much the spot eviction rate increases the effective cost of an option.
+	DefaultEvictionRatePenalty = 1.0
+)
+
+// Options configure how the Server ranks expansion options.
+type Options struct {
+	// Prices returns live hourly prices. When nil, or when it fails, the hourly cost annotation of template nodes is used.
+	Prices PriceProvider
+	// EvictionRates maps lower-cased VM SKU names to their spot eviction rate, between 0 and 1.
+	EvictionRates map[string]float64
+	// EvictionRatePenalty scales how much the spot eviction rate increases the effective cost of an option.
+	EvictionRatePenalty float64
+	// StockoutWindow is how long a node group is deprioritized after a stockout reported on its node info.
+	StockoutWindow time.Duration
+	// MinHealthScore is the health score reported on node infos under which a node group is deprioritized.
+	MinHealthScore float64
+}
+
+// Server is an Expander server ranking Azure node group expansion options by hourly cost, adjusted for
+// spot eviction rates, after node groups that recently ran out of capacity or are unhealthy.
+type Server struct {
+	options Options
+	now     func() time.Time
+}
+
+// NewServer returns a Server ranking expansion options with the given options.
+func NewServer(options Options) *Server {
+	return &Server{options: options, now: time.Now}
+}
+
+// Serve starts serving the Server over gRPC on the given port, using TLS if both certPath and keyPath are set.
+func Serve(certPath, keyPath string, port uint, options Options) error {
+	var serverOptions []grpc.ServerOption
+	if certPath != "" && keyPath != "" {
+		tlsCredentials, err := credentials.NewServerTLSFromFile(certPath, keyPath)
+		if err != nil {
+			return fmt.Errorf("cannot load TLS credentials: %w", err)
+		}
+		serverOptions = append(serverOptions, grpc.Creds(tlsCredentials))
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
+	protos.RegisterExpanderServer(grpcServer, NewServer(options))
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	klog.Infof("Starting Azure expander server on port %d", port)
+	return grpcServer.Serve(listener)
+}
+
+// LoadEvictionRates reads a JSON object mapping VM SKU names to their spot eviction rate, between 0 and 1.
+func LoadEvictionRates(path string) (map[string]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rates := map[string]float64{}
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse eviction rates from %s: %w", path, err)
+	}
+	evictionRates := make(map[string]float64, len(rates))
+	for sku, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("eviction rate %f of SKU %s is not between 0 and 1", rate, sku)
+		}
+		evictionRates[strings.ToLower(sku)] = rate
+	}
+	return evictionRates, nil
+}
+
+type rankedOption struct {
+	option *protos.Option
+	// avoided is set for node groups which recently ran out of capacity or are unhealthy.
+	avoided bool
+	cost    float64
+}
+
+// BestOptions returns the cheapest options among those of healthy node groups without a recent stockout,
+// or among all options if every node group is avoided.
+func (s *Server) BestOptions(ctx context.Context, req *protos.BestOptionsRequest) (*protos.BestOptionsResponse, error) {
+	opts := req.GetOptions()
+	if len(opts) == 0 {
+		return &protos.BestOptionsResponse{}, nil
+	}
+
+	ranked := make([]rankedOption, 0, len(opts))
+	for _, opt := range opts {
+		node := req.GetNodeMap()[opt.NodeGroupId]
+		ranked = append(ranked, rankedOption{
+			option:  opt,
+			avoided: s.recentlyStockedOut(node) || s.unhealthy(node),
+			cost:    s.effectiveCost(ctx, opt, node),
+		})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].avoided != ranked[j].avoided {
+			return !ranked[i].avoided
+		}
+		return ranked[i].cost < ranked[j].cost
+	})
+
+	best := []*protos.Option{ranked[0].option}
+	for _, r := range ranked[1:] {
+		if r.avoided != ranked[0].avoided || r.cost != ranked[0].cost {
+			break
+		}
+		best = append(best, r.option)
+	}
+	for _, r := range ranked {
+		klog.V(4).Infof("Option %s: %d nodes, cost %f, avoided: %t", r.option.NodeGroupId, r.option.NodeCount, r.cost, r.avoided)
+	}
+	return &protos.BestOptionsResponse{Options: best}, nil
+}
+
+// effectiveCost returns the hourly cost of the option, increased by the eviction rate of spot nodes.
+// Options whose price is unknown are ranked last.
+func (s *Server) effectiveCost(ctx context.Context, opt *protos.Option, node *apiv1.Node) float64 {
+	if node == nil {
+		return math.Inf(1)
+	}
+	price, ok := s.nodePrice(ctx, node)
+	if !ok {
+		return math.Inf(1)
+	}
+
+	cost := price * float64(opt.NodeCount)
+	if isSpot(node) {
+		penalty := s.options.EvictionRatePenalty
+		if penalty == 0 {
+			penalty = DefaultEvictionRatePenalty
+		}
+		cost *= 1 + penalty*s.options.EvictionRates[strings.ToLower(node.Labels[apiv1.LabelInstanceTypeStable])]
+	}
+	return cost
+}
+
+func (s *Server) nodePrice(ctx context.Context, node *apiv1.Node) (float64, bool) {
+	sku := node.Labels[apiv1.LabelInstanceTypeStable]
+	region := node.Labels[apiv1.LabelTopologyRegion]
+	if s.options.Prices != nil && sku != "" && region != "" {
+		price, err := s.options.Prices.HourlyPrice(ctx, sku, region, isSpot(node))
+		if err == nil {
+			return price, true
+		}
+		klog.Warningf("Failed to get the price of SKU %s in region %s, falling back to the node template cost: %v", sku, region, err)
+	}
+
+	price, err := strconv.ParseFloat(node.Annotations[hourlyCostAnnotationKey], 64)
+	return price, err == nil
+}
+
+func (s *Server) recentlyStockedOut(node *apiv1.Node) bool {
+	if node == nil {
+		return false
+	}
+	at, err := time.Parse(time.RFC3339, node.Annotations[lastStockoutAnnotationKey])
+	if err != nil {
+		return false
+	}
+	window := s.options.StockoutWindow
+	if window == 0 {
+		window = DefaultStockoutWindow
+	}
+	return s.now().Sub(at) < window
+}
+
+// unhealthy returns whether the health score reported on the node info is under the minimum health score.
+func (s *Server) unhealthy(node *apiv1.Node) bool {
+	if node == nil {
+		return false
+	}
+	score, err := strconv.ParseFloat(node.Annotations[healthScoreAnnotationKey], 64)
+	if err != nil {
+		return false
+	}
+	minScore := s.options.MinHealthScore
+	if minScore == 0 {
+		minScore = DefaultMinHealthScore
+	}
+	return score < minScore
+}
+
+func isSpot(node *apiv1.Node) bool {
+	return node.Labels[spotPriorityNodeLabelKey] == spotPriorityNodeLabelValue
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azureexpander
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/expander/grpcplugin/protos"
+)
+
+type fakePriceProvider map[string]float64
+
+func (p fakePriceProvider) HourlyPrice(_ context.Context, sku, region string, spot bool) (float64, error) {
+	price, found := p[fmt.Sprintf("%s/%s/%t", sku, region, spot)]
+	if !found {
+		return 0, fmt.Errorf("no price for %s", sku)
+	}
+	return price, nil
+}
+
+func newTemplateNode(sku string, spot bool, annotations map[string]string) *apiv1.Node {
+	labels := map[string]string{
+		apiv1.LabelInstanceTypeStable: sku,
+		apiv1.LabelTopologyRegion:     "eastus",
+	}
+	if spot {
+		labels[spotPriorityNodeLabelKey] = spotPriorityNodeLabelValue
+	}
+	return &apiv1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: annotations}}
+}
+
+func TestBestOptions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	prices := fakePriceProvider{
+		"Standard_D4s_v3/eastus/false": 0.2,
+		"Standard_D4s_v3/eastus/true":  0.05,
+		"Standard_D8s_v3/eastus/false": 0.4,
+	}
+
+	testCases := []struct {
+		name          string
+		options       Options
+		nodes         map[string]*apiv1.Node
+		nodeCounts    map[string]int32
+		expectedBest  []string
+		expectedEmpty bool
+	}{
+		{
+			name:    "cheapest option wins",
+			options: Options{Prices: prices},
+			nodes: map[string]*apiv1.Node{
+				"d4": newTemplateNode("Standard_D4s_v3", false, nil),
+				"d8": newTemplateNode("Standard_D8s_v3", false, nil),
+			},
+			nodeCounts:   map[string]int32{"d4": 3, "d8": 1},
+			expectedBest: []string{"d8"},
+		},
+		{
+			name:    "spot eviction rate increases the cost",
+			options: Options{Prices: prices, EvictionRates: map[string]float64{"standard_d4s_v3": 0.9}, EvictionRatePenalty: 5},
+			nodes: map[string]*apiv1.Node{
+				"spot":     newTemplateNode("Standard_D4s_v3", true, nil),
+				"ondemand": newTemplateNode("Standard_D4s_v3", false, nil),
+			},
+			nodeCounts:   map[string]int32{"spot": 1, "ondemand": 1},
+			expectedBest: []string{"ondemand"},
+		},
+		{
+			name:    "recently stocked out node groups are ranked last",
+			options: Options{Prices: prices},
+			nodes: map[string]*apiv1.Node{
+				"d4": newTemplateNode("Standard_D4s_v3", false, map[string]string{
+					lastStockoutAnnotationKey: now.Add(-5 * time.Minute).Format(time.RFC3339),
+				}),
+				"d8": newTemplateNode("Standard_D8s_v3", false, map[string]string{
+					lastStockoutAnnotationKey: now.Add(-time.Hour).Format(time.RFC3339),
+				}),
+			},
+			nodeCounts:   map[string]int32{"d4": 1, "d8": 1},
+			expectedBest: []string{"d8"},
+		},
+		{
+			name:    "unhealthy node groups are ranked last",
+			options: Options{Prices: prices},
+			nodes: map[string]*apiv1.Node{
+				"d4": newTemplateNode("Standard_D4s_v3", false, map[string]string{healthScoreAnnotationKey: "0.33"}),
+				"d8": newTemplateNode("Standard_D8s_v3", false, map[string]string{healthScoreAnnotationKey: "0.67"}),
+			},
+			nodeCounts:   map[string]int32{"d4": 1, "d8": 1},
+			expectedBest: []string{"d8"},
+		},
+		{
+			name:    "minimum health score is configurable",
+			options: Options{Prices: prices, MinHealthScore: 0.8},
+			nodes: map[string]*apiv1.Node{
+				"d4": newTemplateNode("Standard_D4s_v3", false, nil),
+				"d8": newTemplateNode("Standard_D8s_v3", false, map[string]string{healthScoreAnnotationKey: "0.67"}),
+			},
+			nodeCounts:   map[string]int32{"d4": 2, "d8": 1},
+			expectedBest: []string{"d4"},
+		},
+		{
+			name: "template cost is used without live prices",
+			nodes: map[string]*apiv1.Node{
+				"a": newTemplateNode("Standard_A", false, map[string]string{hourlyCostAnnotationKey: "0.3"}),
+				"b": newTemplateNode("Standard_B", false, map[string]string{hourlyCostAnnotationKey: "0.1"}),
+				"c": newTemplateNode("Standard_C", false, nil),
+			},
+			nodeCounts:   map[string]int32{"a": 1, "b": 1, "c": 1},
+			expectedBest: []string{"b"},
+		},
+		{
+			name:    "equally good options are all returned",
+			options: Options{Prices: prices},
+			nodes: map[string]*apiv1.Node{
+				"d4-1": newTemplateNode("Standard_D4s_v3", false, nil),
+				"d4-2": newTemplateNode("Standard_D4s_v3", false, nil),
+			},
+			nodeCounts:   map[string]int32{"d4-1": 1, "d4-2": 1},
+			expectedBest: []string{"d4-1", "d4-2"},
+		},
+		{
+			name:          "no options",
+			expectedEmpty: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(tc.options)
+			server.now = func() time.Time { return now }
+
+			req := &protos.BestOptionsRequest{NodeMap: tc.nodes}
+			for id := range tc.nodes {
+				req.Options = append(req.Options, &protos.Option{NodeGroupId: id, NodeCount: tc.nodeCounts[id]})
+			}
+			resp, err := server.BestOptions(context.Background(), req)
+			assert.NoError(t, err)
+			if tc.expectedEmpty {
+				assert.Empty(t, resp.Options)
+				return
+			}
+			var best []string
+			for _, opt := range resp.Options {
+				best = append(best, opt.NodeGroupId)
+			}
+			assert.ElementsMatch(t, tc.expectedBest, best)
+		})
+	}
+}
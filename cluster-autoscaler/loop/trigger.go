@@ -22,6 +22,7 @@ import (
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
 	"k8s.io/autoscaler/cluster-autoscaler/metrics"
 	kube_client "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -44,6 +45,11 @@ type scalingTimesGetter interface {
 	LastScaleDownDeleteTime() time.Time
 }
 
+// providerHealthGetter exposes the health of the cloud provider backend
+type providerHealthGetter interface {
+	ProviderHealth() cloudprovider.ProviderHealth
+}
+
 // provisioningRequestProcessingTimesGetter exposes recent provisioning request processing activity regardless of wether the
 // ProvisioningRequest was marked as accepted or failed. This is because a ProvisioningRequest being processed indicates that
 // there are other ProvisioningRequests that require processing regardless of the outcome of the current one. Thus, the next iteration
@@ -75,6 +81,20 @@ func (t *LoopTrigger) Wait(lastRun time.Time) {
 	sleepStart := time.Now()
 	defer metrics.UpdateDurationFromStart(metrics.LoopWait, sleepStart)
 
+	// While the cloud provider backend is degraded, iterations are not triggered early after productive ones and
+	// are spaced out by the delay it requested, so that they don't pile up requests against it. Unschedulable pods
+	// appearing meanwhile still trigger the next iteration once the delay is over.
+	if delay := ProviderLoopDelay(t.scalingTimesGetter); delay > 0 {
+		time.Sleep(delay)
+		select {
+		case <-time.After(t.scanInterval):
+			klog.Infof("Autoscaler loop triggered by a %v timer, delayed by %v for the degraded cloud provider", t.scanInterval, delay)
+		case <-t.podObserver.unschedulablePodChan:
+			klog.Infof("Autoscaler loop triggered by unschedulable pod appearing, delayed by %v for the degraded cloud provider", delay)
+		}
+		return
+	}
+
 	// To improve scale-up throughput, Cluster Autoscaler starts new iteration
 	// immediately if the previous one was productive.
 	if !t.scalingTimesGetter.LastScaleUpTime().Before(lastRun) {
@@ -101,6 +121,21 @@ func (t *LoopTrigger) Wait(lastRun time.Time) {
 	}
 }
 
+// ProviderLoopDelay returns how much longer to wait before the next iteration of autoscaler while its cloud
+// provider backend is degraded, 0 if it is healthy or doesn't report its health.
+func ProviderLoopDelay(autoscaler any) time.Duration {
+	getter, ok := autoscaler.(providerHealthGetter)
+	if !ok {
+		return 0
+	}
+	health := getter.ProviderHealth()
+	if !health.Degraded {
+		return 0
+	}
+	klog.Warningf("Cloud provider is degraded: %s, delaying the next autoscaler loop by %v", health.Reason, health.LoopDelay)
+	return health.LoopDelay
+}
+
 // UnschedulablePodObserver triggers a new loop if there are new unschedulable pods
 type UnschedulablePodObserver struct {
 	unschedulablePodChan <-chan any
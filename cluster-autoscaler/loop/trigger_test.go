@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+)
+
+type fakeAutoscaler struct {
+	lastScaleUpTime time.Time
+	health          cloudprovider.ProviderHealth
+}
+
+func (a *fakeAutoscaler) LastScaleUpTime() time.Time                   { return a.lastScaleUpTime }
+func (a *fakeAutoscaler) LastScaleDownDeleteTime() time.Time           { return time.Time{} }
+func (a *fakeAutoscaler) ProviderHealth() cloudprovider.ProviderHealth { return a.health }
+
+type fakeScalingTimesGetter struct{}
+
+func (fakeScalingTimesGetter) LastScaleUpTime() time.Time         { return time.Time{} }
+func (fakeScalingTimesGetter) LastScaleDownDeleteTime() time.Time { return time.Time{} }
+
+func newTestLoopTrigger(autoscaler scalingTimesGetter, scanInterval time.Duration) (*LoopTrigger, chan any) {
+	podChan := make(chan any, 1)
+	return NewLoopTrigger(autoscaler, nil, &UnschedulablePodObserver{unschedulablePodChan: podChan}, scanInterval), podChan
+}
+
+func TestProviderLoopDelay(t *testing.T) {
+	assert.Zero(t, ProviderLoopDelay(fakeScalingTimesGetter{}), "autoscalers not reporting provider health are never delayed")
+	assert.Zero(t, ProviderLoopDelay(&fakeAutoscaler{}))
+	assert.Equal(t, time.Minute, ProviderLoopDelay(&fakeAutoscaler{
+		health: cloudprovider.ProviderHealth{Degraded: true, Reason: "throttled", LoopDelay: time.Minute},
+	}))
+}
+
+func TestLoopTriggerWait(t *testing.T) {
+	lastRun := time.Now()
+
+	// A productive iteration triggers the next one immediately while the provider is healthy.
+	trigger, _ := newTestLoopTrigger(&fakeAutoscaler{lastScaleUpTime: lastRun}, time.Hour)
+	start := time.Now()
+	trigger.Wait(lastRun)
+	assert.Less(t, time.Since(start), time.Minute)
+
+	// An unschedulable pod triggers the next iteration immediately.
+	trigger, podChan := newTestLoopTrigger(&fakeAutoscaler{}, time.Hour)
+	podChan <- struct{}{}
+	start = time.Now()
+	trigger.Wait(lastRun)
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Empty(t, podChan)
+}
+
+func TestLoopTriggerWaitDegraded(t *testing.T) {
+	lastRun := time.Now()
+	delay := 50 * time.Millisecond
+	degraded := cloudprovider.ProviderHealth{Degraded: true, Reason: "throttled", LoopDelay: delay}
+
+	// Productive iterations don't trigger the next one early, which waits for the timer after the delay.
+	trigger, _ := newTestLoopTrigger(&fakeAutoscaler{lastScaleUpTime: lastRun, health: degraded}, 10*time.Millisecond)
+	start := time.Now()
+	trigger.Wait(lastRun)
+	assert.GreaterOrEqual(t, time.Since(start), delay+10*time.Millisecond)
+
+	// Unschedulable pods still trigger the next iteration, once the delay is over.
+	trigger, podChan := newTestLoopTrigger(&fakeAutoscaler{health: degraded}, time.Hour)
+	podChan <- struct{}{}
+	start = time.Now()
+	trigger.Wait(lastRun)
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, delay)
+	assert.Less(t, elapsed, time.Minute)
+	assert.Empty(t, podChan)
+}
@@ -47,6 +47,7 @@ import (
 	"k8s.io/apiserver/pkg/server/routes"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider/builder"
 	"k8s.io/autoscaler/cluster-autoscaler/core"
 	"k8s.io/autoscaler/cluster-autoscaler/core/podlistprocessor"
 	"k8s.io/autoscaler/cluster-autoscaler/metrics"
@@ -59,7 +60,10 @@ import (
 	"k8s.io/autoscaler/cluster-autoscaler/processors/pods"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/provreq"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/scaledowncandidates"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/scaledowncandidates/costcandidates"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/scaledowncandidates/deletionhold"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/scaledowncandidates/emptycandidates"
+	"k8s.io/autoscaler/cluster-autoscaler/processors/scaledowncandidates/maintenancecandidates"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/scaledowncandidates/previouscandidates"
 	"k8s.io/autoscaler/cluster-autoscaler/processors/status"
 	provreqorchestrator "k8s.io/autoscaler/cluster-autoscaler/provisioningrequest/orchestrator"
@@ -132,6 +136,10 @@ func buildAutoscaler(context ctx.Context, debuggingSnapshotter debuggingsnapshot
 
 	opts.Processors = ca_processors.DefaultProcessors(autoscalingOptions)
 	opts.Processors.TemplateNodeInfoProvider = nodeinfosprovider.NewDefaultTemplateNodeInfoProvider(&autoscalingOptions.NodeInfoCacheExpireTime, autoscalingOptions.ForceDaemonSets)
+	if autoscalingOptions.CloudProviderName == cloudprovider.AzureProviderName {
+		// Let expanders see the recent stockouts and health of node groups reported by the cloud provider, including those with ready nodes.
+		opts.Processors.TemplateNodeInfoProvider = nodeinfosprovider.NewProviderAnnotationsNodeInfoProvider(&autoscalingOptions.NodeInfoCacheExpireTime, autoscalingOptions.ForceDaemonSets)
+	}
 	podListProcessor := podlistprocessor.NewDefaultPodListProcessor(scheduling.ScheduleAnywhere)
 
 	var ProvisioningRequestInjector *provreq.ProvisioningRequestPodsInjector
@@ -193,6 +201,20 @@ func buildAutoscaler(context ctx.Context, debuggingSnapshotter debuggingsnapshot
 	opts.Processors.ScaleDownCandidatesNotifier.Register(sdCandidatesSorting)
 
 	cp := scaledowncandidates.NewCombinedScaleDownCandidatesProcessor()
+	// Keep the nodes held from deletion by the cloud provider out of scale-down, before they are drained.
+	cp.Register(deletionhold.NewDeletionHoldProcessor())
+	if autoscalingOptions.CloudProviderName == cloudprovider.AzureProviderName {
+		// Keep nodes with scheduled maintenance out of scale-down simulations, and among otherwise equal candidates,
+		// drain those about to be redeployed, preempted or terminated first.
+		maintenanceEvents := maintenancecandidates.NewMaintenanceEventsProcessor()
+		scaleDownCandidatesComparers = append(scaleDownCandidatesComparers, maintenanceEvents)
+		cp.Register(maintenanceEvents)
+		// Among otherwise equal candidates, prefer draining more expensive nodes, e.g. on-demand over spot ones.
+		// Registered ahead of the sorting processor so it picks up the pricing model first.
+		costSorting := costcandidates.NewCostSortingProcessor()
+		scaleDownCandidatesComparers = append(scaleDownCandidatesComparers, costSorting)
+		cp.Register(costSorting)
+	}
 	cp.Register(scaledowncandidates.NewScaleDownCandidatesSortingProcessor(scaleDownCandidatesComparers))
 
 	if autoscalingOptions.ScaleDownDelayTypeLocal {
@@ -296,7 +318,7 @@ func run(healthCheck *metrics.HealthCheck, debuggingSnapshotter debuggingsnapsho
 		}
 	} else {
 		for {
-			time.Sleep(autoscalingOpts.ScanInterval)
+			time.Sleep(autoscalingOpts.ScanInterval + loop.ProviderLoopDelay(autoscaler))
 			loop.RunAutoscalerOnce(autoscaler, healthCheck, time.Now())
 		}
 	}
@@ -390,6 +412,10 @@ func main() {
 			klog.Fatalf("Unable to create leader election lock: %v", err)
 		}
 
+		// Keep the cloud provider state warm while waiting for leadership, if supported.
+		standbyCtx, stopStandby := ctx.WithCancel(ctx.Background())
+		go builder.WarmStandby(standbyCtx, autoscalingOpts)
+
 		leaderelection.RunOrDie(ctx.TODO(), leaderelection.LeaderElectionConfig{
 			Lock:            lock,
 			LeaseDuration:   leaderElection.LeaseDuration.Duration,
@@ -398,6 +424,7 @@ func main() {
 			ReleaseOnCancel: true,
 			Callbacks: leaderelection.LeaderCallbacks{
 				OnStartedLeading: func(_ ctx.Context) {
+					stopStandby()
 					// Since we are committing a suicide after losing
 					// mastership, we can safely ignore the argument.
 					run(healthCheck, debuggingSnapshotter)
@@ -40,6 +40,14 @@ const aksConsolidatedAdditionalProperties = "kubernetes.azure.com/consolidated-a
 // AKS node image version
 const aksNodeImageVersion = "kubernetes.azure.com/node-image-version"
 
+// Placement labels set on template nodes with the default prefix, naming the groups the nodes are placed in. Node
+// groups in different groups are otherwise similar; labels with a custom prefix are ignored with --balancing-ignore-label.
+const (
+	azureProximityPlacementGroupLabel  = "placement.cluster-autoscaler.azure/proximity-placement-group"
+	azureHostGroupLabel                = "placement.cluster-autoscaler.azure/host-group"
+	azureCapacityReservationGroupLabel = "placement.cluster-autoscaler.azure/capacity-reservation-group"
+)
+
 func nodesFromSameAzureNodePool(n1, n2 *framework.NodeInfo) bool {
 	n1AzureNodePool := n1.Node().Labels[AzureNodepoolLabel]
 	n2AzureNodePool := n2.Node().Labels[AzureNodepoolLabel]
@@ -69,6 +77,9 @@ func CreateAzureNodeInfoComparator(extraIgnoredLabels []string, ratioOpts config
 	azureIgnoredLabels[resourceNameSuffix] = true
 	azureIgnoredLabels[aksNodeImageVersion] = true
 	azureIgnoredLabels[aksConsolidatedAdditionalProperties] = true
+	azureIgnoredLabels[azureProximityPlacementGroupLabel] = true
+	azureIgnoredLabels[azureHostGroupLabel] = true
+	azureIgnoredLabels[azureCapacityReservationGroupLabel] = true
 
 	for _, k := range extraIgnoredLabels {
 		azureIgnoredLabels[k] = true
@@ -88,6 +88,12 @@ func TestIsAzureNodeInfoSimilar(t *testing.T) {
 	// Different aksConsolidatedAdditionalProperties label
 	n2.ObjectMeta.Labels[aksConsolidatedAdditionalProperties] = "bar"
 	checkNodesSimilar(t, n1, n2, comparator, true)
+	// Different placement groups
+	n1.ObjectMeta.Labels[azureProximityPlacementGroupLabel] = "ppg1"
+	n2.ObjectMeta.Labels[azureProximityPlacementGroupLabel] = "ppg2"
+	n1.ObjectMeta.Labels[azureHostGroupLabel] = "hg1"
+	n2.ObjectMeta.Labels[azureCapacityReservationGroupLabel] = "crg2"
+	checkNodesSimilar(t, n1, n2, comparator, true)
 }
 
 func TestFindSimilarNodeGroupsAzureBasic(t *testing.T) {
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeinfosprovider
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator/framework"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/taints"
+)
+
+// ProviderAnnotationsNodeInfoProvider is a wrapper for MixedTemplateNodeInfoProvider setting the annotations
+// reported by cloud providers implementing cloudprovider.NodeGroupAnnotator on the node infos, for expanders.
+// Unlike annotations of template nodes, they reach expanders for node groups with ready nodes too.
+type ProviderAnnotationsNodeInfoProvider struct {
+	templateNodeInfoProvider TemplateNodeInfoProvider
+}
+
+// NewProviderAnnotationsNodeInfoProvider returns ProviderAnnotationsNodeInfoProvider wrapping MixedTemplateNodeInfoProvider.
+func NewProviderAnnotationsNodeInfoProvider(t *time.Duration, forceDaemonSets bool) *ProviderAnnotationsNodeInfoProvider {
+	return &ProviderAnnotationsNodeInfoProvider{
+		templateNodeInfoProvider: NewMixedTemplateNodeInfoProvider(t, forceDaemonSets),
+	}
+}
+
+// Process returns the nodeInfos set for this cluster.
+func (p *ProviderAnnotationsNodeInfoProvider) Process(ctx *context.AutoscalingContext, nodes []*apiv1.Node, daemonsets []*appsv1.DaemonSet, taintConfig taints.TaintConfig, currentTime time.Time) (map[string]*framework.NodeInfo, errors.AutoscalerError) {
+	nodeInfos, err := p.templateNodeInfoProvider.Process(ctx, nodes, daemonsets, taintConfig, currentTime)
+	if err != nil {
+		return nil, err
+	}
+	annotator, ok := ctx.CloudProvider.(cloudprovider.NodeGroupAnnotator)
+	if !ok {
+		return nodeInfos, nil
+	}
+	for _, ng := range ctx.CloudProvider.NodeGroups() {
+		nodeInfo, found := nodeInfos[ng.Id()]
+		if !found {
+			continue
+		}
+		annotations := annotator.NodeGroupAnnotations(ng)
+		if len(annotations) == 0 {
+			continue
+		}
+		node := nodeInfo.Node()
+		if node.Annotations == nil {
+			node.Annotations = make(map[string]string, len(annotations))
+		}
+		// The annotations reported now take precedence over those of the template or real node.
+		for key, val := range annotations {
+			node.Annotations[key] = val
+		}
+	}
+	return nodeInfos, nil
+}
+
+// CleanUp cleans up processor's internal structures.
+func (p *ProviderAnnotationsNodeInfoProvider) CleanUp() {
+	p.templateNodeInfoProvider.CleanUp()
+}
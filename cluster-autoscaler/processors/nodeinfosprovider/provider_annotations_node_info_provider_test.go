@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeinfosprovider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator/clustersnapshot/testsnapshot"
+	"k8s.io/autoscaler/cluster-autoscaler/simulator/framework"
+	kube_util "k8s.io/autoscaler/cluster-autoscaler/utils/kubernetes"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/taints"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+type fakeNodeGroupAnnotator struct {
+	*testprovider.TestCloudProvider
+	annotations map[string]map[string]string
+}
+
+func (f *fakeNodeGroupAnnotator) NodeGroupAnnotations(nodeGroup cloudprovider.NodeGroup) map[string]string {
+	return f.annotations[nodeGroup.Id()]
+}
+
+func TestProviderAnnotationsNodeInfoProvider(t *testing.T) {
+	now := time.Now()
+	ready := BuildTestNode("n1", 1000, 1000)
+	SetNodeReadyState(ready, true, now.Add(-2*time.Minute))
+	ready.Annotations = map[string]string{"stale": "node", "kept": "node"}
+	tn := BuildTestNode("tn", 5000, 5000)
+	tn.Annotations = map[string]string{"stale": "template"}
+
+	provider := &fakeNodeGroupAnnotator{
+		TestCloudProvider: testprovider.NewTestCloudProviderBuilder().WithMachineTemplates(
+			map[string]*framework.NodeInfo{"ng2": framework.NewTestNodeInfo(tn)}).Build(),
+		annotations: map[string]map[string]string{
+			"ng1": {"stale": "reported"},
+			"ng2": {"stale": "reported"},
+		},
+	}
+	provider.AddNodeGroup("ng1", 1, 10, 1) // Nodegroup with a ready node, whose node info is built from it.
+	provider.AddNode("ng1", ready)
+	provider.AddNodeGroup("ng2", 0, 10, 0) // Nodegroup without nodes, whose node info is built from the template.
+
+	nodes := []*apiv1.Node{ready}
+	snapshot := testsnapshot.NewTestSnapshotOrDie(t)
+	assert.NoError(t, snapshot.SetClusterState(nodes, nil, nil))
+	ctx := context.AutoscalingContext{
+		CloudProvider:   provider,
+		ClusterSnapshot: snapshot,
+		AutoscalingKubeClients: context.AutoscalingKubeClients{
+			ListerRegistry: kube_util.NewListerRegistry(nil, nil, kube_util.NewTestPodLister(nil), nil, nil, nil, nil, nil, nil),
+		},
+	}
+
+	res, err := NewProviderAnnotationsNodeInfoProvider(&cacheTtl, false).Process(&ctx, nodes, []*appsv1.DaemonSet{}, taints.TaintConfig{}, now)
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, map[string]string{"stale": "reported", "kept": "node"}, res["ng1"].Node().Annotations)
+	assert.Equal(t, "reported", res["ng2"].Node().Annotations["stale"])
+	assert.Equal(t, "node", ready.Annotations["stale"], "the real node is left unchanged")
+	assert.Equal(t, "template", tn.Annotations["stale"], "the template is left unchanged")
+
+	// Providers which don't report annotations leave node infos unchanged.
+	ctx.CloudProvider = provider.TestCloudProvider
+	res, err = NewProviderAnnotationsNodeInfoProvider(&cacheTtl, false).Process(&ctx, nodes, []*appsv1.DaemonSet{}, taints.TaintConfig{}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "node", res["ng1"].Node().Annotations["stale"])
+}
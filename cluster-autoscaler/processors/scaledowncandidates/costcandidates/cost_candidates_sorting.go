@@ -0,0 +1,78 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package costcandidates
+
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+)
+
+// CostSorting is sorting scale down candidates so that the nodes which are the most expensive
+// to run, according to the cloud provider pricing model, appear first. This e.g. prefers draining
+// on-demand nodes over cheaper spot nodes.
+//
+// It needs to be registered as a ScaleDownNodeProcessor ahead of the sorting processor using it,
+// to pick up the pricing model of the cloud provider.
+type CostSorting struct {
+	pricingModel cloudprovider.PricingModel
+}
+
+// NewCostSortingProcessor returns CostSorting struct.
+func NewCostSortingProcessor() *CostSorting {
+	return &CostSorting{}
+}
+
+// GetPodDestinationCandidates returns nodes as is no processing is required here.
+func (p *CostSorting) GetPodDestinationCandidates(ctx *context.AutoscalingContext,
+	nodes []*apiv1.Node) ([]*apiv1.Node, errors.AutoscalerError) {
+	return nodes, nil
+}
+
+// GetScaleDownCandidates refreshes the pricing model from the cloud provider and returns nodes as is.
+func (p *CostSorting) GetScaleDownCandidates(ctx *context.AutoscalingContext,
+	nodes []*apiv1.Node) ([]*apiv1.Node, errors.AutoscalerError) {
+	p.pricingModel = nil
+	if pricingModel, err := ctx.CloudProvider.Pricing(); err == nil {
+		p.pricingModel = pricingModel
+	}
+	return nodes, nil
+}
+
+// CleanUp is called at CA termination.
+func (p *CostSorting) CleanUp() {
+}
+
+// ScaleDownEarlierThan return true if node1 is more expensive to run than node2.
+func (p *CostSorting) ScaleDownEarlierThan(node1, node2 *apiv1.Node) bool {
+	if p.pricingModel == nil {
+		return false
+	}
+	now := time.Now()
+	price1, err := p.pricingModel.NodePrice(node1, now, now.Add(time.Hour))
+	if err != nil {
+		return false
+	}
+	price2, err := p.pricingModel.NodePrice(node2, now, now.Add(time.Hour))
+	if err != nil {
+		return false
+	}
+	return price1 > price2
+}
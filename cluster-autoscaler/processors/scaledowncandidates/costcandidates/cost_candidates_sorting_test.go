@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package costcandidates
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+type testPricingModel struct {
+	nodePrice map[string]float64
+}
+
+func (tpm *testPricingModel) NodePrice(node *apiv1.Node, startTime time.Time, endTime time.Time) (float64, error) {
+	if price, found := tpm.nodePrice[node.Name]; found {
+		return price, nil
+	}
+	return 0.0, fmt.Errorf("price for node %v not found", node.Name)
+}
+
+func (tpm *testPricingModel) PodPrice(pod *apiv1.Pod, startTime time.Time, endTime time.Time) (float64, error) {
+	return 0.0, nil
+}
+
+func TestScaleDownEarlierThan(t *testing.T) {
+	onDemand := BuildTestNode("onDemand", 2000, 8000)
+	spot := BuildTestNode("spot", 2000, 8000)
+	spot2 := BuildTestNode("spot2", 2000, 8000)
+	noPrice := BuildTestNode("noPrice", 2000, 8000)
+	pricingModel := &testPricingModel{nodePrice: map[string]float64{"onDemand": 1.0, "spot": 0.2, "spot2": 0.2}}
+
+	testCases := []struct {
+		name         string
+		pricingModel *testPricingModel
+		node1, node2 *apiv1.Node
+		wantEarlier  bool
+	}{
+		{
+			name:         "more expensive node is scaled down earlier",
+			pricingModel: pricingModel,
+			node1:        onDemand,
+			node2:        spot,
+			wantEarlier:  true,
+		},
+		{
+			name:         "cheaper node is not scaled down earlier",
+			pricingModel: pricingModel,
+			node1:        spot,
+			node2:        onDemand,
+		},
+		{
+			name:         "same price",
+			pricingModel: pricingModel,
+			node1:        spot,
+			node2:        spot2,
+		},
+		{
+			name:         "node without price",
+			pricingModel: pricingModel,
+			node1:        noPrice,
+			node2:        spot,
+		},
+		{
+			name:  "cloud provider without pricing",
+			node1: onDemand,
+			node2: spot,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := testprovider.NewTestCloudProviderBuilder().Build()
+			if tc.pricingModel != nil {
+				provider.SetPricingModel(tc.pricingModel)
+			}
+			p := NewCostSortingProcessor()
+			nodes := []*apiv1.Node{tc.node1, tc.node2}
+			candidates, err := p.GetScaleDownCandidates(&context.AutoscalingContext{CloudProvider: provider}, nodes)
+			assert.NoError(t, err)
+			assert.Equal(t, nodes, candidates)
+			assert.Equal(t, tc.wantEarlier, p.ScaleDownEarlierThan(tc.node1, tc.node2))
+		})
+	}
+}
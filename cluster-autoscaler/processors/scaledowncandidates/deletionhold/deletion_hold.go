@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deletionhold
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/cloudprovider"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	klog "k8s.io/klog/v2"
+)
+
+// DeletionHold keeps the nodes held from deletion by the cloud provider out of the scale-down candidates, so that
+// they are not drained before the cloud provider refuses to delete them. It does nothing unless the cloud provider
+// implements cloudprovider.DeletionHoldReporter.
+type DeletionHold struct{}
+
+// NewDeletionHoldProcessor returns DeletionHold struct.
+func NewDeletionHoldProcessor() *DeletionHold {
+	return &DeletionHold{}
+}
+
+// GetPodDestinationCandidates returns nodes as is no processing is required here.
+func (p *DeletionHold) GetPodDestinationCandidates(ctx *context.AutoscalingContext,
+	nodes []*apiv1.Node) ([]*apiv1.Node, errors.AutoscalerError) {
+	return nodes, nil
+}
+
+// GetScaleDownCandidates returns the nodes which are not held from deletion by the cloud provider.
+func (p *DeletionHold) GetScaleDownCandidates(ctx *context.AutoscalingContext,
+	nodes []*apiv1.Node) ([]*apiv1.Node, errors.AutoscalerError) {
+	reporter, ok := ctx.CloudProvider.(cloudprovider.DeletionHoldReporter)
+	if !ok {
+		return nodes, nil
+	}
+	candidates := make([]*apiv1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if held, reason := reporter.DeletionHeld(node); held {
+			klog.V(2).Infof("Node %s is held from deletion by %s, skipping it as scale-down candidate", node.Name, reason)
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+	return candidates, nil
+}
+
+// CleanUp is called at CA termination.
+func (p *DeletionHold) CleanUp() {
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deletionhold
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	testprovider "k8s.io/autoscaler/cluster-autoscaler/cloudprovider/test"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+type fakeDeletionHoldReporter struct {
+	*testprovider.TestCloudProvider
+	held map[string]bool
+}
+
+func (f *fakeDeletionHoldReporter) DeletionHeld(node *apiv1.Node) (bool, string) {
+	return f.held[node.Name], "annotation"
+}
+
+func TestDeletionHold(t *testing.T) {
+	n1 := BuildTestNode("n1", 1000, 1000)
+	n2 := BuildTestNode("n2", 1000, 1000)
+	n3 := BuildTestNode("n3", 1000, 1000)
+	nodes := []*apiv1.Node{n1, n2, n3}
+	p := NewDeletionHoldProcessor()
+
+	ctx := &context.AutoscalingContext{CloudProvider: testprovider.NewTestCloudProviderBuilder().Build()}
+	candidates, err := p.GetScaleDownCandidates(ctx, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, nodes, candidates, "providers without deletion holds keep every candidate")
+
+	ctx.CloudProvider = &fakeDeletionHoldReporter{
+		TestCloudProvider: testprovider.NewTestCloudProviderBuilder().Build(),
+		held:              map[string]bool{"n2": true},
+	}
+	candidates, err = p.GetScaleDownCandidates(ctx, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Node{n1, n3}, candidates)
+
+	destinations, err := p.GetPodDestinationCandidates(ctx, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, nodes, destinations, "held nodes still host pods")
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenancecandidates
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/cluster-autoscaler/context"
+	"k8s.io/autoscaler/cluster-autoscaler/utils/errors"
+	klog "k8s.io/klog/v2"
+)
+
+// Node conditions reporting Azure scheduled events, set by the node problem detector of AKS from the Instance
+// Metadata Service when maintenance is scheduled for the VM of the node.
+const (
+	// FreezeScheduledCondition reports an upcoming freeze of the VM, e.g. for a live migration.
+	FreezeScheduledCondition apiv1.NodeConditionType = "FreezeScheduled"
+	// RebootScheduledCondition reports an upcoming reboot of the VM.
+	RebootScheduledCondition apiv1.NodeConditionType = "RebootScheduled"
+	// RedeployScheduledCondition reports an upcoming move of the VM to another host, losing its temporary disk.
+	RedeployScheduledCondition apiv1.NodeConditionType = "RedeployScheduled"
+	// PreemptScheduledCondition reports an upcoming eviction of the spot VM.
+	PreemptScheduledCondition apiv1.NodeConditionType = "PreemptScheduled"
+	// TerminateScheduledCondition reports an upcoming deletion of the VM.
+	TerminateScheduledCondition apiv1.NodeConditionType = "TerminateScheduled"
+)
+
+// transientMaintenance are the scheduled events after which the node comes back: deleting the node meanwhile
+// would compete with the maintenance, so such nodes are not scaled down until it's over.
+var transientMaintenance = []apiv1.NodeConditionType{FreezeScheduledCondition, RebootScheduledCondition}
+
+// disruptiveMaintenance are the scheduled events after which the VM is gone or starts over, so such nodes are
+// scaled down first.
+var disruptiveMaintenance = []apiv1.NodeConditionType{RedeployScheduledCondition, PreemptScheduledCondition, TerminateScheduledCondition}
+
+// MaintenanceEvents takes Azure scheduled events of nodes into account in scale-down: nodes about to be frozen
+// or rebooted are not scale-down candidates, nodes with any scheduled event are not destinations for the pods of
+// the nodes scaled down, and nodes about to be redeployed, preempted or terminated are scaled down first.
+type MaintenanceEvents struct{}
+
+// NewMaintenanceEventsProcessor returns MaintenanceEvents struct.
+func NewMaintenanceEventsProcessor() *MaintenanceEvents {
+	return &MaintenanceEvents{}
+}
+
+// GetPodDestinationCandidates returns the nodes without scheduled maintenance.
+func (p *MaintenanceEvents) GetPodDestinationCandidates(ctx *context.AutoscalingContext,
+	nodes []*apiv1.Node) ([]*apiv1.Node, errors.AutoscalerError) {
+	return filterNodes(nodes, func(node *apiv1.Node) bool {
+		return !hasAnyCondition(node, transientMaintenance) && !hasAnyCondition(node, disruptiveMaintenance)
+	}, "pod destination"), nil
+}
+
+// GetScaleDownCandidates returns the nodes which are not about to be frozen or rebooted.
+func (p *MaintenanceEvents) GetScaleDownCandidates(ctx *context.AutoscalingContext,
+	nodes []*apiv1.Node) ([]*apiv1.Node, errors.AutoscalerError) {
+	return filterNodes(nodes, func(node *apiv1.Node) bool {
+		return !hasAnyCondition(node, transientMaintenance)
+	}, "scale-down candidate"), nil
+}
+
+// CleanUp is called at CA termination.
+func (p *MaintenanceEvents) CleanUp() {
+}
+
+// ScaleDownEarlierThan return true if node1 is about to be redeployed, preempted or terminated, and node2 isn't.
+func (p *MaintenanceEvents) ScaleDownEarlierThan(node1, node2 *apiv1.Node) bool {
+	return hasAnyCondition(node1, disruptiveMaintenance) && !hasAnyCondition(node2, disruptiveMaintenance)
+}
+
+func filterNodes(nodes []*apiv1.Node, keep func(*apiv1.Node) bool, role string) []*apiv1.Node {
+	filtered := make([]*apiv1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if keep(node) {
+			filtered = append(filtered, node)
+			continue
+		}
+		klog.V(2).Infof("Node %s has scheduled maintenance, skipping it as %s", node.Name, role)
+	}
+	return filtered
+}
+
+func hasAnyCondition(node *apiv1.Node, conditionTypes []apiv1.NodeConditionType) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+		for _, conditionType := range conditionTypes {
+			if condition.Type == conditionType {
+				return true
+			}
+		}
+	}
+	return false
+}
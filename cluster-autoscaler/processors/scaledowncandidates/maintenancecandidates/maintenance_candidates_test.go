@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maintenancecandidates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	. "k8s.io/autoscaler/cluster-autoscaler/utils/test"
+)
+
+func buildTestNode(name string, conditionType apiv1.NodeConditionType, status apiv1.ConditionStatus) *apiv1.Node {
+	node := BuildTestNode(name, 2000, 8000)
+	if conditionType != "" {
+		node.Status.Conditions = append(node.Status.Conditions, apiv1.NodeCondition{Type: conditionType, Status: status})
+	}
+	return node
+}
+
+func TestMaintenanceEvents(t *testing.T) {
+	healthy := buildTestNode("healthy", "", "")
+	resolved := buildTestNode("resolved", RebootScheduledCondition, apiv1.ConditionFalse)
+	freezing := buildTestNode("freezing", FreezeScheduledCondition, apiv1.ConditionTrue)
+	rebooting := buildTestNode("rebooting", RebootScheduledCondition, apiv1.ConditionTrue)
+	terminating := buildTestNode("terminating", TerminateScheduledCondition, apiv1.ConditionTrue)
+	preempted := buildTestNode("preempted", PreemptScheduledCondition, apiv1.ConditionTrue)
+	nodes := []*apiv1.Node{healthy, resolved, freezing, rebooting, terminating, preempted}
+
+	p := NewMaintenanceEventsProcessor()
+	candidates, err := p.GetScaleDownCandidates(nil, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Node{healthy, resolved, terminating, preempted}, candidates)
+
+	destinations, err := p.GetPodDestinationCandidates(nil, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, []*apiv1.Node{healthy, resolved}, destinations)
+
+	assert.True(t, p.ScaleDownEarlierThan(terminating, healthy))
+	assert.False(t, p.ScaleDownEarlierThan(healthy, terminating))
+	assert.False(t, p.ScaleDownEarlierThan(terminating, preempted))
+	assert.False(t, p.ScaleDownEarlierThan(resolved, healthy))
+}